@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/cdn-control-panel/backend/internal/config"
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkDomain  string
+	checkCleanup bool
+	checkDryRun  bool
+)
+
+// dnsCheckCmd represents the dns-check command
+var dnsCheckCmd = &cobra.Command{
+	Use:   "dns-check",
+	Short: "检查DNS记录一致性",
+	Long: `检查 domain_dns_records 中的问题记录：
+
+- orphan：所有者（节点分组、线路分组、网站域名）已删除，或超过24小时的ACME验证记录
+- cname_conflict：同一名称和线路下CNAME与其他类型记录共存
+- duplicate_owner：同一名称和线路下的A/AAAA/CNAME记录属于多个所有者
+
+使用 --cleanup 将孤儿记录标记为deleting，由 serve 的DNS同步任务从DNS提供商删除。
+CNAME冲突和重复所有者需要人工处理，不会被修改。
+
+示例:
+  cdn-control dns-check
+  cdn-control dns-check --domain example.com
+  cdn-control dns-check --domain example.com --cleanup --dry-run
+  cdn-control dns-check --cleanup`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDNSCheck()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCheckCmd)
+
+	dnsCheckCmd.Flags().StringVarP(&checkDomain, "domain", "d", "", "仅检查指定域名 (zone)（默认所有域名）")
+	dnsCheckCmd.Flags().BoolVar(&checkCleanup, "cleanup", false, "将孤儿记录标记为deleting")
+	dnsCheckCmd.Flags().BoolVar(&checkDryRun, "dry-run", false, "与 --cleanup 一起使用，仅显示将被清理的记录")
+}
+
+func runDNSCheck() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Connect to database
+	if err := database.Connect(cfg.Database.GetDSN()); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	domainService := service.NewDomainService()
+	checkService := service.NewDNSCheckService(service.NewDNSRecordService(domainService, nil))
+
+	domainID := 0
+	if checkDomain != "" {
+		domain, err := domainService.GetDomainByName(checkDomain)
+		if err != nil {
+			log.Fatalf("Failed to get domain %s: %v", checkDomain, err)
+		}
+		domainID = domain.ID
+	}
+
+	var report *service.DNSCheckReport
+	var cleaned []int
+	if checkCleanup {
+		result, err := checkService.Cleanup(domainID, checkDryRun)
+		if err != nil {
+			log.Fatalf("Failed to clean up DNS records: %v", err)
+		}
+		report, cleaned = result.Report, result.RecordIDs
+	} else {
+		report, err = checkService.Check(domainID)
+		if err != nil {
+			log.Fatalf("Failed to check DNS records: %v", err)
+		}
+	}
+
+	printDNSCheckReport(report)
+
+	if !checkCleanup {
+		return
+	}
+	if checkDryRun {
+		fmt.Printf("dry-run 模式，将清理 %d 条孤儿记录\n", len(cleaned))
+		return
+	}
+	log.Printf("✓ %d orphaned records queued for deletion", len(cleaned))
+}
+
+// printDNSCheckReport prints one block per issue and a summary line
+func printDNSCheckReport(report *service.DNSCheckReport) {
+	for _, issue := range report.Issues {
+		name := issue.Name
+		if issue.Line != "" {
+			name += " [" + issue.Line + "]"
+		}
+		fmt.Printf("! %-15s %s %s: %s\n", issue.Kind, issue.Zone, name, issue.Detail)
+		for _, r := range issue.Records {
+			fmt.Printf("    #%-8d %-5s %-40s %s:%d (%s)\n", r.ID, r.Type, r.Value, r.OwnerType, r.OwnerID, r.Status)
+		}
+	}
+
+	if len(report.Issues) > 0 {
+		fmt.Println()
+	}
+	fmt.Printf("记录: %d  孤儿: %d  CNAME冲突: %d  重复所有者: %d\n",
+		report.Records, report.Orphans, report.Conflicts, report.Duplicates)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/config"
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/dnsserver"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dnsListen        string
+	dnsNameservers   []string
+	dnsHostmaster    string
+	dnsDomains       []string
+	dnsNotify        []string
+	dnsAllowTransfer []string
+	dnsRefresh       time.Duration
+)
+
+// dnsServeCmd represents the dns-serve command
+var dnsServeCmd = &cobra.Command{
+	Use:   "dns-serve",
+	Short: "启动内置权威DNS服务器",
+	Long: `启动内置权威DNS服务器（UDP和TCP），直接从数据库提供DNS解析。
+
+服务DNS提供商为 builtin 的域名（可用 --domain 限定），记录来自 domain_dns_records。
+配置版本（config_versions）变化时自动重新加载，SOA序列号即配置版本号。
+重新加载后向 --notify 指定的从服务器发送NOTIFY，并允许其进行AXFR。
+启用DNSSEC的域名在加载时签名，签名密钥用主密钥（MASTER_KEY 或 MASTER_KEY_FILE）解密。
+
+示例:
+  cdn-control dns-serve --ns ns1.example.com --ns ns2.example.com
+  cdn-control dns-serve --listen :5353 --ns ns1.example.com --domain cdn.example.com
+  cdn-control dns-serve --ns ns1.example.com --notify 192.0.2.10 --allow-transfer 198.51.100.0/24`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDNSServe()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dnsServeCmd)
+
+	dnsServeCmd.Flags().StringVar(&dnsListen, "listen", ":53", "监听地址（UDP和TCP）")
+	dnsServeCmd.Flags().StringSliceVar(&dnsNameservers, "ns", nil, "根域NS主机名，第一个作为SOA主服务器（必填，可重复）")
+	dnsServeCmd.Flags().StringVar(&dnsHostmaster, "hostmaster", "", "SOA管理员邮箱（默认 hostmaster.<zone>）")
+	dnsServeCmd.Flags().StringSliceVar(&dnsDomains, "domain", nil, "仅服务指定域名（默认所有builtin域名，可重复）")
+	dnsServeCmd.Flags().StringSliceVar(&dnsNotify, "notify", nil, "从服务器地址，重新加载后发送NOTIFY并允许AXFR（可重复）")
+	dnsServeCmd.Flags().StringSliceVar(&dnsAllowTransfer, "allow-transfer", nil, "允许AXFR的IP或CIDR（可重复）")
+	dnsServeCmd.Flags().DurationVar(&dnsRefresh, "refresh", 5*time.Second, "检查配置版本变化的间隔")
+	dnsServeCmd.MarkFlagRequired("ns")
+}
+
+func runDNSServe() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Connect to database
+	if err := database.Connect(cfg.Database.GetDSN()); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	allowTransfer, err := dnsserver.ParseNetworks(dnsAllowTransfer)
+	if err != nil {
+		log.Fatalf("Invalid --allow-transfer: %v", err)
+	}
+
+	// NOTIFY targets default to port 53
+	secondaries := make([]string, 0, len(dnsNotify))
+	for _, target := range dnsNotify {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			target = net.JoinHostPort(target, "53")
+		}
+		secondaries = append(secondaries, target)
+	}
+
+	// DNSSEC signing keys are sealed with the master key
+	secretBox := loadSecretBox(cfg)
+
+	server, err := dnsserver.NewServer(dnsserver.Config{
+		Listen:          dnsListen,
+		Nameservers:     dnsNameservers,
+		Hostmaster:      dnsHostmaster,
+		Domains:         dnsDomains,
+		Secondaries:     secondaries,
+		AllowTransfer:   allowTransfer,
+		RefreshInterval: dnsRefresh,
+		SecretBox:       secretBox,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create DNS server: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := server.Start(ctx); err != nil {
+		log.Fatalf("DNS server failed: %v", err)
+	}
+}
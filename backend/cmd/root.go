@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"os"
 
+	"github.com/cdn-control-panel/backend/internal/config"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/pkg/secretbox"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -61,3 +65,32 @@ func initConfig() {
 		fmt.Fprintln(os.Stderr, "使用配置文件:", viper.ConfigFileUsed())
 	}
 }
+
+// loadSecretBox opens the master key box and installs it for the encrypted
+// model columns, or returns nil when no master key is configured (secrets
+// are then stored unencrypted and DNSSEC signing is rejected)
+func loadSecretBox(cfg *config.Config) *secretbox.Box {
+	masterKey, err := cfg.Secrets.LoadMasterKey()
+	if err != nil {
+		log.Fatalf("Failed to load master key: %v", err)
+	}
+	if masterKey == "" {
+		log.Println("No master key configured (MASTER_KEY or MASTER_KEY_FILE), secrets are stored unencrypted and DNSSEC signing is unavailable")
+		return nil
+	}
+
+	box, err := secretbox.NewFromString(masterKey)
+	if err != nil {
+		log.Fatalf("Invalid master key: %v", err)
+	}
+	if cfg.Secrets.PreviousMasterKey != "" {
+		previous, err := secretbox.NewFromString(cfg.Secrets.PreviousMasterKey)
+		if err != nil {
+			log.Fatalf("Invalid previous master key: %v", err)
+		}
+		box = box.WithPrevious(previous)
+	}
+
+	models.SetSecretBox(box)
+	return box
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cdn-control-panel/backend/internal/config"
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/pkg/secretbox"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotateNewKey     string
+	rotateNewKeyFile string
+	rotateDryRun     bool
+)
+
+// rotateMasterKeyCmd represents the rotate-master-key command
+var rotateMasterKeyCmd = &cobra.Command{
+	Use:   "rotate-master-key",
+	Short: "轮换加密数据库中密钥的主密钥",
+	Long: `使用新的主密钥重新加密数据库中的所有密钥（证书私钥、ACME账号密钥、EAB HMAC密钥、DNS提供商API密钥、DNSSEC签名密钥）。
+
+当前主密钥从 MASTER_KEY/MASTER_KEY_FILE 读取（还有未轮换完的值时同时使用 MASTER_KEY_PREVIOUS）。
+信封加密的值只重新加密数据密钥，旧格式和未加密的值用新主密钥重新加密。全部在一个事务中完成，任一值失败时不做任何修改。
+
+完成后将 MASTER_KEY 改为新密钥、MASTER_KEY_PREVIOUS 设为旧密钥并重启所有进程，确认全部重启后再删除 MASTER_KEY_PREVIOUS。
+
+示例:
+  openssl rand -base64 32 > /etc/cdn-control/master.key.new
+  cdn-control rotate-master-key --new-key-file /etc/cdn-control/master.key.new --dry-run
+  cdn-control rotate-master-key --new-key-file /etc/cdn-control/master.key.new`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runRotateMasterKey()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateMasterKeyCmd)
+
+	rotateMasterKeyCmd.Flags().StringVar(&rotateNewKey, "new-key", "", "新主密钥（32字节，base64或hex编码）")
+	rotateMasterKeyCmd.Flags().StringVar(&rotateNewKeyFile, "new-key-file", "", "新主密钥文件")
+	rotateMasterKeyCmd.Flags().BoolVar(&rotateDryRun, "dry-run", false, "只检查所有值能否解密并统计数量，不修改数据库")
+}
+
+func runRotateMasterKey() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	newEncoded := rotateNewKey
+	if rotateNewKeyFile != "" {
+		data, err := os.ReadFile(rotateNewKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to read new master key file: %v", err)
+		}
+		newEncoded = strings.TrimSpace(string(data))
+	}
+	next, err := secretbox.NewFromString(newEncoded)
+	if err != nil {
+		log.Fatalf("Invalid new master key (--new-key or --new-key-file): %v", err)
+	}
+
+	// The current and previous keys open what is stored today
+	var previous []*secretbox.Box
+	masterKey, err := cfg.Secrets.LoadMasterKey()
+	if err != nil {
+		log.Fatalf("Failed to load master key: %v", err)
+	}
+	for _, encoded := range []string{masterKey, cfg.Secrets.PreviousMasterKey} {
+		if encoded == "" {
+			continue
+		}
+		box, err := secretbox.NewFromString(encoded)
+		if err != nil {
+			log.Fatalf("Invalid current master key: %v", err)
+		}
+		previous = append(previous, box)
+	}
+	next = next.WithPrevious(previous...)
+
+	// Connect to database
+	if err := database.Connect(cfg.Database.GetDSN()); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		log.Fatalf("Failed to begin transaction: %v", tx.Error)
+	}
+	defer tx.Rollback()
+
+	for _, col := range models.EncryptedColumns {
+		var rows []struct {
+			ID    int
+			Value string
+		}
+		if err := tx.Table(col.Table).
+			Select(fmt.Sprintf("id, %s AS value", col.Column)).
+			Where(fmt.Sprintf("%s IS NOT NULL AND %s <> ''", col.Column, col.Column)).
+			Scan(&rows).Error; err != nil {
+			log.Fatalf("Failed to read %s.%s: %v", col.Table, col.Column, err)
+		}
+
+		rewrapped, sealed := 0, 0
+		for _, row := range rows {
+			var value string
+			if secretbox.IsSealed(row.Value) {
+				value, err = next.Rewrap(row.Value)
+				rewrapped++
+			} else {
+				value, err = next.Seal([]byte(row.Value))
+				sealed++
+			}
+			if err != nil {
+				log.Fatalf("Failed to re-encrypt %s.%s id=%d: %v", col.Table, col.Column, row.ID, err)
+			}
+			if rotateDryRun {
+				continue
+			}
+			if err := tx.Table(col.Table).Where("id = ?", row.ID).Update(col.Column, value).Error; err != nil {
+				log.Fatalf("Failed to update %s.%s id=%d: %v", col.Table, col.Column, row.ID, err)
+			}
+		}
+		fmt.Printf("%s.%s: 重新加密 %d 个，加密明文 %d 个\n", col.Table, col.Column, rewrapped, sealed)
+	}
+
+	if rotateDryRun {
+		fmt.Println("试运行，未修改数据库")
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Fatalf("Failed to commit: %v", err)
+	}
+
+	fmt.Printf("✓ 所有密钥已使用主密钥 %s 加密\n", next.KeyID())
+	fmt.Println("  请将 MASTER_KEY 改为新密钥、MASTER_KEY_PREVIOUS 设为旧密钥，重启所有进程后删除 MASTER_KEY_PREVIOUS")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/cdn-control-panel/backend/internal/middleware"
 	"github.com/cdn-control-panel/backend/internal/service"
 	"github.com/cdn-control-panel/backend/internal/worker"
+	"github.com/cdn-control-panel/backend/pkg/certchain"
 	_ "github.com/cdn-control-panel/backend/docs"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
@@ -67,16 +68,26 @@ func runServer() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// The DNS sync worker is woken by the services that queue records
+	dnsSyncWorker := worker.NewDNSSyncWorker(30 * time.Second)
+
 	// Initialize services
 	authService := service.NewAuthService(cfg.JWT.Secret)
 	configVersionService := service.NewConfigVersionService()
-	nodeGroupService := service.NewNodeGroupService(configVersionService)
-	lineGroupService := service.NewLineGroupService(configVersionService)
+	nodeGroupService := service.NewNodeGroupService(configVersionService, dnsSyncWorker)
 	
 	// DNS services
 	domainService := service.NewDomainService()
 	dnsProviderService := service.NewDNSProviderService()
-	dnsRecordService := service.NewDNSRecordService(domainService)
+	dnsRecordService := service.NewDNSRecordService(domainService, dnsSyncWorker)
+	zoneFileService := service.NewZoneFileService(domainService, dnsRecordService)
+	nodeHealthService := service.NewNodeHealthService(dnsRecordService)
+	lineGroupService := service.NewLineGroupService(configVersionService, dnsRecordService)
+	dnssecService := service.NewDNSSECService(configVersionService, loadSecretBox(cfg))
+	websiteService := service.NewWebsiteService(dnsSyncWorker)
+	dnsPlanService := service.NewDNSPlanService(nodeGroupService, lineGroupService, websiteService, dnsRecordService)
+	dnsCheckService := service.NewDNSCheckService(dnsRecordService)
+	dnsRecordService.SetConsistencyChecker(dnsCheckService)
 	
 	// Node and API Key services
 	nodeService := service.NewNodeService(configVersionService)
@@ -86,15 +97,26 @@ func runServer() {
 	originService := service.NewOriginService(configVersionService)
 	cacheRuleService := service.NewCacheRuleService(configVersionService)
 
+	// Certificate services
+	certificateService := service.NewCertificateService()
+	acmeService := service.NewACMEService(dnsRecordService)
+	acmeAccountService := service.NewACMEAccountService()
+	ocspService := service.NewOCSPService()
+	if certchain.BundleSize() == 0 {
+		log.Println("Warning: intermediate bundle is empty, complete_chain cannot add intermediates (build with make build or run scripts/update_intermediates.sh)")
+	}
+
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(authService)
-	groupHandler := handler.NewGroupHandler(nodeGroupService, lineGroupService)
+	groupHandler := handler.NewGroupHandler(nodeGroupService, lineGroupService, nodeHealthService)
 	configHandler := handler.NewConfigHandler(configVersionService)
 	
 	// DNS handlers
-	domainHandler := handler.NewDomainHandler(domainService)
+	domainHandler := handler.NewDomainHandler(domainService, zoneFileService, dnssecService)
 	dnsProviderHandler := handler.NewDNSProviderHandler(dnsProviderService)
 	dnsRecordHandler := handler.NewDNSRecordHandler(dnsRecordService)
+	dnsPlanHandler := handler.NewDNSPlanHandler(dnsPlanService)
+	dnsCheckHandler := handler.NewDNSCheckHandler(dnsCheckService)
 	
 	// Node and API Key handlers
 	nodeHandler := handler.NewNodeHandler(nodeService)
@@ -105,21 +127,36 @@ func runServer() {
 	cacheRuleHandler := handler.NewCacheRuleHandler(cacheRuleService)
 	
 	// Website handler
-	websiteHandler := handler.NewWebsiteHandler()
-	certificateHandler := handler.NewCertificateHandler()
+	websiteHandler := handler.NewWebsiteHandler(websiteService)
+	certificateHandler := handler.NewCertificateHandler(certificateService, acmeService)
+	acmeAccountHandler := handler.NewACMEAccountHandler(acmeAccountService)
 	agentHandler := handler.NewAgentHandler()
 	
 	// Start DNS sync worker
 	ctx := context.Background()
-	dnsSyncWorker := worker.NewDNSSyncWorker(30 * time.Second)
 	go dnsSyncWorker.Start(ctx)
 	log.Println("DNS sync worker started")
 
+	// Start node health worker
+	nodeHealthWorker := worker.NewNodeHealthWorker(nodeHealthService, lineGroupService, 10*time.Second)
+	go nodeHealthWorker.Start(ctx)
+	log.Println("Node health worker started")
+
+	// Start DNSSEC worker
+	dnssecWorker := worker.NewDNSSECWorker(dnssecService, 10*time.Minute)
+	go dnssecWorker.Start(ctx)
+	log.Println("DNSSEC worker started")
+
 	// Start ACME worker
 	acmeWorker := worker.NewACMEWorker(acmeService, certificateService, dnsRecordService)
 	go acmeWorker.Start()
 	log.Println("ACME worker started")
 
+	// Start OCSP worker
+	ocspWorker := worker.NewOCSPWorker(ocspService, 5*time.Minute)
+	go ocspWorker.Start(ctx)
+	log.Println("OCSP worker started")
+
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
@@ -149,6 +186,7 @@ func runServer() {
 			nodeGroups := protected.Group("/node-groups")
 			{
 				nodeGroups.GET("", groupHandler.ListNodeGroups)
+				nodeGroups.GET("/health", groupHandler.GetNodeGroupHealth)
 				nodeGroups.POST("/create", groupHandler.CreateNodeGroup)
 				nodeGroups.POST("/update", groupHandler.UpdateNodeGroup)
 				nodeGroups.POST("/delete", groupHandler.DeleteNodeGroup)
@@ -161,6 +199,7 @@ func runServer() {
 				lineGroups.POST("/create", groupHandler.CreateLineGroup)
 				lineGroups.POST("/update", groupHandler.UpdateLineGroup)
 				lineGroups.POST("/delete", groupHandler.DeleteLineGroup)
+				lineGroups.GET("/events", groupHandler.ListLineGroupEvents)
 			}
 
 			// Config version
@@ -174,8 +213,16 @@ func runServer() {
 			{
 				domains.GET("", domainHandler.ListDomains)
 				domains.POST("/create", domainHandler.CreateDomain)
+				domains.GET("/suggest", domainHandler.SuggestZone)
 				domains.POST("/update", domainHandler.UpdateDomain)
 				domains.POST("/delete", domainHandler.DeleteDomain)
+				domains.GET("/:id/zonefile", domainHandler.ExportZoneFile)
+				domains.POST("/zonefile/import", domainHandler.ImportZoneFile)
+				domains.GET("/dnssec", domainHandler.GetDNSSEC)
+				domains.POST("/dnssec/enable", domainHandler.EnableDNSSEC)
+				domains.POST("/dnssec/disable", domainHandler.DisableDNSSEC)
+				domains.POST("/dnssec/rollover", domainHandler.RolloverDNSSECKey)
+				domains.GET("/dnssec/audit", domainHandler.ListDNSSECAuditLogs)
 			}
 			
 			// DNS
@@ -193,6 +240,17 @@ func runServer() {
 				dns.POST("/records/update", dnsRecordHandler.UpdateRecord)
 				dns.POST("/records/delete", dnsRecordHandler.DeleteRecord)
 				dns.POST("/records/sync", dnsRecordHandler.TriggerSync)
+				dns.GET("/records/stuck-deletions", dnsRecordHandler.ListStuckDeletions)
+				
+				// DNS record consistency
+				dns.GET("/check", dnsCheckHandler.Check)
+				dns.POST("/check/cleanup", dnsCheckHandler.Cleanup)
+				dns.GET("/check/runs", dnsCheckHandler.ListRuns)
+				
+				// DNS change plans
+				dns.GET("/plans", dnsPlanHandler.GetPlan)
+				dns.POST("/plans/create", dnsPlanHandler.CreatePlan)
+				dns.POST("/plans/apply", dnsPlanHandler.ApplyPlan)
 			}
 			
 			// API Keys
@@ -244,19 +302,38 @@ func runServer() {
 				websites.POST("/delete", websiteHandler.DeleteWebsite)
 				websites.POST("/domains/manage", websiteHandler.ManageDomains)
 				websites.POST("/clear-cache", websiteHandler.ClearCache)
+				websites.GET("/:id/https-status", websiteHandler.GetHTTPSStatus)
+				websites.POST("/https/provision", websiteHandler.ProvisionHTTPS)
 			}
 
 			certificates := protected.Group("/certificates")
 			{
 				certificates.GET("", certificateHandler.ListCertificates)
 				certificates.GET("/:id", certificateHandler.GetCertificate)
+				certificates.GET("/:id/audit", certificateHandler.ListAuditLogs)
 				certificates.POST("/upload", certificateHandler.UploadCertificate)
+				certificates.POST("/import-pkcs12", certificateHandler.ImportPKCS12)
+				certificates.POST("/export", certificateHandler.ExportCertificate)
 				certificates.POST("/request", certificateHandler.RequestCertificate)
 				certificates.POST("/delete", certificateHandler.DeleteCertificate)
 				certificates.POST("/bind", certificateHandler.BindCertificate)
 				certificates.POST("/unbind", certificateHandler.UnbindCertificate)
 			}
 
+			// ACME providers and accounts
+			acme := protected.Group("/acme")
+			{
+				acme.GET("/providers", acmeAccountHandler.ListProviders)
+				acme.GET("/accounts", acmeAccountHandler.ListAccounts)
+				acme.GET("/accounts/:id", acmeAccountHandler.GetAccount)
+				acme.POST("/accounts/create", acmeAccountHandler.CreateAccount)
+				acme.POST("/accounts/register", acmeAccountHandler.RegisterAccount)
+				acme.POST("/accounts/update", acmeAccountHandler.UpdateAccount)
+				acme.POST("/accounts/rollover-key", acmeAccountHandler.RolloverKey)
+				acme.POST("/accounts/deactivate", acmeAccountHandler.DeactivateAccount)
+				acme.POST("/accounts/delete", acmeAccountHandler.DeleteAccount)
+			}
+
 					// Agent API (mTLS authentication)
 					agent := v1.Group("/agent")
 					agent.Use(middleware.MTLSAuth())
@@ -264,6 +341,8 @@ func runServer() {
 						agent.GET("/config", agentHandler.GetConfig)
 						agent.GET("/certificates", agentHandler.GetCertificates)
 						agent.GET("/certificates/:id", agentHandler.GetCertificateByID)
+						agent.GET("/certificates/:id/ocsp", agentHandler.GetCertificateOCSP)
+						agent.GET("/acme-challenges/:token", agentHandler.GetHTTPChallenge)
 						agent.GET("/tasks", agentHandler.GetPendingTasks)
 						agent.POST("/tasks/:id/status", agentHandler.UpdateTaskStatus)
 					}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/cdn-control-panel/backend/internal/config"
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	zoneDomain string
+	zoneFile   string
+	zoneDryRun bool
+)
+
+// zonefileCmd represents the zonefile command
+var zonefileCmd = &cobra.Command{
+	Use:   "zonefile",
+	Short: "导入/导出BIND zone文件",
+	Long: `导入或导出域名的BIND (RFC 1035) zone文件。
+
+用于在DNS提供商之间迁移域名记录，以及做离线备份。
+
+示例:
+  cdn-control zonefile export --domain example.com --file example.com.zone
+  cdn-control zonefile import --domain example.com --file example.com.zone --dry-run
+  cdn-control zonefile import --domain example.com --file example.com.zone`,
+}
+
+var zonefileExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "导出域名的zone文件",
+	Long: `将域名下的所有DNS记录导出为zone文件。
+
+未指定 --file 时输出到标准输出。
+SOA和根域NS记录由DNS提供商管理，不会导出。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runZonefileExport()
+	},
+}
+
+var zonefileImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "从zone文件导入DNS记录",
+	Long: `解析zone文件并与现有记录对比，缺失的记录以pending状态创建，
+由DNS同步任务推送到DNS提供商。已有记录不会被修改或删除。
+
+未指定 --file 时从标准输入读取。
+使用 --dry-run 仅显示差异，不写入数据库。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runZonefileImport()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(zonefileCmd)
+	zonefileCmd.AddCommand(zonefileExportCmd)
+	zonefileCmd.AddCommand(zonefileImportCmd)
+
+	zonefileCmd.PersistentFlags().StringVarP(&zoneDomain, "domain", "d", "", "域名 (zone)")
+	zonefileCmd.PersistentFlags().StringVarP(&zoneFile, "file", "f", "", "zone文件路径")
+	zonefileCmd.MarkPersistentFlagRequired("domain")
+
+	zonefileImportCmd.Flags().BoolVar(&zoneDryRun, "dry-run", false, "仅显示差异，不写入数据库")
+}
+
+func newZoneFileService() (*service.DomainService, *service.ZoneFileService) {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Connect to database
+	if err := database.Connect(cfg.Database.GetDSN()); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	domainService := service.NewDomainService()
+	dnsRecordService := service.NewDNSRecordService(domainService, nil)
+	return domainService, service.NewZoneFileService(domainService, dnsRecordService)
+}
+
+func runZonefileExport() {
+	domainService, zoneFileService := newZoneFileService()
+
+	domain, err := domainService.GetDomainByName(zoneDomain)
+	if err != nil {
+		log.Fatalf("Failed to get domain %s: %v", zoneDomain, err)
+	}
+
+	content, err := zoneFileService.ExportZoneFile(domain.ID)
+	if err != nil {
+		log.Fatalf("Failed to export zone file: %v", err)
+	}
+
+	if zoneFile == "" {
+		fmt.Print(content)
+		return
+	}
+
+	if err := os.WriteFile(zoneFile, []byte(content), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", zoneFile, err)
+	}
+	log.Printf("✓ Zone file for %s written to %s", domain.Domain, zoneFile)
+}
+
+func runZonefileImport() {
+	var (
+		content []byte
+		err     error
+	)
+	if zoneFile == "" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(zoneFile)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read zone file: %v", err)
+	}
+
+	domainService, zoneFileService := newZoneFileService()
+
+	domain, err := domainService.GetDomainByName(zoneDomain)
+	if err != nil {
+		log.Fatalf("Failed to get domain %s: %v", zoneDomain, err)
+	}
+
+	result, err := zoneFileService.ImportZoneFile(domain.ID, string(content), zoneDryRun)
+	if err != nil {
+		log.Fatalf("Failed to import zone file: %v", err)
+	}
+
+	for _, r := range result.ToCreate {
+		fmt.Printf("+ %-30s %-6d %-5s %s\n", r.Name, r.TTL, r.Type, r.Value)
+	}
+	for _, r := range result.OnlyInDB {
+		fmt.Printf("  %-30s %-6d %-5s %s (only in database, kept)\n", r.Name, r.TTL, r.Type, r.Value)
+	}
+	for _, s := range result.Skipped {
+		fmt.Printf("! %s (skipped: %s)\n", s.Record, s.Reason)
+	}
+
+	fmt.Println()
+	fmt.Printf("新增: %d  未变更: %d  仅数据库: %d  跳过: %d\n",
+		len(result.ToCreate), len(result.Unchanged), len(result.OnlyInDB), len(result.Skipped))
+
+	if zoneDryRun {
+		fmt.Println("dry-run 模式，未写入数据库")
+		return
+	}
+	log.Printf("✓ %d records created with status=pending", result.Created)
+
+	// The CLI exits right away, so check here instead of in the background
+	if result.Created > 0 {
+		report, err := service.NewDNSCheckService(service.NewDNSRecordService(domainService, nil)).Check(domain.ID)
+		if err != nil {
+			log.Fatalf("Failed to check DNS records: %v", err)
+		}
+		if len(report.Issues) > 0 {
+			fmt.Println()
+			printDNSCheckReport(report)
+		}
+	}
+}
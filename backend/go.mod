@@ -9,14 +9,18 @@ require (
 	github.com/redis/go-redis/v9 v9.7.0
 	github.com/cloudflare/cloudflare-go v0.108.0
 	github.com/go-acme/lego/v4 v4.20.4
+	github.com/go-jose/go-jose/v4 v4.0.4
+	github.com/miekg/dns v1.1.62
 	github.com/spf13/cobra v1.8.0
 	github.com/spf13/viper v1.18.2
 	github.com/swaggo/swag v1.16.4
 	github.com/swaggo/gin-swagger v1.6.0
 	github.com/swaggo/files v1.0.1
 	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.33.0
 	gorm.io/driver/mysql v1.5.7
 	gorm.io/gorm v1.25.12
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
@@ -46,7 +50,6 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	golang.org/x/arch v0.8.0 // indirect
-	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	golang.org/x/time v0.8.0 // indirect
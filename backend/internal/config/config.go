@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +14,7 @@ type Config struct {
 	Redis    RedisConfig
 	JWT      JWTConfig
 	TLS      TLSConfig
+	Secrets  SecretsConfig
 }
 
 type ServerConfig struct {
@@ -40,6 +42,17 @@ type JWTConfig struct {
 	Secret string
 }
 
+// SecretsConfig holds the master key that encrypts secrets stored in the
+// database, either inline (MASTER_KEY) or in a file (MASTER_KEY_FILE);
+// both hold 32 bytes, base64 or hex encoded. MASTER_KEY_PREVIOUS keeps the
+// key replaced by rotate-master-key readable until every process has the
+// new one.
+type SecretsConfig struct {
+	MasterKey         string
+	MasterKeyFile     string
+	PreviousMasterKey string
+}
+
 type TLSConfig struct {
 	Enabled    bool
 	CertFile   string
@@ -82,6 +95,11 @@ func Load() (*Config, error) {
 			CAFile:     getEnv("TLS_CA_FILE", ""),
 			ClientAuth: getEnv("TLS_CLIENT_AUTH", "false") == "true",
 		},
+		Secrets: SecretsConfig{
+			MasterKey:         getEnv("MASTER_KEY", ""),
+			MasterKeyFile:     getEnv("MASTER_KEY_FILE", ""),
+			PreviousMasterKey: getEnv("MASTER_KEY_PREVIOUS", ""),
+		},
 	}
 
 	if cfg.JWT.Secret == "" {
@@ -112,6 +130,21 @@ func (c *DatabaseConfig) GetDSN() string {
 	)
 }
 
+// LoadMasterKey returns the encoded master key, or "" if none is configured
+func (c *SecretsConfig) LoadMasterKey() (string, error) {
+	if c.MasterKey != "" {
+		return c.MasterKey, nil
+	}
+	if c.MasterKeyFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(c.MasterKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read master key file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // GetRedisAddr returns Redis address
 func (c *RedisConfig) GetAddr() string {
 	return fmt.Sprintf("%s:%s", c.Host, c.Port)
@@ -44,6 +44,11 @@ func AutoMigrate() error {
 		&models.Domain{},
 		&models.DomainDNSProvider{},
 		&models.DomainDNSRecord{},
+		&models.DomainDNSSEC{},
+		&models.DNSSECKey{},
+		&models.DNSSECAuditLog{},
+		&models.DNSChangePlan{},
+		&models.DNSCheckRun{},
 
 		// Nodes
 		&models.Node{},
@@ -51,6 +56,9 @@ func AutoMigrate() error {
 		&models.NodeGroup{},
 		&models.NodeGroupSubIP{},
 		&models.LineGroup{},
+		&models.LineGroupRoute{},
+		&models.LineGroupMember{},
+		&models.LineGroupEvent{},
 
 		// Origin
 		&models.OriginGroup{},
@@ -66,9 +74,12 @@ func AutoMigrate() error {
 		&models.ACMEProvider{},
 		&models.ACMEAccount{},
 		&models.CertificateRequest{},
+		&models.ACMEHTTPChallenge{},
 		&models.Certificate{},
 		&models.CertificateDomain{},
 		&models.CertificateBinding{},
+		&models.CertificateAuditLog{},
+		&models.CertificateOCSPResponse{},
 
 		// Website
 		&models.Website{},
@@ -153,10 +164,22 @@ func addUniqueConstraints() error {
 		log.Printf("Warning: Could not add unique constraint on certificate_bindings: %v", err)
 	}
 
-	// domain_dns_records: unique(domain_id, type, name, value, owner_type, owner_id)
+	// domain_dns_records: unique(domain_id, type, name, value, line, owner_type, owner_id)
+	// The index predates resolver views; recreate it if it lacks the line column
+	var lineColumns int64
+	DB.Raw(`
+		SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = 'domain_dns_records'
+		AND index_name = 'idx_domain_dns_records_unique' AND column_name = 'line'
+	`).Scan(&lineColumns)
+	if lineColumns == 0 && DB.Migrator().HasIndex(&models.DomainDNSRecord{}, "idx_domain_dns_records_unique") {
+		if err := DB.Migrator().DropIndex(&models.DomainDNSRecord{}, "idx_domain_dns_records_unique"); err != nil {
+			log.Printf("Warning: Could not drop old unique constraint on domain_dns_records: %v", err)
+		}
+	}
 	if err := DB.Exec(`
 		ALTER TABLE domain_dns_records 
-		ADD UNIQUE INDEX idx_domain_dns_records_unique (domain_id, type, name, value(255), owner_type, owner_id)
+		ADD UNIQUE INDEX idx_domain_dns_records_unique (domain_id, type, name, value(255), line, owner_type, owner_id)
 	`).Error; err != nil {
 		log.Printf("Warning: Could not add unique constraint on domain_dns_records: %v", err)
 	}
@@ -182,6 +205,12 @@ func SeedDefaultData() error {
 			RequiresEAB:  true,
 			Status:       "active",
 		},
+		{
+			Name:         "zerossl",
+			DirectoryURL: "https://acme.zerossl.com/v2/DV90",
+			RequiresEAB:  true,
+			Status:       "active",
+		},
 	}
 
 	for _, provider := range acmeProviders {
@@ -0,0 +1,447 @@
+package dnsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/cdn-control-panel/backend/pkg/dnsprovider"
+	"github.com/cdn-control-panel/backend/pkg/secretbox"
+	"github.com/miekg/dns"
+)
+
+// SOA timers advertised to secondaries
+const (
+	soaRefresh = 3600
+	soaRetry   = 600
+	soaExpire  = 604800
+	soaMinTTL  = 60
+	soaTTL     = 3600
+	nsTTL      = 86400
+)
+
+// Config configures the authoritative server
+type Config struct {
+	Listen          string         // Address for both UDP and TCP, e.g. ":53"
+	Nameservers     []string       // Apex NS hostnames; the first one is the SOA MNAME
+	Hostmaster      string         // SOA RNAME; defaults to hostmaster.<zone>
+	Domains         []string       // Zones to serve; empty serves all builtin zones
+	Secondaries     []string       // host:port targets for NOTIFY (also allowed to AXFR)
+	AllowTransfer   []*net.IPNet   // Additional networks allowed to AXFR
+	RefreshInterval time.Duration  // How often to check for a config version bump
+	SecretBox       *secretbox.Box // Decrypts DNSSEC signing keys; nil serves all zones unsigned
+}
+
+// Server is an authoritative DNS server for zones whose DNS provider is
+// "builtin". Zones are loaded from domain_dns_records and reloaded whenever
+// the config version changes; the version is used as the SOA serial. Zones
+// with DNSSEC enabled are signed on every load.
+type Server struct {
+	cfg                  Config
+	configVersionService *service.ConfigVersionService
+	dnssecService        *service.DNSSECService
+
+	mu      sync.RWMutex
+	zones   map[string]*zone // Origin -> zone
+	version int64
+}
+
+// NewServer creates a new authoritative DNS server
+func NewServer(cfg Config) (*Server, error) {
+	if len(cfg.Nameservers) == 0 {
+		return nil, errors.New("at least one nameserver is required")
+	}
+	for i, ns := range cfg.Nameservers {
+		cfg.Nameservers[i] = dns.Fqdn(strings.ToLower(ns))
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 5 * time.Second
+	}
+
+	configVersionService := service.NewConfigVersionService()
+	return &Server{
+		cfg:                  cfg,
+		configVersionService: configVersionService,
+		dnssecService:        service.NewDNSSECService(configVersionService, cfg.SecretBox),
+		zones:                make(map[string]*zone),
+		version:              -1,
+	}, nil
+}
+
+// Start loads the zones and serves UDP and TCP until ctx is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	if _, err := s.refresh(); err != nil {
+		return err
+	}
+
+	servers := []*dns.Server{
+		{Addr: s.cfg.Listen, Net: "udp", Handler: s},
+		{Addr: s.cfg.Listen, Net: "tcp", Handler: s},
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *dns.Server) {
+			log.Printf("[DNSServer] Listening on %s/%s\n", srv.Addr, srv.Net)
+			errCh <- srv.ListenAndServe()
+		}(srv)
+	}
+
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[DNSServer] Stopping DNS server...")
+			for _, srv := range servers {
+				srv.Shutdown()
+			}
+			return nil
+		case err := <-errCh:
+			return err
+		case <-ticker.C:
+			changed, err := s.refresh()
+			if err != nil {
+				log.Printf("[DNSServer] Error reloading zones: %v\n", err)
+				continue
+			}
+			if changed {
+				s.notifyAll()
+			}
+		}
+	}
+}
+
+// refresh reloads all zones if the config version changed since the last load
+func (s *Server) refresh() (bool, error) {
+	latest, err := s.configVersionService.GetLatestVersion()
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	current := s.version
+	s.mu.RUnlock()
+	if latest.Version == current {
+		return false, nil
+	}
+
+	zones, err := s.loadZones(latest.Version)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.zones = zones
+	s.version = latest.Version
+	s.mu.Unlock()
+
+	log.Printf("[DNSServer] Loaded %d zones at config version %d\n", len(zones), latest.Version)
+	return true, nil
+}
+
+// loadZones builds zone snapshots from the database
+func (s *Server) loadZones(version int64) (map[string]*zone, error) {
+	db := database.GetDB()
+
+	var providers []models.DomainDNSProvider
+	if err := db.Preload("Domain").
+		Where("provider = ? AND status = ?", service.BuiltinDNSProvider, "active").
+		Find(&providers).Error; err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(s.cfg.Domains))
+	for _, d := range s.cfg.Domains {
+		wanted[dns.Fqdn(strings.ToLower(d))] = true
+	}
+
+	serial := uint32(version)
+	if serial == 0 {
+		serial = 1
+	}
+
+	zones := make(map[string]*zone)
+	for _, provider := range providers {
+		if provider.Domain == nil || provider.Domain.Status != "active" {
+			continue
+		}
+		origin := dns.Fqdn(strings.ToLower(provider.Domain.Domain))
+		if len(wanted) > 0 && !wanted[origin] {
+			continue
+		}
+
+		z := newZone(origin, s.buildSOA(origin, serial))
+		for _, ns := range s.cfg.Nameservers {
+			z.add(&dns.NS{
+				Hdr: dns.RR_Header{Name: origin, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: nsTTL},
+				Ns:  ns,
+			})
+		}
+
+		// Resolver views need a source-address database: serve the default view.
+		// Only records the sync worker accepted are served: pending changes
+		// go live with the config version bump of the run that activates
+		// them, and records in error are never served
+		var records []models.DomainDNSRecord
+		if err := db.Where("domain_id = ? AND status IN ?", provider.DomainID, []string{"active", "verified"}).
+			Where("line IN ?", []string{"", dnsprovider.ViewDefault}).
+			Find(&records).Error; err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			// Apex NS comes from the server configuration
+			if record.Type == "NS" && record.Name == "@" {
+				continue
+			}
+			rr, err := service.RecordToRR(record, provider.Domain.Domain)
+			if err != nil {
+				log.Printf("[DNSServer] Skipping record %d: %v\n", record.ID, err)
+				continue
+			}
+			z.add(rr)
+		}
+
+		// A zone that fails to sign is served unsigned and logged; resolvers
+		// treat it as bogus while its DS is published
+		keys, err := s.dnssecService.LoadSigningKeys(provider.DomainID)
+		if err != nil {
+			log.Printf("[DNSServer] Serving %s unsigned: %v\n", origin, err)
+		} else if len(keys) > 0 {
+			if err := z.sign(keys, time.Now()); err != nil {
+				log.Printf("[DNSServer] Serving %s unsigned: %v\n", origin, err)
+			}
+		}
+
+		zones[origin] = z
+	}
+
+	return zones, nil
+}
+
+// buildSOA builds the SOA record of a zone
+func (s *Server) buildSOA(origin string, serial uint32) *dns.SOA {
+	hostmaster := s.cfg.Hostmaster
+	if hostmaster == "" {
+		hostmaster = "hostmaster." + origin
+	}
+
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: soaTTL},
+		Ns:      s.cfg.Nameservers[0],
+		Mbox:    dns.Fqdn(strings.Replace(hostmaster, "@", ".", 1)),
+		Serial:  serial,
+		Refresh: soaRefresh,
+		Retry:   soaRetry,
+		Expire:  soaExpire,
+		Minttl:  soaMinTTL,
+	}
+}
+
+// findZone returns the most specific zone containing name
+func (s *Server) findZone(name string) *zone {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for n := name; ; n = parent(n) {
+		if z, ok := s.zones[n]; ok {
+			return z
+		}
+		if n == "." {
+			return nil
+		}
+	}
+}
+
+// ServeDNS implements dns.Handler
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if r.Opcode != dns.OpcodeQuery {
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		w.WriteMsg(m)
+		return
+	}
+	if len(r.Question) != 1 {
+		m.SetRcode(r, dns.RcodeFormatError)
+		w.WriteMsg(m)
+		return
+	}
+
+	q := r.Question[0]
+	z := s.findZone(q.Name)
+	if z == nil {
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+
+	if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+		s.transfer(w, r, z)
+		return
+	}
+
+	// DNSSEC records are only added for clients setting the DO bit
+	opt := r.IsEdns0()
+	dnssec := opt != nil && opt.Do()
+
+	m.Authoritative = true
+	z.answer(m, q, dnssec)
+
+	// Honour the EDNS0 buffer size and truncate oversized UDP answers
+	size := dns.MinMsgSize
+	if opt != nil {
+		size = int(opt.UDPSize())
+		m.SetEdns0(opt.UDPSize(), dnssec)
+	}
+	if w.RemoteAddr().Network() == "udp" {
+		m.Truncate(size)
+	}
+
+	w.WriteMsg(m)
+}
+
+// transfer answers AXFR (and IXFR, with a full transfer) to allowed clients over TCP
+func (s *Server) transfer(w dns.ResponseWriter, r *dns.Msg, z *zone) {
+	remote := w.RemoteAddr()
+	if remote.Network() != "tcp" || !s.transferAllowed(remote) {
+		log.Printf("[DNSServer] Refused zone transfer of %s to %s\n", z.origin, remote)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+
+	rrs := z.all()
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := tr.Out(w, r, ch); err != nil {
+			log.Printf("[DNSServer] Zone transfer of %s to %s failed: %v\n", z.origin, remote, err)
+		}
+	}()
+
+	const chunk = 100
+	for i := 0; i < len(rrs); i += chunk {
+		end := i + chunk
+		if end > len(rrs) {
+			end = len(rrs)
+		}
+		ch <- &dns.Envelope{RR: rrs[i:end]}
+	}
+	close(ch)
+	wg.Wait()
+	w.Close()
+
+	log.Printf("[DNSServer] Transferred %s (serial %d, %d records) to %s\n", z.origin, z.soa.Serial, len(rrs), remote)
+}
+
+// transferAllowed reports whether a client may AXFR: configured networks and
+// NOTIFY targets are allowed
+func (s *Server) transferAllowed(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range s.cfg.AllowTransfer {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	for _, secondary := range s.cfg.Secondaries {
+		if h, _, err := net.SplitHostPort(secondary); err == nil && net.ParseIP(h).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyAll sends NOTIFY for every zone to every secondary (RFC 1996)
+func (s *Server) notifyAll() {
+	if len(s.cfg.Secondaries) == 0 {
+		return
+	}
+
+	s.mu.RLock()
+	zones := make([]*zone, 0, len(s.zones))
+	for _, z := range s.zones {
+		zones = append(zones, z)
+	}
+	s.mu.RUnlock()
+
+	for _, z := range zones {
+		for _, target := range s.cfg.Secondaries {
+			go s.notify(z, target)
+		}
+	}
+}
+
+// notify sends a single NOTIFY and waits for the acknowledgement
+func (s *Server) notify(z *zone, target string) {
+	m := new(dns.Msg)
+	m.SetNotify(z.origin)
+	m.Authoritative = true
+	m.Answer = []dns.RR{z.soa}
+
+	client := &dns.Client{Timeout: 5 * time.Second}
+	resp, _, err := client.Exchange(m, target)
+	if err != nil {
+		log.Printf("[DNSServer] NOTIFY %s to %s failed: %v\n", z.origin, target, err)
+		return
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		log.Printf("[DNSServer] NOTIFY %s to %s rejected: %s\n", z.origin, target, dns.RcodeToString[resp.Rcode])
+		return
+	}
+
+	log.Printf("[DNSServer] NOTIFY %s (serial %d) acknowledged by %s\n", z.origin, z.soa.Serial, target)
+}
+
+// ParseNetworks parses IPs and CIDRs into networks (a bare IP is a single host)
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
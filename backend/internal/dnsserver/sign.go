@@ -0,0 +1,229 @@
+package dnsserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/miekg/dns"
+)
+
+// signatureBackdate covers clock skew of validating resolvers
+const signatureBackdate = time.Hour
+
+// sign publishes the DNSKEYs, builds the NSEC chain and signs every
+// authoritative RRset. Active ZSKs sign zone data; every KSK, including
+// published and retired ones during a rollover, signs the DNSKEY set.
+func (z *zone) sign(keys []service.SigningKey, now time.Time) error {
+	var ksks, zsks []service.SigningKey
+	for _, key := range keys {
+		switch {
+		case key.Role == service.DNSSECRoleKSK:
+			ksks = append(ksks, key)
+		case key.Status == service.DNSSECKeyActive:
+			zsks = append(zsks, key)
+		}
+	}
+	if len(ksks) == 0 || len(zsks) == 0 {
+		return fmt.Errorf("zone %s needs a KSK and an active ZSK", z.origin)
+	}
+
+	for _, key := range keys {
+		dnskey := dns.Copy(key.DNSKEY).(*dns.DNSKEY)
+		dnskey.Hdr.Name = z.origin
+		z.add(dnskey)
+	}
+
+	z.buildNSEC()
+
+	inception := now.Add(-signatureBackdate)
+	expiration := now.Add(service.DNSSECSignatureValidity)
+	z.sigs = make(map[string][]dns.RR)
+
+	if err := z.signRRset([]dns.RR{z.soa}, zsks, inception, expiration); err != nil {
+		return err
+	}
+	for name, rrs := range z.records {
+		cut, _ := z.delegation(name)
+		if cut != "" && cut != name {
+			continue // Glue below a zone cut is not authoritative
+		}
+
+		for _, rrtype := range types(rrs) {
+			// NS at a delegation belongs to the child
+			if cut == name && rrtype == dns.TypeNS {
+				continue
+			}
+			signers := zsks
+			if rrtype == dns.TypeDNSKEY {
+				signers = ksks
+			}
+			if err := z.signRRset(filter(rrs, rrtype), signers, inception, expiration); err != nil {
+				return err
+			}
+		}
+	}
+
+	z.signed = true
+	return nil
+}
+
+// signRRset adds one RRSIG per key over an RRset
+func (z *zone) signRRset(rrset []dns.RR, keys []service.SigningKey, inception, expiration time.Time) error {
+	for _, key := range keys {
+		sig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Ttl: rrset[0].Header().Ttl},
+			KeyTag:     key.DNSKEY.KeyTag(),
+			SignerName: z.origin,
+			Algorithm:  key.DNSKEY.Algorithm,
+			Inception:  uint32(inception.Unix()),
+			Expiration: uint32(expiration.Unix()),
+		}
+		if err := sig.Sign(key.Signer, rrset); err != nil {
+			return fmt.Errorf("failed to sign %s/%s: %w", rrset[0].Header().Name, dns.TypeToString[rrset[0].Header().Rrtype], err)
+		}
+		name := rrset[0].Header().Name
+		z.sigs[name] = append(z.sigs[name], sig)
+	}
+	return nil
+}
+
+// buildNSEC links all authoritative owner names in canonical order (RFC 4034
+// section 6.1). Names below zone cuts and empty non-terminals have no NSEC.
+func (z *zone) buildNSEC() {
+	names := []string{z.origin}
+	for name := range z.records {
+		if name == z.origin {
+			continue
+		}
+		if cut, _ := z.delegation(name); cut != "" && cut != name {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+
+	z.nsec = make([]*dns.NSEC, len(names))
+	for i, name := range names {
+		bitmap := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+		if name == z.origin {
+			bitmap = append(bitmap, dns.TypeSOA)
+		}
+		cut, _ := z.delegation(name)
+		for _, rrtype := range types(z.records[name]) {
+			// A zone cut only owns NS and DS
+			if cut == name && rrtype != dns.TypeNS && rrtype != dns.TypeDS {
+				continue
+			}
+			bitmap = append(bitmap, rrtype)
+		}
+		sort.Slice(bitmap, func(a, b int) bool { return bitmap[a] < bitmap[b] })
+
+		z.nsec[i] = &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: z.soa.Minttl},
+			NextDomain: names[(i+1)%len(names)],
+			TypeBitMap: uniqueTypes(bitmap),
+		}
+	}
+
+	for _, nsec := range z.nsec {
+		z.records[nsec.Hdr.Name] = append(z.records[nsec.Hdr.Name], nsec)
+	}
+}
+
+// covering returns the NSEC whose span covers a name that does not exist
+func (z *zone) covering(name string) *dns.NSEC {
+	if len(z.nsec) == 0 {
+		return nil
+	}
+	i := sort.Search(len(z.nsec), func(i int) bool { return canonicalLess(name, z.nsec[i].Hdr.Name) })
+	if i == 0 {
+		return z.nsec[len(z.nsec)-1]
+	}
+	return z.nsec[i-1]
+}
+
+// nsecAt returns the NSEC owned by name
+func (z *zone) nsecAt(name string) *dns.NSEC {
+	for _, rr := range filter(z.records[name], dns.TypeNSEC) {
+		return rr.(*dns.NSEC)
+	}
+	return nil
+}
+
+// rrsigs returns the signatures over the RRset of name and rrtype (all
+// signatures of name for ANY), owned by ownerName
+func (z *zone) rrsigs(name string, rrtype uint16, ownerName string) []dns.RR {
+	var out []dns.RR
+	for _, rr := range z.sigs[name] {
+		if rrtype == dns.TypeANY || rr.(*dns.RRSIG).TypeCovered == rrtype {
+			out = append(out, rr)
+		}
+	}
+	return withName(out, ownerName)
+}
+
+// withProof appends records and their signatures, skipping duplicates
+func (z *zone) withProof(section []dns.RR, rrs ...dns.RR) []dns.RR {
+	for _, rr := range rrs {
+		if rr == nil || containsRR(section, rr) {
+			continue
+		}
+		section = append(section, rr)
+		for _, sig := range z.rrsigs(rr.Header().Name, rr.Header().Rrtype, rr.Header().Name) {
+			if !containsRR(section, sig) {
+				section = append(section, sig)
+			}
+		}
+	}
+	return section
+}
+
+// types returns the distinct record types of rrs
+func types(rrs []dns.RR) []uint16 {
+	var out []uint16
+	seen := make(map[uint16]bool)
+	for _, rr := range rrs {
+		if t := rr.Header().Rrtype; !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// uniqueTypes drops duplicates from a sorted type list
+func uniqueTypes(sorted []uint16) []uint16 {
+	out := make([]uint16, 0, len(sorted))
+	for i, t := range sorted {
+		if i == 0 || t != sorted[i-1] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// containsRR reports whether section already holds rr
+func containsRR(section []dns.RR, rr dns.RR) bool {
+	for _, existing := range section {
+		if dns.IsDuplicate(existing, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalLess orders names by their labels from the root, compared as
+// lowercase bytes (RFC 4034 section 6.1)
+func canonicalLess(a, b string) bool {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if la[i] != lb[j] {
+			return la[i] < lb[j]
+		}
+	}
+	return len(la) < len(lb)
+}
@@ -0,0 +1,241 @@
+package dnsserver
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain bounds how many in-zone CNAMEs are followed for one answer
+const maxCNAMEChain = 8
+
+// zone is an immutable snapshot of one authoritative zone
+type zone struct {
+	origin  string // Lowercase FQDN with trailing dot
+	soa     *dns.SOA
+	records map[string][]dns.RR // Owner name (lowercase FQDN) -> records, apex NS included
+	names   map[string]bool     // Owner names plus their ancestors (empty non-terminals)
+
+	// Set by sign for DNSSEC zones; NSEC records are also in records
+	signed bool
+	sigs   map[string][]dns.RR // Owner name -> RRSIGs
+	nsec   []*dns.NSEC         // NSEC chain in canonical order
+}
+
+func newZone(origin string, soa *dns.SOA) *zone {
+	return &zone{
+		origin:  origin,
+		soa:     soa,
+		records: make(map[string][]dns.RR),
+		names:   map[string]bool{origin: true},
+	}
+}
+
+// add inserts a record into the zone
+func (z *zone) add(rr dns.RR) {
+	name := strings.ToLower(rr.Header().Name)
+	rr.Header().Name = name
+	z.records[name] = append(z.records[name], rr)
+
+	for n := name; n != z.origin && n != "."; n = parent(n) {
+		z.names[n] = true
+	}
+}
+
+// all returns the zone contents for a transfer: SOA, all records and
+// signatures, SOA
+func (z *zone) all() []dns.RR {
+	rrs := []dns.RR{z.soa}
+	for _, owner := range z.records {
+		rrs = append(rrs, owner...)
+	}
+	for _, sigs := range z.sigs {
+		rrs = append(rrs, sigs...)
+	}
+	return append(rrs, z.soa)
+}
+
+// answer fills the answer/authority sections of m for question q. With
+// dnssec set (the DO bit) signed zones add RRSIGs and NSEC proofs.
+func (z *zone) answer(m *dns.Msg, q dns.Question, dnssec bool) {
+	z.resolve(m, strings.ToLower(q.Name), q.Name, q.Qtype, 0, dnssec && z.signed)
+}
+
+func (z *zone) resolve(m *dns.Msg, name, qname string, qtype uint16, depth int, dnssec bool) {
+	// Delegation below the apex: refer to the child nameservers
+	if cut, ns := z.delegation(name); ns != nil && !(cut == name && qtype == dns.TypeDS) {
+		if depth == 0 {
+			m.Authoritative = false
+			m.Ns = append(m.Ns, ns...)
+			m.Extra = append(m.Extra, z.glue(ns)...)
+			if dnssec {
+				// Signed DS, or the NSEC proving the delegation is insecure
+				if ds := filter(z.records[cut], dns.TypeDS); len(ds) > 0 {
+					m.Ns = z.withProof(m.Ns, ds...)
+				} else {
+					m.Ns = z.withProof(m.Ns, z.nsecAt(cut))
+				}
+			}
+		}
+		return
+	}
+
+	owner := name
+	rrs, exists := z.records[name]
+	if !exists {
+		owner, rrs, exists = z.wildcard(name)
+	}
+
+	if !exists {
+		if depth == 0 {
+			if !z.names[name] {
+				m.Rcode = dns.RcodeNameError
+			}
+			z.negative(m, dnssec)
+			if dnssec {
+				m.Ns = z.withProof(m.Ns, z.covering(name))
+				if m.Rcode == dns.RcodeNameError {
+					m.Ns = z.withProof(m.Ns, z.covering("*."+z.closestEncloser(name)))
+				}
+			}
+		}
+		return
+	}
+
+	// A wildcard answer proves that qname itself does not exist
+	if dnssec && owner != name {
+		m.Ns = z.withProof(m.Ns, z.covering(name))
+	}
+
+	// CNAME at the name answers every type except CNAME itself
+	if cnames := filter(rrs, dns.TypeCNAME); len(cnames) > 0 && qtype != dns.TypeCNAME {
+		m.Answer = append(m.Answer, withName(cnames, qname)...)
+		if dnssec {
+			m.Answer = append(m.Answer, z.rrsigs(owner, dns.TypeCNAME, qname)...)
+		}
+
+		target := strings.ToLower(cnames[0].(*dns.CNAME).Target)
+		if depth < maxCNAMEChain && dns.IsSubDomain(z.origin, target) {
+			z.resolve(m, target, target, qtype, depth+1, dnssec)
+		}
+		return
+	}
+
+	answers := rrs
+	if qtype != dns.TypeANY {
+		answers = filter(rrs, qtype)
+	}
+	if len(answers) == 0 {
+		if depth == 0 {
+			z.negative(m, dnssec) // NODATA
+			if dnssec {
+				m.Ns = z.withProof(m.Ns, z.nsecAt(owner))
+			}
+		}
+		return
+	}
+
+	m.Answer = append(m.Answer, withName(answers, qname)...)
+	if dnssec {
+		m.Answer = append(m.Answer, z.rrsigs(owner, qtype, qname)...)
+	}
+}
+
+// negative adds the SOA of an NXDOMAIN/NODATA answer, signed if requested
+func (z *zone) negative(m *dns.Msg, dnssec bool) {
+	m.Ns = append(m.Ns, z.negativeSOA())
+	if !dnssec {
+		return
+	}
+	for _, sig := range z.rrsigs(z.origin, dns.TypeSOA, z.origin) {
+		if sig.Header().Ttl > z.soa.Minttl {
+			sig.Header().Ttl = z.soa.Minttl
+		}
+		m.Ns = append(m.Ns, sig)
+	}
+}
+
+// negativeSOA returns the SOA for NXDOMAIN/NODATA answers, with its TTL
+// capped at the SOA minimum so negative caching follows RFC 2308
+func (z *zone) negativeSOA() dns.RR {
+	soa := dns.Copy(z.soa)
+	if soa.Header().Ttl > z.soa.Minttl {
+		soa.Header().Ttl = z.soa.Minttl
+	}
+	return soa
+}
+
+// delegation returns the closest zone cut at or above name (below the apex)
+func (z *zone) delegation(name string) (string, []dns.RR) {
+	for n := name; n != z.origin && dns.IsSubDomain(z.origin, n); n = parent(n) {
+		if ns := filter(z.records[n], dns.TypeNS); len(ns) > 0 {
+			return n, ns
+		}
+	}
+	return "", nil
+}
+
+// wildcard looks up *.<closest encloser> for a name that does not exist
+// (RFC 4592) and returns the wildcard owner name with its records
+func (z *zone) wildcard(name string) (string, []dns.RR, bool) {
+	if z.names[name] {
+		return "", nil, false
+	}
+
+	encloser := z.closestEncloser(name)
+	rrs, ok := z.records["*."+encloser]
+	return "*." + encloser, rrs, ok
+}
+
+// closestEncloser returns the nearest existing ancestor of name
+func (z *zone) closestEncloser(name string) string {
+	for n := parent(name); dns.IsSubDomain(z.origin, n) && n != z.origin; n = parent(n) {
+		if z.names[n] {
+			return n
+		}
+	}
+	return z.origin
+}
+
+// glue returns in-zone addresses of the given nameservers
+func (z *zone) glue(ns []dns.RR) []dns.RR {
+	var extra []dns.RR
+	for _, rr := range ns {
+		host := strings.ToLower(rr.(*dns.NS).Ns)
+		extra = append(extra, filter(z.records[host], dns.TypeA)...)
+		extra = append(extra, filter(z.records[host], dns.TypeAAAA)...)
+	}
+	return extra
+}
+
+// filter returns the records of the given type
+func filter(rrs []dns.RR, rrtype uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == rrtype {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// withName returns copies of rrs owned by name (used for wildcard synthesis
+// and to echo the query's case)
+func withName(rrs []dns.RR, name string) []dns.RR {
+	out := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		c := dns.Copy(rr)
+		c.Header().Name = name
+		out = append(out, c)
+	}
+	return out
+}
+
+// parent strips the leftmost label of a FQDN
+func parent(name string) string {
+	i, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[i:]
+}
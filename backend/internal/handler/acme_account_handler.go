@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/cdn-control-panel/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+type ACMEAccountHandler struct {
+	acmeAccountService *service.ACMEAccountService
+}
+
+func NewACMEAccountHandler(acmeAccountService *service.ACMEAccountService) *ACMEAccountHandler {
+	return &ACMEAccountHandler{
+		acmeAccountService: acmeAccountService,
+	}
+}
+
+// ListProviders godoc
+// @Summary List ACME providers
+// @Description Get all ACME providers (certificate authorities)
+// @Tags acme
+// @Produce json
+// @Success 200 {object} response.Response{data=[]models.ACMEProvider}
+// @Failure 500 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/providers [get]
+func (h *ACMEAccountHandler) ListProviders(c *gin.Context) {
+	providers, err := h.acmeAccountService.ListACMEProviders()
+	if err != nil {
+		response.Error(c, response.CodeSystemError, err.Error())
+		return
+	}
+
+	response.Success(c, providers)
+}
+
+// ListAccounts godoc
+// @Summary List ACME accounts
+// @Description Get list of ACME accounts with pagination
+// @Tags acme
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(10)
+// @Param provider_id query int false "Filter by provider"
+// @Param status query string false "Filter by status" Enums(pending, active, disabled)
+// @Success 200 {object} response.Response{data=[]models.ACMEAccount}
+// @Failure 500 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts [get]
+func (h *ACMEAccountHandler) ListAccounts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	providerID, _ := strconv.Atoi(c.Query("provider_id"))
+	status := c.Query("status")
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	accounts, total, err := h.acmeAccountService.ListACMEAccounts(page, pageSize, providerID, status)
+	if err != nil {
+		response.Error(c, response.CodeSystemError, err.Error())
+		return
+	}
+
+	response.SuccessWithPagination(c, accounts, total, page, pageSize)
+}
+
+// GetAccount godoc
+// @Summary Get ACME account
+// @Description Get ACME account by ID
+// @Tags acme
+// @Produce json
+// @Param id path int true "Account ID"
+// @Success 200 {object} response.Response{data=models.ACMEAccount}
+// @Failure 404 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts/{id} [get]
+func (h *ACMEAccountHandler) GetAccount(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.Error(c, response.CodeValidationFailed, "invalid account ID")
+		return
+	}
+
+	account, err := h.acmeAccountService.GetACMEAccount(id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// CreateAccount godoc
+// @Summary Create ACME account
+// @Description Generate an account key and register it with the provider (EAB when required)
+// @Tags acme
+// @Accept json
+// @Produce json
+// @Param request body service.CreateACMEAccountRequest true "Create ACME account request"
+// @Success 200 {object} response.Response{data=models.ACMEAccount}
+// @Failure 400 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts/create [post]
+func (h *ACMEAccountHandler) CreateAccount(c *gin.Context) {
+	var req service.CreateACMEAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, response.CodeValidationFailed, err.Error())
+		return
+	}
+
+	account, err := h.acmeAccountService.CreateACMEAccount(req)
+	if err != nil {
+		if account != nil {
+			// Stored but not registered, it can be registered again by ID
+			response.Error(c, response.CodeACMEError, "account "+strconv.Itoa(account.ID)+" is pending: "+err.Error())
+			return
+		}
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// RegisterAccount godoc
+// @Summary Register ACME account
+// @Description Retry the registration of a pending ACME account
+// @Tags acme
+// @Accept json
+// @Produce json
+// @Param request body service.ACMEAccountIDRequest true "Account ID"
+// @Success 200 {object} response.Response{data=models.ACMEAccount}
+// @Failure 400 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts/register [post]
+func (h *ACMEAccountHandler) RegisterAccount(c *gin.Context) {
+	var req service.ACMEAccountIDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, response.CodeValidationFailed, err.Error())
+		return
+	}
+
+	account, err := h.acmeAccountService.RegisterACMEAccount(req.ID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// UpdateAccount godoc
+// @Summary Update ACME account
+// @Description Update the contact email (also at the provider) or the EAB credentials of a pending account
+// @Tags acme
+// @Accept json
+// @Produce json
+// @Param request body service.UpdateACMEAccountRequest true "Update ACME account request"
+// @Success 200 {object} response.Response{data=models.ACMEAccount}
+// @Failure 400 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts/update [post]
+func (h *ACMEAccountHandler) UpdateAccount(c *gin.Context) {
+	var req service.UpdateACMEAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, response.CodeValidationFailed, err.Error())
+		return
+	}
+
+	account, err := h.acmeAccountService.UpdateACMEAccount(req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// RolloverKey godoc
+// @Summary Roll over ACME account key
+// @Description Replace the key of an active ACME account at the provider
+// @Tags acme
+// @Accept json
+// @Produce json
+// @Param request body service.ACMEAccountIDRequest true "Account ID"
+// @Success 200 {object} response.Response{data=models.ACMEAccount}
+// @Failure 400 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts/rollover-key [post]
+func (h *ACMEAccountHandler) RolloverKey(c *gin.Context) {
+	var req service.ACMEAccountIDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, response.CodeValidationFailed, err.Error())
+		return
+	}
+
+	account, err := h.acmeAccountService.RolloverACMEAccountKey(req.ID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// DeactivateAccount godoc
+// @Summary Deactivate ACME account
+// @Description Deactivate the account at the provider and disable it (permanent)
+// @Tags acme
+// @Accept json
+// @Produce json
+// @Param request body service.ACMEAccountIDRequest true "Account ID"
+// @Success 200 {object} response.Response{data=models.ACMEAccount}
+// @Failure 400 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts/deactivate [post]
+func (h *ACMEAccountHandler) DeactivateAccount(c *gin.Context) {
+	var req service.ACMEAccountIDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, response.CodeValidationFailed, err.Error())
+		return
+	}
+
+	account, err := h.acmeAccountService.DeactivateACMEAccount(req.ID)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, account)
+}
+
+// DeleteAccount godoc
+// @Summary Delete ACME account
+// @Description Delete a pending or disabled ACME account that is no longer referenced
+// @Tags acme
+// @Accept json
+// @Produce json
+// @Param request body service.ACMEAccountIDRequest true "Account ID"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/acme/accounts/delete [post]
+func (h *ACMEAccountHandler) DeleteAccount(c *gin.Context) {
+	var req service.ACMEAccountIDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, response.CodeValidationFailed, err.Error())
+		return
+	}
+
+	if err := h.acmeAccountService.DeleteACMEAccount(req.ID); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// handleError maps ACME account service errors to response codes
+func (h *ACMEAccountHandler) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrACMEAccountNotFound):
+		response.NotFoundError(c, err.Error())
+	case errors.Is(err, service.ErrACMEProviderNotFound):
+		response.NotFoundError(c, err.Error())
+	case errors.Is(err, service.ErrACMEAccountInUse):
+		response.Error(c, response.CodeResourceInUse, err.Error())
+	case errors.Is(err, service.ErrACMEAccountNotPending),
+		errors.Is(err, service.ErrACMEAccountNotActive),
+		errors.Is(err, service.ErrACMEAccountStillActive):
+		response.Error(c, response.CodeResourceConflict, err.Error())
+	case errors.Is(err, service.ErrEABRequired),
+		errors.Is(err, service.ErrEABExpired),
+		errors.Is(err, service.ErrACMEProviderInactive),
+		errors.Is(err, service.ErrACMEAccountEmailRequired):
+		response.Error(c, response.CodeValidationInvalid, err.Error())
+	case errors.Is(err, service.ErrACMERegistrationFailed),
+		errors.Is(err, service.ErrACMEKeyRolloverFailed),
+		errors.Is(err, service.ErrACMEDeactivationFailed):
+		response.Error(c, response.CodeACMEError, err.Error())
+	default:
+		response.Error(c, response.CodeSystemError, err.Error())
+	}
+}
@@ -70,6 +70,54 @@ func (h *AgentHandler) GetCertificateByID(c *gin.Context) {
 	response.Success(c, certificate)
 }
 
+// GetCertificateOCSP godoc
+// @Summary Get the OCSP response of a certificate
+// @Description Get the OCSP response fetched by the control plane for stapling. 404 when there is no current response (no OCSP responder, not fetched yet or expired): serve the certificate without stapling
+// @Tags agent
+// @Accept json
+// @Produce json
+// @Param id path int true "Certificate ID"
+// @Success 200 {object} response.Response{data=service.CertificateOCSPStaple}
+// @Failure 404 {object} response.Response
+// @Security mTLS
+// @Router /api/v1/agent/certificates/{id}/ocsp [get]
+func (h *AgentHandler) GetCertificateOCSP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.Error(c, response.CodeValidationFailed, "invalid certificate ID")
+		return
+	}
+
+	staple, err := h.agentService.GetCertificateOCSP(id)
+	if err != nil {
+		response.NotFoundError(c, "OCSP response not found")
+		return
+	}
+
+	response.Success(c, staple)
+}
+
+// GetHTTPChallenge godoc
+// @Summary Get http-01 challenge by token
+// @Description Fast path for nodes asked for /.well-known/acme-challenge/{token} before their acme_http01 task arrived
+// @Tags agent
+// @Accept json
+// @Produce json
+// @Param token path string true "Challenge token"
+// @Success 200 {object} response.Response{data=models.ACMEHTTPChallenge}
+// @Failure 404 {object} response.Response
+// @Security mTLS
+// @Router /api/v1/agent/acme-challenges/{token} [get]
+func (h *AgentHandler) GetHTTPChallenge(c *gin.Context) {
+	challenge, err := h.agentService.GetHTTPChallenge(c.Param("token"))
+	if err != nil {
+		response.NotFoundError(c, "challenge not found")
+		return
+	}
+
+	response.Success(c, challenge)
+}
+
 // GetConfig godoc
 // @Summary Get complete CDN configuration
 // @Description Get all configuration data for the agent node including websites, node groups, and line groups
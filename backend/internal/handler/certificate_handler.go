@@ -1,9 +1,13 @@
 package handler
 
 import (
+"errors"
+"fmt"
+"net/http"
 "strconv"
 
 "github.com/gin-gonic/gin"
+"github.com/labubu-daydayone/go_cmdb_web/backend/internal/middleware"
 "github.com/labubu-daydayone/go_cmdb_web/backend/internal/service"
 "github.com/labubu-daydayone/go_cmdb_web/backend/pkg/response"
 )
@@ -13,10 +17,10 @@ certificateService *service.CertificateService
 acmeService        *service.ACMEService
 }
 
-func NewCertificateHandler() *CertificateHandler {
+func NewCertificateHandler(certificateService *service.CertificateService, acmeService *service.ACMEService) *CertificateHandler {
 return &CertificateHandler{
-certificateService: service.NewCertificateService(),
-acmeService:        service.NewACMEService(),
+certificateService: certificateService,
+acmeService:        acmeService,
 }
 }
 
@@ -91,7 +95,7 @@ response.Success(c, gin.H{
 
 // UploadCertificate godoc
 // @Summary Upload certificate
-// @Description Upload a certificate manually (WF-06)
+// @Description Upload a certificate manually (WF-06), the chain is validated, reordered and optionally completed
 // @Tags certificates
 // @Accept json
 // @Produce json
@@ -110,20 +114,148 @@ return
 
 resp, err := h.certificateService.UploadCertificate(req)
 if err != nil {
-code := response.CodeSystemError
-if err == service.ErrInvalidCertificatePEM || err == service.ErrInvalidPrivateKeyPEM {
-code = response.CodeValidationFailed
-} else if err == service.ErrCertificateExpired {
-code = response.CodeValidationInvalid
+response.Error(c, importErrorCode(err), err.Error())
+return
 }
 
-response.Error(c, code, err.Error())
+response.Success(c, resp)
+}
+
+// ImportPKCS12 godoc
+// @Summary Import PKCS#12 certificate
+// @Description Import the key and certificates of a base64 encoded .pfx/.p12 file, validated like an upload
+// @Tags certificates
+// @Accept json
+// @Produce json
+// @Param request body service.ImportPKCS12Request true "Import PKCS#12 request"
+// @Success 200 {object} response.Response{data=service.UploadCertificateResponse}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/certificates/import-pkcs12 [post]
+func (h *CertificateHandler) ImportPKCS12(c *gin.Context) {
+var req service.ImportPKCS12Request
+if err := c.ShouldBindJSON(&req); err != nil {
+response.Error(c, response.CodeValidationFailed, err.Error())
+return
+}
+
+resp, err := h.certificateService.ImportPKCS12(req)
+if err != nil {
+response.Error(c, importErrorCode(err), err.Error())
 return
 }
 
 response.Success(c, resp)
 }
 
+// ExportCertificate godoc
+// @Summary Export certificate
+// @Description Download a certificate as PEM bundle, PKCS#12 or a zip of separate files. Exporting the private key requires the admin role and is audited
+// @Tags certificates
+// @Accept json
+// @Produce octet-stream
+// @Param request body service.ExportCertificateRequest true "Export certificate request"
+// @Success 200 {file} file
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Security BearerAuth
+// @Router /api/v1/certificates/export [post]
+func (h *CertificateHandler) ExportCertificate(c *gin.Context) {
+var req service.ExportCertificateRequest
+if err := c.ShouldBindJSON(&req); err != nil {
+response.Error(c, response.CodeValidationFailed, err.Error())
+return
+}
+
+if req.IncludesPrivateKey() && middleware.GetRole(c) != "admin" {
+response.Error(c, response.CodeAuthUnauthorized, "exporting the private key requires the admin role")
+return
+}
+
+actor := fmt.Sprintf("user:%d", middleware.GetUserID(c))
+export, err := h.certificateService.ExportCertificate(req, actor, c.ClientIP())
+if err != nil {
+switch {
+case errors.Is(err, service.ErrCertificateNotFound):
+response.NotFoundError(c, "certificate not found")
+case errors.Is(err, service.ErrExportPasswordRequired):
+response.Error(c, response.CodeValidationMissing, err.Error())
+default:
+response.Error(c, response.CodeSystemError, err.Error())
+}
+return
+}
+
+c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", export.Filename))
+c.Data(http.StatusOK, export.ContentType, export.Data)
+}
+
+// ListAuditLogs godoc
+// @Summary List certificate audit logs
+// @Description Private key exports of a certificate, newest first
+// @Tags certificates
+// @Produce json
+// @Param id path int true "Certificate ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(10)
+// @Success 200 {object} response.Response{data=[]models.CertificateAuditLog}
+// @Security BearerAuth
+// @Router /api/v1/certificates/{id}/audit [get]
+func (h *CertificateHandler) ListAuditLogs(c *gin.Context) {
+id, err := strconv.Atoi(c.Param("id"))
+if err != nil {
+response.Error(c, response.CodeValidationFailed, "invalid certificate ID")
+return
+}
+page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+if page < 1 {
+page = 1
+}
+if pageSize < 1 || pageSize > 100 {
+pageSize = 10
+}
+
+logs, total, err := h.certificateService.ListAuditLogs(id, page, pageSize)
+if err != nil {
+response.Error(c, response.CodeSystemError, err.Error())
+return
+}
+
+response.SuccessWithPagination(c, logs, total, page, pageSize)
+}
+
+// importErrorCode maps upload and PKCS#12 import errors to response codes
+func importErrorCode(err error) int {
+switch {
+case errors.Is(err, service.ErrInvalidCertificatePEM), errors.Is(err, service.ErrNoCertificatePEM):
+return response.CodeCertificateInvalidPEM
+case errors.Is(err, service.ErrInvalidPrivateKeyPEM):
+return response.CodePrivateKeyInvalid
+case errors.Is(err, service.ErrCertificateKeyMismatch):
+return response.CodeCertificateKeyMismatch
+case errors.Is(err, service.ErrCertificateExpired), errors.Is(err, service.ErrCertificateNotYetValid):
+return response.CodeCertificateExpired
+case errors.Is(err, service.ErrCertificateChainInvalid):
+return response.CodeCertificateChainInvalid
+case errors.Is(err, service.ErrInvalidPKCS12),
+errors.Is(err, service.ErrPKCS12NoPrivateKey),
+errors.Is(err, service.ErrPKCS12NoCertificate):
+return response.CodePKCS12Invalid
+case errors.Is(err, service.ErrIncorrectPassword):
+return response.CodePasswordIncorrect
+case errors.Is(err, service.ErrPrivateKeyPasswordRequired):
+return response.CodeValidationMissing
+case errors.Is(err, service.ErrCertificateNoDomains):
+return response.CodeValidationInvalid
+case errors.Is(err, service.ErrCertificateAlreadyExists):
+return response.CodeResourceAlreadyExists
+}
+return response.CodeSystemError
+}
+
 // RequestCertificate godoc
 // @Summary Request certificate via ACME
 // @Description Request a certificate via ACME DNS-01 challenge (WF-07)
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/cdn-control-panel/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+type DNSCheckHandler struct {
+	checkService *service.DNSCheckService
+}
+
+func NewDNSCheckHandler(checkService *service.DNSCheckService) *DNSCheckHandler {
+	return &DNSCheckHandler{
+		checkService: checkService,
+	}
+}
+
+// Check godoc
+// @Summary 检查DNS记录一致性
+// @Description 查找所有者已删除的孤儿记录、CNAME与其他记录共存、多个所有者占用同一名称的记录
+// @Tags DNS记录
+// @Produce json
+// @Security BearerAuth
+// @Param domain_id query int false "域名ID（不传则检查所有域名）"
+// @Success 200 {object} response.Response{data=service.DNSCheckReport}
+// @Router /dns/check [get]
+func (h *DNSCheckHandler) Check(c *gin.Context) {
+	domainID, _ := strconv.Atoi(c.Query("domain_id"))
+
+	report, err := h.checkService.Check(domainID)
+	if err != nil {
+		response.Error(c, 1001, "Failed to check DNS records: "+err.Error())
+		return
+	}
+
+	response.Success(c, report)
+}
+
+// Cleanup godoc
+// @Summary 清理孤儿DNS记录
+// @Description 将孤儿记录标记为deleting，由同步任务从DNS提供商删除。CNAME冲突和重复所有者只报告，不会修改
+// @Tags DNS记录
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body object{domain_id=int,dry_run=bool} false "清理请求（不传domain_id则清理所有域名）"
+// @Success 200 {object} response.Response{data=service.DNSCleanupResult}
+// @Router /dns/check/cleanup [post]
+func (h *DNSCheckHandler) Cleanup(c *gin.Context) {
+	var req struct {
+		DomainID int  `json:"domain_id"`
+		DryRun   bool `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 2001, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.checkService.Cleanup(req.DomainID, req.DryRun)
+	if err != nil {
+		response.Error(c, 1001, "Failed to clean up DNS records: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// ListRuns godoc
+// @Summary 获取自动检查记录
+// @Description 返回批量操作（zone文件导入、批量创建记录、执行DNS变更计划）后自动运行的一致性检查结果，最新在前
+// @Tags DNS记录
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} response.Response{data=[]service.DNSCheckRunInfo}
+// @Router /dns/check/runs [get]
+func (h *DNSCheckHandler) ListRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	runs, total, err := h.checkService.ListRuns(page, pageSize)
+	if err != nil {
+		response.Error(c, 1001, "Failed to list DNS check runs: "+err.Error())
+		return
+	}
+
+	response.SuccessWithPagination(c, runs, total, page, pageSize)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/cdn-control-panel/backend/internal/middleware"
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/cdn-control-panel/backend/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+type DNSPlanHandler struct {
+	planService *service.DNSPlanService
+}
+
+func NewDNSPlanHandler(planService *service.DNSPlanService) *DNSPlanHandler {
+	return &DNSPlanHandler{
+		planService: planService,
+	}
+}
+
+// CreatePlan godoc
+// @Summary 创建DNS变更计划
+// @Description 预演节点组、线路组或网站操作，返回将要创建、修改、删除的DNS记录，不做任何修改。计划1小时内可执行
+// @Tags DNS变更计划
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.CreateDNSPlanRequest true "创建计划请求"
+// @Success 200 {object} response.Response{data=service.DNSPlan}
+// @Router /dns/plans/create [post]
+func (h *DNSPlanHandler) CreatePlan(c *gin.Context) {
+	var req service.CreateDNSPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 2001, "Invalid request: "+err.Error())
+		return
+	}
+
+	plan, err := h.planService.CreatePlan(req, middleware.GetUserID(c))
+	if err != nil {
+		planError(c, err, "Failed to create plan")
+		return
+	}
+
+	response.Success(c, plan)
+}
+
+// GetPlan godoc
+// @Summary 获取DNS变更计划
+// @Description 返回计划状态和DNS记录变更
+// @Tags DNS变更计划
+// @Produce json
+// @Security BearerAuth
+// @Param id query string true "计划ID"
+// @Success 200 {object} response.Response{data=service.DNSPlan}
+// @Router /dns/plans [get]
+func (h *DNSPlanHandler) GetPlan(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		response.Error(c, 2001, "Invalid plan ID")
+		return
+	}
+
+	plan, err := h.planService.GetPlan(id)
+	if err != nil {
+		planError(c, err, "Failed to get plan")
+		return
+	}
+
+	response.Success(c, plan)
+}
+
+// ApplyPlan godoc
+// @Summary 执行DNS变更计划
+// @Description 在一个事务中重新执行计划的操作；DNS记录变更与计划不一致时回滚并将计划标记为drifted
+// @Tags DNS变更计划
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body object{id=string} true "执行计划请求"
+// @Success 200 {object} response.Response{data=service.DNSPlan}
+// @Router /dns/plans/apply [post]
+func (h *DNSPlanHandler) ApplyPlan(c *gin.Context) {
+	var req struct {
+		ID string `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 2001, "Invalid request: "+err.Error())
+		return
+	}
+
+	plan, err := h.planService.ApplyPlan(req.ID)
+	if err != nil {
+		planError(c, err, "Failed to apply plan")
+		return
+	}
+
+	response.Success(c, plan)
+}
+
+// planError maps plan service errors to responses
+func planError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrPlanNotFound):
+		response.Error(c, 3001, "Plan not found")
+	case errors.Is(err, service.ErrUnknownPlanOperation),
+		errors.Is(err, service.ErrInvalidPlanRequest):
+		response.Error(c, 2001, err.Error())
+	case isGroupValidationError(err):
+		response.Error(c, 2003, err.Error())
+	case errors.Is(err, service.ErrPlanNotPending),
+		errors.Is(err, service.ErrPlanExpired),
+		errors.Is(err, service.ErrPlanDrifted):
+		response.Error(c, 3004, err.Error())
+	default:
+		response.Error(c, 1001, msg+": "+err.Error())
+	}
+}
@@ -65,6 +65,10 @@ func (h *DNSProviderHandler) CreateProvider(c *gin.Context) {
 			response.Error(c, 3001, "Domain not found: " + err.Error())
 			return
 		}
+		if err == service.ErrProviderCredentialsMissing {
+			response.Error(c, 2001, "Invalid request: " + err.Error())
+			return
+		}
 		response.Error(c, 1001, "Failed to create provider: " + err.Error())
 		return
 	}
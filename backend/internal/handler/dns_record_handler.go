@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/cdn-control-panel/backend/internal/service"
@@ -28,9 +29,9 @@ func NewDNSRecordHandler(recordService *service.DNSRecordService) *DNSRecordHand
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(50)
 // @Param domain_id query int false "域名ID筛选"
-// @Param type query string false "记录类型筛选" Enums(A, AAAA, CNAME, TXT)
-// @Param status query string false "状态筛选" Enums(pending, active, error)
-// @Param owner_type query string false "所有者类型筛选" Enums(node_group, line_group, website_domain, acme_challenge)
+// @Param type query string false "记录类型筛选" Enums(A, AAAA, CNAME, TXT, MX, SRV, CAA, NS, PTR)
+// @Param status query string false "状态筛选" Enums(pending, active, verified, error, deleting)
+// @Param owner_type query string false "所有者类型筛选" Enums(node_group, line_group, website_domain, acme_challenge, manual)
 // @Param owner_id query int false "所有者ID筛选"
 // @Success 200 {object} response.Response{data=object}
 // @Router /dns/records [get]
@@ -89,6 +90,15 @@ func (h *DNSRecordHandler) CreateRecord(c *gin.Context) {
 			response.Error(c, 3002, "DNS record already exists: " + err.Error())
 			return
 		}
+		if errors.Is(err, service.ErrInvalidRecordType) || errors.Is(err, service.ErrRecordTypeNotAllowed) ||
+			errors.Is(err, service.ErrInvalidRecordValue) {
+			response.Error(c, 2003, "Invalid record: " + err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrNameInSubzone) {
+			response.Error(c, 2004, err.Error())
+			return
+		}
 		if err == service.ErrDomainNotFound {
 			response.Error(c, 3001, "Domain not found: " + err.Error())
 			return
@@ -126,6 +136,14 @@ func (h *DNSRecordHandler) UpdateRecord(c *gin.Context) {
 			response.Error(c, 3001, "DNS record not found: " + err.Error())
 			return
 		}
+		if err == service.ErrDNSRecordDeleting {
+			response.Error(c, 3004, "DNS record is being deleted: " + err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrInvalidRecordValue) {
+			response.Error(c, 2003, "Invalid record: " + err.Error())
+			return
+		}
 		response.Error(c, 1001, "Failed to update record: " + err.Error())
 		return
 	}
@@ -135,7 +153,7 @@ func (h *DNSRecordHandler) UpdateRecord(c *gin.Context) {
 
 // DeleteRecord godoc
 // @Summary 删除DNS记录
-// @Description 删除DNS记录
+// @Description 删除DNS记录（设置status=deleting，由同步任务从DNS提供商删除后再移除）
 // @Tags DNS记录
 // @Accept json
 // @Produce json
@@ -165,6 +183,30 @@ func (h *DNSRecordHandler) DeleteRecord(c *gin.Context) {
 	response.Success(c, nil)
 }
 
+// ListStuckDeletions godoc
+// @Summary 获取删除失败的DNS记录
+// @Description 获取status=deleting且多次从DNS提供商删除失败的记录
+// @Tags DNS记录
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(50)
+// @Success 200 {object} response.Response{data=object}
+// @Router /dns/records/stuck-deletions [get]
+func (h *DNSRecordHandler) ListStuckDeletions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	records, total, err := h.recordService.ListStuckDeletions(page, pageSize)
+	if err != nil {
+		response.Error(c, 1001, "Failed to list stuck deletions: " + err.Error())
+		return
+	}
+
+	response.SuccessWithPagination(c, records, total, page, pageSize)
+}
+
 // TriggerSync godoc
 // @Summary 手动触发DNS同步
 // @Description 手动触发DNS记录同步到Cloudflare
@@ -1,20 +1,30 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
 
+	"github.com/cdn-control-panel/backend/internal/middleware"
 	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/cdn-control-panel/backend/internal/utils"
 	"github.com/cdn-control-panel/backend/pkg/response"
+	"github.com/cdn-control-panel/backend/pkg/secretbox"
 	"github.com/gin-gonic/gin"
 )
 
 type DomainHandler struct {
-	domainService *service.DomainService
+	domainService   *service.DomainService
+	zoneFileService *service.ZoneFileService
+	dnssecService   *service.DNSSECService
 }
 
-func NewDomainHandler(domainService *service.DomainService) *DomainHandler {
+func NewDomainHandler(domainService *service.DomainService, zoneFileService *service.ZoneFileService, dnssecService *service.DNSSECService) *DomainHandler {
 	return &DomainHandler{
-		domainService: domainService,
+		domainService:   domainService,
+		zoneFileService: zoneFileService,
+		dnssecService:   dnssecService,
 	}
 }
 
@@ -76,6 +86,14 @@ func (h *DomainHandler) CreateDomain(c *gin.Context) {
 			response.Error(c, 3002, "Domain already exists: " + err.Error())
 			return
 		}
+		if err == service.ErrProviderCredentialsMissing {
+			response.Error(c, 2001, "Invalid request: " + err.Error())
+			return
+		}
+		if errors.Is(err, utils.ErrInvalidDomainName) || errors.Is(err, service.ErrZoneIsPublicSuffix) {
+			response.Error(c, 2003, err.Error())
+			return
+		}
 		response.Error(c, 1001, "Failed to create domain: " + err.Error())
 		return
 	}
@@ -83,6 +101,29 @@ func (h *DomainHandler) CreateDomain(c *gin.Context) {
 	response.Success(c, domain)
 }
 
+// SuggestZone godoc
+// @Summary 查找域名所属Zone
+// @Description 返回包含该名称的最具体的已托管Zone（子Zone优先于父Zone）；没有时根据公共后缀列表建议应添加的可注册域名
+// @Tags 域名管理
+// @Produce json
+// @Security BearerAuth
+// @Param name query string true "域名，如 www.example.com.cn"
+// @Success 200 {object} response.Response{data=service.ZoneSuggestion}
+// @Router /domains/suggest [get]
+func (h *DomainHandler) SuggestZone(c *gin.Context) {
+	suggestion, err := h.domainService.SuggestZone(c.Query("name"))
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidDomainName) {
+			response.Error(c, 2003, err.Error())
+			return
+		}
+		response.Error(c, 1001, "Failed to find zone: " + err.Error())
+		return
+	}
+
+	response.Success(c, suggestion)
+}
+
 // UpdateDomain godoc
 // @Summary 更新域名
 // @Description 更新DNS Zone配置
@@ -151,3 +192,241 @@ func (h *DomainHandler) DeleteDomain(c *gin.Context) {
 
 	response.Success(c, nil)
 }
+
+// ExportZoneFile godoc
+// @Summary 导出Zone文件
+// @Description 将域名下的所有DNS记录导出为RFC 1035格式的BIND zone文件
+// @Tags 域名管理
+// @Produce plain
+// @Security BearerAuth
+// @Param id path int true "域名ID"
+// @Success 200 {string} string "zone文件内容"
+// @Router /domains/{id}/zonefile [get]
+func (h *DomainHandler) ExportZoneFile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.Error(c, 2001, "Invalid domain ID")
+		return
+	}
+
+	domain, err := h.domainService.GetDomain(id)
+	if err != nil {
+		if err == service.ErrDomainNotFound {
+			response.Error(c, 3001, "Domain not found: "+err.Error())
+			return
+		}
+		response.Error(c, 1001, "Failed to get domain: "+err.Error())
+		return
+	}
+
+	content, err := h.zoneFileService.ExportZoneFile(id)
+	if err != nil {
+		response.Error(c, 1001, "Failed to export zone file: "+err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zone", domain.Domain))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(content))
+}
+
+// ImportZoneFile godoc
+// @Summary 导入Zone文件
+// @Description 解析BIND zone文件并与现有记录对比，缺失的记录以pending状态创建（owner_type=manual）。dry_run=true时仅返回差异，不写入数据库
+// @Tags 域名管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body object{domain_id=int,content=string,dry_run=bool} true "导入Zone文件请求"
+// @Success 200 {object} response.Response{data=service.ZoneFileImportResult}
+// @Router /domains/zonefile/import [post]
+func (h *DomainHandler) ImportZoneFile(c *gin.Context) {
+	var req struct {
+		DomainID int    `json:"domain_id" binding:"required"`
+		Content  string `json:"content" binding:"required"`
+		DryRun   bool   `json:"dry_run"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 2001, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.zoneFileService.ImportZoneFile(req.DomainID, req.Content, req.DryRun)
+	if err != nil {
+		if err == service.ErrDomainNotFound {
+			response.Error(c, 3001, "Domain not found: "+err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrInvalidZoneFile) {
+			response.Error(c, 2003, err.Error())
+			return
+		}
+		response.Error(c, 1001, "Failed to import zone file: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetDNSSEC godoc
+// @Summary 获取域名DNSSEC状态
+// @Description 返回DNSSEC状态、需提交给注册商的DS记录，以及内置DNS签名密钥
+// @Tags 域名管理
+// @Produce json
+// @Security BearerAuth
+// @Param domain_id query int true "域名ID"
+// @Success 200 {object} response.Response{data=service.DNSSECInfo}
+// @Router /domains/dnssec [get]
+func (h *DomainHandler) GetDNSSEC(c *gin.Context) {
+	domainID, err := strconv.Atoi(c.Query("domain_id"))
+	if err != nil || domainID <= 0 {
+		response.Error(c, 2001, "Invalid domain ID")
+		return
+	}
+
+	info, err := h.dnssecService.GetDNSSEC(domainID)
+	if err != nil {
+		dnssecError(c, err, "Failed to get DNSSEC")
+		return
+	}
+
+	response.Success(c, info)
+}
+
+// EnableDNSSEC godoc
+// @Summary 启用DNSSEC
+// @Description 在DNS提供商处启用DNSSEC（目前支持Cloudflare）；内置DNS生成KSK/ZSK并签名，需要配置主密钥。DS记录在父域生效后状态变为active
+// @Tags 域名管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body object{domain_id=int} true "启用DNSSEC请求"
+// @Success 200 {object} response.Response{data=service.DNSSECInfo}
+// @Router /domains/dnssec/enable [post]
+func (h *DomainHandler) EnableDNSSEC(c *gin.Context) {
+	var req struct {
+		DomainID int `json:"domain_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 2001, "Invalid request: "+err.Error())
+		return
+	}
+
+	info, err := h.dnssecService.EnableDNSSEC(req.DomainID, dnssecActor(c))
+	if err != nil {
+		dnssecError(c, err, "Failed to enable DNSSEC")
+		return
+	}
+
+	response.Success(c, info)
+}
+
+// DisableDNSSEC godoc
+// @Summary 停用DNSSEC
+// @Description 停用DNSSEC。内置DNS在父域DS记录删除前保持签名（状态disabling），之后删除密钥
+// @Tags 域名管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body object{domain_id=int} true "停用DNSSEC请求"
+// @Success 200 {object} response.Response{data=service.DNSSECInfo}
+// @Router /domains/dnssec/disable [post]
+func (h *DomainHandler) DisableDNSSEC(c *gin.Context) {
+	var req struct {
+		DomainID int `json:"domain_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 2001, "Invalid request: "+err.Error())
+		return
+	}
+
+	info, err := h.dnssecService.DisableDNSSEC(req.DomainID, dnssecActor(c))
+	if err != nil {
+		dnssecError(c, err, "Failed to disable DNSSEC")
+		return
+	}
+
+	response.Success(c, info)
+}
+
+// RolloverDNSSECKey godoc
+// @Summary 轮换DNSSEC密钥
+// @Description 立即开始内置DNS的KSK或ZSK轮换（ZSK也会按周期自动轮换）。KSK轮换需在注册商处添加新的DS记录
+// @Tags 域名管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body object{domain_id=int,role=string} true "密钥轮换请求（role: ksk, zsk）"
+// @Success 200 {object} response.Response{data=service.DNSSECInfo}
+// @Router /domains/dnssec/rollover [post]
+func (h *DomainHandler) RolloverDNSSECKey(c *gin.Context) {
+	var req struct {
+		DomainID int    `json:"domain_id" binding:"required"`
+		Role     string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 2001, "Invalid request: "+err.Error())
+		return
+	}
+
+	info, err := h.dnssecService.StartRollover(req.DomainID, req.Role, dnssecActor(c))
+	if err != nil {
+		dnssecError(c, err, "Failed to start key rollover")
+		return
+	}
+
+	response.Success(c, info)
+}
+
+// ListDNSSECAuditLogs godoc
+// @Summary 获取DNSSEC审计日志
+// @Description 返回DNSSEC启用/停用、状态变化和密钥轮换记录，按时间倒序
+// @Tags 域名管理
+// @Produce json
+// @Security BearerAuth
+// @Param domain_id query int true "域名ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} response.Response{data=object}
+// @Router /domains/dnssec/audit [get]
+func (h *DomainHandler) ListDNSSECAuditLogs(c *gin.Context) {
+	domainID, err := strconv.Atoi(c.Query("domain_id"))
+	if err != nil || domainID <= 0 {
+		response.Error(c, 2001, "Invalid domain ID")
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	logs, total, err := h.dnssecService.ListAuditLogs(domainID, page, pageSize)
+	if err != nil {
+		response.Error(c, 1001, "Failed to list DNSSEC audit logs: "+err.Error())
+		return
+	}
+
+	response.SuccessWithPagination(c, logs, total, page, pageSize)
+}
+
+// dnssecActor identifies the user in DNSSEC audit logs
+func dnssecActor(c *gin.Context) string {
+	return fmt.Sprintf("user:%d", middleware.GetUserID(c))
+}
+
+// dnssecError maps DNSSEC service errors to responses
+func dnssecError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrDomainNotFound):
+		response.Error(c, 3001, "Domain not found: "+err.Error())
+	case errors.Is(err, service.ErrDNSSECNotSupported),
+		errors.Is(err, service.ErrDNSSECNotEnabled),
+		errors.Is(err, service.ErrRolloverInProgress),
+		errors.Is(err, service.ErrInvalidKeyRole),
+		errors.Is(err, secretbox.ErrNoKey):
+		response.Error(c, 2003, err.Error())
+	default:
+		response.Error(c, 1001, msg+": "+err.Error())
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/cdn-control-panel/backend/internal/service"
@@ -9,14 +10,16 @@ import (
 )
 
 type GroupHandler struct {
-	nodeGroupService *service.NodeGroupService
-	lineGroupService *service.LineGroupService
+	nodeGroupService  *service.NodeGroupService
+	lineGroupService  *service.LineGroupService
+	nodeHealthService *service.NodeHealthService
 }
 
-func NewGroupHandler(nodeGroupService *service.NodeGroupService, lineGroupService *service.LineGroupService) *GroupHandler {
+func NewGroupHandler(nodeGroupService *service.NodeGroupService, lineGroupService *service.LineGroupService, nodeHealthService *service.NodeHealthService) *GroupHandler {
 	return &GroupHandler{
-		nodeGroupService: nodeGroupService,
-		lineGroupService: lineGroupService,
+		nodeGroupService:  nodeGroupService,
+		lineGroupService:  lineGroupService,
+		nodeHealthService: nodeHealthService,
 	}
 }
 
@@ -49,6 +52,10 @@ func (h *GroupHandler) CreateNodeGroup(c *gin.Context) {
 
 	nodeGroup, err := h.nodeGroupService.CreateNodeGroup(req)
 	if err != nil {
+		if isGroupValidationError(err) {
+			response.ValidationError(c, err.Error())
+			return
+		}
 		response.SystemError(c, "Failed to create node group")
 		return
 	}
@@ -56,6 +63,23 @@ func (h *GroupHandler) CreateNodeGroup(c *gin.Context) {
 	response.Success(c, nodeGroup)
 }
 
+// GetNodeGroupHealth handles GET /api/v1/node-groups/health?id=
+func (h *GroupHandler) GetNodeGroupHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil || id <= 0 {
+		response.ValidationError(c, "Invalid node group ID")
+		return
+	}
+
+	health, err := h.nodeHealthService.GetNodeGroupHealth(id)
+	if err != nil {
+		response.NotFoundError(c, "Node group not found")
+		return
+	}
+
+	response.Success(c, health)
+}
+
 // DeleteNodeGroup handles POST /api/v1/node-groups/delete
 func (h *GroupHandler) DeleteNodeGroup(c *gin.Context) {
 	var req struct {
@@ -103,6 +127,10 @@ func (h *GroupHandler) CreateLineGroup(c *gin.Context) {
 
 	lineGroup, err := h.lineGroupService.CreateLineGroup(req)
 	if err != nil {
+		if isGroupValidationError(err) {
+			response.ValidationError(c, err.Error())
+			return
+		}
 		response.SystemError(c, "Failed to create line group")
 		return
 	}
@@ -131,10 +159,12 @@ func (h *GroupHandler) DeleteLineGroup(c *gin.Context) {
 // UpdateNodeGroup handles POST /api/v1/node-groups/update
 func (h *GroupHandler) UpdateNodeGroup(c *gin.Context) {
 	var req struct {
-		ID          int                                `json:"id" binding:"required"`
-		Name        *string                            `json:"name"`
-		Description *string                            `json:"description"`
-		SubIPIDs    []int                              `json:"sub_ip_ids"`
+		ID            int                        `json:"id" binding:"required"`
+		Name          *string                    `json:"name"`
+		Description   *string                    `json:"description"`
+		SubIPIDs      []int                      `json:"sub_ip_ids"`
+		AddressFamily *string                    `json:"address_family"`
+		HealthCheck   *service.HealthCheckConfig `json:"health_check"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.ValidationError(c, "Invalid request parameters")
@@ -142,13 +172,19 @@ func (h *GroupHandler) UpdateNodeGroup(c *gin.Context) {
 	}
 
 	updateReq := service.UpdateNodeGroupRequest{
-		Name:        req.Name,
-		Description: req.Description,
-		SubIPIDs:    req.SubIPIDs,
+		Name:          req.Name,
+		Description:   req.Description,
+		SubIPIDs:      req.SubIPIDs,
+		AddressFamily: req.AddressFamily,
+		HealthCheck:   req.HealthCheck,
 	}
 
 	nodeGroup, err := h.nodeGroupService.UpdateNodeGroup(req.ID, updateReq)
 	if err != nil {
+		if isGroupValidationError(err) {
+			response.ValidationError(c, err.Error())
+			return
+		}
 		response.SystemError(c, "Failed to update node group")
 		return
 	}
@@ -159,9 +195,13 @@ func (h *GroupHandler) UpdateNodeGroup(c *gin.Context) {
 // UpdateLineGroup handles POST /api/v1/line-groups/update
 func (h *GroupHandler) UpdateLineGroup(c *gin.Context) {
 	var req struct {
-		ID          int     `json:"id" binding:"required"`
-		Name        *string `json:"name"`
-		NodeGroupID *int    `json:"node_group_id"`
+		ID                int                               `json:"id" binding:"required"`
+		Name              *string                           `json:"name"`
+		NodeGroupID       *int                              `json:"node_group_id"`
+		AddressFamily     *string                           `json:"address_family"`
+		Routes            *[]service.LineGroupRouteRequest  `json:"routes"`
+		Members           *[]service.LineGroupMemberRequest `json:"members"`
+		FailoverThreshold *int                              `json:"failover_threshold"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.ValidationError(c, "Invalid request parameters")
@@ -169,15 +209,59 @@ func (h *GroupHandler) UpdateLineGroup(c *gin.Context) {
 	}
 
 	updateReq := service.UpdateLineGroupRequest{
-		Name:        req.Name,
-		NodeGroupID: req.NodeGroupID,
+		Name:              req.Name,
+		NodeGroupID:       req.NodeGroupID,
+		AddressFamily:     req.AddressFamily,
+		Routes:            req.Routes,
+		Members:           req.Members,
+		FailoverThreshold: req.FailoverThreshold,
 	}
 
 	lineGroup, err := h.lineGroupService.UpdateLineGroup(req.ID, updateReq)
 	if err != nil {
+		if isGroupValidationError(err) {
+			response.ValidationError(c, err.Error())
+			return
+		}
 		response.SystemError(c, "Failed to update line group")
 		return
 	}
 
 	response.Success(c, lineGroup)
 }
+
+// ListLineGroupEvents handles GET /api/v1/line-groups/events?id=
+func (h *GroupHandler) ListLineGroupEvents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil || id <= 0 {
+		response.ValidationError(c, "Invalid line group ID")
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	events, total, err := h.lineGroupService.ListLineGroupEvents(id, page, pageSize)
+	if err != nil {
+		response.DatabaseError(c, "Failed to list line group events")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"items":     events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// isGroupValidationError reports errors caused by invalid group settings
+func isGroupValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidHealthCheck) ||
+		errors.Is(err, service.ErrInvalidAddressFamily) ||
+		errors.Is(err, service.ErrAddressFamilyMismatch) ||
+		errors.Is(err, service.ErrInvalidView) ||
+		errors.Is(err, service.ErrDuplicateView) ||
+		errors.Is(err, service.ErrViewNotSupported) ||
+		errors.Is(err, service.ErrInvalidMembers) ||
+		errors.Is(err, service.ErrInvalidFailoverThreshold)
+}
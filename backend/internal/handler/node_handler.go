@@ -168,6 +168,10 @@ func (h *NodeHandler) AddSubIP(c *gin.Context) {
 			response.Error(c, 3001, "Node not found: "+err.Error())
 			return
 		}
+		if err == service.ErrInvalidSubIP {
+			response.Error(c, 2003, err.Error())
+			return
+		}
 		response.Error(c, 1001, "Failed to add sub IP: "+err.Error())
 		return
 	}
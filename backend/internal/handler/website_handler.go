@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/labubu-daydayone/go_cmdb_web/backend/internal/service"
+	"github.com/labubu-daydayone/go_cmdb_web/backend/internal/utils"
 	"github.com/labubu-daydayone/go_cmdb_web/backend/pkg/response"
 )
 
@@ -12,9 +14,9 @@ type WebsiteHandler struct {
 websiteService *service.WebsiteService
 }
 
-func NewWebsiteHandler() *WebsiteHandler {
+func NewWebsiteHandler(websiteService *service.WebsiteService) *WebsiteHandler {
 return &WebsiteHandler{
-websiteService: service.NewWebsiteService(),
+websiteService: websiteService,
 }
 }
 
@@ -124,6 +126,12 @@ return
 			code = 2003
 		} else if err == service.ErrNoPrimaryDomain {
 			code = 2004
+		} else if errors.Is(err, utils.ErrInvalidDomainName) {
+			code = 2003
+		} else if errors.Is(err, service.ErrNoZoneForFQDN) {
+			code = 2004
+		} else if err == service.ErrACMEAccountRequired {
+			code = 2002
 		}
 
 		response.Error(c, code, err.Error())
@@ -163,6 +171,10 @@ if err != nil {
 if err == service.ErrWebsiteNotFound {
 	response.NotFoundError(c, "website not found")
 return
+}
+if err == service.ErrACMEAccountRequired {
+	response.Error(c, response.CodeValidationMissing, err.Error())
+return
 }
 	response.Error(c, response.CodeSystemError, err.Error())
 return
@@ -171,6 +183,72 @@ return
 	response.Success(c, nil)
 }
 
+// GetHTTPSStatus godoc
+// @Summary Get website HTTPS provisioning status
+// @Description Get the certificate provisioning state of a website in cert_mode=acme with error details
+// @Tags websites
+// @Produce json
+// @Param id path int true "Website ID"
+// @Success 200 {object} Response{data=service.HTTPSProvisioning}
+// @Failure 404 {object} Response
+// @Security BearerAuth
+// @Router /api/v1/websites/{id}/https-status [get]
+func (h *WebsiteHandler) GetHTTPSStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.Error(c, response.CodeValidationFailed, "invalid website ID")
+		return
+	}
+
+	provisioning, err := h.websiteService.GetHTTPSProvisioning(id)
+	if err != nil {
+		if err == service.ErrWebsiteNotFound {
+			response.NotFoundError(c, "website not found")
+			return
+		}
+		response.Error(c, response.CodeSystemError, err.Error())
+		return
+	}
+
+	response.Success(c, provisioning)
+}
+
+// ProvisionHTTPS godoc
+// @Summary Retry website certificate provisioning
+// @Description Queue the certificate of a website in cert_mode=acme again
+// @Tags websites
+// @Accept json
+// @Produce json
+// @Param request body map[string]int true "Website ID"
+// @Success 200 {object} Response
+// @Failure 404 {object} Response
+// @Security BearerAuth
+// @Router /api/v1/websites/https/provision [post]
+func (h *WebsiteHandler) ProvisionHTTPS(c *gin.Context) {
+	var req struct {
+		WebsiteID int `json:"website_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, response.CodeValidationFailed, err.Error())
+		return
+	}
+
+	if err := h.websiteService.RetryHTTPSProvisioning(req.WebsiteID); err != nil {
+		if err == service.ErrWebsiteNotFound {
+			response.NotFoundError(c, "website not found")
+			return
+		}
+		if err == service.ErrNotACMEMode {
+			response.Error(c, response.CodeResourceConflict, err.Error())
+			return
+		}
+		response.Error(c, response.CodeSystemError, err.Error())
+		return
+	}
+
+	response.Success(c, nil)
+}
+
 // DeleteWebsite godoc
 // @Summary Delete website
 // @Description Delete a website and all related data
@@ -250,6 +328,10 @@ if err == service.ErrWebsiteNotFound {
 code = 3001
 } else if err == service.ErrDomainAlreadyExists {
 code = 3002
+} else if errors.Is(err, utils.ErrInvalidDomainName) {
+code = 2003
+} else if errors.Is(err, service.ErrNoZoneForFQDN) {
+code = 2004
 }
 
 response.Error(c, code, err.Error())
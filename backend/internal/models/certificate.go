@@ -22,18 +22,20 @@ func (ACMEProvider) TableName() string {
 
 // ACMEAccount represents the acme_accounts table
 type ACMEAccount struct {
-	ID              int        `gorm:"primaryKey;autoIncrement" json:"id"`
-	ProviderID      int        `gorm:"not null;index" json:"provider_id"`
-	Email           string     `gorm:"type:varchar(255);not null" json:"email"`
-	AccountKeyPEM   string     `gorm:"type:longtext;not null" json:"-"`
-	RegistrationURI *string    `gorm:"type:varchar(255)" json:"registration_uri"`
-	Status          string     `gorm:"type:enum('pending','active','disabled');not null;default:pending" json:"status"`
-	LastError       *string    `gorm:"type:varchar(255)" json:"last_error"`
-	EABKid          *string    `gorm:"type:varchar(255)" json:"eab_kid"`
-	EABHmacKey      *string    `gorm:"type:varchar(255)" json:"-"`
-	EABExpiresAt    *time.Time `json:"eab_expires_at"`
-	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                int              `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProviderID        int              `gorm:"not null;index" json:"provider_id"`
+	Email             string           `gorm:"type:varchar(255);not null" json:"email"`
+	AccountKeyPEM     EncryptedString  `gorm:"type:longtext;not null" json:"-"`
+	NextAccountKeyPEM *EncryptedString `gorm:"type:longtext" json:"-"` // Key of a rollover the provider may have accepted, stored before asking it
+	RegistrationURI   *string          `gorm:"type:varchar(255)" json:"registration_uri"`
+	Status            string           `gorm:"type:enum('pending','active','disabled');not null;default:pending" json:"status"`
+	LastError         *string          `gorm:"type:varchar(255)" json:"last_error"`
+	EABKid            *string          `gorm:"type:varchar(255)" json:"eab_kid"`
+	EABHmacKey        *EncryptedString `gorm:"type:varchar(1024)" json:"-"`
+	EABExpiresAt      *time.Time       `json:"eab_expires_at"`
+	DefaultKeyType    string           `gorm:"type:enum('rsa2048','rsa3072','rsa4096','ec256','ec384');not null;default:rsa2048" json:"default_key_type"` // Key type of certificates requested without one
+	CreatedAt         time.Time        `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time        `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	Provider *ACMEProvider `gorm:"foreignKey:ProviderID" json:"provider,omitempty"`
@@ -50,11 +52,14 @@ type CertificateRequest struct {
 	ACMEAccountID       int        `gorm:"not null;index" json:"acme_account_id"`
 	DomainsJSON         string     `gorm:"type:json;not null" json:"domains_json"`
 	Status              string     `gorm:"type:enum('pending','running','success','failed');not null;default:pending" json:"status"`
+	ChallengeType       string     `gorm:"type:enum('dns-01','http-01');not null;default:'dns-01'" json:"challenge_type"`
+	KeyType             string     `gorm:"type:enum('rsa2048','rsa3072','rsa4096','ec256','ec384');not null;default:rsa2048" json:"key_type"`
 	PollIntervalSec     int        `gorm:"not null;default:40" json:"poll_interval_sec"`
 	PollMaxAttempts     int        `gorm:"not null;default:10" json:"poll_max_attempts"`
 	Attempts            int        `gorm:"not null;default:0" json:"attempts"`
 	LastError           *string    `gorm:"type:varchar(255)" json:"last_error"`
 	ResultCertificateID *int       `gorm:"index" json:"result_certificate_id"`
+	RenewCertificateID  *int       `gorm:"index" json:"renew_certificate_id"` // Certificate replaced by the result (renewals)
 	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt           time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 
@@ -68,24 +73,49 @@ func (CertificateRequest) TableName() string {
 	return "certificate_requests"
 }
 
+// ACMEHTTPChallenge represents the acme_http_challenges table: an http-01
+// token served by the edge nodes of a website domain at
+// /.well-known/acme-challenge/<token>
+type ACMEHTTPChallenge struct {
+	ID               int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	RequestID        int       `gorm:"not null;index" json:"request_id"`
+	Domain           string    `gorm:"type:varchar(255);not null" json:"domain"`
+	Token            string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"token"`
+	KeyAuthorization string    `gorm:"type:varchar(512);not null" json:"key_authorization"`
+	Status           string    `gorm:"type:enum('pending','ready','failed');not null;default:pending" json:"status"` // ready = all nodes confirmed
+	Nodes            int       `gorm:"not null;default:0" json:"nodes"`                                              // Nodes the token was pushed to
+	LastError        *string   `gorm:"type:varchar(255)" json:"last_error"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (ACMEHTTPChallenge) TableName() string {
+	return "acme_http_challenges"
+}
+
 // Certificate represents the certificates table
 // NOTE: R14 - certificates table MUST NOT store domain/san fields
 type Certificate struct {
-	ID             int        `gorm:"primaryKey;autoIncrement" json:"id"`
-	Provider       string     `gorm:"type:enum('letsencrypt','google_publicca','manual');not null" json:"provider"`
-	Source         string     `gorm:"type:enum('acme','manual');not null" json:"source"`
-	ACMEAccountID  *int       `gorm:"index" json:"acme_account_id"`
-	Status         string     `gorm:"type:enum('valid','expiring','expired','revoked');not null;default:valid" json:"status"`
-	IssueAt        *time.Time `json:"issue_at"`
-	ExpireAt       *time.Time `json:"expire_at"`
-	Fingerprint    string     `gorm:"type:varchar(128);not null;uniqueIndex" json:"fingerprint"`
-	CertificatePEM string     `gorm:"type:longtext;not null" json:"certificate_pem"`
-	PrivateKeyPEM  string     `gorm:"type:longtext;not null" json:"-"`
-	RenewMode      string     `gorm:"type:enum('auto','manual');not null;default:manual" json:"renew_mode"`
-	RenewAt        *time.Time `json:"renew_at"`
-	LastError      *string    `gorm:"type:varchar(255)" json:"last_error"`
-	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	ID             int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	Provider       string          `gorm:"type:enum('letsencrypt','google_publicca','zerossl','manual');not null" json:"provider"`
+	Source         string          `gorm:"type:enum('acme','manual');not null" json:"source"`
+	ACMEAccountID  *int            `gorm:"index" json:"acme_account_id"`
+	Status         string          `gorm:"type:enum('valid','expiring','expired','revoked');not null;default:valid" json:"status"`
+	IssueAt        *time.Time      `json:"issue_at"`
+	ExpireAt       *time.Time      `json:"expire_at"`
+	Fingerprint    string          `gorm:"type:varchar(128);not null;uniqueIndex" json:"fingerprint"`
+	KeyType        string          `gorm:"type:varchar(16);not null;default:''" json:"key_type"` // rsa2048, ec256, ... of the certificate key
+	CertificatePEM string          `gorm:"type:longtext;not null" json:"certificate_pem"`
+	PrivateKeyPEM  EncryptedString `gorm:"type:longtext;not null" json:"-"`
+	RenewMode      string          `gorm:"type:enum('auto','manual');not null;default:manual" json:"renew_mode"`
+	RenewAt        *time.Time      `json:"renew_at"`
+	RenewAttempts  int             `gorm:"not null;default:0" json:"renew_attempts"` // Failed renewals since the last success
+	NextRenewAt    *time.Time      `json:"next_renew_at"`                            // Backoff after a failed renewal
+	ReplacedByID   *int            `gorm:"index" json:"replaced_by_id"`              // Renewed certificate that took over the bindings
+	LastError      *string         `gorm:"type:varchar(255)" json:"last_error"`
+	CreatedAt      time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	ACMEAccount *ACMEAccount `gorm:"foreignKey:ACMEAccountID" json:"acme_account,omitempty"`
@@ -96,6 +126,23 @@ func (Certificate) TableName() string {
 	return "certificates"
 }
 
+// CertificateAuditLog represents the certificate_audit_logs table: every
+// export that contains a private key
+type CertificateAuditLog struct {
+	ID            int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CertificateID int       `gorm:"not null;index" json:"certificate_id"`
+	Action        string    `gorm:"type:varchar(32);not null" json:"action"`
+	Actor         string    `gorm:"type:varchar(64);not null" json:"actor"` // user:<id>
+	ClientIP      string    `gorm:"type:varchar(64);not null;default:''" json:"client_ip"`
+	Detail        string    `gorm:"type:varchar(1024);not null" json:"detail"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (CertificateAuditLog) TableName() string {
+	return "certificate_audit_logs"
+}
+
 // CertificateDomain represents the certificate_domains table
 // R15: This is the ONLY place to store certificate covered domains
 type CertificateDomain struct {
@@ -133,3 +180,28 @@ type CertificateBinding struct {
 func (CertificateBinding) TableName() string {
 	return "certificate_bindings"
 }
+
+// CertificateOCSPResponse represents the certificate_ocsp_responses table:
+// the OCSP response the edges staple for a certificate in use, fetched by the
+// control plane and refreshed at refresh_at
+type CertificateOCSPResponse struct {
+	ID            int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	CertificateID int        `gorm:"not null;uniqueIndex" json:"certificate_id"`
+	ResponderURL  string     `gorm:"type:varchar(255);not null;default:''" json:"responder_url"`
+	Status        string     `gorm:"type:enum('none','good','revoked','unknown');not null;default:none" json:"status"` // none = no response fetched yet
+	Response      []byte     `gorm:"type:blob" json:"-"`                                                               // DER encoded
+	ProducedAt    *time.Time `json:"produced_at"`
+	ThisUpdate    *time.Time `json:"this_update"`
+	NextUpdate    *time.Time `json:"next_update"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RefreshAt     time.Time  `gorm:"not null;index" json:"refresh_at"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"` // Failed fetches since the last success
+	LastError     *string    `gorm:"type:varchar(255)" json:"last_error"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (CertificateOCSPResponse) TableName() string {
+	return "certificate_ocsp_responses"
+}
@@ -2,16 +2,20 @@ package models
 
 import (
 	"time"
+
+	"github.com/cdn-control-panel/backend/internal/utils"
+	"gorm.io/gorm"
 )
 
 // Domain represents the domains table (DNS zone)
 type Domain struct {
-	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	Domain    string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"domain"`
-	Purpose   string    `gorm:"type:enum('cdn','general');not null;default:cdn" json:"purpose"`
-	Status    string    `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID            int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Domain        string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"domain"`
+	DomainUnicode string    `gorm:"-" json:"domain_unicode"`
+	Purpose       string    `gorm:"type:enum('cdn','general');not null;default:cdn" json:"purpose"`
+	Status        string    `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 // TableName specifies the table name
@@ -19,11 +23,23 @@ func (Domain) TableName() string {
 	return "domains"
 }
 
+// AfterFind fills DomainUnicode, the display form of the punycode zone name
+func (d *Domain) AfterFind(tx *gorm.DB) error {
+	d.DomainUnicode = utils.ToUnicode(d.Domain)
+	return nil
+}
+
+// AfterSave fills DomainUnicode after create and update
+func (d *Domain) AfterSave(tx *gorm.DB) error {
+	d.DomainUnicode = utils.ToUnicode(d.Domain)
+	return nil
+}
+
 // DomainDNSProvider represents the domain_dns_providers table (zone -> provider mapping)
 type DomainDNSProvider struct {
 	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
 	DomainID       int       `gorm:"not null;uniqueIndex" json:"domain_id"`
-	Provider       string    `gorm:"type:enum('cloudflare','aliyun','tencent','route53','manual');not null" json:"provider"`
+	Provider       string    `gorm:"type:enum('cloudflare','aliyun','tencent','route53','manual','builtin');not null" json:"provider"`
 	ProviderZoneID string    `gorm:"type:varchar(128);not null" json:"provider_zone_id"`
 	APIKeyID       int       `gorm:"not null" json:"api_key_id"`
 	Status         string    `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
@@ -44,17 +60,26 @@ func (DomainDNSProvider) TableName() string {
 type DomainDNSRecord struct {
 	ID               int        `gorm:"primaryKey;autoIncrement" json:"id"`
 	DomainID         int        `gorm:"not null;index" json:"domain_id"`
-	Type             string     `gorm:"type:enum('A','AAAA','CNAME','TXT');not null" json:"type"`
+	Type             string     `gorm:"type:enum('A','AAAA','CNAME','TXT','MX','SRV','CAA','NS','PTR');not null" json:"type"`
 	Name             string     `gorm:"type:varchar(255);not null" json:"name"`
 	Value            string     `gorm:"type:varchar(2048);not null" json:"value"`
 	TTL              int        `gorm:"not null;default:120" json:"ttl"`
 	Proxied          bool       `gorm:"type:tinyint(1);not null;default:0" json:"proxied"`
-	Status           string     `gorm:"type:enum('pending','active','error');not null;default:pending" json:"status"`
+	Priority         *int       `json:"priority"` // MX, SRV
+	Weight           *int       `json:"weight"`   // SRV; weighted records of line groups
+	Port             *int       `json:"port"`     // SRV
+	CAAFlags         *int       `json:"caa_flags"`
+	CAATag           *string    `gorm:"type:varchar(32)" json:"caa_tag"`
+	Line             string     `gorm:"type:varchar(64);not null;default:''" json:"line"` // Resolver view, "" = not view-specific
+	Status           string     `gorm:"type:enum('pending','active','verified','error','deleting');not null;default:pending" json:"status"`
 	ProviderRecordID *string    `gorm:"type:varchar(128)" json:"provider_record_id"`
+	CreateTimedOut   bool       `gorm:"type:tinyint(1);not null;default:0" json:"create_timed_out"` // A create timed out: the provider may hold the record without its ID stored
 	LastError        *string    `gorm:"type:varchar(255)" json:"last_error"`
 	RetryCount       int        `gorm:"not null;default:0" json:"retry_count"`
 	NextRetryAt      *time.Time `json:"next_retry_at"`
-	OwnerType        string     `gorm:"type:enum('node_group','line_group','website_domain','acme_challenge');not null" json:"owner_type"`
+	SyncedAt         *time.Time `json:"synced_at"`   // Provider API accepted the record (status=active)
+	VerifiedAt       *time.Time `json:"verified_at"` // All authoritative nameservers serve the record (status=verified)
+	OwnerType        string     `gorm:"type:enum('node_group','line_group','website_domain','acme_challenge','manual');not null" json:"owner_type"`
 	OwnerID          int        `gorm:"not null;index" json:"owner_id"`
 	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
@@ -67,3 +92,118 @@ type DomainDNSRecord struct {
 func (DomainDNSRecord) TableName() string {
 	return "domain_dns_records"
 }
+
+// DomainDNSSEC represents the domain_dnssec table: DNSSEC state of a zone.
+// Provider-signed zones mirror the provider's status; builtin zones are
+// signed by dns-serve with the keys in dnssec_keys.
+type DomainDNSSEC struct {
+	ID        int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	DomainID  int        `gorm:"not null;uniqueIndex" json:"domain_id"`
+	Status    string     `gorm:"type:enum('disabled','pending','active','disabling','error');not null;default:disabled" json:"status"`
+	DSRecords string     `gorm:"type:text;not null" json:"ds_records"` // DS records for the registrar, one per line
+	LastError *string    `gorm:"type:varchar(255)" json:"last_error"`
+	CheckedAt *time.Time `json:"checked_at"` // Last status fetch from the provider
+
+	// Builtin signing: ZSKs are rolled every ZSKLifetimeDays
+	ZSKLifetimeDays int        `gorm:"not null;default:90" json:"zsk_lifetime_days"`
+	NextRolloverAt  *time.Time `json:"next_rollover_at"`
+	SignedAt        *time.Time `json:"signed_at"` // Last signature refresh (config version bump)
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relations
+	Domain *Domain `gorm:"foreignKey:DomainID" json:"domain,omitempty"`
+}
+
+// TableName specifies the table name
+func (DomainDNSSEC) TableName() string {
+	return "domain_dnssec"
+}
+
+// DNSSECKey represents the dnssec_keys table: signing keys of builtin zones.
+// Published keys are in the DNSKEY set but do not sign yet, retired keys
+// stay published until RemoveAt.
+type DNSSECKey struct {
+	ID          int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	DomainID    int        `gorm:"not null;index" json:"domain_id"`
+	Role        string     `gorm:"type:enum('ksk','zsk');not null" json:"role"`
+	Algorithm   int        `gorm:"not null" json:"algorithm"`
+	KeyTag      int        `gorm:"not null" json:"key_tag"`
+	PublicKey   string     `gorm:"type:text;not null" json:"public_key"` // DNSKEY record
+	PrivateKey  string     `gorm:"type:text;not null" json:"-"`          // Encrypted with the master key
+	Status      string     `gorm:"type:enum('published','active','retired');not null;default:published" json:"status"`
+	ActivatedAt *time.Time `json:"activated_at"`
+	RetiredAt   *time.Time `json:"retired_at"`
+	RemoveAt    *time.Time `json:"remove_at"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (DNSSECKey) TableName() string {
+	return "dnssec_keys"
+}
+
+// DNSSECAuditLog represents the dnssec_audit_logs table: every DNSSEC state
+// and key change, by user or scheduler
+type DNSSECAuditLog struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	DomainID  int       `gorm:"not null;index" json:"domain_id"`
+	Action    string    `gorm:"type:varchar(32);not null" json:"action"`
+	KeyTag    *int      `json:"key_tag"`
+	Actor     string    `gorm:"type:varchar(64);not null" json:"actor"` // user:<id> or scheduler
+	Detail    string    `gorm:"type:varchar(1024);not null" json:"detail"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (DNSSECAuditLog) TableName() string {
+	return "dnssec_audit_logs"
+}
+
+// DNSChangePlan represents the dns_change_plans table: a previewed node
+// group, line group or website change and the domain_dns_records changes it
+// makes. Applying the plan re-runs the operation and fails when the record
+// changes differ from the preview.
+type DNSChangePlan struct {
+	ID          string     `gorm:"type:varchar(32);primaryKey" json:"id"`
+	Operation   string     `gorm:"type:varchar(32);not null" json:"operation"`    // e.g. node_group.create
+	TargetID    int        `gorm:"not null;default:0" json:"target_id"`           // Node group, line group or website of update/delete operations
+	Request     string     `gorm:"type:text;not null" json:"-"`                   // JSON request of the operation
+	CNAMEPrefix string     `gorm:"type:varchar(32);not null;default:''" json:"-"` // Pinned for node/line group creates
+	Changes     string     `gorm:"type:mediumtext;not null" json:"-"`             // JSON record changes
+	Creates     int        `gorm:"not null;default:0" json:"creates"`
+	Updates     int        `gorm:"not null;default:0" json:"updates"`
+	Deletes     int        `gorm:"not null;default:0" json:"deletes"`
+	Status      string     `gorm:"type:enum('pending','applied','drifted','expired');not null;default:pending" json:"status"`
+	CreatedBy   int        `gorm:"not null;default:0" json:"created_by"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	AppliedAt   *time.Time `json:"applied_at"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (DNSChangePlan) TableName() string {
+	return "dns_change_plans"
+}
+
+// DNSCheckRun represents the dns_check_runs table: a DNS record consistency
+// check run automatically after a bulk operation
+type DNSCheckRun struct {
+	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Source     string    `gorm:"type:varchar(32);not null" json:"source"`   // Bulk operation, e.g. zonefile_import
+	DomainID   int       `gorm:"not null;default:0;index" json:"domain_id"` // 0 = all zones
+	Records    int       `gorm:"not null;default:0" json:"records"`
+	Orphans    int       `gorm:"not null;default:0" json:"orphans"`
+	Conflicts  int       `gorm:"not null;default:0" json:"conflicts"`
+	Duplicates int       `gorm:"not null;default:0" json:"duplicates"`
+	Report     string    `gorm:"type:mediumtext;not null" json:"-"` // JSON issues
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (DNSCheckRun) TableName() string {
+	return "dns_check_runs"
+}
@@ -41,15 +41,29 @@ func (NodeSubIP) TableName() string {
 
 // NodeGroup represents the node_groups table
 type NodeGroup struct {
-	ID           int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name         string    `gorm:"type:varchar(128);not null;uniqueIndex" json:"name"`
-	Description  *string   `gorm:"type:varchar(255)" json:"description"`
-	DomainID     int       `gorm:"not null;index" json:"domain_id"`
-	CNAMEPrefix  string    `gorm:"type:varchar(128);not null;uniqueIndex" json:"cname_prefix"`
-	CNAME        string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"cname"`
-	Status       string    `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
-	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID          int     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string  `gorm:"type:varchar(128);not null;uniqueIndex" json:"name"`
+	Description *string `gorm:"type:varchar(255)" json:"description"`
+	DomainID    int     `gorm:"not null;index" json:"domain_id"`
+	CNAMEPrefix string  `gorm:"type:varchar(128);not null;uniqueIndex" json:"cname_prefix"`
+	CNAME       string  `gorm:"type:varchar(255);not null;uniqueIndex" json:"cname"`
+	Status      string  `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
+
+	// Address families published for member sub IPs: A records (ipv4),
+	// AAAA records (ipv6) or both (dual)
+	AddressFamily string `gorm:"type:enum('ipv4','ipv6','dual');not null;default:dual" json:"address_family"`
+
+	// Health check of member sub IPs; unhealthy members have their A/AAAA records
+	// withdrawn, but never below MinHealthy records per group
+	HealthCheckType   string `gorm:"type:enum('none','tcp','http','https');not null;default:none" json:"health_check_type"`
+	HealthCheckPort   int    `gorm:"not null;default:0" json:"health_check_port"` // 0 = node agent port (443 for https)
+	HealthCheckPath   string `gorm:"type:varchar(255);not null;default:'/'" json:"health_check_path"`
+	FailureThreshold  int    `gorm:"not null;default:3" json:"failure_threshold"`
+	RecoveryThreshold int    `gorm:"not null;default:2" json:"recovery_threshold"`
+	MinHealthy        int    `gorm:"not null;default:1" json:"min_healthy"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	Domain *Domain `gorm:"foreignKey:DomainID" json:"domain,omitempty"`
@@ -62,11 +76,20 @@ func (NodeGroup) TableName() string {
 
 // NodeGroupSubIP represents the node_group_sub_ips table
 type NodeGroupSubIP struct {
-	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	NodeGroupID int       `gorm:"not null;index" json:"node_group_id"`
-	SubIPID     int       `gorm:"not null;index" json:"sub_ip_id"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID          int `gorm:"primaryKey;autoIncrement" json:"id"`
+	NodeGroupID int `gorm:"not null;index" json:"node_group_id"`
+	SubIPID     int `gorm:"not null;index" json:"sub_ip_id"`
+
+	// Health state of the sub IP within this group
+	HealthStatus         string     `gorm:"type:enum('unknown','healthy','unhealthy');not null;default:unknown" json:"health_status"`
+	ConsecutiveFailures  int        `gorm:"not null;default:0" json:"consecutive_failures"`
+	ConsecutiveSuccesses int        `gorm:"not null;default:0" json:"consecutive_successes"`
+	LastCheckedAt        *time.Time `json:"last_checked_at"`
+	LastHealthError      *string    `gorm:"type:text" json:"last_health_error"`
+	Withdrawn            bool       `gorm:"type:tinyint(1);not null;default:0" json:"withdrawn"` // A/AAAA record removed from DNS
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	NodeGroup *NodeGroup `gorm:"foreignKey:NodeGroupID" json:"node_group,omitempty"`
@@ -80,22 +103,93 @@ func (NodeGroupSubIP) TableName() string {
 
 // LineGroup represents the line_groups table
 type LineGroup struct {
+	ID          int    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string `gorm:"type:varchar(128);not null;uniqueIndex" json:"name"`
+	DomainID    int    `gorm:"not null;index" json:"domain_id"`
+	NodeGroupID int    `gorm:"not null;index" json:"node_group_id"` // Default route (first primary member when members are set)
+	CNAMEPrefix string `gorm:"type:varchar(128);not null;uniqueIndex" json:"cname_prefix"`
+	CNAME       string `gorm:"type:varchar(255);not null;uniqueIndex" json:"cname"`
+	Status      string `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
+
+	// Address families the line may resolve to; the node group must not
+	// publish any other family
+	AddressFamily string `gorm:"type:enum('ipv4','ipv6','dual');not null;default:dual" json:"address_family"`
+
+	// Failover of the default route: a primary member node group whose share
+	// of healthy sub IPs drops below FailoverThreshold percent stops serving;
+	// backups serve while no primary is healthy
+	FailoverThreshold int  `gorm:"not null;default:50" json:"failover_threshold"`
+	FailedOver        bool `gorm:"type:tinyint(1);not null;default:0" json:"failed_over"` // Backups are serving
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relations
+	Domain    *Domain           `gorm:"foreignKey:DomainID" json:"domain,omitempty"`
+	NodeGroup *NodeGroup        `gorm:"foreignKey:NodeGroupID" json:"node_group,omitempty"`
+	Routes    []LineGroupRoute  `gorm:"foreignKey:LineGroupID" json:"routes,omitempty"`
+	Members   []LineGroupMember `gorm:"foreignKey:LineGroupID" json:"members,omitempty"`
+}
+
+// TableName specifies the table name
+func (LineGroup) TableName() string {
+	return "line_groups"
+}
+
+// LineGroupRoute represents the line_group_routes table: resolvers of a view
+// (ISP or region) are sent to a node group instead of the line group's
+// default node group
+type LineGroupRoute struct {
 	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name        string    `gorm:"type:varchar(128);not null;uniqueIndex" json:"name"`
-	DomainID    int       `gorm:"not null;index" json:"domain_id"`
+	LineGroupID int       `gorm:"not null;uniqueIndex:idx_line_group_routes_view" json:"line_group_id"`
+	View        string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_line_group_routes_view" json:"view"`
 	NodeGroupID int       `gorm:"not null;index" json:"node_group_id"`
-	CNAMEPrefix string    `gorm:"type:varchar(128);not null;uniqueIndex" json:"cname_prefix"`
-	CNAME       string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"cname"`
-	Status      string    `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
-	Domain    *Domain    `gorm:"foreignKey:DomainID" json:"domain,omitempty"`
 	NodeGroup *NodeGroup `gorm:"foreignKey:NodeGroupID" json:"node_group,omitempty"`
 }
 
 // TableName specifies the table name
-func (LineGroup) TableName() string {
-	return "line_groups"
+func (LineGroupRoute) TableName() string {
+	return "line_group_routes"
+}
+
+// LineGroupMember represents the line_group_members table: one of several
+// weighted node groups behind the default route of a line group. Without
+// members the line group resolves to its NodeGroupID alone.
+type LineGroupMember struct {
+	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	LineGroupID int       `gorm:"not null;uniqueIndex:idx_line_group_members_node_group" json:"line_group_id"`
+	NodeGroupID int       `gorm:"not null;uniqueIndex:idx_line_group_members_node_group;index" json:"node_group_id"`
+	Role        string    `gorm:"type:enum('primary','backup');not null;default:primary" json:"role"`
+	Weight      int       `gorm:"not null;default:1" json:"weight"`                 // 1-100, relative to the other serving members
+	Active      bool      `gorm:"type:tinyint(1);not null;default:0" json:"active"` // Currently published
+	Health      int       `gorm:"not null;default:100" json:"health"`               // Healthy sub IPs of the node group, in percent
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relations
+	NodeGroup *NodeGroup `gorm:"foreignKey:NodeGroupID" json:"node_group,omitempty"`
+}
+
+// TableName specifies the table name
+func (LineGroupMember) TableName() string {
+	return "line_group_members"
+}
+
+// LineGroupEvent represents the line_group_events table: the history of
+// member changes and failovers of a line group
+type LineGroupEvent struct {
+	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	LineGroupID int       `gorm:"not null;index" json:"line_group_id"`
+	Event       string    `gorm:"type:enum('members','failover','failback','rebalance');not null" json:"event"`
+	Detail      string    `gorm:"type:varchar(1024);not null" json:"detail"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name
+func (LineGroupEvent) TableName() string {
+	return "line_group_events"
 }
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/cdn-control-panel/backend/pkg/secretbox"
+)
+
+// secretBox seals EncryptedString columns, nil stores them unencrypted
+var secretBox atomic.Pointer[secretbox.Box]
+
+// SetSecretBox sets the master key box used for EncryptedString columns
+func SetSecretBox(box *secretbox.Box) {
+	secretBox.Store(box)
+}
+
+// redacted replaces secrets in JSON
+const redacted = "******"
+
+// EncryptedString is a string column sealed with the master key at rest.
+// Values are encrypted when written and decrypted when read, plaintext
+// written before a master key was configured is still read (and sealed by
+// rotate-master-key). It is never serialized to JSON.
+type EncryptedString string
+
+// Value seals the string for the database
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	box := secretBox.Load()
+	if box == nil {
+		return string(s), nil
+	}
+	return box.Seal([]byte(s))
+}
+
+// Scan opens a sealed value read from the database
+func (s *EncryptedString) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case EncryptedString:
+		*s = v
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T for an encrypted column", value)
+	}
+
+	if !secretbox.IsSealed(raw) {
+		*s = EncryptedString(raw)
+		return nil
+	}
+	box := secretBox.Load()
+	if box == nil {
+		return secretbox.ErrNoKey
+	}
+	plaintext, err := box.Open(raw)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// MarshalJSON redacts the secret
+func (s EncryptedString) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte(`""`), nil
+	}
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// String returns the plaintext
+func (s EncryptedString) String() string {
+	return string(s)
+}
+
+// EncryptedColumn is a table column holding EncryptedString values (or
+// values sealed by the services), re-sealed by rotate-master-key
+type EncryptedColumn struct {
+	Table  string
+	Column string
+}
+
+// EncryptedColumns lists every column sealed with the master key
+var EncryptedColumns = []EncryptedColumn{
+	{Table: "certificates", Column: "private_key_pem"},
+	{Table: "acme_accounts", Column: "account_key_pem"},
+	{Table: "acme_accounts", Column: "next_account_key_pem"},
+	{Table: "acme_accounts", Column: "eab_hmac_key"},
+	{Table: "api_keys", Column: "api_token"},
+	{Table: "dnssec_keys", Column: "private_key"},
+}
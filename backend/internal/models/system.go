@@ -8,7 +8,7 @@ import (
 type AgentTask struct {
 	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
 	NodeID    int       `gorm:"not null;index" json:"node_id"`
-	Type      string    `gorm:"type:enum('purge_cache','apply_config','reload');not null" json:"type"`
+	Type      string    `gorm:"type:enum('purge_cache','apply_config','reload','acme_http01','acme_http01_cleanup');not null" json:"type"`
 	Payload   string    `gorm:"type:json;not null" json:"payload"`
 	Status    string    `gorm:"type:enum('pending','running','success','failed');not null;default:pending" json:"status"`
 	LastError *string   `gorm:"type:varchar(255)" json:"last_error"`
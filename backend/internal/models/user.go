@@ -22,14 +22,14 @@ func (User) TableName() string {
 
 // APIKey represents the api_keys table
 type APIKey struct {
-	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name      string    `gorm:"type:varchar(128);not null" json:"name"`
-	Provider  string    `gorm:"type:enum('cloudflare');not null" json:"provider"`
-	Account   *string   `gorm:"type:varchar(255)" json:"account"`
-	APIToken  string    `gorm:"type:varchar(255);not null" json:"api_token"`
-	Status    string    `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID        int             `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string          `gorm:"type:varchar(128);not null" json:"name"`
+	Provider  string          `gorm:"type:enum('cloudflare','aliyun','tencent','route53');not null" json:"provider"`
+	Account   *string         `gorm:"type:varchar(255)" json:"account"`             // Access key ID / SecretId (aliyun, tencent, route53)
+	APIToken  EncryptedString `gorm:"type:varchar(1024);not null" json:"api_token"` // API token (cloudflare) or secret key, redacted in JSON
+	Status    string          `gorm:"type:enum('active','inactive');not null;default:active" json:"status"`
+	CreatedAt time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 // TableName specifies the table name
@@ -2,6 +2,9 @@ package models
 
 import (
 	"time"
+
+	"github.com/cdn-control-panel/backend/internal/utils"
+	"gorm.io/gorm"
 )
 
 // Website represents the websites table
@@ -32,13 +35,14 @@ func (Website) TableName() string {
 
 // WebsiteDomain represents the website_domains table
 type WebsiteDomain struct {
-	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	WebsiteID int       `gorm:"not null;index" json:"website_id"`
-	Domain    string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"domain"`
-	IsPrimary bool      `gorm:"type:tinyint(1);not null;default:0" json:"is_primary"`
-	CNAME     *string   `gorm:"type:varchar(255)" json:"cname"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID            int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	WebsiteID     int       `gorm:"not null;index" json:"website_id"`
+	Domain        string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"domain"`
+	DomainUnicode string    `gorm:"-" json:"domain_unicode"`
+	IsPrimary     bool      `gorm:"type:tinyint(1);not null;default:0" json:"is_primary"`
+	CNAME         *string   `gorm:"type:varchar(255)" json:"cname"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	Website *Website `gorm:"foreignKey:WebsiteID" json:"website,omitempty"`
@@ -49,19 +53,36 @@ func (WebsiteDomain) TableName() string {
 	return "website_domains"
 }
 
+// AfterFind fills DomainUnicode, the display form of the punycode domain
+func (d *WebsiteDomain) AfterFind(tx *gorm.DB) error {
+	d.DomainUnicode = utils.ToUnicode(d.Domain)
+	return nil
+}
+
+// AfterSave fills DomainUnicode after create and update
+func (d *WebsiteDomain) AfterSave(tx *gorm.DB) error {
+	d.DomainUnicode = utils.ToUnicode(d.Domain)
+	return nil
+}
+
 // WebsiteHTTPS represents the website_https table
 type WebsiteHTTPS struct {
-	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	WebsiteID      int       `gorm:"not null;uniqueIndex" json:"website_id"`
-	Enabled        bool      `gorm:"type:tinyint(1);not null;default:0" json:"enabled"`
-	ForceRedirect  bool      `gorm:"type:tinyint(1);not null;default:0" json:"force_redirect"`
-	HSTS           bool      `gorm:"type:tinyint(1);not null;default:0" json:"hsts"`
-	CertMode       string    `gorm:"type:enum('select','acme');not null;default:select" json:"cert_mode"`
-	CertificateID  *int      `gorm:"index" json:"certificate_id"`
-	ACMEProviderID *int      `gorm:"index" json:"acme_provider_id"`
-	ACMEAccountID  *int      `gorm:"index" json:"acme_account_id"`
-	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                 int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	WebsiteID          int       `gorm:"not null;uniqueIndex" json:"website_id"`
+	Enabled            bool      `gorm:"type:tinyint(1);not null;default:0" json:"enabled"`
+	ForceRedirect      bool      `gorm:"type:tinyint(1);not null;default:0" json:"force_redirect"`
+	HSTS               bool      `gorm:"type:tinyint(1);not null;default:0" json:"hsts"`
+	CertMode           string    `gorm:"type:enum('select','acme');not null;default:select" json:"cert_mode"`
+	CertificateID      *int      `gorm:"index" json:"certificate_id"`
+	DualCert           bool      `gorm:"type:tinyint(1);not null;default:0" json:"dual_cert"` // Issue an ECDSA and an RSA certificate (cert_mode=acme)
+	RSACertificateID   *int      `gorm:"index" json:"rsa_certificate_id"`                     // RSA certificate next to the ECDSA certificate_id when dual_cert
+	ACMEProviderID     *int      `gorm:"index" json:"acme_provider_id"`
+	ACMEAccountID      *int      `gorm:"index" json:"acme_account_id"`
+	ProvisionStatus    string    `gorm:"type:enum('none','pending','issuing','active','failed');not null;default:none" json:"provision_status"`
+	ProvisionError     *string   `gorm:"type:varchar(255)" json:"provision_error"`
+	ProvisionRequestID *int      `gorm:"index" json:"provision_request_id"`
+	CreatedAt          time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt          time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
 	// Relations
 	Website      *Website      `gorm:"foreignKey:WebsiteID" json:"website,omitempty"`
@@ -0,0 +1,636 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+	"github.com/go-jose/go-jose/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrACMEProviderNotFound     = errors.New("acme provider not found")
+	ErrACMEProviderInactive     = errors.New("acme provider is inactive")
+	ErrEABRequired              = errors.New("acme provider requires external account binding (eab_kid and eab_hmac_key)")
+	ErrEABExpired               = errors.New("external account binding has expired")
+	ErrACMEAccountNotPending    = errors.New("acme account is already registered")
+	ErrACMEAccountNotActive     = errors.New("acme account is not active")
+	ErrACMEAccountInUse         = errors.New("acme account is referenced by certificates or websites")
+	ErrACMEAccountStillActive   = errors.New("acme account must be deactivated before it is deleted")
+	ErrACMERegistrationFailed   = errors.New("acme registration failed")
+	ErrACMEKeyRolloverFailed    = errors.New("acme key rollover failed")
+	ErrACMEDeactivationFailed   = errors.New("acme deactivation failed")
+	ErrACMEAccountEmailRequired = errors.New("acme account email is required")
+)
+
+// acmeHTTPTimeout bounds the requests sent to ACME directories outside lego
+const acmeHTTPTimeout = 30 * time.Second
+
+// ACMEAccountService manages ACME accounts: local key generation and the
+// account lifecycle at the provider (registration, contact update, key
+// rollover and deactivation)
+type ACMEAccountService struct{}
+
+// NewACMEAccountService creates a new ACME account service
+func NewACMEAccountService() *ACMEAccountService {
+	return &ACMEAccountService{}
+}
+
+// CreateACMEAccountRequest represents the request to create an ACME account.
+// EABKid and EABHmacKey (base64url, as handed out by the CA) are required for
+// providers with requires_eab.
+type CreateACMEAccountRequest struct {
+	ProviderID     int        `json:"provider_id" binding:"required"`
+	Email          string     `json:"email" binding:"required,email"`
+	EABKid         *string    `json:"eab_kid"`
+	EABHmacKey     *string    `json:"eab_hmac_key"`
+	EABExpiresAt   *time.Time `json:"eab_expires_at"`
+	DefaultKeyType string     `json:"default_key_type" binding:"omitempty,oneof=rsa2048 rsa3072 rsa4096 ec256 ec384"`
+}
+
+// UpdateACMEAccountRequest represents the request to update an ACME account.
+// The email of an active account is also updated at the provider; the EAB
+// credentials can only be changed before the account is registered. The
+// default key type applies to certificates requested without a key type.
+type UpdateACMEAccountRequest struct {
+	ID             int        `json:"id" binding:"required"`
+	Email          *string    `json:"email" binding:"omitempty,email"`
+	EABKid         *string    `json:"eab_kid"`
+	EABHmacKey     *string    `json:"eab_hmac_key"`
+	EABExpiresAt   *time.Time `json:"eab_expires_at"`
+	DefaultKeyType *string    `json:"default_key_type" binding:"omitempty,oneof=rsa2048 rsa3072 rsa4096 ec256 ec384"`
+}
+
+// ACMEAccountIDRequest represents a request that only targets an account
+type ACMEAccountIDRequest struct {
+	ID int `json:"id" binding:"required"`
+}
+
+// ListACMEProviders returns all ACME providers
+func (s *ACMEAccountService) ListACMEProviders() ([]models.ACMEProvider, error) {
+	var providers []models.ACMEProvider
+	if err := database.DB.Order("id ASC").Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+// ListACMEAccounts returns ACME accounts with pagination
+func (s *ACMEAccountService) ListACMEAccounts(page, pageSize, providerID int, status string) ([]models.ACMEAccount, int64, error) {
+	var accounts []models.ACMEAccount
+	var total int64
+
+	query := database.DB.Model(&models.ACMEAccount{})
+	if providerID > 0 {
+		query = query.Where("provider_id = ?", providerID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Preload("Provider").Order("id DESC").Offset(offset).Limit(pageSize).Find(&accounts).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return accounts, total, nil
+}
+
+// GetACMEAccount returns an ACME account with its provider
+func (s *ACMEAccountService) GetACMEAccount(id int) (*models.ACMEAccount, error) {
+	var account models.ACMEAccount
+	if err := database.DB.Preload("Provider").First(&account, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrACMEAccountNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateACMEAccount generates the account key, stores the account as pending
+// and registers it with the provider directory. When registration fails the
+// account stays pending with last_error set and can be registered again with
+// RegisterACMEAccount.
+func (s *ACMEAccountService) CreateACMEAccount(req CreateACMEAccountRequest) (*models.ACMEAccount, error) {
+	var provider models.ACMEProvider
+	if err := database.DB.First(&provider, req.ProviderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrACMEProviderNotFound
+		}
+		return nil, err
+	}
+	if provider.Status != "active" {
+		return nil, ErrACMEProviderInactive
+	}
+	if provider.RequiresEAB && (isBlank(req.EABKid) || isBlank(req.EABHmacKey)) {
+		return nil, ErrEABRequired
+	}
+
+	keyPEM, err := generateAccountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultKeyType := req.DefaultKeyType
+	if defaultKeyType == "" {
+		defaultKeyType = KeyTypeRSA2048
+	}
+
+	account := models.ACMEAccount{
+		ProviderID:     provider.ID,
+		Email:          req.Email,
+		AccountKeyPEM:  models.EncryptedString(keyPEM),
+		Status:         "pending",
+		EABKid:         req.EABKid,
+		EABHmacKey:     (*models.EncryptedString)(req.EABHmacKey),
+		EABExpiresAt:   req.EABExpiresAt,
+		DefaultKeyType: defaultKeyType,
+	}
+	if err := database.DB.Create(&account).Error; err != nil {
+		return nil, fmt.Errorf("failed to create acme account: %w", err)
+	}
+	account.Provider = &provider
+
+	if err := s.register(&account); err != nil {
+		return &account, err
+	}
+	return &account, nil
+}
+
+// RegisterACMEAccount retries the registration of a pending account
+func (s *ACMEAccountService) RegisterACMEAccount(id int) (*models.ACMEAccount, error) {
+	account, err := s.GetACMEAccount(id)
+	if err != nil {
+		return nil, err
+	}
+	if account.Status != "pending" {
+		return nil, ErrACMEAccountNotPending
+	}
+	if account.Provider.RequiresEAB && (isBlank(account.EABKid) || isBlank((*string)(account.EABHmacKey))) {
+		return nil, ErrEABRequired
+	}
+
+	if err := s.register(account); err != nil {
+		return account, err
+	}
+	return account, nil
+}
+
+// UpdateACMEAccount updates the contact email and, for pending accounts, the
+// EAB credentials
+func (s *ACMEAccountService) UpdateACMEAccount(req UpdateACMEAccountRequest) (*models.ACMEAccount, error) {
+	account, err := s.GetACMEAccount(req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.EABKid != nil || req.EABHmacKey != nil || req.EABExpiresAt != nil {
+		if account.Status != "pending" {
+			return nil, ErrACMEAccountNotPending
+		}
+		if req.EABKid != nil {
+			updates["eab_kid"] = *req.EABKid
+		}
+		if req.EABHmacKey != nil {
+			updates["eab_hmac_key"] = models.EncryptedString(*req.EABHmacKey)
+		}
+		if req.EABExpiresAt != nil {
+			updates["eab_expires_at"] = *req.EABExpiresAt
+		}
+	}
+
+	if req.DefaultKeyType != nil {
+		updates["default_key_type"] = *req.DefaultKeyType
+	}
+
+	if req.Email != nil && *req.Email != account.Email {
+		if *req.Email == "" {
+			return nil, ErrACMEAccountEmailRequired
+		}
+		if account.Status == "active" {
+			// Update the contact at the provider first so both sides agree
+			client, user, err := newLegoClient(account)
+			if err != nil {
+				return nil, err
+			}
+			user.Email = *req.Email
+			if _, err := client.Registration.UpdateRegistration(registration.RegisterOptions{TermsOfServiceAgreed: true}); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrACMERegistrationFailed, err)
+			}
+		}
+		updates["email"] = *req.Email
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(account).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update acme account: %w", err)
+		}
+	}
+
+	return s.GetACMEAccount(account.ID)
+}
+
+// RolloverACMEAccountKey replaces the key of an active account (RFC 8555
+// section 7.3.5). The new key is stored as next_account_key_pem before the
+// provider is asked to switch and swapped in once it accepted, so the key
+// the provider holds is never lost. A rollover interrupted after the
+// provider accepted is completed by the next call.
+func (s *ACMEAccountService) RolloverACMEAccountKey(id int) (*models.ACMEAccount, error) {
+	account, err := s.GetACMEAccount(id)
+	if err != nil {
+		return nil, err
+	}
+	if account.Status != "active" || account.RegistrationURI == nil {
+		return nil, ErrACMEAccountNotActive
+	}
+	if account.Provider == nil {
+		return nil, ErrACMEProviderNotFound
+	}
+
+	oldKey, err := parseAccountKey(string(account.AccountKeyPEM))
+	if err != nil {
+		return nil, err
+	}
+
+	resuming := account.NextAccountKeyPEM != nil
+	var newKeyPEM string
+	if resuming {
+		newKeyPEM = account.NextAccountKeyPEM.String()
+	} else {
+		if newKeyPEM, err = generateAccountKey(); err != nil {
+			return nil, err
+		}
+		if err := database.DB.Model(account).Update("next_account_key_pem", models.EncryptedString(newKeyPEM)).Error; err != nil {
+			return nil, fmt.Errorf("failed to store the new account key: %w", err)
+		}
+	}
+	newKey, err := parseAccountKey(newKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider may already hold the stored key of an interrupted rollover
+	if !resuming || !accountUsesKey(account, newKeyPEM) {
+		if err := rolloverAccountKey(account.Provider.DirectoryURL, *account.RegistrationURI, oldKey, newKey); err != nil {
+			s.setLastError(account, err)
+			return nil, fmt.Errorf("%w: %v", ErrACMEKeyRolloverFailed, err)
+		}
+	}
+
+	if err := database.DB.Model(account).Updates(map[string]interface{}{
+		"account_key_pem":      models.EncryptedString(newKeyPEM),
+		"next_account_key_pem": nil,
+		"last_error":           nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("key rolled over at the provider but failed to swap it in, roll over again to complete: %w", err)
+	}
+
+	return s.GetACMEAccount(account.ID)
+}
+
+// accountUsesKey reports whether the provider resolves keyPEM to the account
+func accountUsesKey(account *models.ACMEAccount, keyPEM string) bool {
+	probe := *account
+	probe.AccountKeyPEM = models.EncryptedString(keyPEM)
+	client, _, err := newLegoClient(&probe)
+	if err != nil {
+		return false
+	}
+	resource, err := client.Registration.ResolveAccountByKey()
+	return err == nil && resource.URI == *account.RegistrationURI
+}
+
+// DeactivateACMEAccount deactivates an active account at the provider and
+// disables it. Deactivation is permanent, the provider rejects every further
+// request signed with the account key.
+func (s *ACMEAccountService) DeactivateACMEAccount(id int) (*models.ACMEAccount, error) {
+	account, err := s.GetACMEAccount(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.Status == "active" && account.RegistrationURI != nil {
+		client, _, err := newLegoClient(account)
+		if err != nil {
+			return nil, err
+		}
+		if err := client.Registration.DeleteRegistration(); err != nil {
+			s.setLastError(account, err)
+			return nil, fmt.Errorf("%w: %v", ErrACMEDeactivationFailed, err)
+		}
+	}
+
+	if err := database.DB.Model(account).Updates(map[string]interface{}{
+		"status":     "disabled",
+		"last_error": nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to disable acme account: %w", err)
+	}
+
+	return s.GetACMEAccount(account.ID)
+}
+
+// DeleteACMEAccount deletes a pending or disabled account that is no longer
+// referenced by certificates, certificate requests or websites
+func (s *ACMEAccountService) DeleteACMEAccount(id int) error {
+	account, err := s.GetACMEAccount(id)
+	if err != nil {
+		return err
+	}
+	if account.Status == "active" {
+		return ErrACMEAccountStillActive
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.Certificate{}, &models.CertificateRequest{}, &models.WebsiteHTTPS{}} {
+			var count int64
+			if err := tx.Model(model).Where("acme_account_id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrACMEAccountInUse
+			}
+		}
+		return tx.Delete(&models.ACMEAccount{}, id).Error
+	})
+}
+
+// register registers a pending account with its provider, binding it to the
+// external account when EAB credentials are set, and activates it
+func (s *ACMEAccountService) register(account *models.ACMEAccount) error {
+	if account.EABExpiresAt != nil && account.EABExpiresAt.Before(time.Now()) {
+		s.setLastError(account, ErrEABExpired)
+		return ErrEABExpired
+	}
+
+	client, _, err := newLegoClient(account)
+	if err != nil {
+		s.setLastError(account, err)
+		return err
+	}
+
+	var reg *registration.Resource
+	if !isBlank(account.EABKid) && !isBlank((*string)(account.EABHmacKey)) {
+		reg, err = client.Registration.RegisterWithExternalAccountBinding(registration.RegisterEABOptions{
+			TermsOfServiceAgreed: true,
+			Kid:                  *account.EABKid,
+			HmacEncoded:          string(*account.EABHmacKey),
+		})
+	} else {
+		reg, err = client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	}
+	if err != nil {
+		s.setLastError(account, err)
+		return fmt.Errorf("%w: %v", ErrACMERegistrationFailed, err)
+	}
+
+	account.RegistrationURI = &reg.URI
+	account.Status = "active"
+	account.LastError = nil
+	return database.DB.Model(account).Updates(map[string]interface{}{
+		"registration_uri": reg.URI,
+		"status":           "active",
+		"last_error":       nil,
+	}).Error
+}
+
+// setLastError records the last provider error of an account
+func (s *ACMEAccountService) setLastError(account *models.ACMEAccount, err error) {
+	msg := truncateError(err.Error())
+	account.LastError = &msg
+	database.DB.Model(account).Update("last_error", msg)
+}
+
+// newLegoClient creates a lego client acting as the account
+func newLegoClient(account *models.ACMEAccount) (*lego.Client, *ACMEUser, error) {
+	if account.Provider == nil {
+		return nil, nil, ErrACMEProviderNotFound
+	}
+
+	key, err := parseAccountKey(string(account.AccountKeyPEM))
+	if err != nil {
+		return nil, nil, err
+	}
+	user := &ACMEUser{
+		Email: account.Email,
+		key:   key,
+	}
+	if account.RegistrationURI != nil && *account.RegistrationURI != "" {
+		user.Registration = &registration.Resource{URI: *account.RegistrationURI}
+	}
+
+	config := lego.NewConfig(user)
+	config.CADirURL = account.Provider.DirectoryURL
+	client, err := lego.NewClient(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create lego client: %w", err)
+	}
+	return client, user, nil
+}
+
+// generateAccountKey generates an ECDSA P-256 account key and returns it PEM
+// encoded
+func generateAccountKey() (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate account key: %w", err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode account key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})), nil
+}
+
+// parseAccountKey parses a PEM encoded EC, PKCS#1 or PKCS#8 account key
+func parseAccountKey(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("failed to decode account key pem")
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse account key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported account key type")
+	}
+	return signer, nil
+}
+
+// jwsAlgorithm returns the JWS algorithm ACME uses for a key
+func jwsAlgorithm(key crypto.Signer) (jose.SignatureAlgorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jose.RS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jose.ES256, nil
+		case elliptic.P384():
+			return jose.ES384, nil
+		}
+	}
+	return "", errors.New("unsupported account key type")
+}
+
+// acmeProblem is an RFC 7807 problem document returned by ACME servers
+// acmeBadNonce is the problem type of a rejected anti-replay nonce
+const acmeBadNonce = "urn:ietf:params:acme:error:badNonce"
+
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+// rolloverAccountKey sends a keyChange request: the inner JWS, signed by the
+// new key, binds the account URL to the old key; the outer JWS is signed by
+// the old key as usual. lego has no API for this. A badNonce rejection is
+// retried once.
+func rolloverAccountKey(directoryURL, accountURL string, oldKey, newKey crypto.Signer) error {
+	httpClient := &http.Client{Timeout: acmeHTTPTimeout}
+
+	var directory struct {
+		NewNonce  string `json:"newNonce"`
+		KeyChange string `json:"keyChange"`
+	}
+	resp, err := httpClient.Get(directoryURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch directory: %w", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&directory)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode directory: %w", err)
+	}
+	if directory.KeyChange == "" || directory.NewNonce == "" {
+		return errors.New("directory does not support key change")
+	}
+
+	// Inner JWS: new key, embedded JWK, no nonce
+	newAlg, err := jwsAlgorithm(newKey)
+	if err != nil {
+		return err
+	}
+	innerSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: newAlg, Key: newKey}, &jose.SignerOptions{
+		EmbedJWK:     true,
+		ExtraHeaders: map[jose.HeaderKey]interface{}{"url": directory.KeyChange},
+	})
+	if err != nil {
+		return err
+	}
+	innerPayload, err := json.Marshal(map[string]interface{}{
+		"account": accountURL,
+		"oldKey":  jose.JSONWebKey{Key: oldKey.Public()},
+	})
+	if err != nil {
+		return err
+	}
+	inner, err := innerSigner.Sign(innerPayload)
+	if err != nil {
+		return fmt.Errorf("failed to sign key change: %w", err)
+	}
+
+	// Outer JWS: old key, identified by the account URL
+	oldAlg, err := jwsAlgorithm(oldKey)
+	if err != nil {
+		return err
+	}
+	nonce, err := fetchNonce(httpClient, directory.NewNonce)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		outerSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: oldAlg, Key: oldKey}, &jose.SignerOptions{
+			ExtraHeaders: map[jose.HeaderKey]interface{}{
+				"url":   directory.KeyChange,
+				"kid":   accountURL,
+				"nonce": nonce,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		outer, err := outerSigner.Sign([]byte(inner.FullSerialize()))
+		if err != nil {
+			return fmt.Errorf("failed to sign key change: %w", err)
+		}
+
+		resp, err := httpClient.Post(directory.KeyChange, "application/jose+json", bytes.NewBufferString(outer.FullSerialize()))
+		if err != nil {
+			return fmt.Errorf("failed to send key change: %w", err)
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+
+		var problem acmeProblem
+		json.Unmarshal(body, &problem)
+
+		// A rejected nonce is retried once, with the nonce of the rejection
+		if problem.Type == acmeBadNonce && attempt == 0 {
+			if nonce = resp.Header.Get("Replay-Nonce"); nonce == "" {
+				if nonce, err = fetchNonce(httpClient, directory.NewNonce); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if problem.Detail != "" {
+			return fmt.Errorf("%s: %s", problem.Type, problem.Detail)
+		}
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+// fetchNonce gets a fresh anti-replay nonce from the newNonce URL
+func fetchNonce(httpClient *http.Client, newNonceURL string) (string, error) {
+	resp, err := httpClient.Head(newNonceURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch nonce: %w", err)
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("server did not return a nonce")
+	}
+	return nonce, nil
+}
+
+func isBlank(s *string) bool {
+	return s == nil || *s == ""
+}
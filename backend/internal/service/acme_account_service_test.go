@@ -0,0 +1,180 @@
+package service
+
+import (
+	"crypto"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const testAccountURL = "https://acme.example/acct/1"
+
+// keyChangeServer is an ACME server answering keyChange requests with the
+// problems in rejections, then with success
+type keyChangeServer struct {
+	t          *testing.T
+	server     *httptest.Server
+	oldKey     crypto.Signer
+	newKey     crypto.Signer
+	rejections []string
+
+	mu     sync.Mutex
+	nonces []string // nonces of the keyChange requests received
+	issued int
+}
+
+func newKeyChangeServer(t *testing.T, rejections ...string) *keyChangeServer {
+	t.Helper()
+
+	s := &keyChangeServer{t: t, rejections: rejections}
+	for _, key := range []*crypto.Signer{&s.oldKey, &s.newKey} {
+		keyPEM, err := generateAccountKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *key, err = parseAccountKey(keyPEM); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":  s.server.URL + "/new-nonce",
+			"keyChange": s.server.URL + "/key-change",
+		})
+	})
+	mux.HandleFunc("/new-nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", s.nonce())
+	})
+	mux.HandleFunc("/key-change", s.keyChange)
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+func (s *keyChangeServer) nonce() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.issued++
+	return "nonce-" + strconv.Itoa(s.issued)
+}
+
+func (s *keyChangeServer) keyChange(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	url := s.server.URL + "/key-change"
+
+	outer, err := jose.ParseSigned(string(body), []jose.SignatureAlgorithm{jose.ES256})
+	if err != nil {
+		s.t.Errorf("outer JWS: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	innerJWS, err := outer.Verify(s.oldKey.Public())
+	if err != nil {
+		s.t.Errorf("outer JWS is not signed by the old key: %v", err)
+	}
+	header := outer.Signatures[0].Protected
+	if header.KeyID != testAccountURL || header.ExtraHeaders["url"] != url {
+		s.t.Errorf("outer header kid=%q url=%v", header.KeyID, header.ExtraHeaders["url"])
+	}
+
+	inner, err := jose.ParseSigned(string(innerJWS), []jose.SignatureAlgorithm{jose.ES256})
+	if err != nil {
+		s.t.Fatalf("inner JWS: %v", err)
+	}
+	innerHeader := inner.Signatures[0].Protected
+	if innerHeader.JSONWebKey == nil || innerHeader.Nonce != "" || innerHeader.ExtraHeaders["url"] != url {
+		s.t.Errorf("inner header jwk=%v nonce=%q url=%v", innerHeader.JSONWebKey, innerHeader.Nonce, innerHeader.ExtraHeaders["url"])
+	}
+	payload, err := inner.Verify(s.newKey.Public())
+	if err != nil {
+		s.t.Errorf("inner JWS is not signed by the new key: %v", err)
+	}
+	var change struct {
+		Account string          `json:"account"`
+		OldKey  jose.JSONWebKey `json:"oldKey"`
+	}
+	if err := json.Unmarshal(payload, &change); err != nil || change.Account != testAccountURL {
+		s.t.Errorf("inner payload %s", payload)
+	} else if !change.OldKey.Valid() || !publicKeysEqual(change.OldKey.Key, s.oldKey.Public()) {
+		s.t.Error("inner payload oldKey is not the old key")
+	}
+
+	s.mu.Lock()
+	s.nonces = append(s.nonces, header.Nonce)
+	attempt := len(s.nonces)
+	s.mu.Unlock()
+
+	w.Header().Set("Replay-Nonce", s.nonce())
+	if attempt <= len(s.rejections) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(acmeProblem{Type: s.rejections[attempt-1], Detail: "rejected"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *keyChangeServer) rollover() error {
+	return rolloverAccountKey(s.server.URL+"/directory", testAccountURL, s.oldKey, s.newKey)
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	return a.(interface{ Equal(crypto.PublicKey) bool }).Equal(b)
+}
+
+func TestRolloverAccountKey(t *testing.T) {
+	s := newKeyChangeServer(t)
+
+	if err := s.rollover(); err != nil {
+		t.Fatalf("rolloverAccountKey: %v", err)
+	}
+	if len(s.nonces) != 1 || s.nonces[0] != "nonce-1" {
+		t.Errorf("keyChange nonces %q, want the one from newNonce", s.nonces)
+	}
+}
+
+func TestRolloverAccountKeyRetriesBadNonce(t *testing.T) {
+	s := newKeyChangeServer(t, acmeBadNonce)
+
+	if err := s.rollover(); err != nil {
+		t.Fatalf("rolloverAccountKey: %v", err)
+	}
+	// The retry uses the nonce of the rejection
+	if len(s.nonces) != 2 || s.nonces[1] != "nonce-2" {
+		t.Errorf("keyChange nonces %q, want a retry with nonce-2", s.nonces)
+	}
+}
+
+func TestRolloverAccountKeyFails(t *testing.T) {
+	tests := []struct {
+		name       string
+		rejections []string
+		attempts   int
+	}{
+		{"bad nonce twice", []string{acmeBadNonce, acmeBadNonce}, 2},
+		{"other problem", []string{"urn:ietf:params:acme:error:unauthorized"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newKeyChangeServer(t, tt.rejections...)
+
+			err := s.rollover()
+			if err == nil || !strings.Contains(err.Error(), tt.rejections[len(tt.rejections)-1]) {
+				t.Errorf("got %v, want the %s problem", err, tt.rejections[len(tt.rejections)-1])
+			}
+			if len(s.nonces) != tt.attempts {
+				t.Errorf("%d keyChange requests, want %d", len(s.nonces), tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// Challenge types of a certificate request
+const (
+	ChallengeDNS01  = "dns-01"
+	ChallengeHTTP01 = "http-01"
+)
+
+// http-01 challenge settings
+const (
+	httpChallengeConfirmTimeout = 5 * time.Minute
+	httpChallengePollInterval   = 2 * time.Second
+)
+
+var (
+	ErrHTTPChallengeNotFound = errors.New("http challenge not found")
+	ErrNoEdgeNodes           = errors.New("no online edge node serves the domain")
+	ErrHTTPChallengeTimeout  = errors.New("http challenge confirmation timeout")
+)
+
+// HTTPChallengeTask is the payload of acme_http01 and acme_http01_cleanup
+// agent tasks. Nodes serve KeyAuthorization at
+// http://<domain>/.well-known/acme-challenge/<token> until cleanup.
+type HTTPChallengeTask struct {
+	ChallengeID      int    `json:"challenge_id"`
+	Domain           string `json:"domain"`
+	Token            string `json:"token"`
+	KeyAuthorization string `json:"key_authorization,omitempty"`
+}
+
+// chooseChallengeType returns dns-01 when every domain of a request lies in a
+// managed zone, and http-01 otherwise. Wildcards can only be validated with
+// dns-01, so a wildcard outside the managed zones is an error.
+func chooseChallengeType(tx *gorm.DB, domains []string) (string, error) {
+	challengeType := ChallengeDNS01
+	for _, domain := range domains {
+		zone, err := findManagedZone(tx, "_acme-challenge."+strings.TrimPrefix(domain, "*."))
+		if err != nil {
+			return "", err
+		}
+		if zone != nil {
+			continue
+		}
+		if strings.HasPrefix(domain, "*.") {
+			return "", fmt.Errorf("wildcard %s requires dns-01: %w", domain, noZoneError(strings.TrimPrefix(domain, "*.")))
+		}
+		challengeType = ChallengeHTTP01
+	}
+	return challengeType, nil
+}
+
+// HTTPChallengeProvider implements the challenge.Provider interface for lego.
+// Tokens are stored in acme_http_challenges and pushed to every online node
+// serving the website domain as acme_http01 agent tasks; Present returns once
+// all nodes have confirmed their task. Nodes that miss the task can look the
+// token up through the agent API.
+type HTTPChallengeProvider struct {
+	requestID int
+	nodes     map[string][]int // Token -> nodes the token was pushed to
+}
+
+// NewHTTPChallengeProvider creates the http-01 solver of a certificate request
+func NewHTTPChallengeProvider(requestID int) *HTTPChallengeProvider {
+	return &HTTPChallengeProvider{
+		requestID: requestID,
+		nodes:     make(map[string][]int),
+	}
+}
+
+// Present publishes the token to the edge nodes of the domain and waits for
+// their confirmation
+func (p *HTTPChallengeProvider) Present(domain, token, keyAuth string) error {
+	domain = utils.ToASCII(domain)
+
+	nodeIDs, err := edgeNodesForDomain(database.DB, domain)
+	if err != nil {
+		return err
+	}
+
+	challenge := models.ACMEHTTPChallenge{
+		RequestID:        p.requestID,
+		Domain:           domain,
+		Token:            token,
+		KeyAuthorization: keyAuth,
+		Status:           "pending",
+		Nodes:            len(nodeIDs),
+	}
+	var taskIDs []int
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&challenge).Error; err != nil {
+			return err
+		}
+		taskIDs, err = createChallengeTasks(tx, "acme_http01", nodeIDs, HTTPChallengeTask{
+			ChallengeID:      challenge.ID,
+			Domain:           domain,
+			Token:            token,
+			KeyAuthorization: keyAuth,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish http challenge for %s: %w", domain, err)
+	}
+	p.nodes[token] = nodeIDs
+
+	if err := waitChallengeTasks(taskIDs); err != nil {
+		msg := err.Error()
+		database.DB.Model(&challenge).Updates(map[string]interface{}{"status": "failed", "last_error": msg})
+		return fmt.Errorf("http challenge for %s: %w", domain, err)
+	}
+
+	return database.DB.Model(&challenge).Update("status", "ready").Error
+}
+
+// CleanUp removes the token so the agent API stops serving it and tells the
+// nodes to drop it
+func (p *HTTPChallengeProvider) CleanUp(domain, token, keyAuth string) error {
+	nodeIDs := p.nodes[token]
+	delete(p.nodes, token)
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var challenge models.ACMEHTTPChallenge
+		if err := tx.Where("token = ?", token).First(&challenge).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err := tx.Delete(&challenge).Error; err != nil {
+			return err
+		}
+		_, err := createChallengeTasks(tx, "acme_http01_cleanup", nodeIDs, HTTPChallengeTask{
+			ChallengeID: challenge.ID,
+			Domain:      challenge.Domain,
+			Token:       token,
+		})
+		return err
+	})
+}
+
+// cleanupHTTPChallenges removes the tokens of a request that are still
+// stored, e.g. when the order was aborted before lego cleaned up
+func cleanupHTTPChallenges(requestID int) error {
+	return database.DB.Where("request_id = ?", requestID).Delete(&models.ACMEHTTPChallenge{}).Error
+}
+
+// edgeNodesForDomain returns the online nodes a website domain currently
+// resolves to: the nodes with a sub IP in a node group targeted by the line
+// group of the website
+func edgeNodesForDomain(tx *gorm.DB, domain string) ([]int, error) {
+	var websiteDomain models.WebsiteDomain
+	if err := tx.Preload("Website.LineGroup").Where("domain = ?", domain).First(&websiteDomain).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s is not a website domain", ErrNoEdgeNodes, domain)
+		}
+		return nil, err
+	}
+	if websiteDomain.Website == nil || websiteDomain.Website.LineGroup == nil {
+		return nil, fmt.Errorf("%w: %s has no line group", ErrNoEdgeNodes, domain)
+	}
+
+	targets, err := lineGroupTargets(tx, websiteDomain.Website.LineGroup)
+	if err != nil {
+		return nil, err
+	}
+	nodeGroupIDs := make([]int, 0, len(targets))
+	for _, target := range targets {
+		nodeGroupIDs = append(nodeGroupIDs, target.nodeGroupID)
+	}
+
+	var nodeIDs []int
+	if err := tx.Model(&models.Node{}).
+		Distinct("nodes.id").
+		Joins("JOIN node_sub_ips ON node_sub_ips.node_id = nodes.id AND node_sub_ips.enabled = ?", true).
+		Joins("JOIN node_group_sub_ips ON node_group_sub_ips.sub_ip_id = node_sub_ips.id").
+		Where("node_group_sub_ips.node_group_id IN ?", nodeGroupIDs).
+		Where("nodes.enabled = ? AND nodes.status = ?", true, "online").
+		Order("nodes.id ASC").
+		Pluck("nodes.id", &nodeIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(nodeIDs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoEdgeNodes, domain)
+	}
+	return nodeIDs, nil
+}
+
+// createChallengeTasks creates one agent task per node and returns their IDs
+func createChallengeTasks(tx *gorm.DB, taskType string, nodeIDs []int, payload HTTPChallengeTask) ([]int, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	taskIDs := make([]int, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		task := models.AgentTask{
+			NodeID:  nodeID,
+			Type:    taskType,
+			Payload: string(payloadJSON),
+			Status:  "pending",
+		}
+		if err := tx.Create(&task).Error; err != nil {
+			return nil, err
+		}
+		taskIDs = append(taskIDs, task.ID)
+	}
+	return taskIDs, nil
+}
+
+// waitChallengeTasks polls agent tasks until all succeeded, one failed or the
+// confirmation timeout is reached
+func waitChallengeTasks(taskIDs []int) error {
+	deadline := time.Now().Add(httpChallengeConfirmTimeout)
+	for {
+		var tasks []models.AgentTask
+		if err := database.DB.Where("id IN ?", taskIDs).Find(&tasks).Error; err != nil {
+			return err
+		}
+
+		confirmed := 0
+		for _, task := range tasks {
+			switch task.Status {
+			case "success":
+				confirmed++
+			case "failed":
+				lastError := "unknown error"
+				if task.LastError != nil {
+					lastError = *task.LastError
+				}
+				return fmt.Errorf("node %d failed to install token: %s", task.NodeID, lastError)
+			}
+		}
+		if confirmed == len(taskIDs) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %d of %d nodes confirmed", ErrHTTPChallengeTimeout, confirmed, len(taskIDs))
+		}
+		time.Sleep(httpChallengePollInterval)
+	}
+}
@@ -3,8 +3,7 @@ package service
 import (
 "crypto"
 "crypto/ecdsa"
-"crypto/elliptic"
-"crypto/rand"
+"crypto/rsa"
 "crypto/sha256"
 "crypto/x509"
 "encoding/hex"
@@ -12,6 +11,7 @@ import (
 "encoding/pem"
 "errors"
 "fmt"
+"log"
 "time"
 
 "github.com/go-acme/lego/v4/certcrypto"
@@ -21,6 +21,8 @@ import (
 "github.com/go-acme/lego/v4/registration"
 "github.com/labubu-daydayone/go_cmdb_web/backend/internal/db"
 "github.com/labubu-daydayone/go_cmdb_web/backend/internal/models"
+"github.com/labubu-daydayone/go_cmdb_web/backend/internal/utils"
+"gorm.io/gorm"
 )
 
 // ACME service errors
@@ -37,11 +39,12 @@ dnsRecordService     *DNSRecordService
 configVersionService *ConfigVersionService
 }
 
-// NewACMEService creates a new ACME service
-func NewACMEService() *ACMEService {
+// NewACMEService creates a new ACME service. dnsRecordService publishes the
+// dns-01 challenge records and wakes DNSSyncWorker.
+func NewACMEService(dnsRecordService *DNSRecordService) *ACMEService {
 return &ACMEService{
 certificateService:   NewCertificateService(),
-dnsRecordService:     NewDNSRecordService(),
+dnsRecordService:     dnsRecordService,
 configVersionService: NewConfigVersionService(),
 }
 }
@@ -50,6 +53,7 @@ configVersionService: NewConfigVersionService(),
 type RequestCertificateRequest struct {
 ACMEAccountID int      `json:"acme_account_id" binding:"required"`
 Domains       []string `json:"domains" binding:"required,min=1"`
+KeyType       string   `json:"key_type" binding:"omitempty,oneof=rsa2048 rsa3072 rsa4096 ec256 ec384"` // Defaults to the account's default_key_type
 }
 
 // RequestCertificateResponse represents the response after requesting a certificate
@@ -58,6 +62,41 @@ RequestID int    `json:"request_id"`
 Status    string `json:"status"`
 }
 
+// Key types of issued certificates
+const (
+KeyTypeRSA2048 = "rsa2048"
+KeyTypeRSA3072 = "rsa3072"
+KeyTypeRSA4096 = "rsa4096"
+KeyTypeEC256   = "ec256"
+KeyTypeEC384   = "ec384"
+)
+
+// legoKeyTypes maps key types to the lego certificate key types
+var legoKeyTypes = map[string]certcrypto.KeyType{
+KeyTypeRSA2048: certcrypto.RSA2048,
+KeyTypeRSA3072: certcrypto.RSA3072,
+KeyTypeRSA4096: certcrypto.RSA4096,
+KeyTypeEC256:   certcrypto.EC256,
+KeyTypeEC384:   certcrypto.EC384,
+}
+
+// isECDSAKeyType reports whether a key type is an ECDSA curve
+func isECDSAKeyType(keyType string) bool {
+return keyType == KeyTypeEC256 || keyType == KeyTypeEC384
+}
+
+// certificateKeyType returns the key type of a certificate public key, e.g.
+// rsa2048 or ec256, or "" for other keys
+func certificateKeyType(publicKey crypto.PublicKey) string {
+switch key := publicKey.(type) {
+case *rsa.PublicKey:
+return fmt.Sprintf("rsa%d", key.N.BitLen())
+case *ecdsa.PublicKey:
+return fmt.Sprintf("ec%d", key.Curve.Params().BitSize)
+}
+return ""
+}
+
 // ACMEUser implements the registration.User interface for lego
 type ACMEUser struct {
 Email        string
@@ -77,50 +116,97 @@ func (u *ACMEUser) GetPrivateKey() crypto.PrivateKey {
 return u.key
 }
 
-// WF-07: Certificate Request (ACME DNS-01)
-// 1. Create certificate_requests(status=pending)
-// 2. Create TXT record(s) as domain_dns_records(owner=acme_challenge,pending)
-// 3. DNS worker sync
-// 4. Poll every 40s up to 10 times: check record exists in provider API and value match
+// WF-07: Certificate Request (ACME DNS-01, or HTTP-01 when a zone is not managed)
+// 1. Create certificate_requests(status=pending, challenge_type)
+// 2. Create TXT record(s) as domain_dns_records(owner=acme_challenge,owner_id=request,pending)
+// 3. Wake DNS worker sync
+// 4. Poll until the worker has verified the record on all authoritative nameservers
 // 5. Finalize -> cert pem/key
 // 6. Insert certificates(provider from account, source=acme, renew_mode=auto)
 // 7. Insert certificate_domains
-// 8. Cleanup TXT records (insert delete/update desired-state)
+// 8. Cleanup TXT records (queue status=deleting, also after a failed order)
 // 9. Update certificate_requests(status=success,result_certificate_id)
+// Renewals (renew_certificate_id set) also move the active bindings and
+// website_https of the old certificate to the new one in step 6-7's
+// transaction and bump config_versions(reason="cert:renew")
 func (s *ACMEService) RequestCertificate(req RequestCertificateRequest) (*RequestCertificateResponse, error) {
+certRequest, err := s.createCertificateRequest(req.ACMEAccountID, req.Domains, req.KeyType, nil)
+if err != nil {
+return nil, err
+}
+
+// Start async processing
+go s.processCertificateRequest(certRequest.ID)
+
+return &RequestCertificateResponse{
+RequestID: certRequest.ID,
+Status:    "pending",
+}, nil
+}
+
+// createCertificateRequest validates the account and domains and stores a
+// pending certificate request. An empty keyType uses the account default;
+// renewCertificateID is set for renewals.
+func (s *ACMEService) createCertificateRequest(accountID int, domains []string, keyType string, renewCertificateID *int) (*models.CertificateRequest, error) {
 // Get ACME account
 var account models.ACMEAccount
-if err := db.DB.Preload("Provider").First(&account, req.ACMEAccountID).Error; err != nil {
+if err := db.DB.Preload("Provider").First(&account, accountID).Error; err != nil {
 return nil, ErrACMEAccountNotFound
 }
 
 // Validate account status
 if account.Status != "active" {
-return nil, errors.New("acme account is not active")
+return nil, ErrACMEAccountNotActive
+}
+
+if keyType == "" {
+keyType = account.DefaultKeyType
+}
+if _, ok := legoKeyTypes[keyType]; !ok {
+return nil, fmt.Errorf("unsupported key type %q", keyType)
+}
+
+// CAs only accept IDNs in punycode
+normalized := make([]string, 0, len(domains))
+for _, d := range domains {
+name, err := utils.NormalizeDomain(d)
+if err != nil {
+return nil, err
+}
+normalized = append(normalized, name)
+}
+
+// dns-01 when we manage every zone, http-01 through the edge nodes otherwise
+challengeType, err := chooseChallengeType(db.DB, normalized)
+if err != nil {
+return nil, err
 }
 
 // Create certificate request
-domainsJSON, _ := json.Marshal(req.Domains)
+domainsJSON, _ := json.Marshal(normalized)
 certRequest := models.CertificateRequest{
-ACMEAccountID:   req.ACMEAccountID,
-DomainsJSON:     string(domainsJSON),
-Status:          "pending",
-PollIntervalSec: 40,
-PollMaxAttempts: 10,
-Attempts:        0,
+ACMEAccountID:      accountID,
+DomainsJSON:        string(domainsJSON),
+Status:             "pending",
+ChallengeType:      challengeType,
+KeyType:            keyType,
+PollIntervalSec:    40,
+PollMaxAttempts:    10,
+Attempts:           0,
+RenewCertificateID: renewCertificateID,
 }
 
 if err := db.DB.Create(&certRequest).Error; err != nil {
 return nil, fmt.Errorf("failed to create certificate request: %w", err)
 }
 
-// Start async processing
-go s.processCertificateRequest(certRequest.ID)
+return &certRequest, nil
+}
 
-return &RequestCertificateResponse{
-RequestID: certRequest.ID,
-Status:    "pending",
-}, nil
+// ProcessPendingRequest processes a request left pending, e.g. by a restart
+// before its processing started
+func (s *ACMEService) ProcessPendingRequest(requestID int) {
+s.processCertificateRequest(requestID)
 }
 
 // processCertificateRequest processes a certificate request asynchronously
@@ -132,8 +218,13 @@ s.updateRequestStatus(requestID, "failed", err.Error(), nil)
 return
 }
 
-// Update status to running
-db.DB.Model(&certRequest).Update("status", "running")
+// Claim the request, it may be picked up by ACMEWorker concurrently
+result := db.DB.Model(&models.CertificateRequest{}).
+Where("id = ? AND status = ?", requestID, "pending").
+Update("status", "running")
+if result.Error != nil || result.RowsAffected == 0 {
+return
+}
 
 // Parse domains
 var domains []string
@@ -152,7 +243,10 @@ return
 // Create lego config
 config := lego.NewConfig(user)
 config.CADirURL = certRequest.ACMEAccount.Provider.DirectoryURL
+config.Certificate.KeyType = legoKeyTypes[certRequest.KeyType]
+if config.Certificate.KeyType == "" {
 config.Certificate.KeyType = certcrypto.RSA2048
+}
 
 // Create lego client
 client, err := lego.NewClient(config)
@@ -161,15 +255,19 @@ s.updateRequestStatus(requestID, "failed", fmt.Sprintf("failed to create lego cl
 return
 }
 
-// Set DNS provider (custom implementation)
-provider := &CustomDNSProvider{
-dnsRecordService: s.dnsRecordService,
-requestID:        requestID,
+// Set the challenge solver chosen for the request
+if certRequest.ChallengeType == ChallengeHTTP01 {
+if err := client.Challenge.SetHTTP01Provider(NewHTTPChallengeProvider(requestID)); err != nil {
+s.updateRequestStatus(requestID, "failed", fmt.Sprintf("failed to set http provider: %v", err), nil)
+return
 }
+} else {
+provider := NewCustomDNSProvider(s.dnsRecordService, requestID)
 if err := client.Challenge.SetDNS01Provider(provider); err != nil {
 s.updateRequestStatus(requestID, "failed", fmt.Sprintf("failed to set dns provider: %v", err), nil)
 return
 }
+}
 
 // Request certificate
 request := certificate.ObtainRequest{
@@ -178,6 +276,7 @@ Bundle:  true,
 }
 
 certificates, err := client.Certificate.Obtain(request)
+s.cleanupChallengeRecords(requestID)
 if err != nil {
 s.updateRequestStatus(requestID, "failed", fmt.Sprintf("failed to obtain certificate: %v", err), nil)
 return
@@ -217,8 +316,9 @@ Status:         "valid",
 IssueAt:        &cert.NotBefore,
 ExpireAt:       &cert.NotAfter,
 Fingerprint:    fingerprint,
+KeyType:        certificateKeyType(cert.PublicKey),
 CertificatePEM: string(certificates.Certificate),
-PrivateKeyPEM:  string(certificates.PrivateKey),
+PrivateKeyPEM:  models.EncryptedString(certificates.PrivateKey),
 RenewMode:      "auto",
 }
 
@@ -245,6 +345,15 @@ return
 }
 }
 
+// Renewals take over the bindings of the certificate they replace
+if certRequest.RenewCertificateID != nil {
+if err := s.replaceCertificate(tx, *certRequest.RenewCertificateID, certificate.ID); err != nil {
+tx.Rollback()
+s.updateRequestStatus(requestID, "failed", fmt.Sprintf("failed to replace certificate: %v", err), nil)
+return
+}
+}
+
 if err := tx.Commit().Error; err != nil {
 s.updateRequestStatus(requestID, "failed", fmt.Sprintf("failed to commit transaction: %v", err), nil)
 return
@@ -254,52 +363,518 @@ return
 s.updateRequestStatus(requestID, "success", "", &certificate.ID)
 }
 
-// getACMEUser gets or creates an ACME user from account
+// getACMEUser returns the lego user of a registered account. Accounts are
+// registered through ACMEAccountService, so the key and registration URI are
+// always set for active accounts.
 func (s *ACMEService) getACMEUser(account *models.ACMEAccount) (*ACMEUser, error) {
-// Parse private key
-var privateKey crypto.PrivateKey
-if account.PrivateKeyPEM != nil && *account.PrivateKeyPEM != "" {
-block, _ := pem.Decode([]byte(*account.PrivateKeyPEM))
-if block == nil {
-return nil, errors.New("failed to decode private key pem")
+if account.RegistrationURI == nil || *account.RegistrationURI == "" {
+return nil, ErrACMEAccountNotActive
 }
 
-key, err := x509.ParseECPrivateKey(block.Bytes)
+privateKey, err := parseAccountKey(string(account.AccountKeyPEM))
 if err != nil {
-return nil, fmt.Errorf("failed to parse private key: %w", err)
+return nil, err
 }
-privateKey = key
-} else {
-// Generate new private key
-key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+return &ACMEUser{
+Email:        account.Email,
+Registration: &registration.Resource{URI: *account.RegistrationURI},
+key:          privateKey,
+}, nil
+}
+
+// Renewal retry backoff: 1h after the first failure, doubling up to a day
+const (
+renewRetryBase = time.Hour
+renewRetryMax  = 24 * time.Hour
+)
+
+// RenewCertificate re-issues a certificate through the ACME account that
+// issued it. On success the new certificate replaces the old one in every
+// active binding and HTTPS setting; on failure the attempt is recorded on the
+// certificate and retried after an exponential backoff. Runs synchronously.
+func (s *ACMEService) RenewCertificate(certificateID int) error {
+var cert models.Certificate
+if err := db.DB.First(&cert, certificateID).Error; err != nil {
+return ErrCertificateNotFound
+}
+if cert.ACMEAccountID == nil {
+return s.recordRenewFailure(&cert, ErrACMEAccountNotFound)
+}
+
+var domains []string
+if err := db.DB.Model(&models.CertificateDomain{}).
+Where("certificate_id = ?", cert.ID).
+Order("id ASC").
+Pluck("domain", &domains).Error; err != nil {
+return err
+}
+if len(domains) == 0 {
+return s.recordRenewFailure(&cert, errors.New("certificate has no domains"))
+}
+
+// Keep the key type, so a dual certificate pair stays ECDSA + RSA
+keyType := ""
+if _, ok := legoKeyTypes[cert.KeyType]; ok {
+keyType = cert.KeyType
+}
+
+certRequest, err := s.createCertificateRequest(*cert.ACMEAccountID, domains, keyType, &cert.ID)
 if err != nil {
-return nil, fmt.Errorf("failed to generate private key: %w", err)
+return s.recordRenewFailure(&cert, err)
+}
+
+s.processCertificateRequest(certRequest.ID)
+
+if err := db.DB.First(certRequest, certRequest.ID).Error; err != nil {
+return err
+}
+if certRequest.Status != "success" {
+lastError := "renewal request did not succeed"
+if certRequest.LastError != nil {
+lastError = *certRequest.LastError
+}
+return s.recordRenewFailure(&cert, fmt.Errorf("request %d: %s", certRequest.ID, lastError))
+}
+
+return nil
+}
+
+// recordRenewFailure stores a failed renewal attempt and schedules the next one
+func (s *ACMEService) recordRenewFailure(cert *models.Certificate, cause error) error {
+attempts := cert.RenewAttempts + 1
+backoff := renewRetryMax
+if attempts <= 5 {
+backoff = renewRetryBase << (attempts - 1)
 }
-privateKey = key
+nextRenewAt := time.Now().Add(backoff)
 
-// Save private key to account
-keyBytes, _ := x509.MarshalECPrivateKey(key)
-keyPEM := pem.EncodeToMemory(&pem.Block{
-Type:  "EC PRIVATE KEY",
-Bytes: keyBytes,
+db.DB.Model(cert).Updates(map[string]interface{}{
+"renew_attempts": attempts,
+"next_renew_at":  nextRenewAt,
+"last_error":     truncateError(cause.Error()),
 })
-keyPEMStr := string(keyPEM)
-db.DB.Model(account).Update("private_key_pem", keyPEMStr)
+
+return fmt.Errorf("renewal attempt %d failed, next attempt at %s: %w", attempts, nextRenewAt.Format(time.RFC3339), cause)
 }
 
-// Parse registration
-var reg *registration.Resource
-if account.RegistrationURL != nil && *account.RegistrationURL != "" {
-reg = &registration.Resource{
-URI: *account.RegistrationURL,
+// replaceCertificate moves the active bindings and HTTPS settings of a
+// renewed certificate to its successor and bumps the config version, all in
+// the transaction that stores the successor
+func (s *ACMEService) replaceCertificate(tx *gorm.DB, oldID, newID int) error {
+// Guard against two renewals of the same certificate
+result := tx.Model(&models.Certificate{}).
+Where("id = ? AND replaced_by_id IS NULL", oldID).
+Updates(map[string]interface{}{
+"replaced_by_id": newID,
+"renew_at":       nil,
+"next_renew_at":  nil,
+})
+if result.Error != nil {
+return result.Error
 }
+if result.RowsAffected == 0 {
+return fmt.Errorf("certificate %d was already replaced", oldID)
 }
 
-return &ACMEUser{
-Email:        account.Email,
-Registration: reg,
-key:          privateKey,
-}, nil
+var bindings []models.CertificateBinding
+if err := tx.Where("certificate_id = ? AND is_active = ?", oldID, true).Find(&bindings).Error; err != nil {
+return err
+}
+for _, binding := range bindings {
+if err := tx.Model(&binding).Update("is_active", false).Error; err != nil {
+return err
+}
+newBinding := models.CertificateBinding{
+CertificateID: newID,
+BindType:      binding.BindType,
+BindID:        binding.BindID,
+IsActive:      true,
+}
+if err := tx.Create(&newBinding).Error; err != nil {
+return err
+}
+}
+
+if err := tx.Model(&models.WebsiteHTTPS{}).
+Where("certificate_id = ?", oldID).
+Update("certificate_id", newID).Error; err != nil {
+return err
+}
+if err := tx.Model(&models.WebsiteHTTPS{}).
+Where("rsa_certificate_id = ?", oldID).
+Update("rsa_certificate_id", newID).Error; err != nil {
+return err
+}
+
+return s.configVersionService.BumpVersion(tx, "cert:renew")
+}
+
+// WF-09: Website Certificate Provisioning (website_https.cert_mode=acme)
+// 1. Claim website_https(provision_status pending -> issuing)
+// 2. Keep the current certificate when it covers every website_domain
+// 3. Otherwise request a certificate for all website_domains with the account
+//    of the website (or the first active account of its provider); with
+//    dual_cert an ECDSA certificate_id and an RSA rsa_certificate_id. A
+//    certificate issued for the same domains and key type that is not bound
+//    yet (e.g. by a run that failed on the other half of the pair) is reused
+// 4. On success bind it (old binding is_active=0, website_https.certificate_id)
+//    and bump config_versions(reason="cert:provision:<website>")
+// 5. On failure provision_status=failed with provision_error
+// Domain changes during issuing set provision_status back to pending; the
+// result is then not bound and the website is provisioned again.
+func (s *ACMEService) ProvisionWebsiteCertificate(websiteID int) error {
+result := db.DB.Model(&models.WebsiteHTTPS{}).
+Where("website_id = ? AND cert_mode = ? AND provision_status = ?", websiteID, "acme", "pending").
+Updates(map[string]interface{}{
+"provision_status":     "issuing",
+"provision_error":      nil,
+"provision_request_id": nil,
+})
+if result.Error != nil {
+return result.Error
+}
+if result.RowsAffected == 0 {
+return nil
+}
+
+var https models.WebsiteHTTPS
+if err := db.DB.Where("website_id = ?", websiteID).First(&https).Error; err != nil {
+return err
+}
+
+var domains []string
+if err := db.DB.Model(&models.WebsiteDomain{}).
+Where("website_id = ?", websiteID).
+Order("id ASC").
+Pluck("domain", &domains).Error; err != nil {
+return s.failProvisioning(websiteID, err)
+}
+if len(domains) == 0 {
+return s.failProvisioning(websiteID, errors.New("website has no domains"))
+}
+
+accountID, err := s.provisioningAccount(&https)
+if err != nil {
+return s.failProvisioning(websiteID, err)
+}
+
+// One certificate with the account default key type, or an ECDSA and an
+// RSA one for dual_cert
+keyTypes := []string{""}
+current := []*int{https.CertificateID}
+if https.DualCert {
+ecdsaKeyType, rsaKeyType, err := s.dualKeyTypes(accountID)
+if err != nil {
+return s.failProvisioning(websiteID, err)
+}
+keyTypes = []string{ecdsaKeyType, rsaKeyType}
+current = []*int{https.CertificateID, https.RSACertificateID}
+}
+
+certificateIDs := make([]int, len(keyTypes))
+for i, keyType := range keyTypes {
+if current[i] != nil && s.certificateCovers(*current[i], domains, keyType) {
+certificateIDs[i] = *current[i]
+continue
+}
+
+certificateID, err := s.issueWebsiteCertificate(websiteID, accountID, domains, keyType)
+if err != nil {
+return s.failProvisioning(websiteID, err)
+}
+certificateIDs[i] = certificateID
+}
+
+var rsaCertificateID *int
+if len(certificateIDs) > 1 {
+rsaCertificateID = &certificateIDs[1]
+}
+return s.bindProvisionedCertificate(websiteID, certificateIDs[0], rsaCertificateID)
+}
+
+// issueWebsiteCertificate requests a certificate for the domains of a website
+// that is being provisioned and returns its ID
+func (s *ACMEService) issueWebsiteCertificate(websiteID, accountID int, domains []string, keyType string) (int, error) {
+// The ECDSA half of a dual pair is kept when the RSA half fails, the retry
+// picks it up instead of issuing it again
+if certificateID, ok := s.unboundCertificate(accountID, domains, keyType); ok {
+log.Printf("[ACME] Reusing unbound certificate %d for website %d\n", certificateID, websiteID)
+return certificateID, nil
+}
+
+certRequest, err := s.createCertificateRequest(accountID, domains, keyType, nil)
+if err != nil {
+return 0, err
+}
+db.DB.Model(&models.WebsiteHTTPS{}).
+Where("website_id = ? AND provision_status = ?", websiteID, "issuing").
+Update("provision_request_id", certRequest.ID)
+
+s.processCertificateRequest(certRequest.ID)
+
+if err := db.DB.First(certRequest, certRequest.ID).Error; err != nil {
+return 0, err
+}
+if certRequest.Status != "success" || certRequest.ResultCertificateID == nil {
+lastError := "certificate request did not succeed"
+if certRequest.LastError != nil {
+lastError = *certRequest.LastError
+}
+return 0, fmt.Errorf("request %d: %s", certRequest.ID, lastError)
+}
+return *certRequest.ResultCertificateID, nil
+}
+
+// unboundCertificate returns the live certificate of an earlier successful
+// request of the account for exactly these domains and key type that no
+// binding or website uses, e.g. one issued by a provisioning run that failed
+// afterwards. An empty keyType is the account default.
+func (s *ACMEService) unboundCertificate(accountID int, domains []string, keyType string) (int, bool) {
+if keyType == "" {
+var account models.ACMEAccount
+if err := db.DB.First(&account, accountID).Error; err != nil {
+return 0, false
+}
+keyType = account.DefaultKeyType
+}
+
+wanted := make(map[string]bool, len(domains))
+for _, domain := range domains {
+wanted[utils.ToASCII(domain)] = true
+}
+
+var requests []models.CertificateRequest
+if err := db.DB.Where("acme_account_id = ? AND key_type = ? AND status = ? AND result_certificate_id IS NOT NULL AND renew_certificate_id IS NULL",
+accountID, keyType, "success").
+Order("id DESC").
+Limit(20).
+Find(&requests).Error; err != nil {
+return 0, false
+}
+
+for _, request := range requests {
+var requested []string
+if err := json.Unmarshal([]byte(request.DomainsJSON), &requested); err != nil || len(requested) != len(wanted) {
+continue
+}
+same := true
+for _, domain := range requested {
+if !wanted[utils.ToASCII(domain)] {
+same = false
+break
+}
+}
+if !same {
+continue
+}
+
+certificateID := *request.ResultCertificateID
+if !s.certificateCovers(certificateID, domains, keyType) {
+continue
+}
+
+var inUse int64
+db.DB.Model(&models.CertificateBinding{}).
+Where("certificate_id = ? AND is_active = ?", certificateID, true).
+Count(&inUse)
+if inUse > 0 {
+continue
+}
+db.DB.Model(&models.WebsiteHTTPS{}).
+Where("certificate_id = ? OR rsa_certificate_id = ?", certificateID, certificateID).
+Count(&inUse)
+if inUse > 0 {
+continue
+}
+
+return certificateID, true
+}
+return 0, false
+}
+
+// dualKeyTypes returns the ECDSA and RSA key types of a dual certificate pair:
+// the account default for its family and ec256/rsa2048 for the other
+func (s *ACMEService) dualKeyTypes(accountID int) (string, string, error) {
+var account models.ACMEAccount
+if err := db.DB.First(&account, accountID).Error; err != nil {
+return "", "", ErrACMEAccountNotFound
+}
+if isECDSAKeyType(account.DefaultKeyType) {
+return account.DefaultKeyType, KeyTypeRSA2048, nil
+}
+if account.DefaultKeyType != "" {
+return KeyTypeEC256, account.DefaultKeyType, nil
+}
+return KeyTypeEC256, KeyTypeRSA2048, nil
+}
+
+// provisioningAccount returns the account a website issues with: its own, or
+// the first active account of its provider
+func (s *ACMEService) provisioningAccount(https *models.WebsiteHTTPS) (int, error) {
+if https.ACMEAccountID != nil {
+return *https.ACMEAccountID, nil
+}
+if https.ACMEProviderID == nil {
+return 0, ErrACMEAccountNotFound
+}
+
+var account models.ACMEAccount
+if err := db.DB.Where("provider_id = ? AND status = ?", *https.ACMEProviderID, "active").
+Order("id ASC").
+First(&account).Error; err != nil {
+return 0, fmt.Errorf("no active acme account for provider %d", *https.ACMEProviderID)
+}
+return account.ID, nil
+}
+
+// certificateCovers reports whether a live certificate covers every domain.
+// With a keyType, its key must also be of the same family (ECDSA or RSA).
+func (s *ACMEService) certificateCovers(certificateID int, domains []string, keyType string) bool {
+var cert models.Certificate
+if err := db.DB.First(&cert, certificateID).Error; err != nil {
+return false
+}
+if cert.ReplacedByID != nil || cert.Status == "revoked" || (cert.ExpireAt != nil && cert.ExpireAt.Before(time.Now())) {
+return false
+}
+if keyType != "" && isECDSAKeyType(keyType) != isECDSAKeyType(cert.KeyType) {
+return false
+}
+
+var certDomains []models.CertificateDomain
+if err := db.DB.Where("certificate_id = ?", certificateID).Find(&certDomains).Error; err != nil {
+return false
+}
+certDomainSet := make(map[string]bool)
+for _, cd := range certDomains {
+certDomainSet[utils.ToASCII(cd.Domain)] = true
+}
+for _, domain := range domains {
+if !s.certificateService.isDomainCovered(domain, certDomainSet) {
+return false
+}
+}
+return true
+}
+
+// bindProvisionedCertificate makes a certificate (and the RSA certificate of
+// a dual pair) the active one of a website that is still issuing. ACME
+// certificates they supersede are no longer renewed once nothing else uses
+// them.
+func (s *ACMEService) bindProvisionedCertificate(websiteID, certificateID int, rsaCertificateID *int) error {
+return db.DB.Transaction(func(tx *gorm.DB) error {
+var https models.WebsiteHTTPS
+if err := tx.Where("website_id = ?", websiteID).First(&https).Error; err != nil {
+return err
+}
+if https.ProvisionStatus != "issuing" {
+// Domains changed meanwhile, provisioned again on the next run
+return nil
+}
+oldID := https.CertificateID
+oldRSAID := https.RSACertificateID
+
+if err := tx.Model(&https).Updates(map[string]interface{}{
+"certificate_id":     certificateID,
+"rsa_certificate_id": rsaCertificateID,
+"provision_status":   "active",
+"provision_error":    nil,
+}).Error; err != nil {
+return err
+}
+
+// Set old binding is_active=0
+if err := tx.Model(&models.CertificateBinding{}).
+Where("bind_type = ? AND bind_id = ? AND is_active = ? AND certificate_id <> ?", "website", websiteID, true, certificateID).
+Update("is_active", false).Error; err != nil {
+return err
+}
+
+var active int64
+if err := tx.Model(&models.CertificateBinding{}).
+Where("bind_type = ? AND bind_id = ? AND is_active = ?", "website", websiteID, true).
+Count(&active).Error; err != nil {
+return err
+}
+if active == 0 {
+binding := models.CertificateBinding{
+CertificateID: certificateID,
+BindType:      "website",
+BindID:        websiteID,
+IsActive:      true,
+}
+if err := tx.Create(&binding).Error; err != nil {
+return err
+}
+}
+
+if oldID != nil && *oldID != certificateID {
+if err := s.retireCertificate(tx, *oldID, certificateID); err != nil {
+return err
+}
+}
+if oldRSAID != nil && (rsaCertificateID == nil || *oldRSAID != *rsaCertificateID) && *oldRSAID != certificateID {
+replacement := certificateID
+if rsaCertificateID != nil {
+replacement = *rsaCertificateID
+}
+if err := s.retireCertificate(tx, *oldRSAID, replacement); err != nil {
+return err
+}
+}
+
+return s.configVersionService.BumpVersion(tx, fmt.Sprintf("cert:provision:%d", websiteID))
+})
+}
+
+// retireCertificate stops renewing an ACME certificate superseded by a
+// provisioned one unless another binding or website still uses it
+func (s *ACMEService) retireCertificate(tx *gorm.DB, oldID, newID int) error {
+var inUse int64
+if err := tx.Model(&models.CertificateBinding{}).
+Where("certificate_id = ? AND is_active = ?", oldID, true).
+Count(&inUse).Error; err != nil {
+return err
+}
+if inUse > 0 {
+return nil
+}
+if err := tx.Model(&models.WebsiteHTTPS{}).
+Where("certificate_id = ? OR rsa_certificate_id = ?", oldID, oldID).
+Count(&inUse).Error; err != nil {
+return err
+}
+if inUse > 0 {
+return nil
+}
+
+return tx.Model(&models.Certificate{}).
+Where("id = ? AND source = ? AND replaced_by_id IS NULL", oldID, "acme").
+Updates(map[string]interface{}{
+"replaced_by_id": newID,
+"renew_at":       nil,
+}).Error
+}
+
+// failProvisioning records why the certificate of a website could not be
+// provisioned
+func (s *ACMEService) failProvisioning(websiteID int, cause error) error {
+db.DB.Model(&models.WebsiteHTTPS{}).
+Where("website_id = ? AND provision_status = ?", websiteID, "issuing").
+Updates(map[string]interface{}{
+"provision_status": "failed",
+"provision_error":  truncateError(cause.Error()),
+})
+return fmt.Errorf("website %d: %w", websiteID, cause)
+}
+
+// ResetInterruptedProvisioning queues websites left issuing by a restart
+// again. Only ACMEWorker provisions, so none is issuing when it starts.
+func (s *ACMEService) ResetInterruptedProvisioning() error {
+return db.DB.Model(&models.WebsiteHTTPS{}).
+Where("provision_status = ?", "issuing").
+Update("provision_status", "pending").Error
 }
 
 // updateRequestStatus updates the status of a certificate request
@@ -329,46 +904,122 @@ return nil, ErrCertificateRequestNotFound
 return &request, nil
 }
 
-// CustomDNSProvider implements the challenge.Provider interface for lego
+// dns-01 challenge record settings
+const (
+challengeRecordTTL     = 60
+challengeVerifyTimeout = 10 * time.Minute
+challengePollInterval  = 3 * time.Second
+)
+
+// CustomDNSProvider implements the challenge.Provider interface for lego.
+// Challenge TXT records are domain_dns_records (owner=acme_challenge,
+// owner_id=request ID) published by DNSSyncWorker like any other record.
 type CustomDNSProvider struct {
 dnsRecordService *DNSRecordService
 requestID        int
 }
 
-// Present creates a TXT record to fulfill the dns-01 challenge
+// NewCustomDNSProvider creates the dns-01 solver of a certificate request
+func NewCustomDNSProvider(dnsRecordService *DNSRecordService, requestID int) *CustomDNSProvider {
+return &CustomDNSProvider{
+dnsRecordService: dnsRecordService,
+requestID:        requestID,
+}
+}
+
+// Present creates the TXT record for the dns-01 challenge in the most specific
+// managed zone and waits until DNSSyncWorker has verified it on all
+// authoritative nameservers
 func (p *CustomDNSProvider) Present(domain, token, keyAuth string) error {
-fqdn, value := dns01.GetRecord(domain, keyAuth)
+// EffectiveFQDN follows a CNAME on _acme-challenge to a delegated name
+info := dns01.GetChallengeInfo(domain, keyAuth)
+fqdn := utils.ToASCII(info.EffectiveFQDN)
 
-// Create DNS TXT record
-// Note: This is a simplified implementation
-// In production, you would need to:
-// 1. Find the zone for the domain
-// 2. Create the TXT record via DNS provider API
-// 3. Wait for DNS propagation
+zone, err := findManagedZone(db.DB, fqdn)
+if err != nil {
+return err
+}
+if zone == nil {
+return noZoneError(fqdn)
+}
+
+record := &models.DomainDNSRecord{
+DomainID:  zone.ID,
+Type:      "TXT",
+Name:      utils.CalculateRelativeName(fqdn, zone.Domain),
+Value:     info.Value,
+TTL:       challengeRecordTTL,
+Status:    "pending",
+OwnerType: "acme_challenge",
+OwnerID:   p.requestID,
+}
+if err := createOrReviveRecord(db.DB, record); err != nil {
+return fmt.Errorf("failed to create challenge record for %s: %w", fqdn, err)
+}
 
-fmt.Printf("DNS-01 Challenge: Create TXT record for %s with value %s\n", fqdn, value)
+p.dnsRecordService.wakeSyncWorker()
+return p.waitVerified(record.ID, fqdn)
+}
 
-// TODO: Implement actual DNS record creation via dnsRecordService
-// This would involve:
-// - Finding the appropriate zone
-// - Creating a domain_dns_records entry with type=TXT, owner=acme_challenge
-// - Waiting for dns_sync_worker to propagate the record
+// waitVerified polls a challenge record until it is verified, failed or the
+// timeout is reached
+func (p *CustomDNSProvider) waitVerified(recordID int, fqdn string) error {
+deadline := time.Now().Add(challengeVerifyTimeout)
+for {
+var record models.DomainDNSRecord
+if err := db.DB.First(&record, recordID).Error; err != nil {
+return fmt.Errorf("challenge record for %s: %w", fqdn, err)
+}
 
+switch record.Status {
+case "verified":
 return nil
+case "error":
+lastError := "unknown error"
+if record.LastError != nil {
+lastError = *record.LastError
+}
+return fmt.Errorf("failed to publish challenge record for %s: %s", fqdn, lastError)
+case "deleting":
+return fmt.Errorf("challenge record for %s was deleted", fqdn)
 }
 
-// CleanUp removes the TXT record after the challenge is complete
-func (p *CustomDNSProvider) CleanUp(domain, token, keyAuth string) error {
-fqdn, _ := dns01.GetRecord(domain, keyAuth)
+if time.Now().After(deadline) {
+return fmt.Errorf("%w: %s is still %s", ErrDNSChallengeTimeout, fqdn, record.Status)
+}
+time.Sleep(challengePollInterval)
+}
+}
 
-fmt.Printf("DNS-01 Challenge: Clean up TXT record for %s\n", fqdn)
+// CleanUp queues the challenge TXT record for deletion. The value identifies
+// the record, so this also works if the zone changed since Present.
+func (p *CustomDNSProvider) CleanUp(domain, token, keyAuth string) error {
+info := dns01.GetChallengeInfo(domain, keyAuth)
 
-// TODO: Implement actual DNS record cleanup
+if err := QueueRecordDeletion(db.DB, "owner_type = ? AND owner_id = ? AND type = ? AND value = ?",
+"acme_challenge", p.requestID, "TXT", info.Value); err != nil {
+return fmt.Errorf("failed to clean up challenge record for %s: %w", info.EffectiveFQDN, err)
+}
 
+p.dnsRecordService.wakeSyncWorker()
 return nil
 }
 
-// Timeout returns the timeout for the DNS challenge
+// Timeout returns how long lego checks propagation after Present. Present
+// only returns once the record is verified, so this is a safety margin.
 func (p *CustomDNSProvider) Timeout() (timeout, interval time.Duration) {
 return 120 * time.Second, 2 * time.Second
 }
+
+// cleanupChallengeRecords removes every dns-01 record and http-01 token of a
+// request, including those lego did not clean up after a failed order
+func (s *ACMEService) cleanupChallengeRecords(requestID int) {
+if err := cleanupHTTPChallenges(requestID); err != nil {
+log.Printf("[ACME] Failed to clean up http challenges of request %d: %v", requestID, err)
+}
+if err := QueueRecordDeletion(db.DB, "owner_type = ? AND owner_id = ?", "acme_challenge", requestID); err != nil {
+log.Printf("[ACME] Failed to clean up challenge records of request %d: %v", requestID, err)
+return
+}
+s.dnsRecordService.wakeSyncWorker()
+}
@@ -1,8 +1,12 @@
 package service
 
 import (
+	"sort"
+	"time"
+
 	"github.com/labubu-daydayone/go_cmdb_web/backend/internal/database"
 	"github.com/labubu-daydayone/go_cmdb_web/backend/internal/models"
+	"github.com/labubu-daydayone/go_cmdb_web/backend/pkg/ocspstaple"
 )
 
 // AgentService handles agent-related operations
@@ -26,6 +30,7 @@ type CertificateListResponse struct {
 	IssueAt        *string  `json:"issue_at"`
 	ExpireAt       *string  `json:"expire_at"`
 	Fingerprint    string   `json:"fingerprint"`
+	KeyType        string   `json:"key_type"`
 	Domains        []string `json:"domains"`
 	RenewMode      string   `json:"renew_mode"`
 	RenewAt        *string  `json:"renew_at"`
@@ -40,6 +45,7 @@ type CertificateDetailResponse struct {
 	IssueAt        *string  `json:"issue_at"`
 	ExpireAt       *string  `json:"expire_at"`
 	Fingerprint    string   `json:"fingerprint"`
+	KeyType        string   `json:"key_type"`
 	CertificatePEM string   `json:"certificate_pem"`
 	PrivateKeyPEM  string   `json:"private_key_pem"`
 	Domains        []string `json:"domains"`
@@ -93,6 +99,7 @@ func (s *AgentService) GetAllCertificates() ([]CertificateListResponse, error) {
 			IssueAt:     issueAt,
 			ExpireAt:    expireAt,
 			Fingerprint: cert.Fingerprint,
+			KeyType:     cert.KeyType,
 			Domains:     domains,
 			RenewMode:   cert.RenewMode,
 			RenewAt:     renewAt,
@@ -102,6 +109,16 @@ func (s *AgentService) GetAllCertificates() ([]CertificateListResponse, error) {
 	return result, nil
 }
 
+// GetHTTPChallenge returns the key authorization for an http-01 token, the
+// fast path for nodes that receive a validation request before their task
+func (s *AgentService) GetHTTPChallenge(token string) (*models.ACMEHTTPChallenge, error) {
+	var challenge models.ACMEHTTPChallenge
+	if err := database.DB.Where("token = ?", token).First(&challenge).Error; err != nil {
+		return nil, ErrHTTPChallengeNotFound
+	}
+	return &challenge, nil
+}
+
 // GetCertificateByID returns detailed certificate information including PEM data
 func (s *AgentService) GetCertificateByID(id int) (*CertificateDetailResponse, error) {
 	var cert models.Certificate
@@ -144,14 +161,60 @@ func (s *AgentService) GetCertificateByID(id int) (*CertificateDetailResponse, e
 		IssueAt:        issueAt,
 		ExpireAt:       expireAt,
 		Fingerprint:    cert.Fingerprint,
+		KeyType:        cert.KeyType,
 		CertificatePEM: cert.CertificatePEM,
-		PrivateKeyPEM:  cert.PrivateKeyPEM,
+		PrivateKeyPEM:  string(cert.PrivateKeyPEM),
 		Domains:        domains,
 		RenewMode:      cert.RenewMode,
 		RenewAt:        renewAt,
 	}, nil
 }
 
+// CertificateOCSPStaple is the OCSP response an agent staples for a certificate
+type CertificateOCSPStaple struct {
+	CertificateID int     `json:"certificate_id"`
+	Status        string  `json:"status"`   // good, revoked or unknown
+	Response      []byte  `json:"response"` // DER encoded, base64 in JSON
+	ThisUpdate    *string `json:"this_update"`
+	NextUpdate    *string `json:"next_update"` // Stop stapling after this time
+	RefreshAt     string  `json:"refresh_at"`  // A newer response is fetched at this time
+}
+
+// GetCertificateOCSP returns the cached OCSP response of a certificate, as
+// long as it is valid. Responses are fetched by the OCSP worker for
+// certificates in use
+func (s *AgentService) GetCertificateOCSP(id int) (*CertificateOCSPStaple, error) {
+	var row models.CertificateOCSPResponse
+	if err := database.DB.Where("certificate_id = ?", id).First(&row).Error; err != nil {
+		return nil, ErrOCSPResponseNotFound
+	}
+	if row.Status == OCSPStatusNone || len(row.Response) == 0 || row.ThisUpdate == nil {
+		return nil, ErrOCSPResponseNotFound
+	}
+
+	var nextUpdate time.Time
+	if row.NextUpdate != nil {
+		nextUpdate = *row.NextUpdate
+	}
+	if !ocspstaple.ValidAt(*row.ThisUpdate, nextUpdate, time.Now()) {
+		return nil, ErrOCSPResponseNotFound
+	}
+
+	thisUpdateStr := row.ThisUpdate.UTC().Format("2006-01-02T15:04:05Z")
+	staple := &CertificateOCSPStaple{
+		CertificateID: id,
+		Status:        row.Status,
+		Response:      row.Response,
+		ThisUpdate:    &thisUpdateStr,
+		RefreshAt:     row.RefreshAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if row.NextUpdate != nil {
+		ts := row.NextUpdate.UTC().Format("2006-01-02T15:04:05Z")
+		staple.NextUpdate = &ts
+	}
+	return staple, nil
+}
+
 // AgentConfigResponse represents the complete configuration for an agent node
 type AgentConfigResponse struct {
 	Version       int                        `json:"version"`
@@ -184,6 +247,15 @@ type WebsiteHTTPSConfig struct {
 	Enabled       bool   `json:"enabled"`
 	ForceHTTPS    bool   `json:"force_https"`
 	CertificateID *int   `json:"certificate_id"`
+	Certificates  []WebsiteCertificateRef `json:"certificates"`
+}
+
+// WebsiteCertificateRef is a certificate an edge serves for a website.
+// Certificates are listed ECDSA first: clients that support ECDSA get the
+// ECDSA certificate, others the RSA one of a dual pair.
+type WebsiteCertificateRef struct {
+	ID      int    `json:"id"`
+	KeyType string `json:"key_type"`
 }
 
 type CacheRuleConfig struct {
@@ -213,6 +285,35 @@ type LineGroupConfig struct {
 	NodeGroupID int    `json:"node_group_id"`
 }
 
+// websiteCertificateRefs returns the certificates of a website with their key
+// types, ECDSA before RSA
+func websiteCertificateRefs(https *models.WebsiteHTTPS) ([]WebsiteCertificateRef, error) {
+	ids := make([]int, 0, 2)
+	if https.CertificateID != nil {
+		ids = append(ids, *https.CertificateID)
+	}
+	if https.RSACertificateID != nil && (https.CertificateID == nil || *https.RSACertificateID != *https.CertificateID) {
+		ids = append(ids, *https.RSACertificateID)
+	}
+
+	refs := make([]WebsiteCertificateRef, 0, len(ids))
+	if len(ids) == 0 {
+		return refs, nil
+	}
+
+	var certificates []models.Certificate
+	if err := database.DB.Select("id", "key_type").Where("id IN ?", ids).Find(&certificates).Error; err != nil {
+		return nil, err
+	}
+	for _, cert := range certificates {
+		refs = append(refs, WebsiteCertificateRef{ID: cert.ID, KeyType: cert.KeyType})
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		return isECDSAKeyType(refs[i].KeyType) && !isECDSAKeyType(refs[j].KeyType)
+	})
+	return refs, nil
+}
+
 // GetConfig returns the complete CDN configuration for the agent
 func (s *AgentService) GetConfig() (*AgentConfigResponse, error) {
 	// Get current config version
@@ -267,6 +368,11 @@ func (s *AgentService) GetConfig() (*AgentConfigResponse, error) {
 			return nil, err
 		}
 
+		certificates, err := websiteCertificateRefs(&websiteHTTPS)
+		if err != nil {
+			return nil, err
+		}
+
 		// Get cache rules
 		var cacheRules []models.CacheRule
 		if err := database.DB.Where("id IN (?)", database.DB.Table("cache_rules").Select("id")).Find(&cacheRules).Error; err != nil {
@@ -306,8 +412,9 @@ func (s *AgentService) GetConfig() (*AgentConfigResponse, error) {
 			},
 			HTTPS: WebsiteHTTPSConfig{
 				Enabled:       websiteHTTPS.Enabled,
-				ForceHTTPS:    websiteHTTPS.ForceHTTPS,
+				ForceHTTPS:    websiteHTTPS.ForceRedirect,
 				CertificateID: websiteHTTPS.CertificateID,
+				Certificates:  certificates,
 			},
 			CacheRules: cacheRuleConfigs,
 		})
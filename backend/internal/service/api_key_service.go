@@ -23,7 +23,7 @@ func NewAPIKeyService() *APIKeyService {
 // CreateAPIKeyRequest represents request to create an API key
 type CreateAPIKeyRequest struct {
 	Name      string  `json:"name" binding:"required"`
-	Provider  string  `json:"provider" binding:"required"` // cloudflare
+	Provider  string  `json:"provider" binding:"required"` // cloudflare, aliyun, tencent, route53
 	Account   *string `json:"account"`
 	APIToken  string  `json:"api_token" binding:"required"`
 }
@@ -50,7 +50,7 @@ func (s *APIKeyService) CreateAPIKey(req CreateAPIKeyRequest) (*models.APIKey, e
 		Name:     req.Name,
 		Provider: req.Provider,
 		Account:  req.Account,
-		APIToken: req.APIToken,
+		APIToken: models.EncryptedString(req.APIToken),
 		Status:   "active",
 	}
 
@@ -98,21 +98,6 @@ func (s *APIKeyService) GetAPIKey(id int) (*models.APIKey, error) {
 	return &apiKey, nil
 }
 
-// GetAPIKeyByToken returns an API key by token
-func (s *APIKeyService) GetAPIKeyByToken(token string) (*models.APIKey, error) {
-	var apiKey models.APIKey
-	if err := database.DB.Where("token = ? AND status = ?", token, "active").First(&apiKey).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrAPIKeyNotFound
-		}
-		return nil, err
-	}
-
-	// Status check is already done in query
-
-	return &apiKey, nil
-}
-
 // UpdateAPIKey updates an API key
 func (s *APIKeyService) UpdateAPIKey(id int, req UpdateAPIKeyRequest) (*models.APIKey, error) {
 	db := database.DB
@@ -133,7 +118,7 @@ func (s *APIKeyService) UpdateAPIKey(id int, req UpdateAPIKeyRequest) (*models.A
 		updates["account"] = *req.Account
 	}
 	if req.APIToken != nil {
-		updates["api_token"] = *req.APIToken
+		updates["api_token"] = models.EncryptedString(*req.APIToken)
 	}
 	if req.Status != nil {
 		updates["status"] = *req.Status
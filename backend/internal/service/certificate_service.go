@@ -1,25 +1,45 @@
 package service
 
 import (
+"archive/zip"
+"bytes"
+"crypto"
 "crypto/sha256"
 "crypto/x509"
+"encoding/base64"
 "encoding/hex"
 "encoding/pem"
 "errors"
 "fmt"
+"log"
 "strings"
 "time"
 
 "github.com/labubu-daydayone/go_cmdb_web/backend/internal/db"
 "github.com/labubu-daydayone/go_cmdb_web/backend/internal/models"
+"github.com/labubu-daydayone/go_cmdb_web/backend/internal/utils"
+"github.com/labubu-daydayone/go_cmdb_web/backend/pkg/certchain"
+"github.com/labubu-daydayone/go_cmdb_web/backend/pkg/pkcs12"
 )
 
 // Certificate service errors
 var (
 ErrCertificateNotFound         = errors.New("certificate not found")
-ErrInvalidCertificatePEM       = errors.New("invalid certificate PEM format")
-ErrInvalidPrivateKeyPEM        = errors.New("invalid private key PEM format")
-ErrCertificateExpired          = errors.New("certificate has expired")
+ErrInvalidCertificatePEM       = certchain.ErrInvalidCertificate
+ErrNoCertificatePEM            = certchain.ErrNoCertificate
+ErrInvalidPrivateKeyPEM        = certchain.ErrInvalidPrivateKey
+ErrCertificateKeyMismatch      = certchain.ErrKeyMismatch
+ErrCertificateExpired          = certchain.ErrExpired
+ErrCertificateNotYetValid      = certchain.ErrNotYetValid
+ErrCertificateChainInvalid     = certchain.ErrUnrelatedCertificate
+ErrCertificateAlreadyExists    = errors.New("certificate already exists")
+ErrCertificateNoDomains        = errors.New("certificate has no valid domains")
+ErrPrivateKeyPasswordRequired  = errors.New("private key is encrypted, private_key_password is required")
+ErrIncorrectPassword           = pkcs12.ErrIncorrectPassword
+ErrInvalidPKCS12               = pkcs12.ErrInvalidData
+ErrPKCS12NoPrivateKey          = pkcs12.ErrNoPrivateKey
+ErrPKCS12NoCertificate         = pkcs12.ErrNoCertificate
+ErrExportPasswordRequired      = errors.New("password is required for PKCS#12 export")
 ErrDomainNotCovered            = errors.New("website domains not covered by certificate")
 ErrActiveBindingExists         = errors.New("website already has an active certificate binding")
 ErrBindingNotFound             = errors.New("certificate binding not found")
@@ -35,14 +55,53 @@ websiteService       *WebsiteService
 func NewCertificateService() *CertificateService {
 return &CertificateService{
 configVersionService: NewConfigVersionService(),
-websiteService:       NewWebsiteService(),
+websiteService:       NewWebsiteService(nil),
 }
 }
 
 // UploadCertificateRequest represents the request to upload a certificate
 type UploadCertificateRequest struct {
-CertificatePEM string `json:"certificate_pem" binding:"required"`
-PrivateKeyPEM  string `json:"private_key_pem" binding:"required"`
+CertificatePEM     string `json:"certificate_pem" binding:"required"`
+PrivateKeyPEM      string `json:"private_key_pem" binding:"required"`
+// CompleteChain fills missing intermediates from the embedded intermediate bundle
+CompleteChain      bool   `json:"complete_chain"`
+// PrivateKeyPassword decrypts an encrypted PKCS#8 key ("ENCRYPTED PRIVATE KEY")
+PrivateKeyPassword string `json:"private_key_password"`
+}
+
+// ImportPKCS12Request represents the request to import a PKCS#12 bundle
+type ImportPKCS12Request struct {
+PFX           string `json:"pfx" binding:"required"` // base64 of the .pfx/.p12 file
+Password      string `json:"password"`
+CompleteChain bool   `json:"complete_chain"`
+}
+
+// Certificate export formats
+const (
+ExportFormatPEM    = "pem"    // one PEM bundle: certificate, chain and optionally the key
+ExportFormatPKCS12 = "pkcs12" // password protected .pfx, always with the key
+ExportFormatFiles  = "files"  // zip of cert.pem, chain.pem, fullchain.pem and optionally privkey.pem
+)
+
+// ExportCertificateRequest represents the request to export a certificate
+type ExportCertificateRequest struct {
+ID         int    `json:"id" binding:"required"`
+Format     string `json:"format" binding:"required,oneof=pem pkcs12 files"`
+IncludeKey bool   `json:"include_key"`
+Password   string `json:"password"` // PKCS#12 password
+Legacy     bool   `json:"legacy"`   // PKCS#12 with 3DES and SHA-1 for old clients
+}
+
+// IncludesPrivateKey reports whether the export contains the private key
+func (r ExportCertificateRequest) IncludesPrivateKey() bool {
+return r.IncludeKey || r.Format == ExportFormatPKCS12
+}
+
+// CertificateExport is an exported certificate file
+type CertificateExport struct {
+Filename    string
+ContentType string
+Data        []byte
 }
 
 // UploadCertificateResponse represents the response after uploading a certificate
@@ -52,6 +111,12 @@ Domains       []string `json:"domains"`
 IssueAt       string   `json:"issue_at"`
 ExpireAt      string   `json:"expire_at"`
 Fingerprint   string   `json:"fingerprint"`
+KeyType       string   `json:"key_type"`
+ChainLength   int      `json:"chain_length"`
+Reordered     bool     `json:"reordered"`
+Completed     int      `json:"completed"`
+Trusted       bool     `json:"trusted"`
+Warnings      []string `json:"warnings"`
 }
 
 // BindCertificateRequest represents the request to bind a certificate to a website
@@ -66,33 +131,26 @@ WebsiteID int `json:"website_id" binding:"required"`
 }
 
 // WF-06: Upload Certificate (manual)
-// 1. Parse cert PEM -> get SAN list
-// 2. Compute fingerprint
-// 3. Insert certificates(provider=manual, source=manual, renew_mode=manual)
-// 4. Insert certificate_domains (one row per SAN)
-// 5. Return certificate_id
+// 1. Validate chain: key matches leaf, leaf not expired, issuing order,
+//    intermediates completed from the bundle when requested
+// 2. Parse leaf -> get SAN list
+// 3. Compute fingerprint
+// 4. Insert certificates(provider=manual, source=manual, renew_mode=manual)
+// 5. Insert certificate_domains (one row per SAN)
+// 6. Return certificate_id and chain warnings
 func (s *CertificateService) UploadCertificate(req UploadCertificateRequest) (*UploadCertificateResponse, error) {
-// Parse certificate PEM
-block, _ := pem.Decode([]byte(req.CertificatePEM))
-if block == nil || block.Type != "CERTIFICATE" {
-return nil, ErrInvalidCertificatePEM
-}
-
-cert, err := x509.ParseCertificate(block.Bytes)
+keyPEM, err := decryptPrivateKeyPEM(req.PrivateKeyPEM, req.PrivateKeyPassword)
 if err != nil {
-return nil, fmt.Errorf("failed to parse certificate: %w", err)
-}
-
-// Validate private key PEM
-keyBlock, _ := pem.Decode([]byte(req.PrivateKeyPEM))
-if keyBlock == nil {
-return nil, ErrInvalidPrivateKeyPEM
+return nil, err
 }
 
-// Check if certificate is expired
-if time.Now().After(cert.NotAfter) {
-return nil, ErrCertificateExpired
+chain, err := certchain.Validate(req.CertificatePEM, keyPEM, certchain.Options{
+CompleteChain: req.CompleteChain,
+})
+if err != nil {
+return nil, err
 }
+cert := chain.Leaf
 
 // Extract SAN list (Subject Alternative Names)
 domains := make([]string, 0)
@@ -114,7 +172,7 @@ domains = append(domains, cert.Subject.CommonName)
 }
 
 if len(domains) == 0 {
-return nil, errors.New("certificate has no valid domains")
+return nil, ErrCertificateNoDomains
 }
 
 // Compute fingerprint (SHA256 of DER bytes)
@@ -124,7 +182,7 @@ fingerprint := hex.EncodeToString(hash[:])
 // Check if certificate already exists
 var existingCert models.Certificate
 if err := db.DB.Where("fingerprint = ?", fingerprint).First(&existingCert).Error; err == nil {
-return nil, errors.New("certificate already exists")
+return nil, ErrCertificateAlreadyExists
 }
 
 // Begin transaction
@@ -143,8 +201,9 @@ Status:         "valid",
 IssueAt:        &cert.NotBefore,
 ExpireAt:       &cert.NotAfter,
 Fingerprint:    fingerprint,
-CertificatePEM: req.CertificatePEM,
-PrivateKeyPEM:  req.PrivateKeyPEM,
+KeyType:        certificateKeyType(cert.PublicKey),
+CertificatePEM: chain.ChainPEM,
+PrivateKeyPEM:  models.EncryptedString(keyPEM),
 RenewMode:      "manual",
 }
 
@@ -175,9 +234,190 @@ Domains:       domains,
 IssueAt:       cert.NotBefore.Format(time.RFC3339),
 ExpireAt:      cert.NotAfter.Format(time.RFC3339),
 Fingerprint:   fingerprint,
+KeyType:       certificate.KeyType,
+ChainLength:   len(chain.Chain),
+Reordered:     chain.Reordered,
+Completed:     chain.Completed,
+Trusted:       chain.Trusted,
+Warnings:      chain.Warnings,
 }, nil
 }
 
+// ImportPKCS12 imports the key and certificates of a PKCS#12 bundle, they go
+// through the same validation as an upload
+func (s *CertificateService) ImportPKCS12(req ImportPKCS12Request) (*UploadCertificateResponse, error) {
+data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(req.PFX))
+if err != nil {
+return nil, fmt.Errorf("%w: pfx must be base64 encoded", ErrInvalidPKCS12)
+}
+
+key, certs, err := pkcs12.Decode(data, req.Password)
+if err != nil {
+return nil, err
+}
+
+keyPEM, err := encodePrivateKeyPEM(key)
+if err != nil {
+return nil, err
+}
+
+return s.UploadCertificate(UploadCertificateRequest{
+CertificatePEM: certchain.EncodeCertificates(certs),
+PrivateKeyPEM:  keyPEM,
+CompleteChain:  req.CompleteChain,
+})
+}
+
+// ExportCertificate encodes a certificate for download. Exports containing
+// the private key are recorded in the audit log before anything is returned
+func (s *CertificateService) ExportCertificate(req ExportCertificateRequest, actor, clientIP string) (*CertificateExport, error) {
+if req.Format == ExportFormatPKCS12 && req.Password == "" {
+return nil, ErrExportPasswordRequired
+}
+
+var certificate models.Certificate
+if err := db.DB.First(&certificate, req.ID).Error; err != nil {
+return nil, ErrCertificateNotFound
+}
+
+certs, err := certchain.ParseCertificates(certificate.CertificatePEM)
+if err != nil {
+return nil, fmt.Errorf("failed to parse stored certificate: %w", err)
+}
+leafPEM := certchain.EncodeCertificates(certs[:1])
+chainPEM := certchain.EncodeCertificates(certs[1:])
+
+var keyPEM string
+var key crypto.Signer
+if req.IncludesPrivateKey() {
+if key, err = certchain.ParsePrivateKey(string(certificate.PrivateKeyPEM)); err != nil {
+return nil, fmt.Errorf("failed to parse stored private key: %w", err)
+}
+if keyPEM, err = encodePrivateKeyPEM(key); err != nil {
+return nil, err
+}
+}
+
+name := s.exportName(certificate.ID)
+export := &CertificateExport{}
+switch req.Format {
+case ExportFormatPEM:
+export.Filename = name + ".pem"
+export.ContentType = "application/x-pem-file"
+export.Data = []byte(leafPEM + chainPEM + keyPEM)
+case ExportFormatPKCS12:
+export.Filename = name + ".pfx"
+export.ContentType = "application/x-pkcs12"
+if export.Data, err = pkcs12.Encode(key, certs[0], certs[1:], req.Password, pkcs12.EncodeOptions{Legacy: req.Legacy}); err != nil {
+return nil, fmt.Errorf("failed to encode PKCS#12: %w", err)
+}
+case ExportFormatFiles:
+// Same names as certbot: name, content
+files := [][2]string{
+{"cert.pem", leafPEM},
+{"chain.pem", chainPEM},
+{"fullchain.pem", leafPEM + chainPEM},
+}
+if keyPEM != "" {
+files = append(files, [2]string{"privkey.pem", keyPEM})
+}
+var buf bytes.Buffer
+zw := zip.NewWriter(&buf)
+for _, f := range files {
+w, err := zw.Create(name + "/" + f[0])
+if err != nil {
+return nil, err
+}
+if _, err := w.Write([]byte(f[1])); err != nil {
+return nil, err
+}
+}
+if err := zw.Close(); err != nil {
+return nil, err
+}
+export.Filename = name + ".zip"
+export.ContentType = "application/zip"
+export.Data = buf.Bytes()
+default:
+return nil, fmt.Errorf("unsupported export format: %s", req.Format)
+}
+
+if req.IncludesPrivateKey() {
+detail := "format=" + req.Format
+if req.Format == ExportFormatPKCS12 && req.Legacy {
+detail += " legacy"
+}
+entry := models.CertificateAuditLog{
+CertificateID: certificate.ID,
+Action:        "export_key",
+Actor:         actor,
+ClientIP:      clientIP,
+Detail:        detail,
+}
+if err := db.DB.Create(&entry).Error; err != nil {
+return nil, fmt.Errorf("failed to record certificate audit log: %w", err)
+}
+log.Printf("[Certificate] Certificate %d: private key exported by %s from %s (%s)\n", certificate.ID, actor, clientIP, detail)
+}
+
+return export, nil
+}
+
+// ListAuditLogs returns the audit log of a certificate, newest first
+func (s *CertificateService) ListAuditLogs(certificateID, page, pageSize int) ([]models.CertificateAuditLog, int64, error) {
+var logs []models.CertificateAuditLog
+var total int64
+
+query := db.DB.Model(&models.CertificateAuditLog{}).Where("certificate_id = ?", certificateID)
+if err := query.Count(&total).Error; err != nil {
+return nil, 0, err
+}
+
+offset := (page - 1) * pageSize
+if err := query.Offset(offset).Limit(pageSize).Order("id DESC").Find(&logs).Error; err != nil {
+return nil, 0, err
+}
+
+return logs, total, nil
+}
+
+// exportName is the file name of an export: the first domain of the
+// certificate, or certificate-<id>
+func (s *CertificateService) exportName(certificateID int) string {
+var domain models.CertificateDomain
+if err := db.DB.Where("certificate_id = ?", certificateID).Order("id ASC").First(&domain).Error; err != nil {
+return fmt.Sprintf("certificate-%d", certificateID)
+}
+return strings.ReplaceAll(domain.Domain, "*", "_")
+}
+
+// decryptPrivateKeyPEM returns an encrypted PKCS#8 key as an unencrypted
+// PKCS#8 PEM, any other key is returned unchanged
+func decryptPrivateKeyPEM(keyPEM, password string) (string, error) {
+block, _ := pem.Decode([]byte(keyPEM))
+if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+return keyPEM, nil
+}
+if password == "" {
+return "", ErrPrivateKeyPasswordRequired
+}
+
+key, err := pkcs12.DecryptPKCS8PEM([]byte(keyPEM), password)
+if err != nil {
+return "", err
+}
+return encodePrivateKeyPEM(key)
+}
+
+// encodePrivateKeyPEM encodes key as an unencrypted PKCS#8 PEM
+func encodePrivateKeyPEM(key crypto.Signer) (string, error) {
+der, err := x509.MarshalPKCS8PrivateKey(key)
+if err != nil {
+return "", fmt.Errorf("failed to encode private key: %w", err)
+}
+return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
 // ListCertificates returns a paginated list of certificates
 func (s *CertificateService) ListCertificates(page, pageSize int, status string) ([]models.Certificate, int64, error) {
 var certificates []models.Certificate
@@ -298,7 +538,7 @@ return errors.New("website has no domains")
 // Validate coverage
 certDomainSet := make(map[string]bool)
 for _, cd := range certDomains {
-certDomainSet[cd.Domain] = true
+certDomainSet[utils.ToASCII(cd.Domain)] = true
 }
 
 for _, wd := range websiteDomains {
@@ -388,7 +628,10 @@ return &certificate, nil
 }
 
 // isDomainCovered checks if a domain is covered by certificate domains (supports wildcard)
+// certDomains must be keyed by punycode; IDN website domains are converted before matching
 func (s *CertificateService) isDomainCovered(domain string, certDomains map[string]bool) bool {
+domain = utils.ToASCII(domain)
+
 // Exact match
 if certDomains[domain] {
 return true
@@ -0,0 +1,429 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/pkg/dnsprovider"
+	"gorm.io/gorm"
+)
+
+// DNS consistency issue kinds
+const (
+	DNSIssueOrphan         = "orphan"          // Owner node group, line group or website domain no longer exists
+	DNSIssueCNAMEConflict  = "cname_conflict"  // CNAME next to other records at the same name and line
+	DNSIssueDuplicateOwner = "duplicate_owner" // Several owners publish A/AAAA/CNAME at the same name and line
+)
+
+// Bulk operations that run a consistency check afterwards
+const (
+	DNSCheckSourceZoneFile    = "zonefile_import"
+	DNSCheckSourceRecordBatch = "record_batch"
+	DNSCheckSourcePlan        = "dns_plan"
+)
+
+// staleChallengeAge is how long an ACME challenge record may exist before it
+// counts as an orphan; validations finish within minutes
+const staleChallengeAge = 24 * time.Hour
+
+// ownerModels are the owners of managed records by owner_type. Manual
+// records have no owner; ACME challenges are checked by age.
+var ownerModels = map[string]interface{}{
+	"node_group":     &models.NodeGroup{},
+	"line_group":     &models.LineGroup{},
+	"website_domain": &models.WebsiteDomain{},
+}
+
+// DNSCheckService finds domain_dns_records that point at deleted owners or
+// conflict with each other. Only orphans are cleaned up automatically;
+// conflicts need a decision which owner keeps the name.
+type DNSCheckService struct {
+	dnsRecordService *DNSRecordService
+}
+
+func NewDNSCheckService(dnsRecordService *DNSRecordService) *DNSCheckService {
+	return &DNSCheckService{
+		dnsRecordService: dnsRecordService,
+	}
+}
+
+// DNSCheckReport is the result of a consistency check
+type DNSCheckReport struct {
+	DomainID   int             `json:"domain_id"` // 0 = all zones
+	Records    int             `json:"records"`   // Records checked (not queued for deletion)
+	Orphans    int             `json:"orphans"`
+	Conflicts  int             `json:"conflicts"`
+	Duplicates int             `json:"duplicates"`
+	Issues     []DNSCheckIssue `json:"issues"`
+}
+
+// DNSCheckIssue is one inconsistency and the records involved
+type DNSCheckIssue struct {
+	Kind     string           `json:"kind"` // orphan, cname_conflict, duplicate_owner
+	DomainID int              `json:"domain_id"`
+	Zone     string           `json:"zone"`
+	Name     string           `json:"name"`
+	Line     string           `json:"line,omitempty"`
+	Detail   string           `json:"detail"`
+	Records  []DNSCheckRecord `json:"records"`
+}
+
+// DNSCheckRecord identifies a record of an issue
+type DNSCheckRecord struct {
+	ID        int    `json:"id"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Status    string `json:"status"`
+	OwnerType string `json:"owner_type"`
+	OwnerID   int    `json:"owner_id"`
+}
+
+// DNSCleanupResult lists the orphaned records queued for deletion
+type DNSCleanupResult struct {
+	DryRun    bool            `json:"dry_run"`
+	RecordIDs []int           `json:"record_ids"`
+	Report    *DNSCheckReport `json:"report"`
+}
+
+// DNSCheckRunInfo is a stored check run with its issues
+type DNSCheckRunInfo struct {
+	models.DNSCheckRun
+	Issues []DNSCheckIssue `json:"issues"`
+}
+
+// Check checks the records of a zone, or of all zones when domainID is 0
+func (s *DNSCheckService) Check(domainID int) (*DNSCheckReport, error) {
+	return checkRecords(database.DB, domainID)
+}
+
+// Cleanup queues orphaned records for deletion (status=deleting) so that the
+// DNS sync worker removes them from the provider. Conflicts and duplicate
+// owners are reported but never touched.
+func (s *DNSCheckService) Cleanup(domainID int, dryRun bool) (*DNSCleanupResult, error) {
+	result := &DNSCleanupResult{DryRun: dryRun, RecordIDs: []int{}}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		report, err := checkRecords(tx, domainID)
+		if err != nil {
+			return err
+		}
+		result.Report = report
+
+		for _, issue := range report.Issues {
+			if issue.Kind != DNSIssueOrphan {
+				continue
+			}
+			for _, record := range issue.Records {
+				result.RecordIDs = append(result.RecordIDs, record.ID)
+			}
+		}
+
+		if dryRun || len(result.RecordIDs) == 0 {
+			return nil
+		}
+		return QueueRecordDeletion(tx, "id IN ?", result.RecordIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun && len(result.RecordIDs) > 0 {
+		log.Printf("[DNSCheck] Queued %d orphaned records for deletion: %v", len(result.RecordIDs), result.RecordIDs)
+		s.dnsRecordService.wakeSyncWorker()
+	}
+	return result, nil
+}
+
+// RunCheck checks the records after a bulk operation and stores the result
+// in dns_check_runs. Issues are logged; nothing is cleaned up.
+func (s *DNSCheckService) RunCheck(source string, domainID int) {
+	report, err := s.Check(domainID)
+	if err != nil {
+		log.Printf("[DNSCheck] Check after %s failed: %v", source, err)
+		return
+	}
+
+	issues, err := json.Marshal(report.Issues)
+	if err != nil {
+		log.Printf("[DNSCheck] Failed to encode issues: %v", err)
+		return
+	}
+	run := &models.DNSCheckRun{
+		Source:     source,
+		DomainID:   domainID,
+		Records:    report.Records,
+		Orphans:    report.Orphans,
+		Conflicts:  report.Conflicts,
+		Duplicates: report.Duplicates,
+		Report:     string(issues),
+	}
+	if err := database.DB.Create(run).Error; err != nil {
+		log.Printf("[DNSCheck] Failed to save check run: %v", err)
+		return
+	}
+
+	if len(report.Issues) > 0 {
+		log.Printf("[DNSCheck] %s: %d orphans, %d CNAME conflicts, %d duplicate owners (run %d)",
+			source, report.Orphans, report.Conflicts, report.Duplicates, run.ID)
+	}
+}
+
+// ListRuns returns the stored check runs, newest first
+func (s *DNSCheckService) ListRuns(page, pageSize int) ([]DNSCheckRunInfo, int64, error) {
+	var runs []models.DNSCheckRun
+	var total int64
+
+	query := database.DB.Model(&models.DNSCheckRun{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count DNS check runs: %w", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&runs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get DNS check runs: %w", err)
+	}
+
+	result := make([]DNSCheckRunInfo, 0, len(runs))
+	for _, run := range runs {
+		info := DNSCheckRunInfo{DNSCheckRun: run, Issues: []DNSCheckIssue{}}
+		if err := json.Unmarshal([]byte(run.Report), &info.Issues); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode DNS check run %d: %w", run.ID, err)
+		}
+		result = append(result, info)
+	}
+
+	return result, total, nil
+}
+
+// checkRecords finds orphans, CNAME conflicts and duplicate owners among the
+// records that are not queued for deletion
+func checkRecords(db *gorm.DB, domainID int) (*DNSCheckReport, error) {
+	query := db.Where("status <> ?", "deleting")
+	if domainID > 0 {
+		query = query.Where("domain_id = ?", domainID)
+	}
+	var records []models.DomainDNSRecord
+	if err := query.Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNS records: %w", err)
+	}
+
+	report := &DNSCheckReport{DomainID: domainID, Records: len(records), Issues: []DNSCheckIssue{}}
+
+	orphans, err := findOrphans(db, records)
+	if err != nil {
+		return nil, err
+	}
+	report.Issues = append(report.Issues, orphans...)
+	report.Issues = append(report.Issues, findConflicts(records)...)
+
+	if err := setIssueZones(db, report.Issues); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i], report.Issues[j]
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Kind < b.Kind
+	})
+
+	for _, issue := range report.Issues {
+		switch issue.Kind {
+		case DNSIssueOrphan:
+			report.Orphans++
+		case DNSIssueCNAMEConflict:
+			report.Conflicts++
+		case DNSIssueDuplicateOwner:
+			report.Duplicates++
+		}
+	}
+	return report, nil
+}
+
+// findOrphans reports records whose owner row is gone, one issue per
+// record, and ACME challenge records older than staleChallengeAge
+func findOrphans(db *gorm.DB, records []models.DomainDNSRecord) ([]DNSCheckIssue, error) {
+	ownerIDs := make(map[string][]int)
+	for _, record := range records {
+		if _, ok := ownerModels[record.OwnerType]; ok {
+			ownerIDs[record.OwnerType] = append(ownerIDs[record.OwnerType], record.OwnerID)
+		}
+	}
+
+	existing := make(map[string]map[int]bool)
+	for ownerType, ids := range ownerIDs {
+		var found []int
+		if err := db.Model(ownerModels[ownerType]).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+			return nil, fmt.Errorf("failed to get %s owners: %w", ownerType, err)
+		}
+		existing[ownerType] = make(map[int]bool, len(found))
+		for _, id := range found {
+			existing[ownerType][id] = true
+		}
+	}
+
+	var issues []DNSCheckIssue
+	staleBefore := time.Now().Add(-staleChallengeAge)
+	for _, record := range records {
+		var detail string
+		switch {
+		case record.OwnerType == "acme_challenge" && record.CreatedAt.Before(staleBefore):
+			detail = fmt.Sprintf("ACME challenge record older than %s", staleChallengeAge)
+		case existing[record.OwnerType] != nil && !existing[record.OwnerType][record.OwnerID]:
+			detail = fmt.Sprintf("%s %d no longer exists", record.OwnerType, record.OwnerID)
+		default:
+			continue
+		}
+		issues = append(issues, DNSCheckIssue{
+			Kind:     DNSIssueOrphan,
+			DomainID: record.DomainID,
+			Name:     record.Name,
+			Line:     record.Line,
+			Detail:   detail,
+			Records:  []DNSCheckRecord{checkRecord(record)},
+		})
+	}
+	return issues, nil
+}
+
+// findConflicts groups records by zone, name and resolver view and reports
+// CNAMEs that share a name with other types, and A/AAAA/CNAME sets claimed by
+// more than one owner. Several CNAMEs of one owner are weighted line group
+// members and are fine.
+func findConflicts(records []models.DomainDNSRecord) []DNSCheckIssue {
+	type nameKey struct {
+		domainID int
+		name     string
+		line     string
+	}
+	groups := make(map[nameKey][]models.DomainDNSRecord)
+	var keys []nameKey
+	for _, record := range records {
+		line := record.Line
+		if line == dnsprovider.ViewDefault {
+			line = ""
+		}
+		key := nameKey{record.DomainID, strings.ToLower(record.Name), line}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], record)
+	}
+
+	var issues []DNSCheckIssue
+	for _, key := range keys {
+		group := groups[key]
+		issue := DNSCheckIssue{DomainID: key.domainID, Name: group[0].Name, Line: key.line}
+
+		byType := make(map[string][]models.DomainDNSRecord)
+		var types []string
+		for _, record := range group {
+			if _, ok := byType[record.Type]; !ok {
+				types = append(types, record.Type)
+			}
+			byType[record.Type] = append(byType[record.Type], record)
+		}
+
+		if len(byType["CNAME"]) > 0 && len(types) > 1 {
+			issue.Kind = DNSIssueCNAMEConflict
+			issue.Detail = fmt.Sprintf("CNAME cannot coexist with %s", strings.Join(otherTypes(types, "CNAME"), ", "))
+			issue.Records = issueRecords(group)
+			issues = append(issues, issue)
+		}
+
+		for _, recordType := range types {
+			if recordType != "A" && recordType != "AAAA" && recordType != "CNAME" {
+				continue
+			}
+			owners := recordOwners(byType[recordType])
+			if len(owners) < 2 {
+				continue
+			}
+			issue.Kind = DNSIssueDuplicateOwner
+			issue.Detail = fmt.Sprintf("%s records owned by %s", recordType, strings.Join(owners, ", "))
+			issue.Records = issueRecords(byType[recordType])
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// setIssueZones fills in the zone names of issues
+func setIssueZones(db *gorm.DB, issues []DNSCheckIssue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+
+	var domainIDs []int
+	for _, issue := range issues {
+		domainIDs = append(domainIDs, issue.DomainID)
+	}
+	var domains []models.Domain
+	if err := db.Where("id IN ?", domainIDs).Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to get domains: %w", err)
+	}
+
+	zones := make(map[int]string, len(domains))
+	for _, domain := range domains {
+		zones[domain.ID] = domain.Domain
+	}
+	for i := range issues {
+		issues[i].Zone = zones[issues[i].DomainID]
+	}
+	return nil
+}
+
+// recordOwners returns the distinct owners of records as owner_type:owner_id
+func recordOwners(records []models.DomainDNSRecord) []string {
+	var owners []string
+	seen := make(map[string]bool)
+	for _, record := range records {
+		owner := fmt.Sprintf("%s:%d", record.OwnerType, record.OwnerID)
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+// otherTypes returns types without skip
+func otherTypes(types []string, skip string) []string {
+	var out []string
+	for _, t := range types {
+		if t != skip {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// issueRecords extracts the fields of records shown in an issue
+func issueRecords(records []models.DomainDNSRecord) []DNSCheckRecord {
+	out := make([]DNSCheckRecord, len(records))
+	for i, record := range records {
+		out[i] = checkRecord(record)
+	}
+	return out
+}
+
+// checkRecord extracts the fields of a record shown in an issue
+func checkRecord(record models.DomainDNSRecord) DNSCheckRecord {
+	return DNSCheckRecord{
+		ID:        record.ID,
+		Type:      record.Type,
+		Value:     record.Value,
+		Status:    record.Status,
+		OwnerType: record.OwnerType,
+		OwnerID:   record.OwnerID,
+	}
+}
@@ -0,0 +1,566 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnknownPlanOperation = errors.New("unknown plan operation")
+	ErrInvalidPlanRequest   = errors.New("invalid plan request")
+	ErrPlanNotFound         = errors.New("plan not found")
+	ErrPlanNotPending       = errors.New("plan has already been applied or has drifted")
+	ErrPlanExpired          = errors.New("plan has expired")
+	ErrPlanDrifted          = errors.New("DNS records changed since the plan was created")
+)
+
+// DNS change plan operations
+const (
+	PlanNodeGroupCreate     = "node_group.create"
+	PlanNodeGroupUpdate     = "node_group.update"
+	PlanNodeGroupDelete     = "node_group.delete"
+	PlanLineGroupCreate     = "line_group.create"
+	PlanLineGroupUpdate     = "line_group.update"
+	PlanLineGroupDelete     = "line_group.delete"
+	PlanWebsiteCreate       = "website.create"
+	PlanWebsiteUpdate       = "website.update"
+	PlanWebsiteDelete       = "website.delete"
+	PlanWebsiteAddDomain    = "website.add_domain"
+	PlanWebsiteRemoveDomain = "website.remove_domain"
+)
+
+// DNS change plan statuses
+const (
+	PlanStatusPending = "pending"
+	PlanStatusApplied = "applied"
+	PlanStatusDrifted = "drifted" // Apply found different record changes and was rolled back
+	PlanStatusExpired = "expired"
+)
+
+// Record change actions of a plan
+const (
+	RecordChangeCreate = "create"
+	RecordChangeUpdate = "update"
+	RecordChangeDelete = "delete"
+)
+
+// dnsPlanTTL is how long a plan can be applied after it was created
+const dnsPlanTTL = time.Hour
+
+// errPlanRollback rolls back the transaction a plan is computed in
+var errPlanRollback = errors.New("plan rollback")
+
+// DNSPlanService previews the domain_dns_records changes of node group, line
+// group and website operations and applies them later. Planning runs the
+// operation in a transaction that is rolled back; applying runs it again and
+// commits only when it makes the same record changes.
+type DNSPlanService struct {
+	nodeGroupService *NodeGroupService
+	lineGroupService *LineGroupService
+	websiteService   *WebsiteService
+	dnsRecordService *DNSRecordService
+}
+
+func NewDNSPlanService(nodeGroupService *NodeGroupService, lineGroupService *LineGroupService, websiteService *WebsiteService, dnsRecordService *DNSRecordService) *DNSPlanService {
+	return &DNSPlanService{
+		nodeGroupService: nodeGroupService,
+		lineGroupService: lineGroupService,
+		websiteService:   websiteService,
+		dnsRecordService: dnsRecordService,
+	}
+}
+
+// CreateDNSPlanRequest represents the request to plan an operation
+type CreateDNSPlanRequest struct {
+	Operation string          `json:"operation" binding:"required"` // e.g. node_group.create
+	ID        int             `json:"id"`                           // Node group, line group or website of update, delete and domain operations
+	Request   json.RawMessage `json:"request"`                      // Body of the operation's endpoint without id
+}
+
+// planDomainRequest is the request of website.add_domain and website.remove_domain
+type planDomainRequest struct {
+	Domain    string `json:"domain"`
+	IsPrimary bool   `json:"is_primary"`
+}
+
+// DNSPlan is a plan with its record changes
+type DNSPlan struct {
+	Plan    *models.DNSChangePlan `json:"plan"`
+	Changes []DNSRecordChange     `json:"changes"`
+}
+
+// DNSRecordChange is one domain_dns_records change of a plan
+type DNSRecordChange struct {
+	Action   string          `json:"action"`              // create, update, delete
+	RecordID int             `json:"record_id,omitempty"` // Existing record of updates and deletes
+	DomainID int             `json:"domain_id"`
+	Zone     string          `json:"zone"`
+	Before   *DNSRecordState `json:"before,omitempty"`
+	After    *DNSRecordState `json:"after,omitempty"`
+}
+
+// DNSRecordState is the content of a record as published by the provider
+type DNSRecordState struct {
+	Type      string  `json:"type"`
+	Name      string  `json:"name"`
+	Value     string  `json:"value"`
+	TTL       int     `json:"ttl"`
+	Proxied   bool    `json:"proxied"`
+	Priority  *int    `json:"priority,omitempty"`
+	Weight    *int    `json:"weight,omitempty"`
+	Port      *int    `json:"port,omitempty"`
+	CAAFlags  *int    `json:"caa_flags,omitempty"`
+	CAATag    *string `json:"caa_tag,omitempty"`
+	Line      string  `json:"line,omitempty"`
+	OwnerType string  `json:"owner_type"`
+	OwnerID   int     `json:"owner_id"`
+}
+
+// CreatePlan runs an operation in a transaction that is rolled back and
+// stores the record changes it makes as a pending plan
+func (s *DNSPlanService) CreatePlan(req CreateDNSPlanRequest, userID int) (*DNSPlan, error) {
+	request := "{}"
+	if len(req.Request) > 0 {
+		request = string(req.Request)
+	}
+
+	plan := &models.DNSChangePlan{
+		Operation: req.Operation,
+		TargetID:  req.ID,
+		Request:   request,
+		Status:    PlanStatusPending,
+		CreatedBy: userID,
+		ExpiresAt: time.Now().Add(dnsPlanTTL),
+	}
+
+	// Creates generate a random CNAME prefix; pin it so apply makes the same records
+	if req.Operation == PlanNodeGroupCreate || req.Operation == PlanLineGroupCreate {
+		prefix, err := utils.GenerateCNAMEPrefix()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate CNAME prefix: %w", err)
+		}
+		plan.CNAMEPrefix = prefix
+	}
+
+	var changes []DNSRecordChange
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if changes, err = s.run(tx, plan); err != nil {
+			return err
+		}
+		return errPlanRollback
+	})
+	if !errors.Is(err, errPlanRollback) {
+		return nil, err
+	}
+
+	id, err := newPlanID()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode record changes: %w", err)
+	}
+	plan.ID = id
+	plan.Changes = string(encoded)
+	plan.Creates, plan.Updates, plan.Deletes = countChanges(changes)
+
+	if err := database.DB.Create(plan).Error; err != nil {
+		return nil, fmt.Errorf("failed to save plan: %w", err)
+	}
+
+	return &DNSPlan{Plan: plan, Changes: changes}, nil
+}
+
+// GetPlan returns a plan with its record changes
+func (s *DNSPlanService) GetPlan(id string) (*DNSPlan, error) {
+	var plan models.DNSChangePlan
+	if err := database.DB.First(&plan, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	if plan.Status == PlanStatusPending && time.Now().After(plan.ExpiresAt) {
+		plan.Status = PlanStatusExpired
+	}
+
+	var changes []DNSRecordChange
+	if err := json.Unmarshal([]byte(plan.Changes), &changes); err != nil {
+		return nil, fmt.Errorf("failed to decode record changes: %w", err)
+	}
+	return &DNSPlan{Plan: &plan, Changes: changes}, nil
+}
+
+// ApplyPlan runs the operation of a pending plan again and commits it when
+// it makes exactly the planned record changes. Otherwise nothing is changed
+// and the plan is marked drifted.
+func (s *DNSPlanService) ApplyPlan(id string) (*DNSPlan, error) {
+	var plan models.DNSChangePlan
+	var changes []DNSRecordChange
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&plan, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPlanNotFound
+			}
+			return err
+		}
+		if plan.Status != PlanStatusPending {
+			return ErrPlanNotPending
+		}
+		if time.Now().After(plan.ExpiresAt) {
+			return ErrPlanExpired
+		}
+
+		var planned []DNSRecordChange
+		if err := json.Unmarshal([]byte(plan.Changes), &planned); err != nil {
+			return fmt.Errorf("failed to decode record changes: %w", err)
+		}
+
+		var err error
+		if changes, err = s.run(tx, &plan); err != nil {
+			return err
+		}
+		if !sameChanges(planned, changes) {
+			return ErrPlanDrifted
+		}
+
+		now := time.Now()
+		if err := tx.Model(&plan).Updates(map[string]interface{}{
+			"status":     PlanStatusApplied,
+			"applied_at": now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update plan: %w", err)
+		}
+		plan.Status = PlanStatusApplied
+		plan.AppliedAt = &now
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, ErrPlanDrifted):
+		s.setStatus(id, PlanStatusDrifted)
+	case errors.Is(err, ErrPlanExpired):
+		s.setStatus(id, PlanStatusExpired)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.dnsRecordService.wakeSyncWorker()
+	s.dnsRecordService.checkAfterBulk(DNSCheckSourcePlan, 0)
+	return &DNSPlan{Plan: &plan, Changes: changes}, nil
+}
+
+// setStatus records why a pending plan can no longer be applied
+func (s *DNSPlanService) setStatus(id, status string) {
+	database.DB.Model(&models.DNSChangePlan{}).
+		Where("id = ? AND status = ?", id, PlanStatusPending).
+		Update("status", status)
+}
+
+// run executes the operation of a plan on tx and returns its record changes
+func (s *DNSPlanService) run(tx *gorm.DB, plan *models.DNSChangePlan) ([]DNSRecordChange, error) {
+	before, err := snapshotRecords(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.execute(tx, plan); err != nil {
+		return nil, err
+	}
+	after, err := snapshotRecords(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffRecords(before, after)
+	if err := setChangeZones(tx, changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// execute runs the service call of a plan's operation on db
+func (s *DNSPlanService) execute(db *gorm.DB, plan *models.DNSChangePlan) error {
+	request := []byte(plan.Request)
+	decode := func(v interface{}) error {
+		if err := json.Unmarshal(request, v); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPlanRequest, err)
+		}
+		return nil
+	}
+
+	switch plan.Operation {
+	case PlanNodeGroupUpdate, PlanNodeGroupDelete, PlanLineGroupUpdate, PlanLineGroupDelete,
+		PlanWebsiteUpdate, PlanWebsiteDelete, PlanWebsiteAddDomain, PlanWebsiteRemoveDomain:
+		if plan.TargetID == 0 {
+			return fmt.Errorf("%w: id is required for %s", ErrInvalidPlanRequest, plan.Operation)
+		}
+	}
+
+	switch plan.Operation {
+	case PlanNodeGroupCreate:
+		var req CreateNodeGroupRequest
+		if err := decode(&req); err != nil {
+			return err
+		}
+		_, err := s.nodeGroupService.createNodeGroup(db, req, plan.CNAMEPrefix)
+		return err
+	case PlanNodeGroupUpdate:
+		var req UpdateNodeGroupRequest
+		if err := decode(&req); err != nil {
+			return err
+		}
+		_, err := s.nodeGroupService.updateNodeGroup(db, plan.TargetID, req)
+		return err
+	case PlanNodeGroupDelete:
+		return s.nodeGroupService.deleteNodeGroup(db, plan.TargetID)
+	case PlanLineGroupCreate:
+		var req CreateLineGroupRequest
+		if err := decode(&req); err != nil {
+			return err
+		}
+		_, err := s.lineGroupService.createLineGroup(db, req, plan.CNAMEPrefix)
+		return err
+	case PlanLineGroupUpdate:
+		var req UpdateLineGroupRequest
+		if err := decode(&req); err != nil {
+			return err
+		}
+		_, err := s.lineGroupService.updateLineGroup(db, plan.TargetID, req)
+		return err
+	case PlanLineGroupDelete:
+		return s.lineGroupService.deleteLineGroup(db, plan.TargetID)
+	case PlanWebsiteCreate:
+		var req CreateWebsiteRequest
+		if err := decode(&req); err != nil {
+			return err
+		}
+		_, err := s.websiteService.createWebsite(db, req)
+		return err
+	case PlanWebsiteUpdate:
+		var req UpdateWebsiteRequest
+		if err := decode(&req); err != nil {
+			return err
+		}
+		return s.websiteService.updateWebsite(db, plan.TargetID, req)
+	case PlanWebsiteDelete:
+		return s.websiteService.deleteWebsite(db, plan.TargetID)
+	case PlanWebsiteAddDomain, PlanWebsiteRemoveDomain:
+		var req planDomainRequest
+		if err := decode(&req); err != nil {
+			return err
+		}
+		if req.Domain == "" {
+			return fmt.Errorf("%w: domain is required", ErrInvalidPlanRequest)
+		}
+		if plan.Operation == PlanWebsiteAddDomain {
+			return s.websiteService.addDomain(db, plan.TargetID, req.Domain, req.IsPrimary)
+		}
+		return s.websiteService.removeDomain(db, plan.TargetID, req.Domain)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownPlanOperation, plan.Operation)
+	}
+}
+
+// snapshotRecords returns the records that are or will be published, by ID.
+// Records queued for deletion count as removed.
+func snapshotRecords(tx *gorm.DB) (map[int]models.DomainDNSRecord, error) {
+	var records []models.DomainDNSRecord
+	if err := tx.Where("status <> ?", "deleting").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read DNS records: %w", err)
+	}
+
+	snapshot := make(map[int]models.DomainDNSRecord, len(records))
+	for _, record := range records {
+		snapshot[record.ID] = record
+	}
+	return snapshot, nil
+}
+
+// diffRecords compares two snapshots. Status and sync bookkeeping are not
+// changes; a record revived from deletion is a create.
+func diffRecords(before, after map[int]models.DomainDNSRecord) []DNSRecordChange {
+	changes := []DNSRecordChange{}
+
+	for id, record := range after {
+		state := recordState(record)
+		old, ok := before[id]
+		if !ok {
+			changes = append(changes, DNSRecordChange{Action: RecordChangeCreate, DomainID: record.DomainID, After: state})
+			continue
+		}
+		if oldState := recordState(old); oldState.key() != state.key() {
+			changes = append(changes, DNSRecordChange{Action: RecordChangeUpdate, RecordID: id, DomainID: record.DomainID, Before: oldState, After: state})
+		}
+	}
+	for id, record := range before {
+		if _, ok := after[id]; !ok {
+			changes = append(changes, DNSRecordChange{Action: RecordChangeDelete, RecordID: id, DomainID: record.DomainID, Before: recordState(record)})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.DomainID != b.DomainID {
+			return a.DomainID < b.DomainID
+		}
+		if sa, sb := a.state(), b.state(); sa.Name != sb.Name {
+			return sa.Name < sb.Name
+		}
+		return a.key() < b.key()
+	})
+	return changes
+}
+
+// setChangeZones fills in the zone names of changes
+func setChangeZones(tx *gorm.DB, changes []DNSRecordChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var domainIDs []int
+	for _, change := range changes {
+		domainIDs = append(domainIDs, change.DomainID)
+	}
+	var domains []models.Domain
+	if err := tx.Where("id IN ?", domainIDs).Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to get domains: %w", err)
+	}
+
+	zones := make(map[int]string, len(domains))
+	for _, domain := range domains {
+		zones[domain.ID] = domain.Domain
+	}
+	for i := range changes {
+		changes[i].Zone = zones[changes[i].DomainID]
+	}
+	return nil
+}
+
+// sameChanges reports whether apply makes the planned changes. Records
+// created by the plan and by apply have different owner IDs, so creates are
+// compared by content only.
+func sameChanges(planned, applied []DNSRecordChange) bool {
+	if len(planned) != len(applied) {
+		return false
+	}
+
+	keys := func(changes []DNSRecordChange) []string {
+		out := make([]string, len(changes))
+		for i, change := range changes {
+			out[i] = change.key()
+		}
+		sort.Strings(out)
+		return out
+	}
+	a, b := keys(planned), keys(applied)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// countChanges returns the number of creates, updates and deletes
+func countChanges(changes []DNSRecordChange) (creates, updates, deletes int) {
+	for _, change := range changes {
+		switch change.Action {
+		case RecordChangeCreate:
+			creates++
+		case RecordChangeUpdate:
+			updates++
+		case RecordChangeDelete:
+			deletes++
+		}
+	}
+	return creates, updates, deletes
+}
+
+// newPlanID returns a random plan ID
+func newPlanID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate plan ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// key identifies a change for drift detection
+func (c DNSRecordChange) key() string {
+	switch c.Action {
+	case RecordChangeCreate:
+		return RecordChangeCreate + "|" + c.After.content()
+	case RecordChangeUpdate:
+		return fmt.Sprintf("%s|%d|%s|%s", c.Action, c.RecordID, c.Before.key(), c.After.key())
+	default:
+		return fmt.Sprintf("%s|%d|%s", c.Action, c.RecordID, c.Before.key())
+	}
+}
+
+// state returns the record content after the change, or before a delete
+func (c DNSRecordChange) state() *DNSRecordState {
+	if c.After != nil {
+		return c.After
+	}
+	return c.Before
+}
+
+// recordState extracts the published content of a record
+func recordState(record models.DomainDNSRecord) *DNSRecordState {
+	return &DNSRecordState{
+		Type:      record.Type,
+		Name:      record.Name,
+		Value:     record.Value,
+		TTL:       record.TTL,
+		Proxied:   record.Proxied,
+		Priority:  record.Priority,
+		Weight:    record.Weight,
+		Port:      record.Port,
+		CAAFlags:  record.CAAFlags,
+		CAATag:    record.CAATag,
+		Line:      record.Line,
+		OwnerType: record.OwnerType,
+		OwnerID:   record.OwnerID,
+	}
+}
+
+// content serializes the record content without the owner ID
+func (r *DNSRecordState) content() string {
+	optional := func(v *int) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.Itoa(*v)
+	}
+	caaTag := "-"
+	if r.CAATag != nil {
+		caaTag = *r.CAATag
+	}
+	return strings.Join([]string{
+		r.Type, r.Name, r.Value, strconv.Itoa(r.TTL), strconv.FormatBool(r.Proxied),
+		optional(r.Priority), optional(r.Weight), optional(r.Port), optional(r.CAAFlags), caaTag,
+		r.Line, r.OwnerType,
+	}, "|")
+}
+
+// key serializes the record content including the owner
+func (r *DNSRecordState) key() string {
+	return r.content() + "|" + strconv.Itoa(r.OwnerID)
+}
@@ -9,10 +9,16 @@ import (
 )
 
 var (
-	ErrProviderNotFound      = errors.New("DNS provider not found")
-	ErrProviderAlreadyExists = errors.New("DNS provider already exists for this domain")
+	ErrProviderNotFound           = errors.New("DNS provider not found")
+	ErrProviderAlreadyExists      = errors.New("DNS provider already exists for this domain")
+	ErrProviderCredentialsMissing = errors.New("provider_zone_id and api_key_id are required for this provider")
 )
 
+// BuiltinDNSProvider marks a zone served by `cdn-control dns-serve` from
+// domain_dns_records instead of a third-party provider. It needs no
+// provider zone ID or API key.
+const BuiltinDNSProvider = "builtin"
+
 type DNSProviderService struct{}
 
 func NewDNSProviderService() *DNSProviderService {
@@ -23,8 +29,8 @@ func NewDNSProviderService() *DNSProviderService {
 type CreateProviderRequest struct {
 	DomainID       int    `json:"domain_id" binding:"required"`
 	Provider       string `json:"provider" binding:"required"`
-	ProviderZoneID string `json:"provider_zone_id" binding:"required"`
-	APIKeyID       int    `json:"api_key_id" binding:"required"`
+	ProviderZoneID string `json:"provider_zone_id"` // Required unless provider=builtin
+	APIKeyID       int    `json:"api_key_id"`       // Required unless provider=builtin
 }
 
 // UpdateProviderRequest represents request to update a DNS provider
@@ -54,11 +60,10 @@ func (s *DNSProviderService) CreateProvider(req CreateProviderRequest) (*models.
 	}
 
 	// Verify API key exists and is active
-	var apiKey models.APIKey
-	if err := db.Where("id = ? AND status = ?", req.APIKeyID, "active").First(&apiKey).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("API key not found or inactive")
-		}
+	if req.Provider == BuiltinDNSProvider {
+		req.ProviderZoneID = domain.Domain
+		req.APIKeyID = 0
+	} else if err := checkProviderCredentials(db, req.ProviderZoneID, req.APIKeyID); err != nil {
 		return nil, err
 	}
 
@@ -77,6 +82,24 @@ func (s *DNSProviderService) CreateProvider(req CreateProviderRequest) (*models.
 	return provider, nil
 }
 
+// checkProviderCredentials verifies that a third-party provider has a zone ID
+// and an active API key
+func checkProviderCredentials(db *gorm.DB, providerZoneID string, apiKeyID int) error {
+	if providerZoneID == "" || apiKeyID == 0 {
+		return ErrProviderCredentialsMissing
+	}
+
+	var apiKey models.APIKey
+	if err := db.Where("id = ? AND status = ?", apiKeyID, "active").First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("API key not found or inactive")
+		}
+		return err
+	}
+
+	return nil
+}
+
 // GetProvider retrieves a DNS provider by ID
 func (s *DNSProviderService) GetProvider(id int) (*models.DomainDNSProvider, error) {
 	db := database.GetDB()
@@ -3,6 +3,8 @@ package service
 import (
 	"errors"
 	"fmt"
+	"net"
+	"strings"
 
 	"github.com/cdn-control-panel/backend/internal/database"
 	"github.com/cdn-control-panel/backend/internal/models"
@@ -13,15 +15,87 @@ import (
 var (
 	ErrDNSRecordNotFound      = errors.New("DNS record not found")
 	ErrDNSRecordAlreadyExists = errors.New("DNS record already exists")
+	ErrDNSRecordDeleting      = errors.New("DNS record is being deleted")
+	ErrInvalidRecordType      = errors.New("invalid DNS record type")
+	ErrRecordTypeNotAllowed   = errors.New("DNS record type not allowed for this domain purpose")
+	ErrInvalidRecordValue     = errors.New("invalid DNS record value")
 )
 
+// cdnRecordTypes are the record types allowed on purpose=cdn domains.
+// purpose=general domains additionally allow MX, SRV, CAA, NS and PTR.
+var cdnRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+	"TXT":   true,
+}
+
+var generalRecordTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"CNAME": true,
+	"TXT":   true,
+	"MX":    true,
+	"SRV":   true,
+	"CAA":   true,
+	"NS":    true,
+	"PTR":   true,
+}
+
+var caaTags = map[string]bool{
+	"issue":     true,
+	"issuewild": true,
+	"iodef":     true,
+}
+
+// StuckDeletionMinRetries is the retry count after which a record in
+// status=deleting is reported as a stuck deletion
+const StuckDeletionMinRetries = 3
+
+// SyncTrigger wakes up the DNS sync worker (implemented by worker.DNSSyncWorker)
+type SyncTrigger interface {
+	Wake()
+}
+
 type DNSRecordService struct {
 	domainService *DomainService
+	checker       *DNSCheckService
+	syncTrigger   SyncTrigger
 }
 
-func NewDNSRecordService(domainService *DomainService) *DNSRecordService {
+// NewDNSRecordService creates a DNS record service. syncTrigger is woken when
+// records are queued for sync; nil outside serve, where records wait for the
+// worker's next tick.
+func NewDNSRecordService(domainService *DomainService, syncTrigger SyncTrigger) *DNSRecordService {
 	return &DNSRecordService{
 		domainService: domainService,
+		syncTrigger:   syncTrigger,
+	}
+}
+
+// wakeSyncWorker asks the DNS sync worker to run now instead of on its next
+// tick; services call it once the transaction that queued records has committed
+func (s *DNSRecordService) wakeSyncWorker() {
+	wakeSyncWorker(s.syncTrigger)
+}
+
+// wakeSyncWorker wakes trigger unless it is nil
+func wakeSyncWorker(trigger SyncTrigger) {
+	if trigger != nil {
+		trigger.Wake()
+	}
+}
+
+// SetConsistencyChecker registers the checker that runs after bulk record changes
+func (s *DNSRecordService) SetConsistencyChecker(checker *DNSCheckService) {
+	s.checker = checker
+}
+
+// checkAfterBulk runs a consistency check in the background after a bulk
+// change of the records of a zone (all zones when domainID is 0)
+func (s *DNSRecordService) checkAfterBulk(source string, domainID int) {
+	if s.checker != nil {
+		go s.checker.RunCheck(source, domainID)
 	}
 }
 
@@ -35,13 +109,25 @@ type CreateDNSRecordRequest struct {
 	Proxied   bool   `json:"proxied"`
 	OwnerType string `json:"owner_type" binding:"required"`
 	OwnerID   int    `json:"owner_id"`
+
+	// Type-specific fields
+	Priority *int    `json:"priority"`  // MX, SRV
+	Weight   *int    `json:"weight"`    // SRV
+	Port     *int    `json:"port"`      // SRV
+	CAAFlags *int    `json:"caa_flags"` // CAA
+	CAATag   *string `json:"caa_tag"`   // CAA: issue, issuewild, iodef
 }
 
 // UpdateDNSRecordRequest represents request to update a DNS record
 type UpdateDNSRecordRequest struct {
-	Value   string `json:"value"`
-	TTL     int    `json:"ttl"`
-	Proxied *bool  `json:"proxied"`
+	Value    string  `json:"value"`
+	TTL      int     `json:"ttl"`
+	Proxied  *bool   `json:"proxied"`
+	Priority *int    `json:"priority"`
+	Weight   *int    `json:"weight"`
+	Port     *int    `json:"port"`
+	CAAFlags *int    `json:"caa_flags"`
+	CAATag   *string `json:"caa_tag"`
 }
 
 // DNSRecordFilter represents filter for listing DNS records
@@ -66,7 +152,7 @@ func (s *DNSRecordService) CreateRecord(req CreateDNSRecordRequest) (*models.Dom
 	}
 
 	// Calculate relative name from FQDN if needed
-	relativeName := req.Name
+	relativeName := utils.ToASCII(req.Name)
 	if utils.ValidateFQDN(req.Name, domain.Domain) {
 		relativeName = utils.CalculateRelativeName(req.Name, domain.Domain)
 	}
@@ -77,6 +163,16 @@ func (s *DNSRecordService) CreateRecord(req CreateDNSRecordRequest) (*models.Dom
 		return nil, ErrInvalidFQDN
 	}
 
+	// Type-specific validation
+	if err := validateRecordRequest(domain, relativeName, &req); err != nil {
+		return nil, err
+	}
+
+	// Names inside a managed subzone belong to that zone
+	if err := checkSubzone(db, domain, fqdn, req.Type); err != nil {
+		return nil, err
+	}
+
 	// Set defaults
 	if req.TTL == 0 {
 		req.TTL = 120
@@ -100,6 +196,11 @@ func (s *DNSRecordService) CreateRecord(req CreateDNSRecordRequest) (*models.Dom
 		Value:     req.Value,
 		TTL:       req.TTL,
 		Proxied:   req.Proxied, // R5: default false
+		Priority:  req.Priority,
+		Weight:    req.Weight,
+		Port:      req.Port,
+		CAAFlags:  req.CAAFlags,
+		CAATag:    req.CAATag,
 		Status:    "pending",
 		OwnerType: req.OwnerType,
 		OwnerID:   req.OwnerID,
@@ -109,6 +210,7 @@ func (s *DNSRecordService) CreateRecord(req CreateDNSRecordRequest) (*models.Dom
 		return nil, err
 	}
 
+	s.wakeSyncWorker()
 	return record, nil
 }
 
@@ -116,7 +218,7 @@ func (s *DNSRecordService) CreateRecord(req CreateDNSRecordRequest) (*models.Dom
 func (s *DNSRecordService) CreateRecordsBatch(records []CreateDNSRecordRequest) error {
 	db := database.GetDB()
 
-	return db.Transaction(func(tx *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
 		for _, req := range records {
 			// Get domain
 			domain, err := s.domainService.GetDomain(req.DomainID)
@@ -125,7 +227,7 @@ func (s *DNSRecordService) CreateRecordsBatch(records []CreateDNSRecordRequest)
 			}
 
 			// Calculate relative name
-			relativeName := req.Name
+			relativeName := utils.ToASCII(req.Name)
 			if utils.ValidateFQDN(req.Name, domain.Domain) {
 				relativeName = utils.CalculateRelativeName(req.Name, domain.Domain)
 			}
@@ -136,6 +238,14 @@ func (s *DNSRecordService) CreateRecordsBatch(records []CreateDNSRecordRequest)
 				return fmt.Errorf("invalid FQDN %s for zone %s", fqdn, domain.Domain)
 			}
 
+			// Type-specific validation
+			if err := validateRecordRequest(domain, relativeName, &req); err != nil {
+				return fmt.Errorf("record %s %s: %w", req.Type, fqdn, err)
+			}
+			if err := checkSubzone(tx, domain, fqdn, req.Type); err != nil {
+				return fmt.Errorf("record %s %s: %w", req.Type, fqdn, err)
+			}
+
 			// Set defaults
 			if req.TTL == 0 {
 				req.TTL = 120
@@ -149,6 +259,11 @@ func (s *DNSRecordService) CreateRecordsBatch(records []CreateDNSRecordRequest)
 				Value:     req.Value,
 				TTL:       req.TTL,
 				Proxied:   req.Proxied,
+				Priority:  req.Priority,
+				Weight:    req.Weight,
+				Port:      req.Port,
+				CAAFlags:  req.CAAFlags,
+				CAATag:    req.CAATag,
 				Status:    "pending",
 				OwnerType: req.OwnerType,
 				OwnerID:   req.OwnerID,
@@ -161,6 +276,129 @@ func (s *DNSRecordService) CreateRecordsBatch(records []CreateDNSRecordRequest)
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	s.wakeSyncWorker()
+
+	// Check the zone, or all zones when the batch spans several
+	domainID := 0
+	for i, req := range records {
+		if i == 0 {
+			domainID = req.DomainID
+		} else if req.DomainID != domainID {
+			domainID = 0
+			break
+		}
+	}
+	s.checkAfterBulk(DNSCheckSourceRecordBatch, domainID)
+	return nil
+}
+
+// validateRecordRequest performs type-specific validation of a record request.
+// The record type must be allowed for the domain purpose, and the value and
+// extra fields must match what the type requires.
+func validateRecordRequest(domain *models.Domain, relativeName string, req *CreateDNSRecordRequest) error {
+	req.Type = strings.ToUpper(req.Type)
+
+	if !generalRecordTypes[req.Type] {
+		return ErrInvalidRecordType
+	}
+	if domain.Purpose != "general" && !cdnRecordTypes[req.Type] {
+		return ErrRecordTypeNotAllowed
+	}
+
+	// Only A/AAAA/CNAME can be proxied at the provider
+	if req.Proxied && req.Type != "A" && req.Type != "AAAA" && req.Type != "CNAME" {
+		return fmt.Errorf("%w: %s records cannot be proxied", ErrInvalidRecordValue, req.Type)
+	}
+
+	// Hostname targets are stored in punycode, keeping an explicit trailing dot
+	switch req.Type {
+	case "CNAME", "NS", "PTR", "MX", "SRV":
+		absolute := strings.HasSuffix(req.Value, ".")
+		req.Value = utils.ToASCII(req.Value)
+		if absolute {
+			req.Value += "."
+		}
+	}
+
+	switch req.Type {
+	case "A":
+		ip := net.ParseIP(req.Value)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%w: A record requires an IPv4 address", ErrInvalidRecordValue)
+		}
+	case "AAAA":
+		ip := net.ParseIP(req.Value)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%w: AAAA record requires an IPv6 address", ErrInvalidRecordValue)
+		}
+	case "CNAME", "NS", "PTR":
+		if !utils.IsValidHostname(req.Value) {
+			return fmt.Errorf("%w: %s record requires a hostname", ErrInvalidRecordValue, req.Type)
+		}
+		if req.Type == "NS" && relativeName == "@" {
+			return fmt.Errorf("%w: apex NS records are managed by the provider", ErrInvalidRecordValue)
+		}
+	case "MX":
+		if req.Priority == nil {
+			return fmt.Errorf("%w: MX record requires priority", ErrInvalidRecordValue)
+		}
+		if !validUint16(*req.Priority) {
+			return fmt.Errorf("%w: priority must be 0-65535", ErrInvalidRecordValue)
+		}
+		if !utils.IsValidHostname(req.Value) {
+			return fmt.Errorf("%w: MX record requires a mail server hostname", ErrInvalidRecordValue)
+		}
+	case "SRV":
+		// Name must be _service._proto[.name]
+		labels := strings.Split(relativeName, ".")
+		if len(labels) < 2 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			return fmt.Errorf("%w: SRV record name must be _service._proto", ErrInvalidRecordValue)
+		}
+		if req.Priority == nil || req.Weight == nil || req.Port == nil {
+			return fmt.Errorf("%w: SRV record requires priority, weight and port", ErrInvalidRecordValue)
+		}
+		if !validUint16(*req.Priority) || !validUint16(*req.Weight) || !validUint16(*req.Port) {
+			return fmt.Errorf("%w: priority, weight and port must be 0-65535", ErrInvalidRecordValue)
+		}
+		if req.Value != "." && !utils.IsValidHostname(req.Value) {
+			return fmt.Errorf("%w: SRV record requires a target hostname", ErrInvalidRecordValue)
+		}
+	case "CAA":
+		if req.CAATag == nil || !caaTags[*req.CAATag] {
+			return fmt.Errorf("%w: CAA tag must be issue, issuewild or iodef", ErrInvalidRecordValue)
+		}
+		if req.CAAFlags == nil {
+			flags := 0
+			req.CAAFlags = &flags
+		}
+		if *req.CAAFlags < 0 || *req.CAAFlags > 255 {
+			return fmt.Errorf("%w: CAA flags must be 0-255", ErrInvalidRecordValue)
+		}
+	}
+
+	// Clear fields that do not apply to the type
+	if req.Type != "MX" && req.Type != "SRV" {
+		req.Priority = nil
+	}
+	if req.Type != "SRV" {
+		req.Weight = nil
+		req.Port = nil
+	}
+	if req.Type != "CAA" {
+		req.CAAFlags = nil
+		req.CAATag = nil
+	}
+
+	return nil
+}
+
+// validUint16 reports whether v fits in an unsigned 16-bit DNS field
+func validUint16(v int) bool {
+	return v >= 0 && v <= 65535
 }
 
 // GetRecord retrieves a DNS record by ID
@@ -242,11 +480,19 @@ func (s *DNSRecordService) ListRecords(filter DNSRecordFilter) ([]map[string]int
 			"value":              record.Value,
 			"ttl":                record.TTL,
 			"proxied":            record.Proxied,
+			"priority":           record.Priority,
+			"weight":             record.Weight,
+			"port":               record.Port,
+			"caa_flags":          record.CAAFlags,
+			"caa_tag":            record.CAATag,
+			"line":               record.Line,
 			"status":             record.Status,
 			"provider_record_id": record.ProviderRecordID,
 			"last_error":         record.LastError,
 			"retry_count":        record.RetryCount,
 			"next_retry_at":      record.NextRetryAt,
+			"synced_at":          record.SyncedAt,
+			"verified_at":        record.VerifiedAt,
 			"owner_type":         record.OwnerType,
 			"owner_id":           record.OwnerID,
 			"owner_name":         ownerName,
@@ -282,6 +528,8 @@ func (s *DNSRecordService) getOwnerName(ownerType string, ownerID int) string {
 		}
 	case "acme_challenge":
 		return "ACME Challenge"
+	case ZoneFileOwnerType:
+		return "Manual"
 	}
 
 	return ""
@@ -303,11 +551,42 @@ func (s *DNSRecordService) GetRecordsByOwner(ownerType string, ownerID int) ([]m
 func (s *DNSRecordService) UpdateRecord(id int, req UpdateDNSRecordRequest) error {
 	db := database.GetDB()
 
+	record, err := s.GetRecord(id)
+	if err != nil {
+		return err
+	}
+
+	// A record queued for deletion must not be resurrected by an update
+	if record.Status == "deleting" {
+		return ErrDNSRecordDeleting
+	}
+
+	domain, err := s.domainService.GetDomain(record.DomainID)
+	if err != nil {
+		return err
+	}
+
+	// Merge the update into the current record and re-validate it as a whole
+	merged := CreateDNSRecordRequest{
+		DomainID: record.DomainID,
+		Type:     record.Type,
+		Name:     record.Name,
+		Value:    record.Value,
+		TTL:      record.TTL,
+		Proxied:  record.Proxied,
+		Priority: record.Priority,
+		Weight:   record.Weight,
+		Port:     record.Port,
+		CAAFlags: record.CAAFlags,
+		CAATag:   record.CAATag,
+	}
+
 	updates := map[string]interface{}{
 		"status": "pending", // Trigger re-sync
 	}
 
 	if req.Value != "" {
+		merged.Value = req.Value
 		updates["value"] = req.Value
 		// Clear provider_record_id to force recreation
 		updates["provider_record_id"] = nil
@@ -316,43 +595,184 @@ func (s *DNSRecordService) UpdateRecord(id int, req UpdateDNSRecordRequest) erro
 		updates["ttl"] = req.TTL
 	}
 	if req.Proxied != nil {
+		merged.Proxied = *req.Proxied
 		updates["proxied"] = *req.Proxied
 	}
+	if req.Priority != nil {
+		merged.Priority = req.Priority
+	}
+	if req.Weight != nil {
+		merged.Weight = req.Weight
+	}
+	if req.Port != nil {
+		merged.Port = req.Port
+	}
+	if req.CAAFlags != nil {
+		merged.CAAFlags = req.CAAFlags
+	}
+	if req.CAATag != nil {
+		merged.CAATag = req.CAATag
+	}
 
-	result := db.Model(&models.DomainDNSRecord{}).Where("id = ?", id).Updates(updates)
-	if result.Error != nil {
-		return result.Error
+	if err := validateRecordRequest(domain, record.Name, &merged); err != nil {
+		return err
 	}
 
-	if result.RowsAffected == 0 {
-		return ErrDNSRecordNotFound
+	updates["priority"] = merged.Priority
+	updates["weight"] = merged.Weight
+	updates["port"] = merged.Port
+	updates["caa_flags"] = merged.CAAFlags
+	updates["caa_tag"] = merged.CAATag
+
+	if err := db.Model(&models.DomainDNSRecord{}).Where("id = ? AND status <> ?", id, "deleting").Updates(updates).Error; err != nil {
+		return err
 	}
 
+	s.wakeSyncWorker()
 	return nil
 }
 
-// DeleteRecord deletes a DNS record
+// DeleteRecord queues a DNS record for deletion (status=deleting).
+// The row is removed by DNSSyncWorker once the provider confirms the delete.
 func (s *DNSRecordService) DeleteRecord(id int) error {
 	db := database.GetDB()
 
-	result := db.Delete(&models.DomainDNSRecord{}, id)
-	if result.Error != nil {
-		return result.Error
+	if _, err := s.GetRecord(id); err != nil {
+		return err
 	}
 
-	if result.RowsAffected == 0 {
-		return ErrDNSRecordNotFound
+	if err := QueueRecordDeletion(db, "id = ?", id); err != nil {
+		return err
 	}
 
+	s.wakeSyncWorker()
 	return nil
 }
 
+// QueueRecordDeletion marks all DNS records matching the given conditions as
+// status=deleting so that DNSSyncWorker removes them from the provider with
+// the same retry/backoff as creates and updates. It is meant to be called
+// inside the caller's transaction in place of a hard delete.
+func QueueRecordDeletion(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	updates := map[string]interface{}{
+		"status":        "deleting",
+		"last_error":    nil,
+		"retry_count":   0,
+		"next_retry_at": nil,
+	}
+
+	return tx.Model(&models.DomainDNSRecord{}).
+		Where(query, args...).
+		Where("status <> ?", "deleting").
+		Updates(updates).Error
+}
+
+// createOrReviveRecord inserts a pending DNS record. If an identical record is
+// still queued for deletion it is switched back to pending instead, so the
+// worker updates the existing provider record rather than hitting the unique key.
+func createOrReviveRecord(tx *gorm.DB, record *models.DomainDNSRecord) error {
+	var existing models.DomainDNSRecord
+	err := tx.Where("domain_id = ? AND type = ? AND name = ? AND value = ? AND line = ? AND owner_type = ? AND owner_id = ? AND status = ?",
+		record.DomainID, record.Type, record.Name, record.Value, record.Line, record.OwnerType, record.OwnerID, "deleting").
+		First(&existing).Error
+	if err == nil {
+		ttl, weight := record.TTL, record.Weight
+		*record = existing
+		record.Status = "pending"
+		record.TTL = ttl
+		record.Weight = weight
+		return tx.Model(&existing).Updates(map[string]interface{}{
+			"status":        "pending",
+			"ttl":           ttl,
+			"weight":        weight,
+			"last_error":    nil,
+			"retry_count":   0,
+			"next_retry_at": nil,
+		}).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return tx.Create(record).Error
+}
+
+// ensureRecord is createOrReviveRecord for callers that may find the record
+// already live, e.g. when re-publishing all records of an owner
+func ensureRecord(tx *gorm.DB, record *models.DomainDNSRecord) error {
+	var count int64
+	if err := tx.Model(&models.DomainDNSRecord{}).
+		Where("domain_id = ? AND type = ? AND name = ? AND value = ? AND line = ? AND owner_type = ? AND owner_id = ? AND status <> ?",
+			record.DomainID, record.Type, record.Name, record.Value, record.Line, record.OwnerType, record.OwnerID, "deleting").
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return createOrReviveRecord(tx, record)
+}
+
+// ListStuckDeletions returns records whose provider-side deletion keeps failing
+func (s *DNSRecordService) ListStuckDeletions(page, pageSize int) ([]map[string]interface{}, int64, error) {
+	db := database.GetDB()
+
+	query := db.Model(&models.DomainDNSRecord{}).
+		Where("status = ? AND retry_count >= ?", "deleting", StuckDeletionMinRetries)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+
+	offset := (page - 1) * pageSize
+
+	var records []models.DomainDNSRecord
+	if err := query.Offset(offset).Limit(pageSize).Order("retry_count DESC, updated_at ASC").Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(records))
+
+	for _, record := range records {
+		var domain models.Domain
+		db.First(&domain, record.DomainID)
+
+		result = append(result, map[string]interface{}{
+			"id":                 record.ID,
+			"domain_id":          record.DomainID,
+			"domain":             domain.Domain,
+			"type":               record.Type,
+			"name":               record.Name,
+			"value":              record.Value,
+			"provider_record_id": record.ProviderRecordID,
+			"last_error":         record.LastError,
+			"retry_count":        record.RetryCount,
+			"next_retry_at":      record.NextRetryAt,
+			"owner_type":         record.OwnerType,
+			"owner_id":           record.OwnerID,
+			"owner_name":         s.getOwnerName(record.OwnerType, record.OwnerID),
+			"updated_at":         record.UpdatedAt,
+		})
+	}
+
+	return result, total, nil
+}
+
 // TriggerSync manually triggers sync for a specific record or all error records
 func (s *DNSRecordService) TriggerSync(recordID *int) error {
 	db := database.GetDB()
 
 	updates := map[string]interface{}{
-		"status":        "pending",
+		// Records queued for deletion stay in the delete queue
+		"status":        gorm.Expr("IF(status = ?, ?, ?)", "deleting", "deleting", "pending"),
 		"retry_count":   0,
 		"next_retry_at": nil,
 	}
@@ -371,6 +791,7 @@ func (s *DNSRecordService) TriggerSync(recordID *int) error {
 		db.Model(&models.DomainDNSRecord{}).Where("status = ?", "error").Updates(updates)
 	}
 
+	s.wakeSyncWorker()
 	return nil
 }
 
@@ -0,0 +1,950 @@
+package service
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/pkg/cloudflare"
+	"github.com/cdn-control-panel/backend/pkg/dnsprovider"
+	"github.com/cdn-control-panel/backend/pkg/secretbox"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDNSSECNotSupported = errors.New("DNSSEC is not supported by the zone's DNS provider")
+	ErrDNSSECNotEnabled   = errors.New("DNSSEC is not enabled for this domain")
+	ErrRolloverInProgress = errors.New("a key rollover is already in progress")
+	ErrInvalidKeyRole     = errors.New("key role must be ksk or zsk")
+)
+
+// DNSSEC key roles and states of builtin zones
+const (
+	DNSSECRoleKSK = "ksk"
+	DNSSECRoleZSK = "zsk"
+
+	DNSSECKeyPublished = "published" // In the DNSKEY set, not signing zone data yet
+	DNSSECKeyActive    = "active"
+	DNSSECKeyRetired   = "retired" // Still published until remove_at so cached signatures validate
+)
+
+// DNSSEC audit log actions
+const (
+	DNSSECActionEnable        = "enable"
+	DNSSECActionDisable       = "disable"
+	DNSSECActionStatus        = "status"
+	DNSSECActionKeyCreated    = "key_created"
+	DNSSECActionKeyActivated  = "key_activated"
+	DNSSECActionKeyRetired    = "key_retired"
+	DNSSECActionKeyRemoved    = "key_removed"
+	DNSSECActionRolloverStart = "rollover_start"
+	DNSSECActionRolloverDone  = "rollover_complete"
+)
+
+// DNSSECSchedulerActor is the audit actor of scheduled DNSSEC changes
+const DNSSECSchedulerActor = "scheduler"
+
+// Builtin signing parameters
+const (
+	dnssecAlgorithm = dns.ECDSAP256SHA256
+	dnskeyTTL       = 3600
+
+	// DNSSECSignatureValidity is how long dns-serve signatures are valid;
+	// zones are re-signed every dnssecResignInterval by bumping the config version
+	DNSSECSignatureValidity = 14 * 24 * time.Hour
+	dnssecResignInterval    = 3 * 24 * time.Hour
+
+	// dnssecPropagationDelay is how long a key change waits for secondaries
+	// and resolver caches (DNSKEY and DS TTLs) before the next step
+	dnssecPropagationDelay = 48 * time.Hour
+
+	defaultZSKLifetimeDays = 90
+)
+
+type DNSSECService struct {
+	configVersionService *ConfigVersionService
+	box                  *secretbox.Box // Encrypts builtin signing keys; nil without a master key
+	cloudflareClient     *cloudflare.Client
+}
+
+func NewDNSSECService(configVersionService *ConfigVersionService, box *secretbox.Box) *DNSSECService {
+	return &DNSSECService{
+		configVersionService: configVersionService,
+		box:                  box,
+		cloudflareClient:     cloudflare.NewClient(),
+	}
+}
+
+// DNSSECInfo is the DNSSEC state of a domain
+type DNSSECInfo struct {
+	DomainID       int                `json:"domain_id"`
+	Provider       string             `json:"provider"`
+	Status         string             `json:"status"`
+	DSRecords      []string           `json:"ds_records"` // Hand these to the registrar
+	LastError      *string            `json:"last_error"`
+	CheckedAt      *time.Time         `json:"checked_at"`
+	NextRolloverAt *time.Time         `json:"next_rollover_at"`
+	SignedAt       *time.Time         `json:"signed_at"`
+	Keys           []models.DNSSECKey `json:"keys"` // Builtin zones only
+}
+
+// SigningKey is a decrypted signing key of a builtin zone, used by dns-serve
+type SigningKey struct {
+	Role   string
+	Status string
+	DNSKEY *dns.DNSKEY
+	Signer crypto.Signer
+}
+
+// GetDNSSEC returns the DNSSEC state of a domain
+func (s *DNSSECService) GetDNSSEC(domainID int) (*DNSSECInfo, error) {
+	provider, err := s.zoneProvider(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.getState(database.DB, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &DNSSECInfo{
+		DomainID:       domainID,
+		Provider:       provider.Provider,
+		Status:         state.Status,
+		DSRecords:      splitDS(state.DSRecords),
+		LastError:      state.LastError,
+		CheckedAt:      state.CheckedAt,
+		NextRolloverAt: state.NextRolloverAt,
+		SignedAt:       state.SignedAt,
+		Keys:           []models.DNSSECKey{},
+	}
+	if provider.Provider == BuiltinDNSProvider {
+		if err := database.DB.Where("domain_id = ?", domainID).Order("id").Find(&info.Keys).Error; err != nil {
+			return nil, fmt.Errorf("failed to get DNSSEC keys: %w", err)
+		}
+	}
+
+	return info, nil
+}
+
+// EnableDNSSEC enables DNSSEC for a domain.
+// Provider-signed zones are enabled at the provider and mirror its status
+// and DS records. Builtin zones:
+// 1. generate a KSK and a ZSK (ECDSA P-256), private keys sealed with the master key
+// 2. upsert domain_dnssec(status=pending, ds_records=DS of the KSK, next_rollover_at)
+// 3. insert dnssec_audit_logs(enable, key_created)
+// 4. bump config_versions(reason="dnssec:enable") so dns-serve signs the zone
+// The zone turns active once the parent zone serves the DS.
+func (s *DNSSECService) EnableDNSSEC(domainID int, actor string) (*DNSSECInfo, error) {
+	provider, err := s.zoneProvider(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.Provider != BuiltinDNSProvider {
+		if err := s.enableAtProvider(provider, actor); err != nil {
+			return nil, err
+		}
+		return s.GetDNSSEC(domainID)
+	}
+
+	if s.box == nil {
+		return nil, secretbox.ErrNoKey
+	}
+	origin := dns.Fqdn(strings.ToLower(provider.Domain.Domain))
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := s.getState(tx, domainID)
+		if err != nil {
+			return err
+		}
+		switch state.Status {
+		case dnsprovider.DNSSECPending, dnsprovider.DNSSECActive:
+			return nil
+		case dnsprovider.DNSSECDisabling:
+			// Keys are still published: keep signing
+			state.Status = dnsprovider.DNSSECPending
+			if err := tx.Save(state).Error; err != nil {
+				return fmt.Errorf("failed to save DNSSEC state: %w", err)
+			}
+			return s.audit(tx, domainID, DNSSECActionEnable, nil, actor, "disable cancelled, keys kept")
+		}
+
+		now := time.Now()
+		for _, role := range []string{DNSSECRoleKSK, DNSSECRoleZSK} {
+			key, err := s.generateKey(origin, domainID, role)
+			if err != nil {
+				return err
+			}
+			key.Status = DNSSECKeyActive
+			key.ActivatedAt = &now
+			if err := tx.Create(key).Error; err != nil {
+				return fmt.Errorf("failed to create DNSSEC key: %w", err)
+			}
+			if err := s.audit(tx, domainID, DNSSECActionKeyCreated, &key.KeyTag, actor, role+" created active"); err != nil {
+				return err
+			}
+		}
+
+		ds, err := s.builtinDS(tx, domainID)
+		if err != nil {
+			return err
+		}
+		nextRollover := now.AddDate(0, 0, state.ZSKLifetimeDays)
+		state.Status = dnsprovider.DNSSECPending
+		state.DSRecords = strings.Join(ds, "\n")
+		state.LastError = nil
+		state.NextRolloverAt = &nextRollover
+		state.SignedAt = &now
+		if err := tx.Save(state).Error; err != nil {
+			return fmt.Errorf("failed to save DNSSEC state: %w", err)
+		}
+
+		if err := s.audit(tx, domainID, DNSSECActionEnable, nil, actor, "signing enabled, waiting for the DS at the registrar"); err != nil {
+			return err
+		}
+		return s.configVersionService.BumpVersion(tx, "dnssec:enable")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetDNSSEC(domainID)
+}
+
+// DisableDNSSEC disables DNSSEC for a domain. Builtin zones keep signing
+// (status=disabling) until the DS is gone from the parent zone, since
+// removing signatures first would make the zone bogus; the keys are then
+// deleted by the scheduler.
+func (s *DNSSECService) DisableDNSSEC(domainID int, actor string) (*DNSSECInfo, error) {
+	provider, err := s.zoneProvider(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.getState(database.DB, domainID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Status == dnsprovider.DNSSECDisabled {
+		return nil, ErrDNSSECNotEnabled
+	}
+
+	if provider.Provider != BuiltinDNSProvider {
+		if err := s.disableAtProvider(provider, state, actor); err != nil {
+			return nil, err
+		}
+		return s.GetDNSSEC(domainID)
+	}
+
+	parentDS, err := lookupParentDS(provider.Domain.Domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up DS records: %w", err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(parentDS) == 0 {
+			return s.finishDisable(tx, state, actor)
+		}
+
+		state.Status = dnsprovider.DNSSECDisabling
+		if err := tx.Save(state).Error; err != nil {
+			return fmt.Errorf("failed to save DNSSEC state: %w", err)
+		}
+		return s.audit(tx, domainID, DNSSECActionDisable, nil, actor, "waiting for the DS to be removed at the registrar")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetDNSSEC(domainID)
+}
+
+// StartRollover starts a key rollover of a builtin zone.
+// ZSKs roll by pre-publication: the new key is published, activated after
+// the propagation delay, and the old key stays published (retired) for
+// another delay. KSKs roll by double-DS: both DS records are listed for the
+// registrar and the new KSK signs the DNSKEY set right away; the rollover
+// completes once the parent serves the new DS.
+func (s *DNSSECService) StartRollover(domainID int, role, actor string) (*DNSSECInfo, error) {
+	if role != DNSSECRoleKSK && role != DNSSECRoleZSK {
+		return nil, ErrInvalidKeyRole
+	}
+
+	provider, err := s.zoneProvider(domainID)
+	if err != nil {
+		return nil, err
+	}
+	if provider.Provider != BuiltinDNSProvider {
+		return nil, fmt.Errorf("%w: keys of provider-signed zones are managed by the provider", ErrDNSSECNotSupported)
+	}
+	if s.box == nil {
+		return nil, secretbox.ErrNoKey
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := s.getState(tx, domainID)
+		if err != nil {
+			return err
+		}
+		if state.Status != dnsprovider.DNSSECPending && state.Status != dnsprovider.DNSSECActive {
+			return ErrDNSSECNotEnabled
+		}
+		return s.startRollover(tx, state, provider.Domain.Domain, role, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetDNSSEC(domainID)
+}
+
+// ListAuditLogs returns the DNSSEC audit log of a domain, newest first
+func (s *DNSSECService) ListAuditLogs(domainID, page, pageSize int) ([]models.DNSSECAuditLog, int64, error) {
+	var logs []models.DNSSECAuditLog
+	var total int64
+
+	query := database.DB.Model(&models.DNSSECAuditLog{}).Where("domain_id = ?", domainID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count DNSSEC audit logs: %w", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get DNSSEC audit logs: %w", err)
+	}
+
+	return logs, total, nil
+}
+
+// RunScheduled advances DNSSEC of all enabled domains:
+// 1. provider-signed zones: refresh pending/disabling/error status and DS records from the provider
+// 2. builtin zones: pending -> active once the parent serves a DS, disabling -> disabled once it is gone
+// 3. builtin zones: start ZSK rollovers when due, advance rollovers in progress, remove retired keys
+// 4. builtin zones: bump config_versions(reason="dnssec:resign") before signatures age out
+// Every change is written to dnssec_audit_logs with actor=scheduler.
+func (s *DNSSECService) RunScheduled() error {
+	var states []models.DomainDNSSEC
+	if err := database.DB.Where("status <> ?", dnsprovider.DNSSECDisabled).Find(&states).Error; err != nil {
+		return fmt.Errorf("failed to list DNSSEC domains: %w", err)
+	}
+
+	var errs []error
+	for i := range states {
+		state := &states[i]
+		provider, err := s.zoneProvider(state.DomainID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("domain %d: %w", state.DomainID, err))
+			continue
+		}
+
+		if provider.Provider == BuiltinDNSProvider {
+			err = s.advanceBuiltin(state, provider.Domain.Domain)
+		} else if state.Status != dnsprovider.DNSSECActive {
+			err = s.refreshProvider(provider, state)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("domain %d: %w", state.DomainID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LoadSigningKeys returns the decrypted keys a builtin zone is signed with,
+// or nil if the zone is not signed
+func (s *DNSSECService) LoadSigningKeys(domainID int) ([]SigningKey, error) {
+	state, err := s.getState(database.DB, domainID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Status == dnsprovider.DNSSECDisabled || state.Status == dnsprovider.DNSSECError {
+		return nil, nil
+	}
+
+	var keys []models.DNSSECKey
+	if err := database.DB.Where("domain_id = ?", domainID).Order("id").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNSSEC keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if s.box == nil {
+		return nil, secretbox.ErrNoKey
+	}
+
+	signingKeys := make([]SigningKey, 0, len(keys))
+	for _, key := range keys {
+		rr, err := dns.NewRR(key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: invalid DNSKEY: %w", key.KeyTag, err)
+		}
+		dnskey, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			return nil, fmt.Errorf("key %d: not a DNSKEY record", key.KeyTag)
+		}
+
+		plaintext, err := s.box.Open(key.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", key.KeyTag, err)
+		}
+		private, err := dnskey.NewPrivateKey(string(plaintext))
+		if err != nil {
+			return nil, fmt.Errorf("key %d: invalid private key: %w", key.KeyTag, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("key %d: unsupported private key", key.KeyTag)
+		}
+
+		signingKeys = append(signingKeys, SigningKey{Role: key.Role, Status: key.Status, DNSKEY: dnskey, Signer: signer})
+	}
+
+	return signingKeys, nil
+}
+
+// enableAtProvider enables signing at the zone's provider and stores its status
+func (s *DNSSECService) enableAtProvider(provider *models.DomainDNSProvider, actor string) error {
+	client, err := s.dnssecProvider(provider)
+	if err != nil {
+		return err
+	}
+
+	status, err := client.EnableDNSSEC(provider.ProviderZoneID)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		state, err := s.getState(tx, provider.DomainID)
+		if err != nil {
+			return err
+		}
+		s.applyProviderStatus(state, status)
+		if err := tx.Save(state).Error; err != nil {
+			return fmt.Errorf("failed to save DNSSEC state: %w", err)
+		}
+		return s.audit(tx, provider.DomainID, DNSSECActionEnable, nil, actor, "enabled at "+provider.Provider+", status "+status.Status)
+	})
+}
+
+// disableAtProvider disables signing at the zone's provider and stores its status
+func (s *DNSSECService) disableAtProvider(provider *models.DomainDNSProvider, state *models.DomainDNSSEC, actor string) error {
+	client, err := s.dnssecProvider(provider)
+	if err != nil {
+		return err
+	}
+
+	status, err := client.DisableDNSSEC(provider.ProviderZoneID)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		s.applyProviderStatus(state, status)
+		if err := tx.Save(state).Error; err != nil {
+			return fmt.Errorf("failed to save DNSSEC state: %w", err)
+		}
+		return s.audit(tx, provider.DomainID, DNSSECActionDisable, nil, actor, "disabled at "+provider.Provider+", status "+status.Status)
+	})
+}
+
+// refreshProvider fetches the provider's DNSSEC status of a zone
+func (s *DNSSECService) refreshProvider(provider *models.DomainDNSProvider, state *models.DomainDNSSEC) error {
+	client, err := s.dnssecProvider(provider)
+	if err != nil {
+		return err
+	}
+
+	status, err := client.GetDNSSEC(provider.ProviderZoneID)
+	if err != nil {
+		msg := truncateError(err.Error())
+		state.LastError = &msg
+		return database.DB.Model(state).Update("last_error", msg).Error
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		previous := state.Status
+		s.applyProviderStatus(state, status)
+		if err := tx.Save(state).Error; err != nil {
+			return fmt.Errorf("failed to save DNSSEC state: %w", err)
+		}
+		if previous == state.Status {
+			return nil
+		}
+		return s.audit(tx, provider.DomainID, DNSSECActionStatus, nil, DNSSECSchedulerActor, previous+" -> "+state.Status)
+	})
+}
+
+// applyProviderStatus copies a provider status into the stored state
+func (s *DNSSECService) applyProviderStatus(state *models.DomainDNSSEC, status *dnsprovider.DNSSECStatus) {
+	now := time.Now()
+	state.Status = status.Status
+	state.DSRecords = strings.Join(status.DS, "\n")
+	state.LastError = nil
+	state.CheckedAt = &now
+}
+
+// advanceBuiltin runs the scheduled steps of one builtin zone
+func (s *DNSSECService) advanceBuiltin(state *models.DomainDNSSEC, domain string) error {
+	now := time.Now()
+
+	// A failed lookup only postpones steps that wait for the parent;
+	// rollovers and re-signing go on
+	var parentDS []*dns.DS
+	var lookupErr error
+	if state.Status == dnsprovider.DNSSECPending || state.Status == dnsprovider.DNSSECDisabling || s.kskRolloverPending(state.DomainID) {
+		parentDS, lookupErr = lookupParentDS(domain)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		state.CheckedAt = &now
+		state.LastError = nil
+		if lookupErr != nil {
+			msg := truncateError("DS lookup: " + lookupErr.Error())
+			state.LastError = &msg
+		}
+
+		switch state.Status {
+		case dnsprovider.DNSSECDisabling:
+			if lookupErr != nil || len(parentDS) > 0 {
+				return tx.Save(state).Error
+			}
+			return s.finishDisable(tx, state, DNSSECSchedulerActor)
+
+		case dnsprovider.DNSSECPending:
+			if matched, err := s.parentHasActiveKSK(tx, state.DomainID, parentDS); err != nil {
+				return err
+			} else if matched {
+				state.Status = dnsprovider.DNSSECActive
+				if err := s.audit(tx, state.DomainID, DNSSECActionStatus, nil, DNSSECSchedulerActor, "DS found at the parent, pending -> active"); err != nil {
+					return err
+				}
+			}
+
+		case dnsprovider.DNSSECActive:
+
+		default:
+			return tx.Save(state).Error
+		}
+
+		changed, err := s.advanceRollovers(tx, state, domain, parentDS, now)
+		if err != nil {
+			return err
+		}
+
+		if !changed && state.SignedAt != nil && now.Sub(*state.SignedAt) < dnssecResignInterval {
+			return tx.Save(state).Error
+		}
+
+		state.SignedAt = &now
+		if err := tx.Save(state).Error; err != nil {
+			return fmt.Errorf("failed to save DNSSEC state: %w", err)
+		}
+		reason := "dnssec:resign"
+		if changed {
+			reason = "dnssec:rollover"
+		}
+		return s.configVersionService.BumpVersion(tx, reason)
+	})
+}
+
+// advanceRollovers moves key rollovers of a builtin zone forward and
+// reports whether the DNSKEY set or the signing keys changed
+func (s *DNSSECService) advanceRollovers(tx *gorm.DB, state *models.DomainDNSSEC, domain string, parentDS []*dns.DS, now time.Time) (bool, error) {
+	var keys []models.DNSSECKey
+	if err := tx.Where("domain_id = ?", state.DomainID).Order("id").Find(&keys).Error; err != nil {
+		return false, fmt.Errorf("failed to get DNSSEC keys: %w", err)
+	}
+
+	changed := false
+	zskPublished := false
+	for i := range keys {
+		key := &keys[i]
+
+		switch {
+		case key.Status == DNSSECKeyRetired && key.RemoveAt != nil && now.After(*key.RemoveAt):
+			if err := tx.Delete(key).Error; err != nil {
+				return false, fmt.Errorf("failed to delete DNSSEC key: %w", err)
+			}
+			if err := s.audit(tx, state.DomainID, DNSSECActionKeyRemoved, &key.KeyTag, DNSSECSchedulerActor, key.Role+" removed from the DNSKEY set"); err != nil {
+				return false, err
+			}
+			changed = true
+
+		case key.Status == DNSSECKeyPublished && now.Sub(key.CreatedAt) >= dnssecPropagationDelay:
+			if key.Role == DNSSECRoleKSK && !dsMatches(key, parentDS) {
+				continue // Waiting for the registrar
+			}
+			if err := s.completeRollover(tx, state, key, keys, now); err != nil {
+				return false, err
+			}
+			changed = true
+
+		case key.Status == DNSSECKeyPublished && key.Role == DNSSECRoleZSK:
+			zskPublished = true
+		}
+	}
+
+	if !zskPublished && state.NextRolloverAt != nil && now.After(*state.NextRolloverAt) {
+		if err := s.startRollover(tx, state, domain, DNSSECRoleZSK, DNSSECSchedulerActor); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// startRollover publishes a new key of the given role
+func (s *DNSSECService) startRollover(tx *gorm.DB, state *models.DomainDNSSEC, domain, role, actor string) error {
+	var inProgress int64
+	if err := tx.Model(&models.DNSSECKey{}).
+		Where("domain_id = ? AND role = ? AND status = ?", state.DomainID, role, DNSSECKeyPublished).
+		Count(&inProgress).Error; err != nil {
+		return fmt.Errorf("failed to check DNSSEC keys: %w", err)
+	}
+	if inProgress > 0 {
+		return ErrRolloverInProgress
+	}
+
+	key, err := s.generateKey(dns.Fqdn(strings.ToLower(domain)), state.DomainID, role)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create DNSSEC key: %w", err)
+	}
+
+	detail := "zsk published, activated after the propagation delay"
+	if role == DNSSECRoleKSK {
+		detail = "ksk published, add its DS at the registrar"
+		ds, err := s.builtinDS(tx, state.DomainID)
+		if err != nil {
+			return err
+		}
+		state.DSRecords = strings.Join(ds, "\n")
+	} else {
+		next := time.Now().AddDate(0, 0, state.ZSKLifetimeDays)
+		state.NextRolloverAt = &next
+	}
+	if err := tx.Save(state).Error; err != nil {
+		return fmt.Errorf("failed to save DNSSEC state: %w", err)
+	}
+
+	if err := s.audit(tx, state.DomainID, DNSSECActionRolloverStart, &key.KeyTag, actor, detail); err != nil {
+		return err
+	}
+	if actor != DNSSECSchedulerActor {
+		return s.configVersionService.BumpVersion(tx, "dnssec:rollover")
+	}
+	return nil
+}
+
+// completeRollover activates a published key and retires the active keys of its role
+func (s *DNSSECService) completeRollover(tx *gorm.DB, state *models.DomainDNSSEC, key *models.DNSSECKey, keys []models.DNSSECKey, now time.Time) error {
+	removeAt := now.Add(dnssecPropagationDelay)
+	for i := range keys {
+		old := &keys[i]
+		if old.Role != key.Role || old.Status != DNSSECKeyActive {
+			continue
+		}
+		if err := tx.Model(old).Updates(map[string]interface{}{
+			"status":     DNSSECKeyRetired,
+			"retired_at": now,
+			"remove_at":  removeAt,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to retire DNSSEC key: %w", err)
+		}
+		old.Status = DNSSECKeyRetired
+		if err := s.audit(tx, state.DomainID, DNSSECActionKeyRetired, &old.KeyTag, DNSSECSchedulerActor, old.Role+" retired, removed at "+removeAt.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(key).Updates(map[string]interface{}{
+		"status":       DNSSECKeyActive,
+		"activated_at": now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to activate DNSSEC key: %w", err)
+	}
+	key.Status = DNSSECKeyActive
+	if err := s.audit(tx, state.DomainID, DNSSECActionKeyActivated, &key.KeyTag, DNSSECSchedulerActor, key.Role+" activated"); err != nil {
+		return err
+	}
+
+	if key.Role == DNSSECRoleKSK {
+		ds, err := s.builtinDS(tx, state.DomainID)
+		if err != nil {
+			return err
+		}
+		state.DSRecords = strings.Join(ds, "\n")
+	}
+
+	return s.audit(tx, state.DomainID, DNSSECActionRolloverDone, &key.KeyTag, DNSSECSchedulerActor, key.Role+" rollover complete")
+}
+
+// finishDisable removes the keys of a builtin zone once no DS points at them
+func (s *DNSSECService) finishDisable(tx *gorm.DB, state *models.DomainDNSSEC, actor string) error {
+	if err := tx.Where("domain_id = ?", state.DomainID).Delete(&models.DNSSECKey{}).Error; err != nil {
+		return fmt.Errorf("failed to delete DNSSEC keys: %w", err)
+	}
+
+	state.Status = dnsprovider.DNSSECDisabled
+	state.DSRecords = ""
+	state.NextRolloverAt = nil
+	state.SignedAt = nil
+	if err := tx.Save(state).Error; err != nil {
+		return fmt.Errorf("failed to save DNSSEC state: %w", err)
+	}
+
+	if err := s.audit(tx, state.DomainID, DNSSECActionDisable, nil, actor, "no DS at the parent, signing stopped and keys removed"); err != nil {
+		return err
+	}
+	return s.configVersionService.BumpVersion(tx, "dnssec:disable")
+}
+
+// kskRolloverPending reports whether a KSK waits for its DS at the parent
+func (s *DNSSECService) kskRolloverPending(domainID int) bool {
+	var count int64
+	database.DB.Model(&models.DNSSECKey{}).
+		Where("domain_id = ? AND role = ? AND status = ?", domainID, DNSSECRoleKSK, DNSSECKeyPublished).
+		Count(&count)
+	return count > 0
+}
+
+// parentHasActiveKSK reports whether the parent serves a DS of an active KSK
+func (s *DNSSECService) parentHasActiveKSK(tx *gorm.DB, domainID int, parentDS []*dns.DS) (bool, error) {
+	var keys []models.DNSSECKey
+	if err := tx.Where("domain_id = ? AND role = ? AND status = ?", domainID, DNSSECRoleKSK, DNSSECKeyActive).
+		Find(&keys).Error; err != nil {
+		return false, fmt.Errorf("failed to get DNSSEC keys: %w", err)
+	}
+	for i := range keys {
+		if dsMatches(&keys[i], parentDS) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// builtinDS returns the DS records of all KSKs that are not retired
+func (s *DNSSECService) builtinDS(tx *gorm.DB, domainID int) ([]string, error) {
+	var keys []models.DNSSECKey
+	if err := tx.Where("domain_id = ? AND role = ? AND status <> ?", domainID, DNSSECRoleKSK, DNSSECKeyRetired).
+		Order("id").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNSSEC keys: %w", err)
+	}
+
+	var ds []string
+	for _, key := range keys {
+		rr, err := dns.NewRR(key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: invalid DNSKEY: %w", key.KeyTag, err)
+		}
+		ds = append(ds, rr.(*dns.DNSKEY).ToDS(dns.SHA256).String())
+	}
+	return ds, nil
+}
+
+// generateKey creates a key pair and seals its private key
+func (s *DNSSECService) generateKey(origin string, domainID int, role string) (*models.DNSSECKey, error) {
+	flags := uint16(dns.ZONE)
+	if role == DNSSECRoleKSK {
+		flags |= dns.SEP
+	}
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: dnskeyTTL},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dnssecAlgorithm,
+	}
+
+	private, err := dnskey.Generate(256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate DNSSEC key: %w", err)
+	}
+	sealed, err := s.box.Seal([]byte(dnskey.PrivateKeyString(private)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt DNSSEC key: %w", err)
+	}
+
+	return &models.DNSSECKey{
+		DomainID:   domainID,
+		Role:       role,
+		Algorithm:  int(dnskey.Algorithm),
+		KeyTag:     int(dnskey.KeyTag()),
+		PublicKey:  dnskey.String(),
+		PrivateKey: sealed,
+		Status:     DNSSECKeyPublished,
+	}, nil
+}
+
+// dnssecProvider returns the DNSSEC API of a provider-signed zone
+func (s *DNSSECService) dnssecProvider(provider *models.DomainDNSProvider) (dnsprovider.DNSSECProvider, error) {
+	if provider.Provider == "manual" {
+		return nil, ErrDNSSECNotSupported
+	}
+
+	var apiKey models.APIKey
+	if err := database.DB.First(&apiKey, provider.APIKeyID).Error; err != nil {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if apiKey.Status != "active" {
+		return nil, fmt.Errorf("API key is inactive")
+	}
+
+	var client dnsprovider.Provider
+	if provider.Provider == dnsprovider.Cloudflare {
+		client = dnsprovider.NewCloudflare(s.cloudflareClient.WithToken(string(apiKey.APIToken)))
+	} else {
+		creds := dnsprovider.Credentials{Secret: string(apiKey.APIToken)}
+		if apiKey.Account != nil {
+			creds.Account = *apiKey.Account
+		}
+		var err error
+		if client, err = dnsprovider.New(provider.Provider, creds); err != nil {
+			return nil, err
+		}
+	}
+
+	dnssec, ok := client.(dnsprovider.DNSSECProvider)
+	if !ok {
+		return nil, ErrDNSSECNotSupported
+	}
+	return dnssec, nil
+}
+
+// zoneProvider returns the active DNS provider of a domain with the domain preloaded
+func (s *DNSSECService) zoneProvider(domainID int) (*models.DomainDNSProvider, error) {
+	var provider models.DomainDNSProvider
+	if err := database.DB.Preload("Domain").Where("domain_id = ?", domainID).First(&provider).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrDomainNotFound
+		}
+		return nil, fmt.Errorf("failed to get DNS provider: %w", err)
+	}
+	if provider.Domain == nil {
+		return nil, ErrDomainNotFound
+	}
+	return &provider, nil
+}
+
+// getState returns the DNSSEC state of a domain, a disabled one if none is stored
+func (s *DNSSECService) getState(tx *gorm.DB, domainID int) (*models.DomainDNSSEC, error) {
+	var state models.DomainDNSSEC
+	err := tx.Where("domain_id = ?", domainID).First(&state).Error
+	if err == gorm.ErrRecordNotFound {
+		return &models.DomainDNSSEC{
+			DomainID:        domainID,
+			Status:          dnsprovider.DNSSECDisabled,
+			ZSKLifetimeDays: defaultZSKLifetimeDays,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DNSSEC state: %w", err)
+	}
+	return &state, nil
+}
+
+// audit records a DNSSEC change
+func (s *DNSSECService) audit(tx *gorm.DB, domainID int, action string, keyTag *int, actor, detail string) error {
+	entry := models.DNSSECAuditLog{
+		DomainID: domainID,
+		Action:   action,
+		KeyTag:   keyTag,
+		Actor:    actor,
+		Detail:   detail,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record DNSSEC audit log: %w", err)
+	}
+	if keyTag != nil {
+		log.Printf("[DNSSEC] Domain %d: %s (key %d) by %s: %s\n", domainID, action, *keyTag, actor, detail)
+	} else {
+		log.Printf("[DNSSEC] Domain %d: %s by %s: %s\n", domainID, action, actor, detail)
+	}
+	return nil
+}
+
+// lookupParentDS queries the DS records of a zone through the system resolver
+func lookupParentDS(domain string) ([]*dns.DS, error) {
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil || len(conf.Servers) == 0 {
+		return nil, fmt.Errorf("no system resolver: %v", err)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeDS)
+	msg.SetEdns0(4096, true)
+
+	client := &dns.Client{Timeout: 5 * time.Second}
+	var lastErr error
+	for _, server := range conf.Servers {
+		resp, _, err := client.Exchange(msg, server+":"+conf.Port)
+		if err == nil && resp.Truncated {
+			client.Net = "tcp"
+			resp, _, err = client.Exchange(msg, server+":"+conf.Port)
+			client.Net = ""
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			lastErr = fmt.Errorf("%s from %s", dns.RcodeToString[resp.Rcode], server)
+			continue
+		}
+
+		var ds []*dns.DS
+		for _, rr := range resp.Answer {
+			if rr, ok := rr.(*dns.DS); ok {
+				ds = append(ds, rr)
+			}
+		}
+		return ds, nil
+	}
+	return nil, lastErr
+}
+
+// dsMatches reports whether one of the DS records points at a key
+func dsMatches(key *models.DNSSECKey, parentDS []*dns.DS) bool {
+	for _, ds := range parentDS {
+		if int(ds.KeyTag) == key.KeyTag && int(ds.Algorithm) == key.Algorithm {
+			rr, err := dns.NewRR(key.PublicKey)
+			if err != nil {
+				return false
+			}
+			if own := rr.(*dns.DNSKEY).ToDS(ds.DigestType); own != nil && strings.EqualFold(own.Digest, ds.Digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitDS splits stored DS records into a list
+func splitDS(stored string) []string {
+	ds := []string{}
+	for _, line := range strings.Split(stored, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			ds = append(ds, line)
+		}
+	}
+	return ds
+}
+
+// truncateError fits an error message into a varchar(255) column
+func truncateError(msg string) string {
+	if len(msg) > 255 {
+		return msg[:255]
+	}
+	return msg
+}
@@ -3,10 +3,13 @@ package service
 import (
 	"errors"
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/cdn-control-panel/backend/internal/database"
 	"github.com/cdn-control-panel/backend/internal/models"
 	"github.com/cdn-control-panel/backend/internal/utils"
+	"github.com/cdn-control-panel/backend/pkg/dnsprovider"
 	"gorm.io/gorm"
 )
 
@@ -15,6 +18,9 @@ var (
 	ErrDomainAlreadyExists = errors.New("domain already exists")
 	ErrDomainHasDependency = errors.New("domain has dependencies")
 	ErrInvalidFQDN         = errors.New("invalid FQDN for this zone")
+	ErrZoneIsPublicSuffix  = errors.New("domain is a public suffix")
+	ErrNoZoneForFQDN       = errors.New("no managed zone for FQDN")
+	ErrNameInSubzone       = errors.New("name belongs to a managed subzone")
 )
 
 type DomainService struct{}
@@ -28,8 +34,8 @@ type CreateDomainRequest struct {
 	Domain         string `json:"domain" binding:"required"`
 	Purpose        string `json:"purpose"`
 	Provider       string `json:"provider" binding:"required"`
-	ProviderZoneID string `json:"provider_zone_id" binding:"required"`
-	APIKeyID       int    `json:"api_key_id" binding:"required"`
+	ProviderZoneID string `json:"provider_zone_id"` // Required unless provider=builtin
+	APIKeyID       int    `json:"api_key_id"`       // Required unless provider=builtin
 }
 
 // UpdateDomainRequest represents request to update a domain
@@ -50,6 +56,18 @@ type DomainFilter struct {
 func (s *DomainService) CreateDomain(req CreateDomainRequest) (*models.Domain, error) {
 	db := database.GetDB()
 
+	// Store IDN zones in punycode, the form DNS providers expect
+	name, err := utils.NormalizeDomain(req.Domain)
+	if err != nil {
+		return nil, err
+	}
+	req.Domain = name
+
+	// Names like com.cn are shared by all registrants and cannot be a zone
+	if utils.IsPublicSuffix(req.Domain) {
+		return nil, fmt.Errorf("%w: %s", ErrZoneIsPublicSuffix, req.Domain)
+	}
+
 	// Check if domain already exists
 	var existing models.Domain
 	if err := db.Where("domain = ?", req.Domain).First(&existing).Error; err == nil {
@@ -57,11 +75,10 @@ func (s *DomainService) CreateDomain(req CreateDomainRequest) (*models.Domain, e
 	}
 
 	// Verify API key exists and is active
-	var apiKey models.APIKey
-	if err := db.Where("id = ? AND status = ?", req.APIKeyID, "active").First(&apiKey).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("API key not found or inactive")
-		}
+	if req.Provider == BuiltinDNSProvider {
+		req.ProviderZoneID = req.Domain
+		req.APIKeyID = 0
+	} else if err := checkProviderCredentials(db, req.ProviderZoneID, req.APIKeyID); err != nil {
 		return nil, err
 	}
 
@@ -76,7 +93,7 @@ func (s *DomainService) CreateDomain(req CreateDomainRequest) (*models.Domain, e
 		domain.Purpose = "cdn"
 	}
 
-	err := db.Transaction(func(tx *gorm.DB) error {
+	err = db.Transaction(func(tx *gorm.DB) error {
 		// Create domain
 		if err := tx.Create(domain).Error; err != nil {
 			return err
@@ -95,6 +112,15 @@ func (s *DomainService) CreateDomain(req CreateDomainRequest) (*models.Domain, e
 			return err
 		}
 
+		// A subzone of a managed zone takes over the parent's records below it
+		copied, parent, err := adoptSubzoneRecords(tx, domain)
+		if err != nil {
+			return err
+		}
+		if copied > 0 {
+			log.Printf("[Domain] Copied %d DNS records from %s to subzone %s\n", copied, parent, domain.Domain)
+		}
+
 		return nil
 	})
 
@@ -105,6 +131,266 @@ func (s *DomainService) CreateDomain(req CreateDomainRequest) (*models.Domain, e
 	return domain, nil
 }
 
+// ZoneSuggestion describes where records for a name belong
+type ZoneSuggestion struct {
+	Name          string         `json:"name"`
+	Zone          *models.Domain `json:"zone"`           // Most specific managed zone, nil when none
+	PublicSuffix  string         `json:"public_suffix"`  // e.g. com.cn
+	SuggestedZone string         `json:"suggested_zone"` // Registrable domain to add when Zone is nil
+}
+
+// SuggestZone returns the managed zone containing name, or the registrable
+// domain that should be added as a zone when there is none
+func (s *DomainService) SuggestZone(name string) (*ZoneSuggestion, error) {
+	fqdn, err := utils.NormalizeDomain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	zone, err := findManagedZone(database.GetDB(), fqdn)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion := &ZoneSuggestion{
+		Name:         fqdn,
+		Zone:         zone,
+		PublicSuffix: utils.PublicSuffix(fqdn),
+	}
+	if zone == nil {
+		suggestion.SuggestedZone, _ = utils.RegistrableDomain(fqdn)
+	}
+	return suggestion, nil
+}
+
+// findManagedZone returns the most specific zone containing fqdn, so a
+// delegated subzone wins over its parent when both are managed. Returns nil
+// when no zone matches.
+func findManagedZone(db *gorm.DB, fqdn string) (*models.Domain, error) {
+	fqdn = utils.ToASCII(fqdn)
+
+	labels := strings.Split(fqdn, ".")
+	candidates := make([]string, 0, len(labels))
+	for i := range labels {
+		candidates = append(candidates, strings.Join(labels[i:], "."))
+	}
+
+	var zones []models.Domain
+	if err := db.Where("domain IN ?", candidates).Find(&zones).Error; err != nil {
+		return nil, err
+	}
+
+	var best *models.Domain
+	for i := range zones {
+		if best == nil || len(zones[i].Domain) > len(best.Domain) {
+			best = &zones[i]
+		}
+	}
+	return best, nil
+}
+
+// noZoneError reports a name without a managed zone, suggesting the
+// registrable domain to add
+func noZoneError(fqdn string) error {
+	if zone, err := utils.RegistrableDomain(fqdn); err == nil {
+		return fmt.Errorf("%w: %s (add zone %s)", ErrNoZoneForFQDN, fqdn, zone)
+	}
+	return fmt.Errorf("%w: %s", ErrNoZoneForFQDN, fqdn)
+}
+
+// checkSubzone rejects a record in domain whose name belongs to a managed
+// subzone, where resolvers would never see it. NS records at the subzone
+// apex are the delegation and stay in the parent.
+func checkSubzone(db *gorm.DB, domain *models.Domain, fqdn, recordType string) error {
+	zone, err := findManagedZone(db, fqdn)
+	if err != nil {
+		return err
+	}
+	if zone == nil || zone.ID == domain.ID {
+		return nil
+	}
+	if recordType == "NS" && zone.Domain == utils.ToASCII(fqdn) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is in zone %s", ErrNameInSubzone, fqdn, zone.Domain)
+}
+
+// adoptSubzoneRecords copies the records of the closest managed parent zone
+// that fall inside the new zone into the subzone (pending). The parent copies
+// keep answering until the delegation is live, see CompleteSubzoneMoves.
+// Returns the number of records copied and the parent zone name.
+func adoptSubzoneRecords(tx *gorm.DB, domain *models.Domain) (int, string, error) {
+	parent, err := findParentZone(tx, domain)
+	if err != nil || parent == nil {
+		return 0, "", err
+	}
+
+	var records []models.DomainDNSRecord
+	if err := tx.Where("domain_id = ? AND status <> ?", parent.ID, "deleting").Find(&records).Error; err != nil {
+		return 0, "", err
+	}
+
+	copied := 0
+	for _, record := range records {
+		if !movesToSubzone(record, parent, domain) {
+			continue
+		}
+
+		fqdn := utils.CalculateFQDN(record.Name, parent.Domain)
+		child := models.DomainDNSRecord{
+			DomainID:  domain.ID,
+			Type:      record.Type,
+			Name:      utils.CalculateRelativeName(fqdn, domain.Domain),
+			Value:     record.Value,
+			TTL:       record.TTL,
+			Proxied:   record.Proxied,
+			Priority:  record.Priority,
+			Weight:    record.Weight,
+			Port:      record.Port,
+			CAAFlags:  record.CAAFlags,
+			CAATag:    record.CAATag,
+			Line:      record.Line,
+			Status:    "pending",
+			OwnerType: record.OwnerType,
+			OwnerID:   record.OwnerID,
+		}
+		if err := createOrReviveRecord(tx, &child); err != nil {
+			return 0, "", err
+		}
+		copied++
+	}
+
+	return copied, parent.Domain, nil
+}
+
+// findParentZone returns the closest managed zone above domain, nil when none
+func findParentZone(db *gorm.DB, domain *models.Domain) (*models.Domain, error) {
+	dot := strings.Index(domain.Domain, ".")
+	if dot < 0 {
+		return nil, nil
+	}
+	return findManagedZone(db, domain.Domain[dot+1:])
+}
+
+// movesToSubzone reports whether a record of parent belongs to the subzone
+// child. NS records at the subzone apex are the delegation and stay in the
+// parent, and node/line group records stay with the zone of their group.
+func movesToSubzone(record models.DomainDNSRecord, parent, child *models.Domain) bool {
+	fqdn := utils.CalculateFQDN(record.Name, parent.Domain)
+	if !utils.ValidateFQDN(fqdn, child.Domain) {
+		return false
+	}
+	if record.Type == "NS" && fqdn == child.Domain {
+		return false
+	}
+	return record.OwnerType != "node_group" && record.OwnerType != "line_group"
+}
+
+// CompleteSubzoneMoves queues the parent copies of records adopted by a
+// subzone for deletion once resolvers reach the subzone (see subzoneCutover).
+// Called by DNSSyncWorker after each verification run; returns the number of
+// parent records queued.
+func CompleteSubzoneMoves(db *gorm.DB) (int, error) {
+	// Zones have at least two labels, so only zones of three or more can be
+	// below another zone
+	var zones []models.Domain
+	if err := db.Where("domain LIKE ?", "%.%.%").Find(&zones).Error; err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for i := range zones {
+		child := &zones[i]
+		parent, err := findParentZone(db, child)
+		if err != nil {
+			return queued, err
+		}
+		if parent == nil {
+			continue
+		}
+
+		var parentRecords, childRecords []models.DomainDNSRecord
+		if err := db.Where("domain_id = ? AND status <> ?", parent.ID, "deleting").Find(&parentRecords).Error; err != nil {
+			return queued, err
+		}
+		if err := db.Where("domain_id = ? AND status <> ?", child.ID, "deleting").Find(&childRecords).Error; err != nil {
+			return queued, err
+		}
+		ids := subzoneCutover(parent, child, parentRecords, childRecords)
+		if len(ids) == 0 {
+			continue
+		}
+
+		if err := QueueRecordDeletion(db, "id IN ?", ids); err != nil {
+			return queued, err
+		}
+		log.Printf("[Domain] Removed %d DNS records moved to subzone %s from %s\n", len(ids), child.Domain, parent.Domain)
+		queued += len(ids)
+	}
+
+	return queued, nil
+}
+
+// subzoneCutover returns the parent records whose copy in the subzone child
+// is served, so they can be deleted from the parent. Resolvers only reach the
+// subzone through the delegation, so nothing is returned until the parent
+// publishes NS records at the subzone apex and every apex record of the
+// subzone is verified. A parent record is then returned once all subzone
+// records of the same name, type and line are served.
+func subzoneCutover(parent, child *models.Domain, parentRecords, childRecords []models.DomainDNSRecord) []int {
+	delegated := false
+	var candidates []models.DomainDNSRecord
+	for _, record := range parentRecords {
+		if record.Type == "NS" && utils.CalculateFQDN(record.Name, parent.Domain) == child.Domain {
+			if record.Status != "active" && record.Status != "verified" {
+				return nil
+			}
+			delegated = true
+			continue
+		}
+		if movesToSubzone(record, parent, child) {
+			candidates = append(candidates, record)
+		}
+	}
+	if !delegated || len(candidates) == 0 {
+		return nil
+	}
+
+	type key struct{ name, typ, line string }
+	served := make(map[key]bool)
+	for _, record := range childRecords {
+		if record.Name == "@" && !recordServed(record) {
+			return nil
+		}
+		k := key{record.Name, record.Type, record.Line}
+		ok, seen := served[k]
+		served[k] = recordServed(record) && (ok || !seen)
+	}
+
+	var ids []int
+	for _, record := range candidates {
+		fqdn := utils.CalculateFQDN(record.Name, parent.Domain)
+		k := key{utils.CalculateRelativeName(fqdn, child.Domain), record.Type, record.Line}
+		if served[k] {
+			ids = append(ids, record.ID)
+		}
+	}
+	return ids
+}
+
+// recordServed reports whether a record is known to be answered by the
+// nameservers of its zone. Records of other resolver views and weighted
+// records are never verified (see DNSSyncWorker), so for them being synced is
+// as far as it goes.
+func recordServed(record models.DomainDNSRecord) bool {
+	if record.Status == "verified" {
+		return true
+	}
+	unverifiable := (record.Line != "" && record.Line != dnsprovider.ViewDefault) ||
+		(record.Weight != nil && record.Type != "SRV")
+	return record.Status == "active" && unverifiable
+}
+
 // GetDomain retrieves a domain by ID
 func (s *DomainService) GetDomain(id int) (*models.Domain, error) {
 	db := database.GetDB()
@@ -125,7 +411,7 @@ func (s *DomainService) GetDomainByName(domainName string) (*models.Domain, erro
 	db := database.GetDB()
 
 	var domain models.Domain
-	if err := db.Where("domain = ?", domainName).First(&domain).Error; err != nil {
+	if err := db.Where("domain = ?", utils.ToASCII(domainName)).First(&domain).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrDomainNotFound
 		}
@@ -233,6 +519,15 @@ func (s *DomainService) DeleteDomain(id int) error {
 		return fmt.Errorf("%w: has %d line groups", ErrDomainHasDependency, lineGroupCount)
 	}
 
+	// Signed zones must be disabled first so the registrar's DS is removed
+	var dnssecCount int64
+	if err := db.Model(&models.DomainDNSSEC{}).Where("domain_id = ? AND status <> ?", id, "disabled").Count(&dnssecCount).Error; err != nil {
+		return err
+	}
+	if dnssecCount > 0 {
+		return fmt.Errorf("%w: DNSSEC is enabled", ErrDomainHasDependency)
+	}
+
 	// Delete in transaction
 	return db.Transaction(func(tx *gorm.DB) error {
 		// Delete DNS provider
@@ -240,6 +535,11 @@ func (s *DomainService) DeleteDomain(id int) error {
 			return err
 		}
 
+		// Delete DNSSEC state (audit logs are kept)
+		if err := tx.Where("domain_id = ?", id).Delete(&models.DomainDNSSEC{}).Error; err != nil {
+			return err
+		}
+
 		// Delete domain
 		result := tx.Delete(&models.Domain{}, id)
 		if result.Error != nil {
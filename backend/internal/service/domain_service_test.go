@@ -0,0 +1,132 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cdn-control-panel/backend/internal/models"
+)
+
+func TestSubzoneCutover(t *testing.T) {
+	parent := &models.Domain{ID: 1, Domain: "example.com"}
+	child := &models.Domain{ID: 2, Domain: "cdn.example.com"}
+	weight := 10
+
+	parentRecord := func(id int, recordType, name, status string) models.DomainDNSRecord {
+		return models.DomainDNSRecord{ID: id, DomainID: parent.ID, Type: recordType, Name: name, Value: "v", Status: status}
+	}
+	childRecord := func(recordType, name, status string) models.DomainDNSRecord {
+		return models.DomainDNSRecord{DomainID: child.ID, Type: recordType, Name: name, Value: "v", Status: status}
+	}
+
+	moved := []models.DomainDNSRecord{
+		parentRecord(10, "A", "www.cdn", "verified"),
+		parentRecord(11, "TXT", "cdn", "verified"),
+		parentRecord(12, "A", "www", "verified"),
+	}
+	groupRecord := parentRecord(13, "CNAME", "ng.cdn", "verified")
+	groupRecord.OwnerType = "node_group"
+	moved = append(moved, groupRecord)
+
+	delegation := func(status string) []models.DomainDNSRecord {
+		return []models.DomainDNSRecord{
+			parentRecord(1, "NS", "cdn", status),
+			parentRecord(2, "NS", "cdn", "verified"),
+		}
+	}
+	served := []models.DomainDNSRecord{
+		childRecord("A", "www", "verified"),
+		childRecord("TXT", "@", "verified"),
+	}
+
+	tests := []struct {
+		name          string
+		parentRecords []models.DomainDNSRecord
+		childRecords  []models.DomainDNSRecord
+		want          []int
+	}{
+		{
+			name:          "no delegation",
+			parentRecords: moved,
+			childRecords:  served,
+		},
+		{
+			name:          "delegation not synced",
+			parentRecords: append(delegation("pending"), moved...),
+			childRecords:  served,
+		},
+		{
+			name:          "delegation failed",
+			parentRecords: append(delegation("error"), moved...),
+			childRecords:  served,
+		},
+		{
+			name:          "apex not verified",
+			parentRecords: append(delegation("active"), moved...),
+			childRecords:  []models.DomainDNSRecord{childRecord("A", "www", "verified"), childRecord("TXT", "@", "active")},
+		},
+		{
+			name:          "copies not synced",
+			parentRecords: append(delegation("active"), moved...),
+			childRecords:  []models.DomainDNSRecord{childRecord("A", "www", "pending"), childRecord("TXT", "@", "verified")},
+			want:          []int{11},
+		},
+		{
+			name:          "delegated and verified",
+			parentRecords: append(delegation("active"), moved...),
+			childRecords:  served,
+			want:          []int{10, 11},
+		},
+		{
+			name:          "one of a set not verified",
+			parentRecords: append(delegation("verified"), moved...),
+			childRecords:  append([]models.DomainDNSRecord{childRecord("A", "www", "active")}, served...),
+			want:          []int{11},
+		},
+		{
+			name: "unverifiable records are served once active",
+			parentRecords: append(delegation("verified"),
+				models.DomainDNSRecord{ID: 20, Type: "A", Name: "geo.cdn", Line: "cn", Status: "active"},
+				models.DomainDNSRecord{ID: 21, Type: "A", Name: "lb.cdn", Weight: &weight, Status: "active"}),
+			childRecords: []models.DomainDNSRecord{
+				{Type: "A", Name: "geo", Line: "cn", Status: "active"},
+				{Type: "A", Name: "lb", Weight: &weight, Status: "active"},
+			},
+			want: []int{20, 21},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := subzoneCutover(parent, child, tt.parentRecords, tt.childRecords)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subzoneCutover() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMovesToSubzone(t *testing.T) {
+	parent := &models.Domain{ID: 1, Domain: "example.com"}
+	child := &models.Domain{ID: 2, Domain: "cdn.example.com"}
+
+	tests := []struct {
+		record models.DomainDNSRecord
+		want   bool
+	}{
+		{models.DomainDNSRecord{Type: "A", Name: "www.cdn"}, true},
+		{models.DomainDNSRecord{Type: "MX", Name: "cdn"}, true},
+		{models.DomainDNSRecord{Type: "NS", Name: "sub.cdn"}, true},
+		{models.DomainDNSRecord{Type: "NS", Name: "cdn"}, false},
+		{models.DomainDNSRecord{Type: "A", Name: "www"}, false},
+		{models.DomainDNSRecord{Type: "A", Name: "xcdn"}, false},
+		{models.DomainDNSRecord{Type: "CNAME", Name: "lg.cdn", OwnerType: "line_group"}, false},
+		{models.DomainDNSRecord{Type: "CNAME", Name: "site.cdn", OwnerType: "website_domain"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := movesToSubzone(tt.record, parent, child); got != tt.want {
+			t.Errorf("movesToSubzone(%s %s) = %v, want %v", tt.record.Type, tt.record.Name, got, tt.want)
+		}
+	}
+}
@@ -1,21 +1,52 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 
 	"github.com/cdn-control-panel/backend/internal/database"
 	"github.com/cdn-control-panel/backend/internal/models"
 	"github.com/cdn-control-panel/backend/internal/utils"
+	"github.com/cdn-control-panel/backend/pkg/dnsprovider"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidView              = errors.New("invalid resolver view")
+	ErrDuplicateView            = errors.New("duplicate resolver view")
+	ErrViewNotSupported         = errors.New("resolver view not supported by the zone's DNS provider")
+	ErrInvalidMembers           = errors.New("invalid line group members")
+	ErrInvalidFailoverThreshold = errors.New("failover threshold must be between 1 and 100")
+)
+
+// Line group member roles
+const (
+	MemberRolePrimary = "primary"
+	MemberRoleBackup  = "backup"
+)
+
+// Line group events
+const (
+	LineGroupEventMembers   = "members"
+	LineGroupEventFailover  = "failover"
+	LineGroupEventFailback  = "failback"
+	LineGroupEventRebalance = "rebalance"
+)
+
+const defaultFailoverThreshold = 50
+
 type LineGroupService struct {
 	configVersionService *ConfigVersionService
+	dnsRecordService     *DNSRecordService
 }
 
-func NewLineGroupService(configVersionService *ConfigVersionService) *LineGroupService {
+func NewLineGroupService(configVersionService *ConfigVersionService, dnsRecordService *DNSRecordService) *LineGroupService {
 	return &LineGroupService{
 		configVersionService: configVersionService,
+		dnsRecordService:     dnsRecordService,
 	}
 }
 
@@ -23,17 +54,84 @@ func NewLineGroupService(configVersionService *ConfigVersionService) *LineGroupS
 type CreateLineGroupRequest struct {
 	Name        string `json:"name" binding:"required"`
 	DomainID    int    `json:"domain_id" binding:"required"`
+	NodeGroupID int    `json:"node_group_id"` // Required unless members are given
+
+	AddressFamily string `json:"address_family"` // ipv4, ipv6, dual (default); must cover the node group's
+
+	Routes []LineGroupRouteRequest `json:"routes"` // Resolver view -> node group; node_group_id is the default route
+
+	Members           []LineGroupMemberRequest `json:"members"`            // Weighted node groups of the default route
+	FailoverThreshold int                      `json:"failover_threshold"` // Percent of healthy sub IPs, default 50
+}
+
+// LineGroupRouteRequest routes a resolver view to a node group
+type LineGroupRouteRequest struct {
+	View        string `json:"view" binding:"required"` // telecom, unicom, mobile, edu, overseas, continent:XX, country:XX
+	NodeGroupID int    `json:"node_group_id" binding:"required"`
+}
+
+// LineGroupMemberRequest adds a node group to the default route
+type LineGroupMemberRequest struct {
 	NodeGroupID int    `json:"node_group_id" binding:"required"`
+	Role        string `json:"role"`   // primary (default), backup
+	Weight      int    `json:"weight"` // 1-100, default 1
 }
 
 // CreateLineGroup implements WF-02: Create Line Group
-// 1. insert line_groups (generate cname_prefix/cname)
-// 2. insert domain_dns_records(type=CNAME, value=node_group.cname, proxied=0, owner=line_group, pending)
-// 3. bump config_versions(reason="line_group:create")
+// 1. insert line_groups (generate cname_prefix/cname, address family checked against the node groups)
+// 2. insert line_group_members (node_group_id = first primary) and select the serving members by health
+// 3. insert line_group_routes (views checked against the zone's DNS provider)
+// 4. insert domain_dns_records(type=CNAME, value=node_group.cname, line=view, weight, proxied=0, owner=line_group, pending)
+// 5. insert line_group_events(event=members) when members are given
+// 6. bump config_versions(reason="line_group:create")
 func (s *LineGroupService) CreateLineGroup(req CreateLineGroupRequest) (*models.LineGroup, error) {
+	lineGroup, err := s.createLineGroup(database.DB, req, "")
+	if err != nil {
+		return nil, err
+	}
+	s.dnsRecordService.wakeSyncWorker()
+	return lineGroup, nil
+}
+
+// createLineGroup runs CreateLineGroup on db, which may be a plan transaction. An
+// empty cnamePrefix is generated; plans pin it so that apply creates the
+// same records.
+func (s *LineGroupService) createLineGroup(db *gorm.DB, req CreateLineGroupRequest, cnamePrefix string) (*models.LineGroup, error) {
 	var lineGroup *models.LineGroup
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	addressFamily := req.AddressFamily
+	if addressFamily == "" {
+		addressFamily = AddressFamilyDual
+	}
+	if err := validateAddressFamily(addressFamily); err != nil {
+		return nil, err
+	}
+
+	threshold := req.FailoverThreshold
+	if threshold == 0 {
+		threshold = defaultFailoverThreshold
+	}
+	if threshold < 1 || threshold > 100 {
+		return nil, ErrInvalidFailoverThreshold
+	}
+
+	members, err := buildMembers(req.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeGroupID := req.NodeGroupID
+	if len(members) > 0 {
+		if nodeGroupID != 0 && nodeGroupID != members[0].NodeGroupID {
+			return nil, fmt.Errorf("%w: node_group_id must be omitted or the first primary member", ErrInvalidMembers)
+		}
+		nodeGroupID = members[0].NodeGroupID
+	}
+	if nodeGroupID == 0 {
+		return nil, fmt.Errorf("%w: node_group_id or members required", ErrInvalidMembers)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
 		// Get domain to build CNAME
 		var domain models.Domain
 		if err := tx.First(&domain, req.DomainID).Error; err != nil {
@@ -42,52 +140,66 @@ func (s *LineGroupService) CreateLineGroup(req CreateLineGroupRequest) (*models.
 
 		// Get node group to get its CNAME
 		var nodeGroup models.NodeGroup
-		if err := tx.First(&nodeGroup, req.NodeGroupID).Error; err != nil {
+		if err := tx.First(&nodeGroup, nodeGroupID).Error; err != nil {
 			return fmt.Errorf("node group not found: %w", err)
 		}
 
+		if err := checkLineFamily(addressFamily, nodeGroup.AddressFamily); err != nil {
+			return err
+		}
+
 		// Generate CNAME prefix
-		cnamePrefix, err := utils.GenerateCNAMEPrefix()
-		if err != nil {
-			return fmt.Errorf("failed to generate CNAME prefix: %w", err)
+		if cnamePrefix == "" {
+			var err error
+			if cnamePrefix, err = utils.GenerateCNAMEPrefix(); err != nil {
+				return fmt.Errorf("failed to generate CNAME prefix: %w", err)
+			}
 		}
 
 		cname := utils.BuildCNAME(cnamePrefix, domain.Domain)
 
 		// 1. Insert line_groups
 		lineGroup = &models.LineGroup{
-			Name:        req.Name,
-			DomainID:    req.DomainID,
-			NodeGroupID: req.NodeGroupID,
-			CNAMEPrefix: cnamePrefix,
-			CNAME:       cname,
-			Status:      "active",
+			Name:              req.Name,
+			DomainID:          req.DomainID,
+			NodeGroupID:       nodeGroupID,
+			CNAMEPrefix:       cnamePrefix,
+			CNAME:             cname,
+			Status:            "active",
+			AddressFamily:     addressFamily,
+			FailoverThreshold: threshold,
 		}
 
 		if err := tx.Create(lineGroup).Error; err != nil {
 			return fmt.Errorf("failed to create line group: %w", err)
 		}
 
-		// 2. Insert domain_dns_records (CNAME pointing to node_group.cname)
-		relativeName := utils.CalculateRelativeName(cname, domain.Domain)
+		// 2. Insert line_group_members
+		if err := replaceMembers(tx, lineGroup, members); err != nil {
+			return err
+		}
+		if _, _, err := evaluateMembers(tx, lineGroup); err != nil {
+			return err
+		}
 
-		dnsRecord := models.DomainDNSRecord{
-			DomainID:  req.DomainID,
-			Type:      "CNAME",
-			Name:      relativeName,
-			Value:     nodeGroup.CNAME,
-			TTL:       120,
-			Proxied:   false, // R5: Proxied default 0
-			Status:    "pending",
-			OwnerType: "line_group",
-			OwnerID:   lineGroup.ID,
+		// 3. Insert line_group_routes
+		if err := s.replaceRoutes(tx, lineGroup, req.Routes); err != nil {
+			return err
 		}
 
-		if err := tx.Create(&dnsRecord).Error; err != nil {
-			return fmt.Errorf("failed to create DNS record: %w", err)
+		// 4. Insert domain_dns_records (CNAME pointing to node_group.cname per view)
+		if err := syncLineGroupRecords(tx, lineGroup); err != nil {
+			return err
 		}
 
-		// 3. Bump config_versions
+		// 5. Record the members
+		if len(members) > 0 {
+			if err := recordLineGroupEvent(tx, lineGroup.ID, LineGroupEventMembers, describeMembers(lineGroup, members)); err != nil {
+				return err
+			}
+		}
+
+		// 6. Bump config_versions
 		if err := s.configVersionService.BumpVersion(tx, "line_group:create"); err != nil {
 			return fmt.Errorf("failed to bump config version: %w", err)
 		}
@@ -112,7 +224,7 @@ func (s *LineGroupService) ListLineGroups(page, pageSize int) ([]models.LineGrou
 	}
 
 	offset := (page - 1) * pageSize
-	if err := database.DB.Preload("Domain").Preload("NodeGroup").Offset(offset).Limit(pageSize).Find(&lineGroups).Error; err != nil {
+	if err := preloadLineGroup(database.DB).Offset(offset).Limit(pageSize).Find(&lineGroups).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to get line groups: %w", err)
 	}
 
@@ -122,21 +234,57 @@ func (s *LineGroupService) ListLineGroups(page, pageSize int) ([]models.LineGrou
 // GetLineGroup returns a line group by ID
 func (s *LineGroupService) GetLineGroup(id int) (*models.LineGroup, error) {
 	var lineGroup models.LineGroup
-	if err := database.DB.Preload("Domain").Preload("NodeGroup").First(&lineGroup, id).Error; err != nil {
+	if err := preloadLineGroup(database.DB).First(&lineGroup, id).Error; err != nil {
 		return nil, fmt.Errorf("line group not found: %w", err)
 	}
 	return &lineGroup, nil
 }
 
+// ListLineGroupEvents returns the member and failover history of a line group, newest first
+func (s *LineGroupService) ListLineGroupEvents(lineGroupID, page, pageSize int) ([]models.LineGroupEvent, int64, error) {
+	var events []models.LineGroupEvent
+	var total int64
+
+	query := database.DB.Model(&models.LineGroupEvent{}).Where("line_group_id = ?", lineGroupID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count line group events: %w", err)
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get line group events: %w", err)
+	}
+
+	return events, total, nil
+}
+
 // DeleteLineGroup deletes a line group
 func (s *LineGroupService) DeleteLineGroup(id int) error {
-	return database.DB.Transaction(func(tx *gorm.DB) error {
-		// Delete DNS records
-		if err := tx.Where("owner_type = ? AND owner_id = ?", "line_group", id).Delete(&models.DomainDNSRecord{}).Error; err != nil {
+	if err := s.deleteLineGroup(database.DB, id); err != nil {
+		return err
+	}
+	s.dnsRecordService.wakeSyncWorker()
+	return nil
+}
+
+// deleteLineGroup runs DeleteLineGroup on db, which may be a plan transaction
+func (s *LineGroupService) deleteLineGroup(db *gorm.DB, id int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Queue DNS records for provider-side deletion
+		if err := QueueRecordDeletion(tx, "owner_type = ? AND owner_id = ?", "line_group", id); err != nil {
 			return fmt.Errorf("failed to delete DNS records: %w", err)
 		}
 
-		// Delete line group
+		// Delete routes, members, events and line group
+		if err := tx.Where("line_group_id = ?", id).Delete(&models.LineGroupRoute{}).Error; err != nil {
+			return fmt.Errorf("failed to delete line group routes: %w", err)
+		}
+		if err := tx.Where("line_group_id = ?", id).Delete(&models.LineGroupMember{}).Error; err != nil {
+			return fmt.Errorf("failed to delete line group members: %w", err)
+		}
+		if err := tx.Where("line_group_id = ?", id).Delete(&models.LineGroupEvent{}).Error; err != nil {
+			return fmt.Errorf("failed to delete line group events: %w", err)
+		}
 		if err := tx.Delete(&models.LineGroup{}, id).Error; err != nil {
 			return fmt.Errorf("failed to delete line group: %w", err)
 		}
@@ -152,34 +300,108 @@ func (s *LineGroupService) DeleteLineGroup(id int) error {
 
 // UpdateLineGroupRequest represents the request to update a line group
 type UpdateLineGroupRequest struct {
-	Name        *string `json:"name"`
-	NodeGroupID *int    `json:"node_group_id"`
+	Name              *string                   `json:"name"`
+	NodeGroupID       *int                      `json:"node_group_id"` // Only for line groups without members
+	AddressFamily     *string                   `json:"address_family"`
+	Routes            *[]LineGroupRouteRequest  `json:"routes"`  // Replaces all routes when set
+	Members           *[]LineGroupMemberRequest `json:"members"` // Replaces all members when set; empty = node_group_id only
+	FailoverThreshold *int                      `json:"failover_threshold"`
 }
 
 // UpdateLineGroup updates a line group
 // DB Writes (transaction):
-// 1. update line_groups (name, node_group_id)
-// 2. if node_group_id changed: update domain_dns_records(value=new_node_group.cname, status=pending)
-// 3. bump config_versions(reason="line_group:update")
+// 1. update line_groups (name, node_group_id, address_family, failover_threshold; the node groups must stay within the family)
+// 2. if members set: replace line_group_members (node_group_id = first primary), insert line_group_events(event=members)
+// 3. reselect the serving members by health
+// 4. if routes set: replace line_group_routes
+// 5. sync domain_dns_records to the members and routes (changed values -> pending, removed ones -> deleting)
+// 6. bump config_versions(reason="line_group:update")
 func (s *LineGroupService) UpdateLineGroup(id int, req UpdateLineGroupRequest) (*models.LineGroup, error) {
+	lineGroup, err := s.updateLineGroup(database.DB, id, req)
+	if err != nil {
+		return nil, err
+	}
+	s.dnsRecordService.wakeSyncWorker()
+	return lineGroup, nil
+}
+
+// updateLineGroup runs UpdateLineGroup on db, which may be a plan transaction
+func (s *LineGroupService) updateLineGroup(db *gorm.DB, id int, req UpdateLineGroupRequest) (*models.LineGroup, error) {
 	var lineGroup *models.LineGroup
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	if req.AddressFamily != nil {
+		if err := validateAddressFamily(*req.AddressFamily); err != nil {
+			return nil, err
+		}
+	}
+	if req.FailoverThreshold != nil && (*req.FailoverThreshold < 1 || *req.FailoverThreshold > 100) {
+		return nil, ErrInvalidFailoverThreshold
+	}
+
+	var members []models.LineGroupMember
+	if req.Members != nil {
+		var err error
+		if members, err = buildMembers(*req.Members); err != nil {
+			return nil, err
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
 		// Get existing line group
 		lineGroup = &models.LineGroup{}
 		if err := tx.First(lineGroup, id).Error; err != nil {
 			return fmt.Errorf("line group not found: %w", err)
 		}
 
-		oldNodeGroupID := lineGroup.NodeGroupID
+		var memberCount int64
+		if err := tx.Model(&models.LineGroupMember{}).Where("line_group_id = ?", id).Count(&memberCount).Error; err != nil {
+			return fmt.Errorf("failed to count line group members: %w", err)
+		}
+
+		// The default node group follows the members
+		nodeGroupID := lineGroup.NodeGroupID
+		switch {
+		case len(members) > 0:
+			if req.NodeGroupID != nil && *req.NodeGroupID != members[0].NodeGroupID {
+				return fmt.Errorf("%w: node_group_id must be omitted or the first primary member", ErrInvalidMembers)
+			}
+			nodeGroupID = members[0].NodeGroupID
+		case req.NodeGroupID != nil:
+			if memberCount > 0 && req.Members == nil {
+				return fmt.Errorf("%w: line group has members, update the members instead", ErrInvalidMembers)
+			}
+			nodeGroupID = *req.NodeGroupID
+		}
+
+		addressFamily := lineGroup.AddressFamily
+		if req.AddressFamily != nil {
+			addressFamily = *req.AddressFamily
+		}
+
+		// Check the resulting line/node group address families
+		if nodeGroupID != lineGroup.NodeGroupID || req.AddressFamily != nil {
+			var nodeGroup models.NodeGroup
+			if err := tx.First(&nodeGroup, nodeGroupID).Error; err != nil {
+				return fmt.Errorf("node group not found: %w", err)
+			}
+			if err := checkLineFamily(addressFamily, nodeGroup.AddressFamily); err != nil {
+				return err
+			}
+		}
 
 		// 1. Update line_groups
 		updates := make(map[string]interface{})
 		if req.Name != nil {
 			updates["name"] = *req.Name
 		}
-		if req.NodeGroupID != nil {
-			updates["node_group_id"] = *req.NodeGroupID
+		if nodeGroupID != lineGroup.NodeGroupID {
+			updates["node_group_id"] = nodeGroupID
+		}
+		if req.AddressFamily != nil {
+			updates["address_family"] = addressFamily
+		}
+		if req.FailoverThreshold != nil {
+			updates["failover_threshold"] = *req.FailoverThreshold
 		}
 
 		if len(updates) > 0 {
@@ -187,27 +409,56 @@ func (s *LineGroupService) UpdateLineGroup(id int, req UpdateLineGroupRequest) (
 				return fmt.Errorf("failed to update line group: %w", err)
 			}
 		}
+		lineGroup.NodeGroupID = nodeGroupID
+		lineGroup.AddressFamily = addressFamily
+		if req.FailoverThreshold != nil {
+			lineGroup.FailoverThreshold = *req.FailoverThreshold
+		}
 
-		// 2. If node_group_id changed, update DNS records
-		if req.NodeGroupID != nil && *req.NodeGroupID != oldNodeGroupID {
-			// Get new node group to get its CNAME
-			var newNodeGroup models.NodeGroup
-			if err := tx.First(&newNodeGroup, *req.NodeGroupID).Error; err != nil {
-				return fmt.Errorf("new node group not found: %w", err)
+		// 2. Replace members
+		if req.Members != nil {
+			if err := replaceMembers(tx, lineGroup, members); err != nil {
+				return err
+			}
+			detail := fmt.Sprintf("members removed, node group %d serves alone", nodeGroupID)
+			if len(members) > 0 {
+				detail = describeMembers(lineGroup, members)
+			}
+			if err := recordLineGroupEvent(tx, id, LineGroupEventMembers, detail); err != nil {
+				return err
+			}
+		}
+
+		// 3. Reselect the serving members
+		event, detail, err := evaluateMembers(tx, lineGroup)
+		if err != nil {
+			return err
+		}
+		if event != "" && req.Members == nil {
+			if err := recordLineGroupEvent(tx, id, event, detail); err != nil {
+				return err
 			}
+		}
 
-			// Update DNS record value and set status to pending
-			if err := tx.Model(&models.DomainDNSRecord{}).
-				Where("owner_type = ? AND owner_id = ?", "line_group", id).
-				Updates(map[string]interface{}{
-					"value":  newNodeGroup.CNAME,
-					"status": "pending",
-				}).Error; err != nil {
-				return fmt.Errorf("failed to update DNS record: %w", err)
+		// 4. Replace routes
+		if req.Routes != nil {
+			if err := s.replaceRoutes(tx, lineGroup, *req.Routes); err != nil {
+				return err
+			}
+		}
+		if req.AddressFamily != nil {
+			// Existing routes and members must stay within the new family
+			if err := checkLineGroupFamilies(tx, lineGroup); err != nil {
+				return err
 			}
 		}
 
-		// 3. Bump config_versions
+		// 5. Sync DNS records to the members and routes
+		if err := syncLineGroupRecords(tx, lineGroup); err != nil {
+			return err
+		}
+
+		// 6. Bump config_versions
 		if err := s.configVersionService.BumpVersion(tx, "line_group:update"); err != nil {
 			return fmt.Errorf("failed to bump config version: %w", err)
 		}
@@ -220,9 +471,546 @@ func (s *LineGroupService) UpdateLineGroup(id int, req UpdateLineGroupRequest) (
 	}
 
 	// Reload line group with relations
-	if err := database.DB.Preload("Domain").Preload("NodeGroup").First(lineGroup, id).Error; err != nil {
+	if err := preloadLineGroup(db).First(lineGroup, id).Error; err != nil {
 		return nil, fmt.Errorf("failed to reload line group: %w", err)
 	}
 
 	return lineGroup, nil
 }
+
+// EvaluateFailovers reselects the serving members of every line group with
+// members after node group health changed. Changes are recorded as line
+// group events and bump the config version.
+func (s *LineGroupService) EvaluateFailovers() error {
+	var lineGroupIDs []int
+	if err := database.DB.Model(&models.LineGroupMember{}).Distinct().Pluck("line_group_id", &lineGroupIDs).Error; err != nil {
+		return fmt.Errorf("failed to get line groups with members: %w", err)
+	}
+
+	var errs []error
+	changed := false
+	for _, id := range lineGroupIDs {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var lineGroup models.LineGroup
+			if err := tx.First(&lineGroup, id).Error; err != nil {
+				return fmt.Errorf("line group not found: %w", err)
+			}
+
+			event, detail, err := evaluateMembers(tx, &lineGroup)
+			if err != nil || event == "" {
+				return err
+			}
+
+			if err := syncLineGroupRecords(tx, &lineGroup); err != nil {
+				return err
+			}
+			if err := recordLineGroupEvent(tx, id, event, detail); err != nil {
+				return err
+			}
+			if err := s.configVersionService.BumpVersion(tx, "line_group:"+event); err != nil {
+				return fmt.Errorf("failed to bump config version: %w", err)
+			}
+
+			log.Printf("[LineGroup] Line group %s: %s (%s)\n", lineGroup.Name, event, detail)
+			changed = true
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line group %d: %w", id, err))
+		}
+	}
+
+	if changed {
+		s.dnsRecordService.wakeSyncWorker()
+	}
+	return errors.Join(errs...)
+}
+
+// preloadLineGroup loads the relations returned by the line group API
+func preloadLineGroup(db *gorm.DB) *gorm.DB {
+	return db.Preload("Domain").Preload("NodeGroup").Preload("Routes.NodeGroup").
+		Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).Preload("Members.NodeGroup")
+}
+
+// zoneProvider returns the DNS provider of a zone ("" without one)
+func zoneProvider(tx *gorm.DB, domainID int) string {
+	var dnsProvider models.DomainDNSProvider
+	if err := tx.Where("domain_id = ?", domainID).First(&dnsProvider).Error; err != nil {
+		return ""
+	}
+	return dnsProvider.Provider
+}
+
+// replaceRoutes validates routes and replaces the line group's routing table
+func (s *LineGroupService) replaceRoutes(tx *gorm.DB, lineGroup *models.LineGroup, routes []LineGroupRouteRequest) error {
+	if err := tx.Where("line_group_id = ?", lineGroup.ID).Delete(&models.LineGroupRoute{}).Error; err != nil {
+		return fmt.Errorf("failed to delete line group routes: %w", err)
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+
+	provider := zoneProvider(tx, lineGroup.DomainID)
+	seen := make(map[string]bool)
+	for _, r := range routes {
+		view := dnsprovider.NormalizeView(r.View)
+		// The default view is the line group's own node group
+		if view == dnsprovider.ViewDefault || !dnsprovider.ValidView(view) {
+			return fmt.Errorf("%w: %q", ErrInvalidView, r.View)
+		}
+		if seen[view] {
+			return fmt.Errorf("%w: %s", ErrDuplicateView, view)
+		}
+		seen[view] = true
+		if !dnsprovider.SupportsView(provider, view) {
+			return fmt.Errorf("%w: %s", ErrViewNotSupported, view)
+		}
+
+		var nodeGroup models.NodeGroup
+		if err := tx.First(&nodeGroup, r.NodeGroupID).Error; err != nil {
+			return fmt.Errorf("node group not found: %w", err)
+		}
+		if err := checkLineFamily(lineGroup.AddressFamily, nodeGroup.AddressFamily); err != nil {
+			return fmt.Errorf("route %s: %w", view, err)
+		}
+
+		route := models.LineGroupRoute{
+			LineGroupID: lineGroup.ID,
+			View:        view,
+			NodeGroupID: r.NodeGroupID,
+		}
+		if err := tx.Create(&route).Error; err != nil {
+			return fmt.Errorf("failed to create line group route: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkLineGroupFamilies checks the routed and member node groups against
+// the line group's address-family policy
+func checkLineGroupFamilies(tx *gorm.DB, lineGroup *models.LineGroup) error {
+	var routes []models.LineGroupRoute
+	if err := tx.Preload("NodeGroup").Where("line_group_id = ?", lineGroup.ID).Find(&routes).Error; err != nil {
+		return fmt.Errorf("failed to get line group routes: %w", err)
+	}
+	for _, route := range routes {
+		if route.NodeGroup == nil {
+			continue
+		}
+		if err := checkLineFamily(lineGroup.AddressFamily, route.NodeGroup.AddressFamily); err != nil {
+			return fmt.Errorf("route %s: %w", route.View, err)
+		}
+	}
+
+	var members []models.LineGroupMember
+	if err := tx.Preload("NodeGroup").Where("line_group_id = ?", lineGroup.ID).Find(&members).Error; err != nil {
+		return fmt.Errorf("failed to get line group members: %w", err)
+	}
+	for _, member := range members {
+		if member.NodeGroup == nil {
+			continue
+		}
+		if err := checkLineFamily(lineGroup.AddressFamily, member.NodeGroup.AddressFamily); err != nil {
+			return fmt.Errorf("member %s: %w", member.NodeGroup.Name, err)
+		}
+	}
+	return nil
+}
+
+// buildMembers validates member requests and applies defaults. Primaries are
+// moved first (keeping their order), so the first member is the line group's
+// node_group_id.
+func buildMembers(reqs []LineGroupMemberRequest) ([]models.LineGroupMember, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+
+	members := make([]models.LineGroupMember, 0, len(reqs))
+	seen := make(map[int]bool)
+	for _, r := range reqs {
+		role := r.Role
+		if role == "" {
+			role = MemberRolePrimary
+		}
+		if role != MemberRolePrimary && role != MemberRoleBackup {
+			return nil, fmt.Errorf("%w: invalid role %q", ErrInvalidMembers, r.Role)
+		}
+		weight := r.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if weight < 1 || weight > 100 {
+			return nil, fmt.Errorf("%w: weight must be between 1 and 100", ErrInvalidMembers)
+		}
+		if r.NodeGroupID <= 0 || seen[r.NodeGroupID] {
+			return nil, fmt.Errorf("%w: duplicate or missing node group %d", ErrInvalidMembers, r.NodeGroupID)
+		}
+		seen[r.NodeGroupID] = true
+
+		members = append(members, models.LineGroupMember{
+			NodeGroupID: r.NodeGroupID,
+			Role:        role,
+			Weight:      weight,
+		})
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Role == MemberRolePrimary && members[j].Role != MemberRolePrimary
+	})
+	if members[0].Role != MemberRolePrimary {
+		return nil, fmt.Errorf("%w: at least one primary required", ErrInvalidMembers)
+	}
+	return members, nil
+}
+
+// replaceMembers replaces the members of a line group; the node groups must
+// stay within its address family
+func replaceMembers(tx *gorm.DB, lineGroup *models.LineGroup, members []models.LineGroupMember) error {
+	if err := tx.Where("line_group_id = ?", lineGroup.ID).Delete(&models.LineGroupMember{}).Error; err != nil {
+		return fmt.Errorf("failed to delete line group members: %w", err)
+	}
+
+	for i := range members {
+		var nodeGroup models.NodeGroup
+		if err := tx.First(&nodeGroup, members[i].NodeGroupID).Error; err != nil {
+			return fmt.Errorf("node group not found: %w", err)
+		}
+		if err := checkLineFamily(lineGroup.AddressFamily, nodeGroup.AddressFamily); err != nil {
+			return fmt.Errorf("member %s: %w", nodeGroup.Name, err)
+		}
+
+		members[i].ID = 0
+		members[i].LineGroupID = lineGroup.ID
+		if err := tx.Create(&members[i]).Error; err != nil {
+			return fmt.Errorf("failed to create line group member: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// evaluateMembers refreshes the health of the members' node groups and
+// selects the serving members: the primaries at or above the failover
+// threshold, else the backups at or above it, else all primaries (nothing
+// healthy: keep answering). It returns the event to record when the serving
+// members changed, or "" when they did not.
+func evaluateMembers(tx *gorm.DB, lineGroup *models.LineGroup) (string, string, error) {
+	var members []models.LineGroupMember
+	if err := tx.Preload("NodeGroup").Where("line_group_id = ?", lineGroup.ID).Order("id ASC").Find(&members).Error; err != nil {
+		return "", "", fmt.Errorf("failed to get line group members: %w", err)
+	}
+
+	health := make([]int, len(members))
+	for i := range members {
+		if members[i].NodeGroup == nil {
+			continue
+		}
+		h, err := nodeGroupHealth(tx, members[i].NodeGroup)
+		if err != nil {
+			return "", "", err
+		}
+		health[i] = h
+	}
+
+	serving := func(role string) map[int]bool {
+		set := make(map[int]bool)
+		for i, m := range members {
+			if m.Role == role && health[i] >= lineGroup.FailoverThreshold {
+				set[i] = true
+			}
+		}
+		return set
+	}
+	active := serving(MemberRolePrimary)
+	failedOver := false
+	if len(active) == 0 {
+		active = serving(MemberRoleBackup)
+		failedOver = len(active) > 0
+	}
+	if len(active) == 0 {
+		for i, m := range members {
+			active[i] = m.Role == MemberRolePrimary
+		}
+	}
+
+	changed := false
+	var in, out []string
+	for i := range members {
+		m := &members[i]
+		label := fmt.Sprintf("node group %d (%d%%)", m.NodeGroupID, health[i])
+		if m.NodeGroup != nil {
+			label = fmt.Sprintf("%s (%d%%)", m.NodeGroup.Name, health[i])
+		}
+		if active[i] {
+			in = append(in, label)
+		} else {
+			out = append(out, label)
+		}
+
+		if m.Active == active[i] && m.Health == health[i] {
+			continue
+		}
+		changed = changed || m.Active != active[i]
+		if err := tx.Model(&models.LineGroupMember{}).Where("id = ?", m.ID).
+			Updates(map[string]interface{}{
+				"active": active[i],
+				"health": health[i],
+			}).Error; err != nil {
+			return "", "", fmt.Errorf("failed to update line group member: %w", err)
+		}
+	}
+
+	wasFailedOver := lineGroup.FailedOver
+	if failedOver != wasFailedOver {
+		if err := tx.Model(&models.LineGroup{}).Where("id = ?", lineGroup.ID).
+			Update("failed_over", failedOver).Error; err != nil {
+			return "", "", fmt.Errorf("failed to update line group: %w", err)
+		}
+		lineGroup.FailedOver = failedOver
+	}
+
+	if !changed {
+		return "", "", nil
+	}
+
+	event := LineGroupEventRebalance
+	switch {
+	case failedOver && !wasFailedOver:
+		event = LineGroupEventFailover
+	case !failedOver && wasFailedOver:
+		event = LineGroupEventFailback
+	}
+	detail := "serving: " + strings.Join(in, ", ")
+	if len(out) > 0 {
+		detail += "; out: " + strings.Join(out, ", ")
+	}
+	return event, detail, nil
+}
+
+// nodeGroupHealth returns the share of enabled member sub IPs of a node group
+// that are not unhealthy, in percent. Groups without health check count as
+// healthy as long as they have members.
+func nodeGroupHealth(tx *gorm.DB, nodeGroup *models.NodeGroup) (int, error) {
+	members := func() *gorm.DB {
+		return tx.Model(&models.NodeGroupSubIP{}).
+			Joins("JOIN node_sub_ips ON node_sub_ips.id = node_group_sub_ips.sub_ip_id").
+			Where("node_group_sub_ips.node_group_id = ? AND node_sub_ips.enabled = ?", nodeGroup.ID, true)
+	}
+
+	var total, healthy int64
+	if err := members().Count(&total).Error; err != nil {
+		return 0, fmt.Errorf("failed to count node group members: %w", err)
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	if nodeGroup.HealthCheckType == HealthCheckNone {
+		return 100, nil
+	}
+	if err := members().Where("node_group_sub_ips.health_status <> ?", HealthUnhealthy).Count(&healthy).Error; err != nil {
+		return 0, fmt.Errorf("failed to count healthy node group members: %w", err)
+	}
+	return int(healthy * 100 / total), nil
+}
+
+// describeMembers summarizes members for the line group event log
+func describeMembers(lineGroup *models.LineGroup, members []models.LineGroupMember) string {
+	parts := make([]string, 0, len(members))
+	for _, m := range members {
+		parts = append(parts, fmt.Sprintf("%s node group %d weight %d", m.Role, m.NodeGroupID, m.Weight))
+	}
+	return fmt.Sprintf("%s; failover threshold %d%%", strings.Join(parts, ", "), lineGroup.FailoverThreshold)
+}
+
+// recordLineGroupEvent appends to the line group's event log
+func recordLineGroupEvent(tx *gorm.DB, lineGroupID int, event, detail string) error {
+	if len(detail) > 1024 {
+		detail = detail[:1024]
+	}
+	if err := tx.Create(&models.LineGroupEvent{
+		LineGroupID: lineGroupID,
+		Event:       event,
+		Detail:      detail,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record line group event: %w", err)
+	}
+	return nil
+}
+
+// lineTarget is one desired CNAME record of a line group
+type lineTarget struct {
+	line        string
+	nodeGroupID int
+	weight      *int
+}
+
+// lineGroupTargets returns the desired records of a line group. The default
+// route resolves to the serving members: one weighted record each where the
+// provider supports weights, otherwise the heaviest member alone. Route 53
+// cannot mix weighted and geolocation records of a name, so line groups with
+// routes publish the heaviest member there too. Without routes the default
+// record has no line; with routes it is the provider's default line.
+func lineGroupTargets(tx *gorm.DB, lineGroup *models.LineGroup) ([]lineTarget, error) {
+	var routes []models.LineGroupRoute
+	if err := tx.Where("line_group_id = ?", lineGroup.ID).Order("id ASC").Find(&routes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get line group routes: %w", err)
+	}
+
+	var members []models.LineGroupMember
+	if err := tx.Where("line_group_id = ? AND active = ?", lineGroup.ID, true).
+		Order("weight DESC, id ASC").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to get line group members: %w", err)
+	}
+
+	defaultLine := ""
+	if len(routes) > 0 {
+		defaultLine = dnsprovider.ViewDefault
+	}
+
+	var targets []lineTarget
+	provider := zoneProvider(tx, lineGroup.DomainID)
+	weighted := dnsprovider.SupportsWeight(provider) && !(provider == dnsprovider.Route53 && len(routes) > 0)
+	switch {
+	case len(members) == 0:
+		targets = append(targets, lineTarget{line: defaultLine, nodeGroupID: lineGroup.NodeGroupID})
+	case weighted:
+		for _, m := range members {
+			weight := m.Weight
+			targets = append(targets, lineTarget{line: defaultLine, nodeGroupID: m.NodeGroupID, weight: &weight})
+		}
+	default:
+		targets = append(targets, lineTarget{line: defaultLine, nodeGroupID: members[0].NodeGroupID})
+	}
+
+	for _, route := range routes {
+		targets = append(targets, lineTarget{line: route.View, nodeGroupID: route.NodeGroupID})
+	}
+	return targets, nil
+}
+
+// syncLineGroupRecords makes the line group's CNAME records match its
+// members and routes (see lineGroupTargets). Records that only need a new
+// value or weight are updated in place and set back to pending.
+func syncLineGroupRecords(tx *gorm.DB, lineGroup *models.LineGroup) error {
+	var domain models.Domain
+	if err := tx.First(&domain, lineGroup.DomainID).Error; err != nil {
+		return fmt.Errorf("domain not found: %w", err)
+	}
+
+	targets, err := lineGroupTargets(tx, lineGroup)
+	if err != nil {
+		return err
+	}
+
+	cnames := make(map[int]string)
+	for _, t := range targets {
+		if _, ok := cnames[t.nodeGroupID]; ok {
+			continue
+		}
+		var nodeGroup models.NodeGroup
+		if err := tx.First(&nodeGroup, t.nodeGroupID).Error; err != nil {
+			return fmt.Errorf("node group not found: %w", err)
+		}
+		cnames[t.nodeGroupID] = nodeGroup.CNAME
+	}
+
+	var existing []models.DomainDNSRecord
+	if err := tx.Where("owner_type = ? AND owner_id = ? AND status <> ?", "line_group", lineGroup.ID, "deleting").
+		Order("id ASC").Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to get DNS records: %w", err)
+	}
+
+	// Match existing records by line and value first, then reuse the
+	// remaining records of a line for its remaining targets
+	matched := make([]bool, len(targets))
+	var unmatched []models.DomainDNSRecord
+	for _, record := range existing {
+		found := -1
+		for i, t := range targets {
+			if !matched[i] && t.line == record.Line && cnames[t.nodeGroupID] == record.Value {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			unmatched = append(unmatched, record)
+			continue
+		}
+		matched[found] = true
+		if err := updateLineGroupRecord(tx, record, record.Value, targets[found].weight); err != nil {
+			return err
+		}
+	}
+
+	var stale []int
+	for _, record := range unmatched {
+		found := -1
+		for i, t := range targets {
+			if !matched[i] && t.line == record.Line {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			stale = append(stale, record.ID)
+			continue
+		}
+		matched[found] = true
+		t := targets[found]
+		if err := updateLineGroupRecord(tx, record, cnames[t.nodeGroupID], t.weight); err != nil {
+			return err
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := QueueRecordDeletion(tx, "id IN ?", stale); err != nil {
+			return fmt.Errorf("failed to delete DNS records: %w", err)
+		}
+	}
+
+	relativeName := utils.CalculateRelativeName(lineGroup.CNAME, domain.Domain)
+	for i, t := range targets {
+		if matched[i] {
+			continue
+		}
+		dnsRecord := models.DomainDNSRecord{
+			DomainID:  lineGroup.DomainID,
+			Type:      "CNAME",
+			Name:      relativeName,
+			Value:     cnames[t.nodeGroupID],
+			Weight:    t.weight,
+			Line:      t.line,
+			TTL:       120,
+			Proxied:   false, // R5: Proxied default 0
+			Status:    "pending",
+			OwnerType: "line_group",
+			OwnerID:   lineGroup.ID,
+		}
+		if err := createOrReviveRecord(tx, &dnsRecord); err != nil {
+			return fmt.Errorf("failed to create DNS record: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// updateLineGroupRecord sets the value and weight of a line group record,
+// setting it back to pending when either changed
+func updateLineGroupRecord(tx *gorm.DB, record models.DomainDNSRecord, value string, weight *int) error {
+	sameWeight := (record.Weight == nil && weight == nil) ||
+		(record.Weight != nil && weight != nil && *record.Weight == *weight)
+	if record.Value == value && sameWeight {
+		return nil
+	}
+
+	if err := tx.Model(&models.DomainDNSRecord{}).Where("id = ?", record.ID).
+		Updates(map[string]interface{}{
+			"value":  value,
+			"weight": weight,
+			"status": "pending",
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update DNS record: %w", err)
+	}
+	return nil
+}
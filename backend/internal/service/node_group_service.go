@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/cdn-control-panel/backend/internal/database"
@@ -9,13 +10,27 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidAddressFamily  = errors.New("invalid address family")
+	ErrAddressFamilyMismatch = errors.New("node group publishes an address family the line group does not allow")
+)
+
+// Address-family policies of node groups and line groups
+const (
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+	AddressFamilyDual = "dual"
+)
+
 type NodeGroupService struct {
 	configVersionService *ConfigVersionService
+	syncTrigger          SyncTrigger
 }
 
-func NewNodeGroupService(configVersionService *ConfigVersionService) *NodeGroupService {
+func NewNodeGroupService(configVersionService *ConfigVersionService, syncTrigger SyncTrigger) *NodeGroupService {
 	return &NodeGroupService{
 		configVersionService: configVersionService,
+		syncTrigger:          syncTrigger,
 	}
 }
 
@@ -25,18 +40,49 @@ type CreateNodeGroupRequest struct {
 	Description *string `json:"description"`
 	DomainID    int     `json:"domain_id" binding:"required"`
 	SubIPIDs    []int   `json:"sub_ip_ids" binding:"required"`
+
+	AddressFamily string             `json:"address_family"` // ipv4, ipv6, dual (default)
+	HealthCheck   *HealthCheckConfig `json:"health_check"`
 }
 
 // CreateNodeGroup implements WF-01: Create Node Group
 // DB Writes (transaction):
 // 1. insert node_groups (generate cname_prefix/cname)
 // 2. insert node_group_sub_ips
-// 3. for each enabled sub_ip: insert domain_dns_records(type=A, proxied=0, owner=node_group, status=pending)
+// 3. for each enabled sub_ip of an allowed family: insert domain_dns_records(type=A/AAAA, proxied=0, owner=node_group, status=pending)
 // 4. bump config_versions(reason="node_group:create")
 func (s *NodeGroupService) CreateNodeGroup(req CreateNodeGroupRequest) (*models.NodeGroup, error) {
+	nodeGroup, err := s.createNodeGroup(database.DB, req, "")
+	if err != nil {
+		return nil, err
+	}
+	wakeSyncWorker(s.syncTrigger)
+	return nodeGroup, nil
+}
+
+// createNodeGroup runs CreateNodeGroup on db, which may be a plan transaction. An
+// empty cnamePrefix is generated; plans pin it so that apply creates the
+// same records.
+func (s *NodeGroupService) createNodeGroup(db *gorm.DB, req CreateNodeGroupRequest, cnamePrefix string) (*models.NodeGroup, error) {
 	var nodeGroup *models.NodeGroup
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	addressFamily := req.AddressFamily
+	if addressFamily == "" {
+		addressFamily = AddressFamilyDual
+	}
+	if err := validateAddressFamily(addressFamily); err != nil {
+		return nil, err
+	}
+
+	var healthCheck map[string]interface{}
+	if req.HealthCheck != nil {
+		var err error
+		if healthCheck, err = req.HealthCheck.columns(); err != nil {
+			return nil, err
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
 		// Get domain to build CNAME
 		var domain models.Domain
 		if err := tx.First(&domain, req.DomainID).Error; err != nil {
@@ -44,27 +90,36 @@ func (s *NodeGroupService) CreateNodeGroup(req CreateNodeGroupRequest) (*models.
 		}
 
 		// Generate CNAME prefix
-		cnamePrefix, err := utils.GenerateCNAMEPrefix()
-		if err != nil {
-			return fmt.Errorf("failed to generate CNAME prefix: %w", err)
+		if cnamePrefix == "" {
+			var err error
+			if cnamePrefix, err = utils.GenerateCNAMEPrefix(); err != nil {
+				return fmt.Errorf("failed to generate CNAME prefix: %w", err)
+			}
 		}
 
 		cname := utils.BuildCNAME(cnamePrefix, domain.Domain)
 
 		// 1. Insert node_groups
 		nodeGroup = &models.NodeGroup{
-			Name:        req.Name,
-			Description: req.Description,
-			DomainID:    req.DomainID,
-			CNAMEPrefix: cnamePrefix,
-			CNAME:       cname,
-			Status:      "active",
+			Name:          req.Name,
+			Description:   req.Description,
+			DomainID:      req.DomainID,
+			CNAMEPrefix:   cnamePrefix,
+			CNAME:         cname,
+			Status:        "active",
+			AddressFamily: addressFamily,
 		}
 
 		if err := tx.Create(nodeGroup).Error; err != nil {
 			return fmt.Errorf("failed to create node group: %w", err)
 		}
 
+		if healthCheck != nil {
+			if err := tx.Model(nodeGroup).Updates(healthCheck).Error; err != nil {
+				return fmt.Errorf("failed to set health check: %w", err)
+			}
+		}
+
 		// 2. Insert node_group_sub_ips
 		for _, subIPID := range req.SubIPIDs {
 			nodeGroupSubIP := models.NodeGroupSubIP{
@@ -86,18 +141,11 @@ func (s *NodeGroupService) CreateNodeGroup(req CreateNodeGroupRequest) (*models.
 		relativeName := utils.CalculateRelativeName(cname, domain.Domain)
 
 		for _, subIP := range subIPs {
-			dnsRecord := models.DomainDNSRecord{
-				DomainID:  req.DomainID,
-				Type:      "A",
-				Name:      relativeName,
-				Value:     subIP.IP,
-				TTL:       120,
-				Proxied:   false, // R5: Proxied default 0
-				Status:    "pending",
-				OwnerType: "node_group",
-				OwnerID:   nodeGroup.ID,
+			dnsRecord, ok := nodeGroupAddressRecord(nodeGroup, relativeName, subIP.IP)
+			if !ok {
+				continue
 			}
-			if err := tx.Create(&dnsRecord).Error; err != nil {
+			if err := tx.Create(dnsRecord).Error; err != nil {
 				return fmt.Errorf("failed to create DNS record: %w", err)
 			}
 		}
@@ -145,9 +193,18 @@ func (s *NodeGroupService) GetNodeGroup(id int) (*models.NodeGroup, error) {
 
 // DeleteNodeGroup deletes a node group
 func (s *NodeGroupService) DeleteNodeGroup(id int) error {
-	return database.DB.Transaction(func(tx *gorm.DB) error {
-		// Delete DNS records
-		if err := tx.Where("owner_type = ? AND owner_id = ?", "node_group", id).Delete(&models.DomainDNSRecord{}).Error; err != nil {
+	if err := s.deleteNodeGroup(database.DB, id); err != nil {
+		return err
+	}
+	wakeSyncWorker(s.syncTrigger)
+	return nil
+}
+
+// deleteNodeGroup runs DeleteNodeGroup on db, which may be a plan transaction
+func (s *NodeGroupService) deleteNodeGroup(db *gorm.DB, id int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Queue DNS records for provider-side deletion
+		if err := QueueRecordDeletion(tx, "owner_type = ? AND owner_id = ?", "node_group", id); err != nil {
 			return fmt.Errorf("failed to delete DNS records: %w", err)
 		}
 
@@ -175,19 +232,47 @@ type UpdateNodeGroupRequest struct {
 	Name        *string `json:"name"`
 	Description *string `json:"description"`
 	SubIPIDs    []int   `json:"sub_ip_ids"`
+
+	AddressFamily *string            `json:"address_family"`
+	HealthCheck   *HealthCheckConfig `json:"health_check"`
 }
 
 // UpdateNodeGroup updates a node group
 // DB Writes (transaction):
-// 1. update node_groups (name, description)
-// 2. sync node_group_sub_ips (add/remove)
-// 3. for newly added enabled sub_ips: insert domain_dns_records(type=A, status=pending)
-// 4. for removed sub_ips: delete corresponding domain_dns_records
-// 5. bump config_versions(reason="node_group:update")
+// 1. update node_groups (name, description, health check; turning it off restores withdrawn records)
+// 2. if address_family changed: check line groups, create/delete A/AAAA records of existing members
+// 3. sync node_group_sub_ips (add/remove)
+// 4. for newly added enabled sub_ips of an allowed family: insert domain_dns_records(type=A/AAAA, status=pending)
+// 5. for removed sub_ips: mark corresponding domain_dns_records status=deleting
+// 6. bump config_versions(reason="node_group:update")
 func (s *NodeGroupService) UpdateNodeGroup(id int, req UpdateNodeGroupRequest) (*models.NodeGroup, error) {
+	nodeGroup, err := s.updateNodeGroup(database.DB, id, req)
+	if err != nil {
+		return nil, err
+	}
+	wakeSyncWorker(s.syncTrigger)
+	return nodeGroup, nil
+}
+
+// updateNodeGroup runs UpdateNodeGroup on db, which may be a plan transaction
+func (s *NodeGroupService) updateNodeGroup(db *gorm.DB, id int, req UpdateNodeGroupRequest) (*models.NodeGroup, error) {
 	var nodeGroup *models.NodeGroup
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	if req.AddressFamily != nil {
+		if err := validateAddressFamily(*req.AddressFamily); err != nil {
+			return nil, err
+		}
+	}
+
+	var healthCheck map[string]interface{}
+	if req.HealthCheck != nil {
+		var err error
+		if healthCheck, err = req.HealthCheck.columns(); err != nil {
+			return nil, err
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
 		// Get existing node group
 		nodeGroup = &models.NodeGroup{}
 		if err := tx.First(nodeGroup, id).Error; err != nil {
@@ -202,14 +287,40 @@ func (s *NodeGroupService) UpdateNodeGroup(id int, req UpdateNodeGroupRequest) (
 		if req.Description != nil {
 			updates["description"] = *req.Description
 		}
+		familyChanged := req.AddressFamily != nil && *req.AddressFamily != nodeGroup.AddressFamily
+		if familyChanged {
+			updates["address_family"] = *req.AddressFamily
+		}
+		for column, value := range healthCheck {
+			updates[column] = value
+		}
 
 		if len(updates) > 0 {
 			if err := tx.Model(nodeGroup).Updates(updates).Error; err != nil {
 				return fmt.Errorf("failed to update node group: %w", err)
 			}
 		}
+		if familyChanged {
+			nodeGroup.AddressFamily = *req.AddressFamily
+		}
 
-		// 2. Sync node_group_sub_ips if provided
+		if req.HealthCheck != nil && req.HealthCheck.Type == HealthCheckNone {
+			if err := restoreWithdrawnMembers(tx, nodeGroup); err != nil {
+				return err
+			}
+		}
+
+		// 2. Publish members under the new address-family policy
+		if familyChanged {
+			if err := checkNodeGroupLineFamilies(tx, nodeGroup); err != nil {
+				return err
+			}
+			if err := syncNodeGroupFamily(tx, nodeGroup); err != nil {
+				return err
+			}
+		}
+
+		// 3. Sync node_group_sub_ips if provided
 		if req.SubIPIDs != nil {
 			// Get existing sub IP IDs
 			var existingSubIPs []models.NodeGroupSubIP
@@ -251,7 +362,7 @@ func (s *NodeGroupService) UpdateNodeGroup(id int, req UpdateNodeGroupRequest) (
 
 			relativeName := utils.CalculateRelativeName(nodeGroup.CNAME, domain.Domain)
 
-			// 3. Add new sub IPs
+			// 4. Add new sub IPs
 			if len(toAdd) > 0 {
 				// Insert node_group_sub_ips
 				for _, subIPID := range toAdd {
@@ -271,24 +382,17 @@ func (s *NodeGroupService) UpdateNodeGroup(id int, req UpdateNodeGroupRequest) (
 				}
 
 				for _, subIP := range newSubIPs {
-					dnsRecord := models.DomainDNSRecord{
-						DomainID:  nodeGroup.DomainID,
-						Type:      "A",
-						Name:      relativeName,
-						Value:     subIP.IP,
-						TTL:       120,
-						Proxied:   false,
-						Status:    "pending",
-						OwnerType: "node_group",
-						OwnerID:   id,
+					dnsRecord, ok := nodeGroupAddressRecord(nodeGroup, relativeName, subIP.IP)
+					if !ok {
+						continue
 					}
-					if err := tx.Create(&dnsRecord).Error; err != nil {
+					if err := createOrReviveRecord(tx, dnsRecord); err != nil {
 						return fmt.Errorf("failed to create DNS record: %w", err)
 					}
 				}
 			}
 
-			// 4. Remove old sub IPs
+			// 5. Remove old sub IPs
 			if len(toRemove) > 0 {
 				// Delete node_group_sub_ips
 				if err := tx.Where("node_group_id = ? AND sub_ip_id IN ?", id, toRemove).Delete(&models.NodeGroupSubIP{}).Error; err != nil {
@@ -302,15 +406,14 @@ func (s *NodeGroupService) UpdateNodeGroup(id int, req UpdateNodeGroupRequest) (
 				}
 
 				for _, subIP := range removedSubIPs {
-					if err := tx.Where("owner_type = ? AND owner_id = ? AND value = ?", "node_group", id, subIP.IP).
-						Delete(&models.DomainDNSRecord{}).Error; err != nil {
-						return fmt.Errorf("failed to delete DNS record: %w", err)
+					if err := queueMemberRecordDeletion(tx, id, subIP.IP); err != nil {
+						return err
 					}
 				}
 			}
 		}
 
-		// 5. Bump config_versions
+		// 6. Bump config_versions
 		if err := s.configVersionService.BumpVersion(tx, "node_group:update"); err != nil {
 			return fmt.Errorf("failed to bump config version: %w", err)
 		}
@@ -323,9 +426,122 @@ func (s *NodeGroupService) UpdateNodeGroup(id int, req UpdateNodeGroupRequest) (
 	}
 
 	// Reload node group with relations
-	if err := database.DB.Preload("Domain").First(nodeGroup, id).Error; err != nil {
+	if err := db.Preload("Domain").First(nodeGroup, id).Error; err != nil {
 		return nil, fmt.Errorf("failed to reload node group: %w", err)
 	}
 
 	return nodeGroup, nil
 }
+
+// validateAddressFamily checks an address-family policy value
+func validateAddressFamily(family string) error {
+	switch family {
+	case AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyDual:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidAddressFamily, family)
+}
+
+// familyAllows reports whether a policy publishes records of the given type
+func familyAllows(family, recordType string) bool {
+	switch family {
+	case AddressFamilyIPv4:
+		return recordType == "A"
+	case AddressFamilyIPv6:
+		return recordType == "AAAA"
+	}
+	return recordType == "A" || recordType == "AAAA"
+}
+
+// checkLineFamily checks that a line group only resolves to families it
+// allows: a CNAME exposes every family the node group publishes
+func checkLineFamily(lineFamily, nodeGroupFamily string) error {
+	if lineFamily == AddressFamilyDual || lineFamily == nodeGroupFamily {
+		return nil
+	}
+	return fmt.Errorf("%w: line group is %s, node group is %s", ErrAddressFamilyMismatch, lineFamily, nodeGroupFamily)
+}
+
+// checkNodeGroupLineFamilies checks the line groups pointing at a node group,
+// by default, through a route or as a member, against its (new) address-family policy
+func checkNodeGroupLineFamilies(tx *gorm.DB, nodeGroup *models.NodeGroup) error {
+	var lineGroups []models.LineGroup
+	routed := tx.Model(&models.LineGroupRoute{}).Select("line_group_id").Where("node_group_id = ?", nodeGroup.ID)
+	member := tx.Model(&models.LineGroupMember{}).Select("line_group_id").Where("node_group_id = ?", nodeGroup.ID)
+	if err := tx.Where("node_group_id = ? OR id IN (?) OR id IN (?)", nodeGroup.ID, routed, member).Find(&lineGroups).Error; err != nil {
+		return fmt.Errorf("failed to get line groups: %w", err)
+	}
+	for _, lineGroup := range lineGroups {
+		if err := checkLineFamily(lineGroup.AddressFamily, nodeGroup.AddressFamily); err != nil {
+			return fmt.Errorf("line group %s: %w", lineGroup.Name, err)
+		}
+	}
+	return nil
+}
+
+// nodeGroupAddressRecord builds the A or AAAA record of a member sub IP.
+// It returns false for invalid IPs and for families the group's policy excludes.
+func nodeGroupAddressRecord(nodeGroup *models.NodeGroup, relativeName, ip string) (*models.DomainDNSRecord, bool) {
+	recordType, value, ok := utils.AddressRecordType(ip)
+	if !ok || !familyAllows(nodeGroup.AddressFamily, recordType) {
+		return nil, false
+	}
+	return &models.DomainDNSRecord{
+		DomainID:  nodeGroup.DomainID,
+		Type:      recordType,
+		Name:      relativeName,
+		Value:     value,
+		TTL:       120,
+		Proxied:   false, // R5: Proxied default 0
+		Status:    "pending",
+		OwnerType: "node_group",
+		OwnerID:   nodeGroup.ID,
+	}, true
+}
+
+// queueMemberRecordDeletion queues the record of a member sub IP for deletion,
+// matching both the stored and the canonical form of the IP
+func queueMemberRecordDeletion(tx *gorm.DB, nodeGroupID int, ip string) error {
+	values := []string{ip}
+	if _, canonical, ok := utils.AddressRecordType(ip); ok && canonical != ip {
+		values = append(values, canonical)
+	}
+	if err := QueueRecordDeletion(tx, "owner_type = ? AND owner_id = ? AND value IN ?", "node_group", nodeGroupID, values); err != nil {
+		return fmt.Errorf("failed to delete DNS record: %w", err)
+	}
+	return nil
+}
+
+// syncNodeGroupFamily creates or deletes member records after the
+// address-family policy of a group changed. Withdrawn members stay withdrawn
+// and are published under the new policy when they recover.
+func syncNodeGroupFamily(tx *gorm.DB, nodeGroup *models.NodeGroup) error {
+	var domain models.Domain
+	if err := tx.First(&domain, nodeGroup.DomainID).Error; err != nil {
+		return fmt.Errorf("domain not found: %w", err)
+	}
+	relativeName := utils.CalculateRelativeName(nodeGroup.CNAME, domain.Domain)
+
+	var members []models.NodeGroupSubIP
+	if err := tx.Preload("SubIP").Where("node_group_id = ? AND withdrawn = ?", nodeGroup.ID, false).Find(&members).Error; err != nil {
+		return fmt.Errorf("failed to get node group members: %w", err)
+	}
+
+	for _, m := range members {
+		if m.SubIP == nil || !m.SubIP.Enabled {
+			continue
+		}
+		dnsRecord, ok := nodeGroupAddressRecord(nodeGroup, relativeName, m.SubIP.IP)
+		if !ok {
+			if err := queueMemberRecordDeletion(tx, nodeGroup.ID, m.SubIP.IP); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ensureRecord(tx, dnsRecord); err != nil {
+			return fmt.Errorf("failed to create DNS record: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidHealthCheck = errors.New("invalid health check configuration")
+)
+
+// Health check types of node groups
+const (
+	HealthCheckNone  = "none"
+	HealthCheckTCP   = "tcp"
+	HealthCheckHTTP  = "http"
+	HealthCheckHTTPS = "https"
+)
+
+// Health states of node group members
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthCheckConfig is the health check part of node group create/update requests
+type HealthCheckConfig struct {
+	Type              string `json:"type" binding:"required"` // none, tcp, http, https
+	Port              int    `json:"port"`                    // 0 = node agent port (443 for https)
+	Path              string `json:"path"`                    // http/https only, default "/"
+	FailureThreshold  int    `json:"failure_threshold"`       // default 3
+	RecoveryThreshold int    `json:"recovery_threshold"`      // default 2
+	MinHealthy        int    `json:"min_healthy"`             // default 1
+}
+
+// columns validates the config and returns the node_groups columns to write
+func (c *HealthCheckConfig) columns() (map[string]interface{}, error) {
+	switch c.Type {
+	case HealthCheckNone, HealthCheckTCP, HealthCheckHTTP, HealthCheckHTTPS:
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidHealthCheck, c.Type)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return nil, fmt.Errorf("%w: port out of range", ErrInvalidHealthCheck)
+	}
+	if c.FailureThreshold < 0 || c.RecoveryThreshold < 0 || c.MinHealthy < 0 {
+		return nil, fmt.Errorf("%w: thresholds must not be negative", ErrInvalidHealthCheck)
+	}
+
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%w: path must start with /", ErrInvalidHealthCheck)
+	}
+
+	return map[string]interface{}{
+		"health_check_type":  c.Type,
+		"health_check_port":  c.Port,
+		"health_check_path":  path,
+		"failure_threshold":  defaultInt(c.FailureThreshold, 3),
+		"recovery_threshold": defaultInt(c.RecoveryThreshold, 2),
+		"min_healthy":        defaultInt(c.MinHealthy, 1),
+	}, nil
+}
+
+func defaultInt(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// ProbeResult is the outcome of one health probe of a node group member
+type ProbeResult struct {
+	SubIPID int
+	Healthy bool
+	Error   string
+}
+
+// NodeGroupMemberHealth is the health view of one node group member
+type NodeGroupMemberHealth struct {
+	SubIPID              int        `json:"sub_ip_id"`
+	IP                   string     `json:"ip"`
+	NodeID               int        `json:"node_id"`
+	Enabled              bool       `json:"enabled"`
+	HealthStatus         string     `json:"health_status"`
+	ConsecutiveFailures  int        `json:"consecutive_failures"`
+	ConsecutiveSuccesses int        `json:"consecutive_successes"`
+	LastCheckedAt        *time.Time `json:"last_checked_at"`
+	LastHealthError      *string    `json:"last_health_error"`
+	Withdrawn            bool       `json:"withdrawn"`
+}
+
+// NodeGroupHealth is the health view of a node group
+type NodeGroupHealth struct {
+	NodeGroupID     int                     `json:"node_group_id"`
+	HealthCheckType string                  `json:"health_check_type"`
+	MinHealthy      int                     `json:"min_healthy"`
+	Members         []NodeGroupMemberHealth `json:"members"`
+}
+
+// NodeHealthService turns health probe results into DNS changes: the A/AAAA
+// records of unhealthy node group members are withdrawn and restored once
+// the member recovers
+type NodeHealthService struct {
+	dnsRecordService *DNSRecordService
+}
+
+func NewNodeHealthService(dnsRecordService *DNSRecordService) *NodeHealthService {
+	return &NodeHealthService{
+		dnsRecordService: dnsRecordService,
+	}
+}
+
+// ListCheckedGroups returns the active node groups with health checks enabled
+func (s *NodeHealthService) ListCheckedGroups() ([]models.NodeGroup, error) {
+	var groups []models.NodeGroup
+	if err := database.DB.Where("status = ? AND health_check_type <> ?", "active", HealthCheckNone).
+		Find(&groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to get node groups: %w", err)
+	}
+	return groups, nil
+}
+
+// ListMembers returns the members of a node group with their sub IP and node
+func (s *NodeHealthService) ListMembers(groupID int) ([]models.NodeGroupSubIP, error) {
+	var members []models.NodeGroupSubIP
+	if err := database.DB.Preload("SubIP.Node").Where("node_group_id = ?", groupID).
+		Order("id").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to get node group members: %w", err)
+	}
+	return members, nil
+}
+
+// GetNodeGroupHealth returns the health state of all members of a node group
+func (s *NodeHealthService) GetNodeGroupHealth(groupID int) (*NodeGroupHealth, error) {
+	var group models.NodeGroup
+	if err := database.DB.First(&group, groupID).Error; err != nil {
+		return nil, fmt.Errorf("node group not found: %w", err)
+	}
+
+	members, err := s.ListMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &NodeGroupHealth{
+		NodeGroupID:     group.ID,
+		HealthCheckType: group.HealthCheckType,
+		MinHealthy:      group.MinHealthy,
+		Members:         make([]NodeGroupMemberHealth, 0, len(members)),
+	}
+	for _, m := range members {
+		item := NodeGroupMemberHealth{
+			SubIPID:              m.SubIPID,
+			HealthStatus:         m.HealthStatus,
+			ConsecutiveFailures:  m.ConsecutiveFailures,
+			ConsecutiveSuccesses: m.ConsecutiveSuccesses,
+			LastCheckedAt:        m.LastCheckedAt,
+			LastHealthError:      m.LastHealthError,
+			Withdrawn:            m.Withdrawn,
+		}
+		if m.SubIP != nil {
+			item.IP = m.SubIP.IP
+			item.NodeID = m.SubIP.NodeID
+			item.Enabled = m.SubIP.Enabled
+		}
+		health.Members = append(health.Members, item)
+	}
+
+	return health, nil
+}
+
+// ApplyProbeResults records one round of probe results for a node group and
+// withdraws/restores A/AAAA records accordingly (transaction):
+// 1. update member counters (unhealthy after failure_threshold failures, healthy after recovery_threshold successes)
+// 2. restore withdrawn members that are healthy again
+// 3. withdraw unhealthy members, most failures first, keeping at least min_healthy records in DNS
+// The DNS sync worker is woken up to push the record changes.
+func (s *NodeHealthService) ApplyProbeResults(groupID int, results []ProbeResult) error {
+	changed := false
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var group models.NodeGroup
+		if err := tx.Preload("Domain").First(&group, groupID).Error; err != nil {
+			return fmt.Errorf("node group not found: %w", err)
+		}
+
+		var members []models.NodeGroupSubIP
+		if err := tx.Preload("SubIP").Where("node_group_id = ?", groupID).Find(&members).Error; err != nil {
+			return fmt.Errorf("failed to get node group members: %w", err)
+		}
+
+		byID := make(map[int]*models.NodeGroupSubIP, len(members))
+		for i := range members {
+			byID[members[i].SubIPID] = &members[i]
+		}
+
+		// 1. Update counters and health status
+		now := time.Now()
+		for _, r := range results {
+			m, ok := byID[r.SubIPID]
+			if !ok {
+				continue // Removed from the group while probing
+			}
+
+			m.LastCheckedAt = &now
+			if r.Healthy {
+				m.ConsecutiveSuccesses++
+				m.ConsecutiveFailures = 0
+				m.LastHealthError = nil
+				if m.HealthStatus == HealthUnknown || m.ConsecutiveSuccesses >= group.RecoveryThreshold {
+					m.HealthStatus = HealthHealthy
+				}
+			} else {
+				m.ConsecutiveFailures++
+				m.ConsecutiveSuccesses = 0
+				errMsg := r.Error
+				m.LastHealthError = &errMsg
+				if m.ConsecutiveFailures >= group.FailureThreshold {
+					m.HealthStatus = HealthUnhealthy
+				}
+			}
+		}
+
+		relativeName := utils.CalculateRelativeName(group.CNAME, group.Domain.Domain)
+
+		// Records currently published for the group
+		published := func(m *models.NodeGroupSubIP) bool {
+			if m.SubIP == nil || !m.SubIP.Enabled {
+				return false
+			}
+			_, ok := nodeGroupAddressRecord(&group, relativeName, m.SubIP.IP)
+			return ok
+		}
+		inDNS := 0
+		for i := range members {
+			if !members[i].Withdrawn && published(&members[i]) {
+				inDNS++
+			}
+		}
+
+		// 2. Restore recovered members
+		for i := range members {
+			m := &members[i]
+			if !m.Withdrawn || m.HealthStatus != HealthHealthy {
+				continue
+			}
+			if published(m) {
+				if err := restoreMemberRecord(tx, &group, relativeName, m.SubIP.IP); err != nil {
+					return err
+				}
+				inDNS++
+				log.Printf("[NodeHealth] Restored %s in node group %d\n", m.SubIP.IP, group.ID)
+			}
+			m.Withdrawn = false
+			changed = true
+		}
+
+		// 3. Withdraw unhealthy members, keeping the min_healthy floor
+		var unhealthy []*models.NodeGroupSubIP
+		for i := range members {
+			m := &members[i]
+			if m.HealthStatus == HealthUnhealthy && !m.Withdrawn && published(m) {
+				unhealthy = append(unhealthy, m)
+			}
+		}
+		sort.SliceStable(unhealthy, func(i, j int) bool {
+			return unhealthy[i].ConsecutiveFailures > unhealthy[j].ConsecutiveFailures
+		})
+
+		for _, m := range unhealthy {
+			if inDNS-1 < group.MinHealthy {
+				log.Printf("[NodeHealth] Keeping unhealthy %s in node group %d: min_healthy=%d reached\n",
+					m.SubIP.IP, group.ID, group.MinHealthy)
+				continue
+			}
+			if err := queueMemberRecordDeletion(tx, group.ID, m.SubIP.IP); err != nil {
+				return err
+			}
+			m.Withdrawn = true
+			inDNS--
+			changed = true
+			log.Printf("[NodeHealth] Withdrew %s from node group %d after %d failures\n",
+				m.SubIP.IP, group.ID, m.ConsecutiveFailures)
+		}
+
+		for _, m := range members {
+			if err := tx.Model(&models.NodeGroupSubIP{}).Where("id = ?", m.ID).Updates(map[string]interface{}{
+				"health_status":         m.HealthStatus,
+				"consecutive_failures":  m.ConsecutiveFailures,
+				"consecutive_successes": m.ConsecutiveSuccesses,
+				"last_checked_at":       m.LastCheckedAt,
+				"last_health_error":     m.LastHealthError,
+				"withdrawn":             m.Withdrawn,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update member health: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		s.dnsRecordService.wakeSyncWorker()
+	}
+
+	return nil
+}
+
+// restoreWithdrawnMembers puts the records of all withdrawn members of a
+// group back, e.g. when its health check is turned off
+func restoreWithdrawnMembers(tx *gorm.DB, group *models.NodeGroup) error {
+	var members []models.NodeGroupSubIP
+	if err := tx.Preload("SubIP").Where("node_group_id = ? AND withdrawn = ?", group.ID, true).Find(&members).Error; err != nil {
+		return fmt.Errorf("failed to get withdrawn members: %w", err)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	var domain models.Domain
+	if err := tx.First(&domain, group.DomainID).Error; err != nil {
+		return fmt.Errorf("domain not found: %w", err)
+	}
+	relativeName := utils.CalculateRelativeName(group.CNAME, domain.Domain)
+
+	for _, m := range members {
+		if m.SubIP != nil && m.SubIP.Enabled {
+			if err := restoreMemberRecord(tx, group, relativeName, m.SubIP.IP); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Model(&models.NodeGroupSubIP{}).Where("node_group_id = ?", group.ID).Updates(map[string]interface{}{
+		"withdrawn":             false,
+		"health_status":         HealthUnknown,
+		"consecutive_failures":  0,
+		"consecutive_successes": 0,
+	}).Error
+}
+
+// restoreMemberRecord recreates the A/AAAA record of a node group member
+// (nothing for families the group's policy excludes)
+func restoreMemberRecord(tx *gorm.DB, group *models.NodeGroup, relativeName, ip string) error {
+	dnsRecord, ok := nodeGroupAddressRecord(group, relativeName, ip)
+	if !ok {
+		return nil
+	}
+	if err := ensureRecord(tx, dnsRecord); err != nil {
+		return fmt.Errorf("failed to restore DNS record: %w", err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/cdn-control-panel/backend/internal/database"
 	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/utils"
 	"gorm.io/gorm"
 )
 
@@ -12,6 +13,7 @@ var (
 	ErrNodeNotFound      = errors.New("node not found")
 	ErrNodeAlreadyExists = errors.New("node already exists")
 	ErrNodeInUse         = errors.New("node is in use")
+	ErrInvalidSubIP      = errors.New("sub IP must be an IPv4 or IPv6 address")
 )
 
 type NodeService struct {
@@ -233,15 +235,22 @@ func (s *NodeService) AddSubIP(req AddSubIPRequest) (*models.NodeSubIP, error) {
 		return nil, err
 	}
 
+	// IPv4 sub IPs are published as A records, IPv6 ones as AAAA records;
+	// store the canonical form so records and lookups match
+	_, ip, ok := utils.AddressRecordType(req.IP)
+	if !ok {
+		return nil, ErrInvalidSubIP
+	}
+
 	// Check if sub IP already exists
 	var existing models.NodeSubIP
-	if err := db.Where("node_id = ? AND ip = ?", req.NodeID, req.IP).First(&existing).Error; err == nil {
+	if err := db.Where("node_id = ? AND ip = ?", req.NodeID, ip).First(&existing).Error; err == nil {
 		return nil, errors.New("sub IP already exists")
 	}
 
 	subIP := &models.NodeSubIP{
 		NodeID:  req.NodeID,
-		IP:      req.IP,
+		IP:      ip,
 		Enabled: req.Enabled,
 	}
 
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/pkg/certchain"
+	"github.com/cdn-control-panel/backend/pkg/ocspstaple"
+	"gorm.io/gorm"
+)
+
+var ErrOCSPResponseNotFound = errors.New("no current OCSP response for this certificate")
+
+// OCSPStatusNone marks a certificate without a fetched response (no
+// responder, or every fetch failed so far)
+const OCSPStatusNone = "none"
+
+const (
+	ocspFetchTimeout = 15 * time.Second
+
+	// Certificates without an OCSP responder are checked again daily
+	ocspNoResponderInterval = 24 * time.Hour
+
+	// Failed fetches are retried with a backoff from ocspRetryMin to ocspRetryMax;
+	// responses are refreshed halfway through their validity so a cached
+	// response outlives many retries
+	ocspRetryMin = 5 * time.Minute
+	ocspRetryMax = time.Hour
+)
+
+// OCSPService fetches OCSP responses for the certificates served by the
+// edges, so the edges staple them without contacting the CAs themselves
+type OCSPService struct {
+	client *http.Client
+}
+
+func NewOCSPService() *OCSPService {
+	return &OCSPService{
+		client: &http.Client{Timeout: ocspFetchTimeout},
+	}
+}
+
+// RefreshDue fetches responses for certificates in use that have none yet or
+// whose refresh time has come, and drops responses of certificates no
+// longer in use
+func (s *OCSPService) RefreshDue(ctx context.Context) error {
+	now := time.Now()
+
+	ids, err := s.certificatesInUse()
+	if err != nil {
+		return fmt.Errorf("failed to list certificates in use: %w", err)
+	}
+
+	prune := database.DB.Where("1 = 1")
+	if len(ids) > 0 {
+		prune = database.DB.Where("certificate_id NOT IN ?", ids)
+	}
+	if err := prune.Delete(&models.CertificateOCSPResponse{}).Error; err != nil {
+		return fmt.Errorf("failed to remove unused OCSP responses: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []models.CertificateOCSPResponse
+	if err := database.DB.Where("certificate_id IN ?", ids).Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to list OCSP responses: %w", err)
+	}
+	cached := make(map[int]*models.CertificateOCSPResponse, len(rows))
+	for i := range rows {
+		cached[rows[i].CertificateID] = &rows[i]
+	}
+
+	var errs []error
+	for _, id := range ids {
+		row := cached[id]
+		if row != nil && row.RefreshAt.After(now) {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err := s.refresh(ctx, id, row, now); err != nil {
+			errs = append(errs, fmt.Errorf("certificate %d: %w", id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// certificatesInUse returns the IDs of certificates bound to websites,
+// including the RSA certificate of dual certificate websites
+func (s *OCSPService) certificatesInUse() ([]int, error) {
+	var bound []int
+	if err := database.DB.Model(&models.CertificateBinding{}).
+		Where("is_active = ?", true).
+		Distinct().
+		Pluck("certificate_id", &bound).Error; err != nil {
+		return nil, err
+	}
+
+	var https []models.WebsiteHTTPS
+	if err := database.DB.Select("certificate_id", "rsa_certificate_id").
+		Where("certificate_id IS NOT NULL OR rsa_certificate_id IS NOT NULL").
+		Find(&https).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool, len(bound)+len(https))
+	ids := make([]int, 0, len(bound)+len(https))
+	add := func(id int) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range bound {
+		add(id)
+	}
+	for _, h := range https {
+		if h.CertificateID != nil {
+			add(*h.CertificateID)
+		}
+		if h.RSACertificateID != nil {
+			add(*h.RSACertificateID)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// refresh fetches the response of one certificate into row (created when
+// nil). On failure the previous response is kept, it is stapled until its
+// next update
+func (s *OCSPService) refresh(ctx context.Context, certificateID int, row *models.CertificateOCSPResponse, now time.Time) error {
+	var cert models.Certificate
+	if err := database.DB.Select("id", "status", "expire_at", "certificate_pem").First(&cert, certificateID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	// Responders stop answering for expired certificates
+	if cert.Status == "expired" || (cert.ExpireAt != nil && cert.ExpireAt.Before(now)) {
+		return nil
+	}
+
+	if row == nil {
+		row = &models.CertificateOCSPResponse{CertificateID: certificateID, Status: OCSPStatusNone}
+	}
+
+	resp, err := s.fetch(ctx, cert.CertificatePEM, now)
+	switch {
+	case errors.Is(err, ocspstaple.ErrNoResponder):
+		row.ResponderURL = ""
+		row.Status = OCSPStatusNone
+		row.Response = nil
+		row.ProducedAt, row.ThisUpdate, row.NextUpdate, row.RevokedAt = nil, nil, nil, nil
+		row.Attempts = 0
+		row.LastError = nil
+		row.RefreshAt = now.Add(ocspNoResponderInterval)
+		err = nil
+	case err != nil:
+		row.Attempts++
+		msg := truncateError(err.Error())
+		row.LastError = &msg
+		row.RefreshAt = now.Add(ocspRetryDelay(row.Attempts))
+	default:
+		row.ResponderURL = resp.ResponderURL
+		row.Status = resp.Status
+		row.Response = resp.Raw
+		row.ProducedAt = timePtr(resp.ProducedAt)
+		row.ThisUpdate = timePtr(resp.ThisUpdate)
+		row.NextUpdate = timePtr(resp.NextUpdate)
+		row.RevokedAt = timePtr(resp.RevokedAt)
+		row.Attempts = 0
+		row.LastError = nil
+		row.RefreshAt = resp.RefreshAt(now)
+		if resp.Status == ocspstaple.StatusRevoked {
+			log.Printf("[OCSP] certificate %d is revoked according to %s", certificateID, resp.ResponderURL)
+		}
+	}
+
+	if saveErr := database.DB.Save(row).Error; saveErr != nil {
+		return fmt.Errorf("failed to save OCSP response: %w", saveErr)
+	}
+	return err
+}
+
+// fetch queries the responder of the leaf of a stored chain; chains are
+// stored leaf first in issuing order, so the issuer is the second certificate
+func (s *OCSPService) fetch(ctx context.Context, chainPEM string, now time.Time) (*ocspstaple.Response, error) {
+	certs, err := certchain.ParseCertificates(chainPEM)
+	if err != nil {
+		return nil, err
+	}
+	var issuer *x509.Certificate
+	if len(certs) > 1 {
+		issuer = certs[1]
+	}
+	return ocspstaple.Fetch(ctx, s.client, certs[0], issuer, now)
+}
+
+// ocspRetryDelay doubles from ocspRetryMin up to ocspRetryMax
+func ocspRetryDelay(attempts int) time.Duration {
+	delay := ocspRetryMin
+	for i := 1; i < attempts && delay < ocspRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > ocspRetryMax {
+		delay = ocspRetryMax
+	}
+	return delay
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
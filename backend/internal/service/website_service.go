@@ -3,7 +3,6 @@ package service
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 "github.com/labubu-daydayone/go_cmdb_web/backend/internal/database"
 "github.com/labubu-daydayone/go_cmdb_web/backend/internal/models"
@@ -18,6 +17,8 @@ ErrInvalidOriginMode      = errors.New("invalid origin mode")
 ErrOriginGroupRequired    = errors.New("origin_group_id required when mode=group")
 ErrOriginAddressesRequired = errors.New("origin_addresses required when mode=manual")
 ErrNoPrimaryDomain        = errors.New("at least one primary domain required")
+ErrACMEAccountRequired    = errors.New("acme_account_id or acme_provider_id required when cert_mode=acme")
+ErrNotACMEMode            = errors.New("website https is not in cert_mode=acme")
 )
 
 type WebsiteService struct {
@@ -28,14 +29,17 @@ lineGroupService     *LineGroupService
 originService        *OriginService
 }
 
-func NewWebsiteService() *WebsiteService {
+// NewWebsiteService creates a website service. syncTrigger is woken when
+// website changes queue DNS records; nil outside serve.
+func NewWebsiteService(syncTrigger SyncTrigger) *WebsiteService {
 	configVersionService := NewConfigVersionService()
 	domainService := NewDomainService()
+	dnsRecordService := NewDNSRecordService(domainService, syncTrigger)
 	return &WebsiteService{
 		domainService:        domainService,
 		configVersionService: configVersionService,
-dnsRecordService:     NewDNSRecordService(NewDomainService()),
-lineGroupService:     NewLineGroupService(NewConfigVersionService()),
+dnsRecordService:     dnsRecordService,
+lineGroupService:     NewLineGroupService(NewConfigVersionService(), dnsRecordService),
 originService:        NewOriginService(NewConfigVersionService()),
 }
 }
@@ -74,6 +78,9 @@ ForceRedirect bool   `json:"force_redirect"`
 HSTS          bool   `json:"hsts"`
 CertMode      string `json:"cert_mode" binding:"oneof=select acme"`
 CertificateID *int   `json:"certificate_id"`
+ACMEProviderID *int  `json:"acme_provider_id"`
+ACMEAccountID  *int  `json:"acme_account_id"`
+DualCert       bool  `json:"dual_cert"`
 }
 
 // CreateWebsiteResponse represents response after creating a website
@@ -86,8 +93,16 @@ FailedDomains  []string `json:"failed_domains"`
 
 // CreateWebsite creates a new website (WF-03 workflow)
 func (s *WebsiteService) CreateWebsite(req CreateWebsiteRequest) (*CreateWebsiteResponse, error) {
-db := database.DB
+resp, err := s.createWebsite(database.DB, req)
+if err != nil {
+return nil, err
+}
+s.dnsRecordService.wakeSyncWorker()
+return resp, nil
+}
 
+// createWebsite runs CreateWebsite on db, which may be a plan transaction
+func (s *WebsiteService) createWebsite(db *gorm.DB, req CreateWebsiteRequest) (*CreateWebsiteResponse, error) {
 // Validate origin mode
 if req.OriginMode == "group" && req.OriginGroupID == nil {
 return nil, ErrOriginGroupRequired
@@ -108,6 +123,21 @@ if !hasPrimary {
 return nil, ErrNoPrimaryDomain
 }
 
+// ACME mode needs an account to issue with (or a provider to pick one from)
+if req.HTTPSConfig != nil && req.HTTPSConfig.CertMode == "acme" &&
+req.HTTPSConfig.ACMEAccountID == nil && req.HTTPSConfig.ACMEProviderID == nil {
+return nil, ErrACMEAccountRequired
+}
+
+// Store IDN domains in punycode, the form used for DNS records, certificates and agents
+for i := range req.Domains {
+name, err := utils.NormalizeDomain(req.Domains[i].Domain)
+if err != nil {
+return nil, err
+}
+req.Domains[i].Domain = name
+}
+
 // Get line group to get CNAME
 lineGroup, err := s.lineGroupService.GetLineGroup(*&req.LineGroupID)
 if err != nil {
@@ -204,6 +234,7 @@ Enabled:       false,
 ForceRedirect: false,
 HSTS:          false,
 CertMode:      "select",
+ProvisionStatus: "none",
 }
 
 if req.HTTPSConfig != nil {
@@ -214,6 +245,13 @@ if req.HTTPSConfig.CertMode != "" {
 httpsConfig.CertMode = req.HTTPSConfig.CertMode
 }
 httpsConfig.CertificateID = req.HTTPSConfig.CertificateID
+httpsConfig.ACMEProviderID = req.HTTPSConfig.ACMEProviderID
+httpsConfig.ACMEAccountID = req.HTTPSConfig.ACMEAccountID
+httpsConfig.DualCert = req.HTTPSConfig.DualCert
+if httpsConfig.CertMode == "acme" {
+// Issued by ACMEWorker after commit, once the domains below exist
+httpsConfig.ProvisionStatus = "pending"
+}
 }
 
 if err := tx.Create(httpsConfig).Error; err != nil {
@@ -376,6 +414,70 @@ return nil, err
 return &https, nil
 }
 
+// HTTPSProvisioning is the certificate provisioning state of a website in
+// cert_mode=acme, with the certificate request being issued
+type HTTPSProvisioning struct {
+WebsiteID     int                        `json:"website_id"`
+CertMode      string                     `json:"cert_mode"`
+Status        string                     `json:"status"`
+Error         *string                    `json:"error"`
+CertificateID *int                       `json:"certificate_id"`
+Request       *models.CertificateRequest `json:"request,omitempty"`
+}
+
+// GetHTTPSProvisioning returns the certificate provisioning state of a website
+func (s *WebsiteService) GetHTTPSProvisioning(websiteID int) (*HTTPSProvisioning, error) {
+var https models.WebsiteHTTPS
+if err := database.DB.Where("website_id = ?", websiteID).First(&https).Error; err != nil {
+if errors.Is(err, gorm.ErrRecordNotFound) {
+return nil, ErrWebsiteNotFound
+}
+return nil, err
+}
+
+provisioning := &HTTPSProvisioning{
+WebsiteID:     websiteID,
+CertMode:      https.CertMode,
+Status:        https.ProvisionStatus,
+Error:         https.ProvisionError,
+CertificateID: https.CertificateID,
+}
+if https.ProvisionRequestID != nil {
+var request models.CertificateRequest
+if err := database.DB.First(&request, *https.ProvisionRequestID).Error; err == nil {
+provisioning.Request = &request
+}
+}
+return provisioning, nil
+}
+
+// RetryHTTPSProvisioning queues the certificate of a website in
+// cert_mode=acme again, e.g. after a failure was fixed
+func (s *WebsiteService) RetryHTTPSProvisioning(websiteID int) error {
+var https models.WebsiteHTTPS
+if err := database.DB.Where("website_id = ?", websiteID).First(&https).Error; err != nil {
+if errors.Is(err, gorm.ErrRecordNotFound) {
+return ErrWebsiteNotFound
+}
+return err
+}
+if https.CertMode != "acme" {
+return ErrNotACMEMode
+}
+return requestHTTPSProvisioning(database.DB, websiteID)
+}
+
+// requestHTTPSProvisioning queues a certificate covering all domains of a
+// website in cert_mode=acme. ACMEWorker issues it once tx is committed.
+func requestHTTPSProvisioning(tx *gorm.DB, websiteID int) error {
+return tx.Model(&models.WebsiteHTTPS{}).
+Where("website_id = ? AND cert_mode = ?", websiteID, "acme").
+Updates(map[string]interface{}{
+"provision_status": "pending",
+"provision_error":  nil,
+}).Error
+}
+
 // UpdateWebsiteRequest represents request to update a website
 type UpdateWebsiteRequest struct {
 Name            *string                       `json:"name"`
@@ -396,12 +498,22 @@ ForceRedirect *bool   `json:"force_redirect"`
 HSTS          *bool   `json:"hsts"`
 CertMode      *string `json:"cert_mode"`
 CertificateID *int    `json:"certificate_id"`
+ACMEProviderID *int   `json:"acme_provider_id"`
+ACMEAccountID  *int   `json:"acme_account_id"`
+DualCert       *bool  `json:"dual_cert"`
 }
 
 // UpdateWebsite updates a website configuration
 func (s *WebsiteService) UpdateWebsite(id int, req UpdateWebsiteRequest) error {
-db := database.DB
+if err := s.updateWebsite(database.DB, id, req); err != nil {
+return err
+}
+s.dnsRecordService.wakeSyncWorker()
+return nil
+}
 
+// updateWebsite runs UpdateWebsite on db, which may be a plan transaction
+func (s *WebsiteService) updateWebsite(db *gorm.DB, id int, req UpdateWebsiteRequest) error {
 // Check if website exists
 var website models.Website
 if err := db.First(&website, id).Error; err != nil {
@@ -488,6 +600,35 @@ httpsUpdates["cert_mode"] = *req.HTTPSConfig.CertMode
 if req.HTTPSConfig.CertificateID != nil {
 httpsUpdates["certificate_id"] = *req.HTTPSConfig.CertificateID
 }
+if req.HTTPSConfig.ACMEProviderID != nil {
+httpsUpdates["acme_provider_id"] = *req.HTTPSConfig.ACMEProviderID
+}
+if req.HTTPSConfig.ACMEAccountID != nil {
+httpsUpdates["acme_account_id"] = *req.HTTPSConfig.ACMEAccountID
+}
+if req.HTTPSConfig.DualCert != nil {
+httpsUpdates["dual_cert"] = *req.HTTPSConfig.DualCert
+}
+
+// Switching to acme or changing its account or dual_cert (re)issues the certificate
+certMode := httpsConfig.CertMode
+if req.HTTPSConfig.CertMode != nil {
+certMode = *req.HTTPSConfig.CertMode
+}
+if certMode == "acme" {
+if httpsConfig.ACMEAccountID == nil && httpsConfig.ACMEProviderID == nil &&
+req.HTTPSConfig.ACMEAccountID == nil && req.HTTPSConfig.ACMEProviderID == nil {
+return ErrACMEAccountRequired
+}
+if httpsConfig.CertMode != "acme" || req.HTTPSConfig.ACMEAccountID != nil || req.HTTPSConfig.ACMEProviderID != nil ||
+(req.HTTPSConfig.DualCert != nil && *req.HTTPSConfig.DualCert != httpsConfig.DualCert) {
+httpsUpdates["provision_status"] = "pending"
+httpsUpdates["provision_error"] = nil
+}
+} else if httpsConfig.CertMode == "acme" {
+httpsUpdates["provision_status"] = "none"
+httpsUpdates["provision_error"] = nil
+}
 
 if len(httpsUpdates) > 0 {
 if err := tx.Model(&httpsConfig).Updates(httpsUpdates).Error; err != nil {
@@ -639,8 +780,15 @@ return nil
 
 // DeleteWebsite deletes a website
 func (s *WebsiteService) DeleteWebsite(id int) error {
-db := database.DB
+if err := s.deleteWebsite(database.DB, id); err != nil {
+return err
+}
+s.dnsRecordService.wakeSyncWorker()
+return nil
+}
 
+// deleteWebsite runs DeleteWebsite on db, which may be a plan transaction
+func (s *WebsiteService) deleteWebsite(db *gorm.DB, id int) error {
 // Check if website exists
 var website models.Website
 if err := db.First(&website, id).Error; err != nil {
@@ -663,9 +811,8 @@ return err
 }
 
 for _, domain := range domains {
-// Delete DNS records
-if err := tx.Where("owner_type = ? AND owner_id = ?", "website_domain", domain.ID).
-			Delete(&models.DomainDNSRecord{}).Error; err != nil {
+// Queue DNS records for provider-side deletion
+if err := QueueRecordDeletion(tx, "owner_type = ? AND owner_id = ?", "website_domain", domain.ID); err != nil {
 return err
 }
 }
@@ -704,7 +851,19 @@ return nil
 
 // AddDomain adds a new domain to an existing website
 func (s *WebsiteService) AddDomain(websiteID int, domain string, isPrimary bool) error {
-db := database.DB
+if err := s.addDomain(database.DB, websiteID, domain, isPrimary); err != nil {
+return err
+}
+s.dnsRecordService.wakeSyncWorker()
+return nil
+}
+
+// addDomain runs AddDomain on db, which may be a plan transaction
+func (s *WebsiteService) addDomain(db *gorm.DB, websiteID int, domain string, isPrimary bool) error {
+domain, err := utils.NormalizeDomain(domain)
+if err != nil {
+return err
+}
 
 // Check if website exists
 var website models.Website
@@ -769,6 +928,11 @@ if err := tx.Create(dnsRecord).Error; err != nil {
 return err
 }
 
+// The certificate must cover the new domain
+if err := requestHTTPSProvisioning(tx, websiteID); err != nil {
+return err
+}
+
 // Bump config version
 if err := s.configVersionService.BumpVersion(tx, fmt.Sprintf("website:add_domain:%d", websiteID)); err != nil {
 return err
@@ -780,8 +944,16 @@ return nil
 
 // RemoveDomain removes a domain from a website
 func (s *WebsiteService) RemoveDomain(websiteID int, domain string) error {
-db := database.DB
+if err := s.removeDomain(database.DB, websiteID, domain); err != nil {
+return err
+}
+s.dnsRecordService.wakeSyncWorker()
+return nil
+}
 
+// removeDomain runs RemoveDomain on db, which may be a plan transaction
+func (s *WebsiteService) removeDomain(db *gorm.DB, websiteID int, domain string) error {
+domain = utils.ToASCII(domain)
 return db.Transaction(func(tx *gorm.DB) error {
 // Find domain
 var websiteDomain models.WebsiteDomain
@@ -792,9 +964,8 @@ return errors.New("domain not found")
 return err
 }
 
-// Delete DNS records
-if err := tx.Where("owner_type = ? AND owner_id = ?", "website_domain", websiteDomain.ID).
-		Delete(&models.DomainDNSRecord{}).Error; err != nil {
+// Queue DNS records for provider-side deletion
+if err := QueueRecordDeletion(tx, "owner_type = ? AND owner_id = ?", "website_domain", websiteDomain.ID); err != nil {
 return err
 }
 
@@ -803,6 +974,11 @@ if err := tx.Delete(&websiteDomain).Error; err != nil {
 return err
 }
 
+// Re-check the certificate, usually the current one still covers the rest
+if err := requestHTTPSProvisioning(tx, websiteID); err != nil {
+return err
+}
+
 // Bump config version
 if err := s.configVersionService.BumpVersion(tx, fmt.Sprintf("website:remove_domain:%d", websiteID)); err != nil {
 return err
@@ -854,24 +1030,15 @@ return nil
 })
 }
 
-// findZoneForFQDN finds the zone (domain) that contains the given FQDN
+// findZoneForFQDN finds the most specific zone (domain) that contains the given FQDN;
+// when none is managed the error suggests the registrable domain to add
 func (s *WebsiteService) findZoneForFQDN(tx *gorm.DB, fqdn string) (string, error) {
-	fqdn = strings.TrimSuffix(fqdn, ".")
-	
-	// Try to find exact match first
-	var domain models.Domain
-	if err := tx.Where("domain = ?", fqdn).First(&domain).Error; err == nil {
-		return domain.Domain, nil
+	zone, err := findManagedZone(tx, fqdn)
+	if err != nil {
+		return "", err
 	}
-	
-	// Try to find parent zones
-	parts := strings.Split(fqdn, ".")
-	for i := 1; i < len(parts); i++ {
-		zone := strings.Join(parts[i:], ".")
-		if err := tx.Where("domain = ?", zone).First(&domain).Error; err == nil {
-			return domain.Domain, nil
-		}
+	if zone == nil {
+		return "", noZoneError(utils.ToASCII(fqdn))
 	}
-	
-	return "", errors.New("no zone found for FQDN: " + fqdn)
+	return zone.Domain, nil
 }
@@ -0,0 +1,498 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/utils"
+	"github.com/cdn-control-panel/backend/pkg/dnsprovider"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidZoneFile = errors.New("invalid zone file")
+)
+
+// ZoneFileOwnerType is the owner_type of records created by a zone file import
+const ZoneFileOwnerType = "manual"
+
+// txtChunkSize is the maximum length of a single TXT character-string (RFC 1035 3.3)
+const txtChunkSize = 255
+
+type ZoneFileService struct {
+	domainService    *DomainService
+	dnsRecordService *DNSRecordService
+}
+
+func NewZoneFileService(domainService *DomainService, dnsRecordService *DNSRecordService) *ZoneFileService {
+	return &ZoneFileService{
+		domainService:    domainService,
+		dnsRecordService: dnsRecordService,
+	}
+}
+
+// ZoneFileRecord is a single record as it appears in a zone file diff
+type ZoneFileRecord struct {
+	Type     string  `json:"type"`
+	Name     string  `json:"name"` // Relative name (@ for apex)
+	Value    string  `json:"value"`
+	TTL      int     `json:"ttl"`
+	Proxied  bool    `json:"proxied"`
+	Priority *int    `json:"priority,omitempty"`
+	Weight   *int    `json:"weight,omitempty"`
+	Port     *int    `json:"port,omitempty"`
+	CAAFlags *int    `json:"caa_flags,omitempty"`
+	CAATag   *string `json:"caa_tag,omitempty"`
+}
+
+// ZoneFileSkippedRecord is a zone file entry that cannot be imported
+type ZoneFileSkippedRecord struct {
+	Record string `json:"record"`
+	Reason string `json:"reason"`
+}
+
+// ZoneFileImportResult is the diff between a zone file and the current records.
+// Import only ever adds records: OnlyInDB is informational and never deleted.
+type ZoneFileImportResult struct {
+	DryRun    bool                    `json:"dry_run"`
+	ToCreate  []ZoneFileRecord        `json:"to_create"`
+	Unchanged []ZoneFileRecord        `json:"unchanged"`
+	OnlyInDB  []ZoneFileRecord        `json:"only_in_db"`
+	Skipped   []ZoneFileSkippedRecord `json:"skipped"`
+	Created   int                     `json:"created"`
+}
+
+// ExportZoneFile renders all records of a domain as an RFC 1035 zone file.
+// SOA and apex NS records are owned by the DNS provider and are not included.
+func (s *ZoneFileService) ExportZoneFile(domainID int) (string, error) {
+	db := database.GetDB()
+
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return "", err
+	}
+
+	// Zone files have no resolver views: export the default view
+	var records []models.DomainDNSRecord
+	if err := db.Where("domain_id = ? AND status <> ?", domainID, "deleting").
+		Where("line IN ?", []string{"", dnsprovider.ViewDefault}).
+		Order("name ASC, type ASC, id ASC").
+		Find(&records).Error; err != nil {
+		return "", err
+	}
+
+	origin := dns.Fqdn(strings.ToLower(domain.Domain))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "; Zone file for %s\n", origin)
+	fmt.Fprintf(&b, "; Exported at %s (%d records)\n", time.Now().UTC().Format(time.RFC3339), len(records))
+	fmt.Fprintf(&b, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(&b, "$TTL 120\n\n")
+
+	for _, record := range records {
+		rr, err := RecordToRR(record, domain.Domain)
+		if err != nil {
+			fmt.Fprintf(&b, "; skipped record %d: %v\n", record.ID, err)
+			continue
+		}
+
+		line := rr.String()
+		if record.Proxied {
+			line += " ; proxied"
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	return b.String(), nil
+}
+
+// ImportZoneFile parses a zone file and diffs it against the current records
+// of the domain. Unless dryRun is set, missing records are created with
+// status=pending and owner_type=manual so DNSSyncWorker pushes them to the
+// provider. Existing records are never modified or deleted.
+func (s *ZoneFileService) ImportZoneFile(domainID int, content string, dryRun bool) (*ZoneFileImportResult, error) {
+	db := database.GetDB()
+
+	domain, err := s.domainService.GetDomain(domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, skipped, err := parseZoneFile(domain, content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records below a managed subzone would never be served from this zone
+	kept := parsed[:0]
+	for _, record := range parsed {
+		fqdn := utils.CalculateFQDN(record.Name, domain.Domain)
+		if err := checkSubzone(db, domain, fqdn, record.Type); err != nil {
+			if !errors.Is(err, ErrNameInSubzone) {
+				return nil, err
+			}
+			skipped = append(skipped, ZoneFileSkippedRecord{
+				Record: fmt.Sprintf("%s %s %s", fqdn, record.Type, record.Value),
+				Reason: err.Error(),
+			})
+			continue
+		}
+		kept = append(kept, record)
+	}
+	parsed = kept
+
+	var existing []models.DomainDNSRecord
+	if err := db.Where("domain_id = ? AND status <> ?", domainID, "deleting").
+		Where("line IN ?", []string{"", dnsprovider.ViewDefault}).
+		Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	result := &ZoneFileImportResult{
+		DryRun:    dryRun,
+		ToCreate:  []ZoneFileRecord{},
+		Unchanged: []ZoneFileRecord{},
+		OnlyInDB:  []ZoneFileRecord{},
+		Skipped:   skipped,
+	}
+
+	existingKeys := make(map[string]bool, len(existing))
+	for _, record := range existing {
+		existingKeys[zoneFileRecordKey(zoneFileRecordFromModel(record))] = true
+	}
+
+	fileKeys := make(map[string]bool, len(parsed))
+	for _, record := range parsed {
+		key := zoneFileRecordKey(record)
+		if fileKeys[key] {
+			continue
+		}
+		fileKeys[key] = true
+
+		if existingKeys[key] {
+			result.Unchanged = append(result.Unchanged, record)
+		} else {
+			result.ToCreate = append(result.ToCreate, record)
+		}
+	}
+
+	for _, record := range existing {
+		r := zoneFileRecordFromModel(record)
+		if !fileKeys[zoneFileRecordKey(r)] {
+			result.OnlyInDB = append(result.OnlyInDB, r)
+		}
+	}
+
+	if dryRun || len(result.ToCreate) == 0 {
+		return result, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, r := range result.ToCreate {
+			record := &models.DomainDNSRecord{
+				DomainID:  domainID,
+				Type:      r.Type,
+				Name:      r.Name,
+				Value:     r.Value,
+				TTL:       r.TTL,
+				Proxied:   r.Proxied,
+				Priority:  r.Priority,
+				Weight:    r.Weight,
+				Port:      r.Port,
+				CAAFlags:  r.CAAFlags,
+				CAATag:    r.CAATag,
+				Status:    "pending",
+				OwnerType: ZoneFileOwnerType,
+				OwnerID:   0,
+			}
+			if err := createOrReviveRecord(tx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Created = len(result.ToCreate)
+	s.dnsRecordService.wakeSyncWorker()
+	s.dnsRecordService.checkAfterBulk(DNSCheckSourceZoneFile, domainID)
+	return result, nil
+}
+
+// parseZoneFile parses zone file content relative to the domain origin.
+// Entries that cannot be represented as domain_dns_records are returned as skipped.
+func parseZoneFile(domain *models.Domain, content string) ([]ZoneFileRecord, []ZoneFileSkippedRecord, error) {
+	zone := strings.ToLower(strings.TrimSuffix(domain.Domain, "."))
+	origin := dns.Fqdn(zone)
+
+	records := []ZoneFileRecord{}
+	skipped := []ZoneFileSkippedRecord{}
+
+	zp := dns.NewZoneParser(strings.NewReader(content), origin, "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		record, reason := zoneFileRecordFromRR(rr, zone)
+		if reason == "" {
+			record.Proxied = isProxiedComment(zp.Comment())
+
+			req := CreateDNSRecordRequest{
+				Type:     record.Type,
+				Value:    record.Value,
+				Proxied:  record.Proxied,
+				Priority: record.Priority,
+				Weight:   record.Weight,
+				Port:     record.Port,
+				CAAFlags: record.CAAFlags,
+				CAATag:   record.CAATag,
+			}
+			if err := validateRecordRequest(domain, record.Name, &req); err != nil {
+				reason = err.Error()
+			}
+		}
+
+		if reason != "" {
+			skipped = append(skipped, ZoneFileSkippedRecord{
+				Record: rr.String(),
+				Reason: reason,
+			})
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	if err := zp.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidZoneFile, err)
+	}
+
+	return records, skipped, nil
+}
+
+// zoneFileRecordFromRR converts a parsed resource record. A non-empty reason
+// means the record is not supported and should be skipped.
+func zoneFileRecordFromRR(rr dns.RR, zone string) (ZoneFileRecord, string) {
+	hdr := rr.Header()
+	if hdr.Class != dns.ClassINET {
+		return ZoneFileRecord{}, "only class IN is supported"
+	}
+
+	fqdn := strings.ToLower(strings.TrimSuffix(hdr.Name, "."))
+	if !utils.ValidateFQDN(fqdn, zone) {
+		return ZoneFileRecord{}, "name is outside of the zone"
+	}
+
+	record := ZoneFileRecord{
+		Name: utils.CalculateRelativeName(fqdn, zone),
+		TTL:  int(hdr.Ttl),
+	}
+	if record.TTL == 0 {
+		record.TTL = 120
+	}
+
+	switch v := rr.(type) {
+	case *dns.A:
+		record.Type = "A"
+		record.Value = v.A.String()
+	case *dns.AAAA:
+		record.Type = "AAAA"
+		record.Value = v.AAAA.String()
+	case *dns.CNAME:
+		record.Type = "CNAME"
+		record.Value = normalizeZoneFileHost(v.Target)
+	case *dns.NS:
+		if record.Name == "@" {
+			return ZoneFileRecord{}, "apex NS records are managed by the provider"
+		}
+		record.Type = "NS"
+		record.Value = normalizeZoneFileHost(v.Ns)
+	case *dns.PTR:
+		record.Type = "PTR"
+		record.Value = normalizeZoneFileHost(v.Ptr)
+	case *dns.TXT:
+		record.Type = "TXT"
+		record.Value = strings.Join(v.Txt, "")
+	case *dns.MX:
+		priority := int(v.Preference)
+		record.Type = "MX"
+		record.Value = normalizeZoneFileHost(v.Mx)
+		record.Priority = &priority
+	case *dns.SRV:
+		priority, weight, port := int(v.Priority), int(v.Weight), int(v.Port)
+		record.Type = "SRV"
+		record.Value = normalizeZoneFileHost(v.Target)
+		if record.Value == "" {
+			record.Value = "."
+		}
+		record.Priority = &priority
+		record.Weight = &weight
+		record.Port = &port
+	case *dns.CAA:
+		flags := int(v.Flag)
+		tag := strings.ToLower(v.Tag)
+		record.Type = "CAA"
+		record.Value = v.Value
+		record.CAAFlags = &flags
+		record.CAATag = &tag
+	case *dns.SOA:
+		return ZoneFileRecord{}, "SOA records are managed by the provider"
+	default:
+		return ZoneFileRecord{}, fmt.Sprintf("record type %s is not supported", dns.TypeToString[hdr.Rrtype])
+	}
+
+	return record, ""
+}
+
+// zoneFileRecordFromModel converts a stored record for diffing
+func zoneFileRecordFromModel(record models.DomainDNSRecord) ZoneFileRecord {
+	r := ZoneFileRecord{
+		Type:     record.Type,
+		Name:     strings.ToLower(record.Name),
+		Value:    record.Value,
+		TTL:      record.TTL,
+		Proxied:  record.Proxied,
+		Priority: record.Priority,
+		Weight:   record.Weight,
+		Port:     record.Port,
+		CAAFlags: record.CAAFlags,
+		CAATag:   record.CAATag,
+	}
+
+	switch record.Type {
+	case "CNAME", "NS", "PTR", "MX":
+		r.Value = normalizeZoneFileHost(record.Value)
+	case "SRV":
+		if record.Value != "." {
+			r.Value = normalizeZoneFileHost(record.Value)
+		}
+	}
+
+	return r
+}
+
+// zoneFileRecordKey identifies a record for diffing. TTL and proxied are not
+// part of the key: a record that only differs in TTL is considered unchanged.
+func zoneFileRecordKey(r ZoneFileRecord) string {
+	optional := func(v *int) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+	tag := ""
+	if r.CAATag != nil {
+		tag = *r.CAATag
+	}
+
+	return strings.Join([]string{
+		r.Type, r.Name, r.Value,
+		optional(r.Priority), optional(r.Weight), optional(r.Port),
+		optional(r.CAAFlags), tag,
+	}, "|")
+}
+
+// RecordToRR converts a stored record into the resource record it is
+// expected to be served as. Used for zone file export and DNS verification.
+func RecordToRR(record models.DomainDNSRecord, zone string) (dns.RR, error) {
+	hdr := dns.RR_Header{
+		Name:  dns.Fqdn(strings.ToLower(utils.CalculateFQDN(record.Name, zone))),
+		Class: dns.ClassINET,
+		Ttl:   uint32(record.TTL),
+	}
+
+	switch record.Type {
+	case "A", "AAAA":
+		ip := net.ParseIP(record.Value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", record.Value)
+		}
+		if record.Type == "A" {
+			hdr.Rrtype = dns.TypeA
+			return &dns.A{Hdr: hdr, A: ip.To4()}, nil
+		}
+		hdr.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	case "CNAME":
+		hdr.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(record.Value)}, nil
+	case "NS":
+		hdr.Rrtype = dns.TypeNS
+		return &dns.NS{Hdr: hdr, Ns: dns.Fqdn(record.Value)}, nil
+	case "PTR":
+		hdr.Rrtype = dns.TypePTR
+		return &dns.PTR{Hdr: hdr, Ptr: dns.Fqdn(record.Value)}, nil
+	case "TXT":
+		hdr.Rrtype = dns.TypeTXT
+		return &dns.TXT{Hdr: hdr, Txt: splitTXTValue(record.Value)}, nil
+	case "MX":
+		hdr.Rrtype = dns.TypeMX
+		return &dns.MX{Hdr: hdr, Preference: uint16(intValue(record.Priority)), Mx: dns.Fqdn(record.Value)}, nil
+	case "SRV":
+		hdr.Rrtype = dns.TypeSRV
+		return &dns.SRV{
+			Hdr:      hdr,
+			Priority: uint16(intValue(record.Priority)),
+			Weight:   uint16(intValue(record.Weight)),
+			Port:     uint16(intValue(record.Port)),
+			Target:   dns.Fqdn(record.Value),
+		}, nil
+	case "CAA":
+		if record.CAATag == nil {
+			return nil, errors.New("CAA record without tag")
+		}
+		hdr.Rrtype = dns.TypeCAA
+		return &dns.CAA{Hdr: hdr, Flag: uint8(intValue(record.CAAFlags)), Tag: *record.CAATag, Value: record.Value}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported record type %s", record.Type)
+}
+
+// splitTXTValue splits a TXT value into RFC 1035 character-strings
+func splitTXTValue(value string) []string {
+	if len(value) <= txtChunkSize {
+		return []string{value}
+	}
+
+	var chunks []string
+	for len(value) > txtChunkSize {
+		chunks = append(chunks, value[:txtChunkSize])
+		value = value[txtChunkSize:]
+	}
+	return append(chunks, value)
+}
+
+// normalizeZoneFileHost lowercases a hostname and strips the trailing dot
+func normalizeZoneFileHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// isProxiedComment reports whether a zone file comment marks the record as
+// proxied. Both our own export ("; proxied") and Cloudflare's
+// ("; cf_tags=cf-proxied:true") formats are recognised.
+func isProxiedComment(comment string) bool {
+	if strings.Contains(comment, "cf-proxied:true") {
+		return true
+	}
+	for _, field := range strings.Fields(strings.TrimPrefix(comment, ";")) {
+		if field == "proxied" {
+			return true
+		}
+	}
+	return false
+}
+
+// intValue dereferences an optional integer field
+func intValue(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
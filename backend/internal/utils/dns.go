@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"net"
 	"strings"
 )
 
@@ -9,9 +10,12 @@ import (
 //   - ValidateFQDN("example.com", "example.com") => true
 //   - ValidateFQDN("www.example.com", "example.com") => true
 //   - ValidateFQDN("example.org", "example.com") => false
+//   - ValidateFQDN("www.例子.中国", "xn--fsqu00a.xn--fiqs8s") => true
+//
+// Both names are compared in punycode, case-insensitively.
 func ValidateFQDN(fqdn string, zone string) bool {
-	fqdn = strings.TrimSuffix(fqdn, ".")
-	zone = strings.TrimSuffix(zone, ".")
+	fqdn = ToASCII(fqdn)
+	zone = ToASCII(zone)
 
 	// Exact match
 	if fqdn == zone {
@@ -27,9 +31,12 @@ func ValidateFQDN(fqdn string, zone string) bool {
 //   - CalculateRelativeName("example.com", "example.com") => "@"
 //   - CalculateRelativeName("www.example.com", "example.com") => "www"
 //   - CalculateRelativeName("a.b.example.com", "example.com") => "a.b"
+//   - CalculateRelativeName("商店.例子.中国", "例子.中国") => "xn--czrs0t"
+//
+// The result is in punycode like the stored record names.
 func CalculateRelativeName(fqdn string, zone string) string {
-	fqdn = strings.TrimSuffix(fqdn, ".")
-	zone = strings.TrimSuffix(zone, ".")
+	fqdn = ToASCII(fqdn)
+	zone = ToASCII(zone)
 
 	// zone => @
 	if fqdn == zone {
@@ -50,12 +57,61 @@ func CalculateRelativeName(fqdn string, zone string) string {
 //   - CalculateFQDN("@", "example.com") => "example.com"
 //   - CalculateFQDN("www", "example.com") => "www.example.com"
 //   - CalculateFQDN("a.b", "example.com") => "a.b.example.com"
+//   - CalculateFQDN("商店", "例子.中国") => "xn--czrs0t.xn--fsqu00a.xn--fiqs8s"
 func CalculateFQDN(relativeName string, zone string) string {
-	zone = strings.TrimSuffix(zone, ".")
+	zone = ToASCII(zone)
 
 	if relativeName == "@" || relativeName == "" {
 		return zone
 	}
 
-	return relativeName + "." + zone
+	return ToASCII(relativeName) + "." + zone
+}
+
+// IsValidHostname checks if a string is a syntactically valid DNS hostname
+// (LDH labels, 1-63 chars each, 253 chars total). A trailing dot is allowed.
+// Example:
+//   - IsValidHostname("mail.example.com") => true
+//   - IsValidHostname("-bad.example.com") => false
+func IsValidHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, ch := range label {
+			isAlnum := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+			if !isAlnum && ch != '-' && ch != '_' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// AddressRecordType returns the DNS record type serving an IP address ("A" or
+// "AAAA") together with its canonical text form. IPv4-mapped IPv6 addresses
+// are treated as IPv4.
+// Example:
+//   - AddressRecordType("192.0.2.1") => "A", "192.0.2.1", true
+//   - AddressRecordType("2001:DB8::0001") => "AAAA", "2001:db8::1", true
+//   - AddressRecordType("::ffff:192.0.2.1") => "A", "192.0.2.1", true
+//   - AddressRecordType("example.com") => "", "", false
+func AddressRecordType(ip string) (string, string, bool) {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return "", "", false
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return "A", v4.String(), true
+	}
+	return "AAAA", parsed.String(), true
 }
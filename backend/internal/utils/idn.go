@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidDomainName is returned for names that cannot be converted to
+// punycode (IDNA2008 with UTS #46 mapping)
+var ErrInvalidDomainName = errors.New("invalid domain name")
+
+// idnaProfile maps and validates labels like a resolver lookup, but allows
+// underscores and wildcard labels (_acme-challenge, *.example.com) which
+// are valid DNS names though not valid hostnames
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// displayProfile converts punycode back for display with the same relaxed rules
+var displayProfile = idna.New(
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// NormalizeDomain converts a domain name to the lowercase punycode form that
+// is stored in the database and sent to DNS providers, certificate
+// authorities and agents. A trailing dot is removed.
+// Example:
+//   - NormalizeDomain("例子.中国") => "xn--fsqu00a.xn--fiqs8s", nil
+//   - NormalizeDomain("WWW.Example.com.") => "www.example.com", nil
+//   - NormalizeDomain("*.例子.中国") => "*.xn--fsqu00a.xn--fiqs8s", nil
+func NormalizeDomain(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "", ErrInvalidDomainName
+	}
+
+	ascii, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidDomainName, name, err)
+	}
+
+	// Without strict rules the profile lets through spaces and symbols
+	for _, label := range strings.Split(ascii, ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("%w: %s", ErrInvalidDomainName, name)
+		}
+		if label == "*" {
+			continue
+		}
+		for _, ch := range label {
+			if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') && ch != '-' && ch != '_' {
+				return "", fmt.Errorf("%w: %s", ErrInvalidDomainName, name)
+			}
+		}
+	}
+	return ascii, nil
+}
+
+// ToASCII is NormalizeDomain for names that were validated elsewhere: names
+// that cannot be converted are only lowercased
+func ToASCII(name string) string {
+	ascii, err := NormalizeDomain(name)
+	if err != nil {
+		return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	}
+	return ascii
+}
+
+// ToUnicode returns the display form of a punycode domain name. Names that
+// are not valid punycode are returned unchanged.
+// Example:
+//   - ToUnicode("xn--fsqu00a.xn--fiqs8s") => "例子.中国"
+//   - ToUnicode("www.example.com") => "www.example.com"
+func ToUnicode(name string) string {
+	unicode, err := displayProfile.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return unicode
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// The public suffix list is compiled into golang.org/x/net/publicsuffix, so
+// zone detection works without network access. Both the ICANN and the
+// private section (e.g. github.io) count as public suffixes.
+
+// PublicSuffix returns the public suffix of a domain name
+// Example:
+//   - PublicSuffix("www.example.com.cn") => "com.cn"
+//   - PublicSuffix("foo.github.io") => "github.io"
+func PublicSuffix(name string) string {
+	suffix, _ := publicsuffix.PublicSuffix(ToASCII(name))
+	return suffix
+}
+
+// IsPublicSuffix reports whether a domain name is itself a public suffix,
+// i.e. a name under which anyone can register domains. Unlisted TLDs are
+// treated as suffixes.
+// Example:
+//   - IsPublicSuffix("com.cn") => true
+//   - IsPublicSuffix("example.com.cn") => false
+func IsPublicSuffix(name string) bool {
+	name = ToASCII(name)
+	return PublicSuffix(name) == name
+}
+
+// RegistrableDomain returns the registrable domain (public suffix plus one
+// label) containing a domain name, the zone that would normally be managed
+// for it
+// Example:
+//   - RegistrableDomain("www.shop.example.co.uk") => "example.co.uk", nil
+//   - RegistrableDomain("co.uk") => "", error
+func RegistrableDomain(name string) (string, error) {
+	name = ToASCII(name)
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return "", fmt.Errorf("%s is a public suffix", name)
+	}
+	return registrable, nil
+}
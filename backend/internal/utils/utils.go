@@ -98,12 +98,13 @@ func ValidateDomainCoverage(domains []string, certDomains []string) bool {
 	return true
 }
 
-// isDomainCovered checks if a domain is covered by any certificate domain
+// isDomainCovered checks if a domain is covered by any certificate domain.
+// IDNs are compared in punycode, the form used in certificate SANs.
 func isDomainCovered(domain string, certDomains []string) bool {
-	domain = strings.ToLower(domain)
+	domain = ToASCII(domain)
 
 	for _, certDomain := range certDomains {
-		certDomain = strings.ToLower(certDomain)
+		certDomain = ToASCII(certDomain)
 
 		// Exact match
 		if domain == certDomain {
@@ -0,0 +1,259 @@
+//go:build integration
+
+package worker
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/database"
+	"github.com/cdn-control-panel/backend/internal/dnsserver"
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/service"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+	"github.com/miekg/dns"
+)
+
+// TestCustomDNSProviderPebble obtains a certificate from Pebble with the
+// dns-01 solver of certificate requests. The challenge zone is a builtin zone
+// served by an in-process dnsserver, which Pebble uses to validate:
+//
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053
+//
+//	CDN_TEST_MYSQL_DSN='user:pass@tcp(127.0.0.1:3306)/cdn_test?parseTime=true' \
+//	PEBBLE_DIRECTORY=https://127.0.0.1:14000/dir \
+//	PEBBLE_DNS_LISTEN=127.0.0.1:8053 \
+//	LEGO_CA_CERTIFICATES=test/certs/pebble.minica.pem \
+//	go test -tags integration -run Pebble ./internal/worker/
+func TestCustomDNSProviderPebble(t *testing.T) {
+	dsn := os.Getenv("CDN_TEST_MYSQL_DSN")
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	dnsListen := os.Getenv("PEBBLE_DNS_LISTEN")
+	if dsn == "" || directory == "" || dnsListen == "" {
+		t.Skip("CDN_TEST_MYSQL_DSN, PEBBLE_DIRECTORY and PEBBLE_DNS_LISTEN are required")
+	}
+
+	if err := database.Connect(dsn); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db := database.GetDB()
+
+	zoneName := fmt.Sprintf("acme-%d.test", time.Now().UnixNano())
+	zone, err := service.NewDomainService().CreateDomain(service.CreateDomainRequest{
+		Domain:   zoneName,
+		Provider: service.BuiltinDNSProvider,
+	})
+	if err != nil {
+		t.Fatalf("create zone: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("domain_id = ?", zone.ID).Delete(&models.DomainDNSRecord{})
+		db.Where("domain_id = ?", zone.ID).Delete(&models.DomainDNSProvider{})
+		db.Delete(zone)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	server, err := dnsserver.NewServer(dnsserver.Config{
+		Listen:          dnsListen,
+		Nameservers:     []string{"ns1." + zoneName},
+		Domains:         []string{zoneName},
+		RefreshInterval: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("dns server: %v", err)
+	}
+	go func() {
+		if err := server.Start(ctx); err != nil {
+			t.Errorf("dns server: %v", err)
+		}
+	}()
+
+	// The worker runs on a short loop instead of Start, so CleanUp can hold
+	// it off while checking the record it queued
+	w := NewDNSSyncWorker(time.Second)
+	w.verifier.Nameservers = []string{dnsListen}
+	var syncMu sync.Mutex
+	go func() {
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				syncMu.Lock()
+				w.syncPendingRecords()
+				syncMu.Unlock()
+			}
+		}
+	}()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &testUser{email: "acme@" + zoneName, key: key}
+	config := lego.NewConfig(user)
+	config.CADirURL = directory
+	client, err := lego.NewClient(config)
+	if err != nil {
+		t.Fatalf("lego client: %v", err)
+	}
+	user.registration, err = client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	provider := &checkedProvider{
+		CustomDNSProvider: service.NewCustomDNSProvider(service.NewDNSRecordService(nil, w), zone.ID),
+		t:                 t,
+		dnsListen:         dnsListen,
+		syncMu:            &syncMu,
+	}
+	// Present only returns once the record is served, and the test names
+	// cannot be resolved through the system resolvers lego checks by default
+	if err := client.Challenge.SetDNS01Provider(provider, dns01.PropagationWait(0, true)); err != nil {
+		t.Fatalf("set dns provider: %v", err)
+	}
+
+	certificates, err := client.Certificate.Obtain(certificate.ObtainRequest{
+		Domains: []string{zoneName, "*." + zoneName},
+		Bundle:  true,
+	})
+	if err != nil {
+		t.Fatalf("obtain: %v", err)
+	}
+	if len(certificates.Certificate) == 0 {
+		t.Fatal("empty certificate")
+	}
+
+	provider.mu.Lock()
+	presented, cleanedUp := provider.presented, provider.cleanedUp
+	provider.mu.Unlock()
+	// The apex and the wildcard share _acme-challenge.<zone>
+	if presented != 2 || cleanedUp != 2 {
+		t.Errorf("presented %d and cleaned up %d challenges, want 2 each", presented, cleanedUp)
+	}
+
+	// The worker removes the queued records
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var count int64
+		db.Model(&models.DomainDNSRecord{}).
+			Where("owner_type = ? AND owner_id = ?", "acme_challenge", zone.ID).
+			Count(&count)
+		if count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d challenge records left after CleanUp", count)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+type testUser struct {
+	email        string
+	registration *registration.Resource
+	key          crypto.PrivateKey
+}
+
+func (u *testUser) GetEmail() string                        { return u.email }
+func (u *testUser) GetRegistration() *registration.Resource { return u.registration }
+func (u *testUser) GetPrivateKey() crypto.PrivateKey        { return u.key }
+
+// checkedProvider checks the challenge record around each call of the
+// provider under test
+type checkedProvider struct {
+	*service.CustomDNSProvider
+	t         *testing.T
+	dnsListen string
+	syncMu    *sync.Mutex
+
+	mu                   sync.Mutex
+	presented, cleanedUp int
+}
+
+func (p *checkedProvider) Present(domain, token, keyAuth string) error {
+	start := time.Now()
+	if err := p.CustomDNSProvider.Present(domain, token, keyAuth); err != nil {
+		return err
+	}
+
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+	if record := p.challengeRecord(info.Value); record == nil || record.Status != "verified" {
+		p.t.Errorf("Present returned after %s with challenge record %+v, want verified", time.Since(start), record)
+	}
+	if !p.served(info.EffectiveFQDN, info.Value) {
+		p.t.Errorf("Present returned before %s TXT %q was served", info.EffectiveFQDN, info.Value)
+	}
+
+	p.mu.Lock()
+	p.presented++
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *checkedProvider) CleanUp(domain, token, keyAuth string) error {
+	// Hold off the worker, which would delete the record right away
+	p.syncMu.Lock()
+	defer p.syncMu.Unlock()
+
+	if err := p.CustomDNSProvider.CleanUp(domain, token, keyAuth); err != nil {
+		return err
+	}
+
+	info := dns01.GetChallengeInfo(domain, keyAuth)
+	if record := p.challengeRecord(info.Value); record == nil || record.Status != "deleting" {
+		p.t.Errorf("CleanUp left challenge record %+v, want deleting", record)
+	}
+
+	p.mu.Lock()
+	p.cleanedUp++
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *checkedProvider) challengeRecord(value string) *models.DomainDNSRecord {
+	var record models.DomainDNSRecord
+	err := database.GetDB().
+		Where("owner_type = ? AND type = ? AND value = ?", "acme_challenge", "TXT", value).
+		First(&record).Error
+	if err != nil {
+		return nil
+	}
+	return &record
+}
+
+// served reports whether the builtin server answers fqdn with the TXT value
+func (p *checkedProvider) served(fqdn, value string) bool {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(fqdn), dns.TypeTXT)
+	resp, err := dns.Exchange(msg, p.dnsListen)
+	if err != nil {
+		return false
+	}
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true
+		}
+	}
+	return false
+}
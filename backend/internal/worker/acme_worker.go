@@ -1,24 +1,23 @@
 package worker
 
 import (
-	"fmt"
 	"log"
 	"time"
 
 	"github.com/cdn-control-panel/backend/internal/database"
 	"github.com/cdn-control-panel/backend/internal/models"
 	"github.com/cdn-control-panel/backend/internal/service"
-	"gorm.io/gorm"
 )
 
-// ACMEWorker handles automatic certificate requests and renewals
+// ACMEWorker handles automatic certificate requests, website certificate
+// provisioning and renewals
 type ACMEWorker struct {
-	acmeService          *service.ACMEService
-	certificateService   *service.CertificateService
-	dnsRecordService     *service.DNSRecordService
-	interval             time.Duration
-	renewalThresholdDays int
-	stopChan             chan struct{}
+	acmeService        *service.ACMEService
+	certificateService *service.CertificateService
+	dnsRecordService   *service.DNSRecordService
+	interval           time.Duration
+	provisionInterval  time.Duration
+	stopChan           chan struct{}
 }
 
 // NewACMEWorker creates a new ACME worker
@@ -28,12 +27,12 @@ func NewACMEWorker(
 	dnsRecordService *service.DNSRecordService,
 ) *ACMEWorker {
 	return &ACMEWorker{
-		acmeService:          acmeService,
-		certificateService:   certificateService,
-		dnsRecordService:     dnsRecordService,
-		interval:             5 * time.Minute, // Check every 5 minutes
-		renewalThresholdDays: 30,               // Renew 30 days before expiration
-		stopChan:             make(chan struct{}),
+		acmeService:        acmeService,
+		certificateService: certificateService,
+		dnsRecordService:   dnsRecordService,
+		interval:           5 * time.Minute,  // Check every 5 minutes
+		provisionInterval:  30 * time.Second, // Websites wait for their certificate
+		stopChan:           make(chan struct{}),
 	}
 }
 
@@ -41,19 +40,29 @@ func NewACMEWorker(
 func (w *ACMEWorker) Start() {
 	log.Println("[ACME Worker] Starting...")
 
+	// Websites left issuing by a restart are provisioned again
+	if err := w.acmeService.ResetInterruptedProvisioning(); err != nil {
+		log.Printf("[ACME Worker] Failed to reset interrupted provisioning: %v", err)
+	}
+
 	// Run immediately on start
 	w.processPendingRequests()
+	w.processProvisioning()
 	w.processRenewals()
 
 	// Then run periodically
 	ticker := time.NewTicker(w.interval)
 	defer ticker.Stop()
+	provisionTicker := time.NewTicker(w.provisionInterval)
+	defer provisionTicker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			w.processPendingRequests()
 			w.processRenewals()
+		case <-provisionTicker.C:
+			w.processProvisioning()
 		case <-w.stopChan:
 			log.Println("[ACME Worker] Stopped")
 			return
@@ -66,183 +75,80 @@ func (w *ACMEWorker) Stop() {
 	close(w.stopChan)
 }
 
-// processPendingRequests processes pending certificate requests
+// processPendingRequests processes certificate requests left pending, e.g.
+// by a restart before their processing started. Requests are normally
+// processed right after creation, so only requests older than a minute are
+// picked up.
 func (w *ACMEWorker) processPendingRequests() {
-	log.Println("[ACME Worker] Processing pending certificate requests...")
-
 	var requests []models.CertificateRequest
-	if err := database.DB.Where("status = ?", "pending").Find(&requests).Error; err != nil {
+	if err := database.DB.Where("status = ? AND created_at < ?", "pending", time.Now().Add(-time.Minute)).
+		Order("id ASC").
+		Find(&requests).Error; err != nil {
 		log.Printf("[ACME Worker] Failed to get pending requests: %v", err)
 		return
 	}
 
 	if len(requests) == 0 {
-		log.Println("[ACME Worker] No pending requests found")
 		return
 	}
 
 	log.Printf("[ACME Worker] Found %d pending requests", len(requests))
 
 	for _, req := range requests {
-		if err := w.processRequest(&req); err != nil {
-			log.Printf("[ACME Worker] Failed to process request %d: %v", req.ID, err)
-			// Update status to error
-			database.DB.Model(&req).Updates(map[string]interface{}{
-				"status":     "error",
-				"last_error": err.Error(),
-			})
-		}
+		log.Printf("[ACME Worker] Processing request %d", req.ID)
+		w.acmeService.ProcessPendingRequest(req.ID)
 	}
 }
 
-// processRequest processes a single certificate request
-func (w *ACMEWorker) processRequest(req *models.CertificateRequest) error {
-	log.Printf("[ACME Worker] Processing request %d for domains: %v", req.ID, req.Domains)
-
-	// Update status to processing
-	if err := database.DB.Model(req).Update("status", "processing").Error; err != nil {
-		return fmt.Errorf("failed to update status: %w", err)
-	}
-
-	// Request certificate using ACME service
-	// The ACMEService will handle DNS-01 challenge internally
-	certificateID, err := w.acmeService.RequestCertificate(req.Domains, req.Email)
-	if err != nil {
-		return fmt.Errorf("ACME request failed: %w", err)
+// processProvisioning issues certificates for websites in cert_mode=acme
+// whose domains or account changed (provision_status=pending)
+func (w *ACMEWorker) processProvisioning() {
+	var websiteIDs []int
+	if err := database.DB.Model(&models.WebsiteHTTPS{}).
+		Where("cert_mode = ? AND provision_status = ?", "acme", "pending").
+		Order("updated_at ASC").
+		Pluck("website_id", &websiteIDs).Error; err != nil {
+		log.Printf("[ACME Worker] Failed to get websites to provision: %v", err)
+		return
 	}
 
-	// Update request status to completed
-	if err := database.DB.Model(req).Updates(map[string]interface{}{
-		"status":         "completed",
-		"certificate_id": certificateID,
-		"last_error":     "",
-	}).Error; err != nil {
-		return fmt.Errorf("failed to update request: %w", err)
+	for _, websiteID := range websiteIDs {
+		log.Printf("[ACME Worker] Provisioning certificate for website %d", websiteID)
+		if err := w.acmeService.ProvisionWebsiteCertificate(websiteID); err != nil {
+			log.Printf("[ACME Worker] Failed to provision certificate: %v", err)
+			continue
+		}
 	}
-
-	log.Printf("[ACME Worker] Successfully completed request %d, certificate ID: %d", req.ID, certificateID)
-	return nil
 }
 
-// processRenewals processes certificate renewals
+// processRenewals renews ACME certificates with renew_mode=auto whose
+// renew_at has passed. Certificates with a failed renewal wait until their
+// next_renew_at backoff has passed; replaced certificates are skipped.
 func (w *ACMEWorker) processRenewals() {
-	log.Println("[ACME Worker] Processing certificate renewals...")
-
-	// Find certificates expiring within threshold
-	expirationThreshold := time.Now().AddDate(0, 0, w.renewalThresholdDays)
+	now := time.Now()
 
 	var certificates []models.Certificate
-	if err := database.DB.Where("not_after < ? AND auto_renew = ?", expirationThreshold, true).
+	if err := database.DB.Where("source = ? AND renew_mode = ? AND renew_at <= ?", "acme", "auto", now).
+		Where("replaced_by_id IS NULL AND acme_account_id IS NOT NULL").
+		Where("next_renew_at IS NULL OR next_renew_at <= ?", now).
+		Order("renew_at ASC").
 		Find(&certificates).Error; err != nil {
 		log.Printf("[ACME Worker] Failed to get certificates for renewal: %v", err)
 		return
 	}
 
 	if len(certificates) == 0 {
-		log.Println("[ACME Worker] No certificates need renewal")
 		return
 	}
 
 	log.Printf("[ACME Worker] Found %d certificates for renewal", len(certificates))
 
 	for _, cert := range certificates {
-		if err := w.renewCertificate(&cert); err != nil {
+		log.Printf("[ACME Worker] Renewing certificate %d (expires: %v)", cert.ID, cert.ExpireAt)
+		if err := w.acmeService.RenewCertificate(cert.ID); err != nil {
 			log.Printf("[ACME Worker] Failed to renew certificate %d: %v", cert.ID, err)
+			continue
 		}
+		log.Printf("[ACME Worker] Renewed certificate %d", cert.ID)
 	}
 }
-
-// renewCertificate renews a single certificate
-func (w *ACMEWorker) renewCertificate(cert *models.Certificate) error {
-	log.Printf("[ACME Worker] Renewing certificate %d (expires: %v)", cert.ID, cert.NotAfter)
-
-	// Get certificate domains
-	var domains []models.CertificateDomain
-	if err := database.DB.Where("certificate_id = ?", cert.ID).Find(&domains).Error; err != nil {
-		return fmt.Errorf("failed to get certificate domains: %w", err)
-	}
-
-	if len(domains) == 0 {
-		return fmt.Errorf("no domains found for certificate")
-	}
-
-	// Extract domain names
-	var domainNames []string
-	for _, d := range domains {
-		domainNames = append(domainNames, d.Domain)
-	}
-
-	// Create a new certificate request
-	req := models.CertificateRequest{
-		Domains: domainNames,
-		Email:   "admin@example.com", // TODO: Get from config or certificate metadata
-		Status:  "pending",
-	}
-
-	if err := database.DB.Create(&req).Error; err != nil {
-		return fmt.Errorf("failed to create renewal request: %w", err)
-	}
-
-	log.Printf("[ACME Worker] Created renewal request %d for certificate %d", req.ID, cert.ID)
-
-	// The renewal will be processed in the next cycle
-	return nil
-}
-
-// processChallenge processes DNS-01 challenge for a domain
-// This is called by ACMEService during certificate request
-func (w *ACMEWorker) processChallenge(domain, token, keyAuth string) error {
-	log.Printf("[ACME Worker] Processing DNS-01 challenge for domain: %s", domain)
-
-	// Find the zone for this domain
-	var domainRecord models.Domain
-	if err := database.DB.Where("domain = ?", domain).Or("domain LIKE ?", "%."+domain).
-		Order("LENGTH(domain) DESC").First(&domainRecord).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("no zone found for domain %s", domain)
-		}
-		return fmt.Errorf("failed to find zone: %w", err)
-	}
-
-	// Create DNS TXT record for challenge
-	challengeRecord := "_acme-challenge." + domain
-
-	createReq := service.CreateDNSRecordRequest{
-		DomainID:  domainRecord.ID,
-		Type:      "TXT",
-		Name:      challengeRecord,
-		Value:     keyAuth,
-		TTL:       120,
-		Proxied:   false,
-		OwnerType: "acme_challenge",
-		OwnerID:   0, // No specific owner
-	}
-
-	if err := w.dnsRecordService.CreateDNSRecord(createReq); err != nil {
-		return fmt.Errorf("failed to create challenge record: %w", err)
-	}
-
-	log.Printf("[ACME Worker] Created DNS TXT record: %s = %s", challengeRecord, keyAuth)
-
-	// Wait for DNS propagation
-	time.Sleep(30 * time.Second)
-
-	return nil
-}
-
-// cleanupChallenge cleans up DNS-01 challenge record
-func (w *ACMEWorker) cleanupChallenge(domain string) error {
-	log.Printf("[ACME Worker] Cleaning up DNS-01 challenge for domain: %s", domain)
-
-	challengeRecord := "_acme-challenge." + domain
-
-	// Delete challenge TXT records
-	if err := database.DB.Where("type = ? AND name = ? AND owner_type = ?",
-		"TXT", challengeRecord, "acme_challenge").
-		Delete(&models.DomainDNSRecord{}).Error; err != nil {
-		log.Printf("[ACME Worker] Failed to cleanup challenge record: %v", err)
-		// Don't return error, as this is cleanup
-	}
-
-	return nil
-}
@@ -2,22 +2,61 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cdn-control-panel/backend/internal/database"
 	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/service"
 	"github.com/cdn-control-panel/backend/pkg/cloudflare"
+	"github.com/cdn-control-panel/backend/pkg/dnsprovider"
+	"github.com/cdn-control-panel/backend/pkg/dnsverify"
 	"gorm.io/gorm"
 )
 
-// DNSSyncWorker handles asynchronous DNS record synchronization with Cloudflare
+const (
+	// zoneConcurrency bounds concurrent provider calls per zone (domain)
+	zoneConcurrency = 4
+	// apiKeyConcurrency bounds concurrent provider calls per API key,
+	// which is what Cloudflare rate limits are accounted against
+	apiKeyConcurrency = 8
+	// maxBatchesPerRun bounds how many batches one run drains back to back
+	maxBatchesPerRun = 10
+
+	// Retry backoff: retryBaseDelay * 2^(retry_count-1), capped at retryMaxDelay, with jitter
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = time.Hour
+
+	// Verification backoff while a synced record is not yet visible on all
+	// authoritative nameservers
+	verifyBaseDelay = 5 * time.Second
+	verifyMaxDelay  = 10 * time.Minute
+)
+
+// DNSSyncWorker handles asynchronous DNS record synchronization with the DNS providers
 type DNSSyncWorker struct {
 	db               *gorm.DB
 	cloudflareClient *cloudflare.Client
+	verifier         *dnsverify.Verifier
 	interval         time.Duration
 	batchSize        int
+	wake             chan struct{}
+
+	// builtinChanged is set when records of builtin zones changed during a
+	// run; the run then bumps the config version so dns-serve reloads
+	builtinChanged atomic.Bool
+
+	mu          sync.Mutex
+	apiKeySlots map[int]chan struct{}
+	// inFlight holds the records whose provider create or update is running;
+	// a delete queued meanwhile waits for the provider_record_id it returns
+	inFlight map[int]bool
 }
 
 // NewDNSSyncWorker creates a new DNS sync worker
@@ -25,8 +64,12 @@ func NewDNSSyncWorker(interval time.Duration) *DNSSyncWorker {
 	return &DNSSyncWorker{
 		db:               database.GetDB(),
 		cloudflareClient: cloudflare.NewClient(),
+		verifier:         dnsverify.NewVerifier(),
 		interval:         interval,
 		batchSize:        100,
+		wake:             make(chan struct{}, 1),
+		apiKeySlots:      make(map[int]chan struct{}),
+		inFlight:         make(map[int]bool),
 	}
 }
 
@@ -47,32 +90,136 @@ func (w *DNSSyncWorker) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			w.syncPendingRecords()
+		case <-w.wake:
+			w.syncPendingRecords()
 		}
 	}
 }
 
-// syncPendingRecords syncs all pending and error records
+// Wake requests an immediate sync run instead of waiting for the next tick.
+// It never blocks; wake-ups requested during a run are coalesced into one.
+func (w *DNSSyncWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// syncPendingRecords syncs all pending, error and deleting records, then
+// verifies synced records against the authoritative nameservers and removes
+// records moved to a delegated subzone from the parent.
+// Full batches are drained back to back so large changes do not wait for
+// the next tick between batches.
 func (w *DNSSyncWorker) syncPendingRecords() {
-	records := w.fetchPendingRecords()
+	for i := 0; i < maxBatchesPerRun; i++ {
+		records := w.fetchPendingRecords()
 
-	if len(records) == 0 {
-		return
+		if len(records) == 0 {
+			break
+		}
+
+		log.Printf("[DNSSyncWorker] Found %d records to sync\n", len(records))
+
+		w.runPerZone(records, w.syncSingleRecord)
+
+		if len(records) < w.batchSize {
+			break
+		}
+	}
+
+	if w.builtinChanged.Swap(false) {
+		if err := service.NewConfigVersionService().BumpVersionInTx("builtin DNS records changed"); err != nil {
+			log.Printf("[DNSSyncWorker] Error bumping config version: %v\n", err)
+		}
 	}
 
-	log.Printf("[DNSSyncWorker] Found %d records to sync\n", len(records))
+	w.verifySyncedRecords()
+
+	// Parent copies of records adopted by a subzone go once it is delegated
+	if queued, err := service.CompleteSubzoneMoves(w.db); err != nil {
+		log.Printf("[DNSSyncWorker] Error completing subzone moves: %v\n", err)
+	} else if queued > 0 {
+		w.Wake()
+	}
+}
 
+// runPerZone processes a batch of records, handling zones in parallel with
+// at most zoneConcurrency records in flight per zone. The per-API-key bound
+// is enforced around each provider call (see acquireAPIKey).
+func (w *DNSSyncWorker) runPerZone(records []models.DomainDNSRecord, fn func(models.DomainDNSRecord)) {
+	byZone := make(map[int][]models.DomainDNSRecord)
 	for _, record := range records {
-		w.syncSingleRecord(record)
+		byZone[record.DomainID] = append(byZone[record.DomainID], record)
+	}
+
+	var wg sync.WaitGroup
+	for _, zoneRecords := range byZone {
+		queue := make(chan models.DomainDNSRecord, len(zoneRecords))
+		for _, record := range zoneRecords {
+			queue <- record
+		}
+		close(queue)
+
+		workers := zoneConcurrency
+		if len(zoneRecords) < workers {
+			workers = len(zoneRecords)
+		}
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for record := range queue {
+					fn(record)
+				}
+			}()
+		}
+	}
+
+	wg.Wait()
+}
+
+// acquireAPIKey takes one of the apiKeyConcurrency slots of an API key and
+// returns the function that releases it
+func (w *DNSSyncWorker) acquireAPIKey(apiKeyID int) func() {
+	w.mu.Lock()
+	slots, ok := w.apiKeySlots[apiKeyID]
+	if !ok {
+		slots = make(chan struct{}, apiKeyConcurrency)
+		w.apiKeySlots[apiKeyID] = slots
+	}
+	w.mu.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// setInFlight marks a record's provider call as running or finished
+func (w *DNSSyncWorker) setInFlight(recordID int, running bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if running {
+		w.inFlight[recordID] = true
+	} else {
+		delete(w.inFlight, recordID)
 	}
 }
 
+// isInFlight reports whether a record's provider call is running
+func (w *DNSSyncWorker) isInFlight(recordID int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.inFlight[recordID]
+}
+
 // fetchPendingRecords fetches records that need to be synced
-// Input: domain_dns_records where status IN ('pending', 'error')
-//        AND (next_retry_at IS NULL OR next_retry_at <= NOW())
+// Input: domain_dns_records where status IN ('pending', 'error', 'deleting')
+//
+//	AND (next_retry_at IS NULL OR next_retry_at <= NOW())
 func (w *DNSSyncWorker) fetchPendingRecords() []models.DomainDNSRecord {
 	var records []models.DomainDNSRecord
 
-	err := w.db.Where("status IN (?, ?)", "pending", "error").
+	err := w.db.Where("status IN (?, ?, ?)", "pending", "error", "deleting").
 		Where("next_retry_at IS NULL OR next_retry_at <= ?", time.Now()).
 		Order("created_at ASC").
 		Limit(w.batchSize).
@@ -86,8 +233,13 @@ func (w *DNSSyncWorker) fetchPendingRecords() []models.DomainDNSRecord {
 	return records
 }
 
-// syncSingleRecord syncs a single DNS record with Cloudflare
+// syncSingleRecord syncs a single DNS record with the zone's provider
 func (w *DNSSyncWorker) syncSingleRecord(record models.DomainDNSRecord) {
+	if record.Status == "deleting" {
+		w.deleteSingleRecord(record)
+		return
+	}
+
 	log.Printf("[DNSSyncWorker] Syncing record ID=%d, domain_id=%d, type=%s, name=%s\n",
 		record.ID, record.DomainID, record.Type, record.Name)
 
@@ -105,62 +257,65 @@ func (w *DNSSyncWorker) syncSingleRecord(record models.DomainDNSRecord) {
 		return
 	}
 
-	// 3. Get API key
-	var apiKey models.APIKey
-	if err := w.db.First(&apiKey, provider.APIKeyID).Error; err != nil {
-		w.markError(record.ID, "API key not found")
+	// Builtin zones are served from the database by dns-serve: nothing to call
+	if provider.Provider == service.BuiltinDNSProvider {
+		w.markSuccess(record.ID, "")
+		w.builtinChanged.Store(true)
 		return
 	}
 
-	// Check API key status
-	if apiKey.Status != "active" {
-		w.markError(record.ID, "API key is inactive")
+	// 3. Get provider client
+	client, apiKeyID, err := w.providerClient(provider)
+	if err != nil {
+		w.markError(record.ID, err.Error())
 		return
 	}
 
-	// 4. Initialize Cloudflare client with token
-	client := w.cloudflareClient.WithToken(apiKey.APIToken)
-
-	// 5. Calculate full DNS name
-	var fullName string
-	if record.Name == "@" {
-		fullName = domain.Domain
-	} else {
-		fullName = record.Name + "." + domain.Domain
+	// 4. Build provider record
+	providerRecord, err := w.buildProviderRecord(record, domain, provider)
+	if err != nil {
+		w.markError(record.ID, err.Error())
+		return
 	}
 
-	// 6. Call Cloudflare API
+	// 5. Call provider API
 	var providerRecordID string
-	var err error
 
-	if record.ProviderRecordID != nil && *record.ProviderRecordID != "" {
+	// Released after the outcome (provider_record_id) is stored
+	w.setInFlight(record.ID, true)
+	defer w.setInFlight(record.ID, false)
+
+	release := w.acquireAPIKey(apiKeyID)
+
+	updating := record.ProviderRecordID != nil && *record.ProviderRecordID != ""
+	if updating {
 		// Update existing record
 		log.Printf("[DNSSyncWorker] Updating existing record: provider_record_id=%s\n", *record.ProviderRecordID)
-		providerRecordID, err = client.UpdateDNSRecord(
+		providerRecordID, err = client.UpdateRecord(
 			provider.ProviderZoneID,
 			*record.ProviderRecordID,
-			record.Type,
-			fullName,
-			record.Value,
-			record.TTL,
-			record.Proxied,
+			providerRecord,
 		)
 	} else {
 		// Create new record
 		log.Printf("[DNSSyncWorker] Creating new record\n")
-		providerRecordID, err = client.CreateDNSRecord(
+		providerRecordID, err = client.CreateRecord(
 			provider.ProviderZoneID,
-			record.Type,
-			fullName,
-			record.Value,
-			record.TTL,
-			record.Proxied,
+			providerRecord,
 		)
 	}
-
-	// 7. Update database status
-	if err != nil {
+	release()
+
+	// 6. Update database status
+	var rateLimitErr *cloudflare.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		log.Printf("[DNSSyncWorker] Rate limited syncing record ID=%d, retry after %s\n", record.ID, rateLimitErr.RetryAfter)
+		w.deferRecord(record.ID, rateLimitErr)
+	} else if err != nil {
 		log.Printf("[DNSSyncWorker] Error syncing record ID=%d: %v\n", record.ID, err)
+		if !updating && isTimeout(err) {
+			w.markCreateTimedOut(record.ID)
+		}
 		w.markError(record.ID, err.Error())
 	} else {
 		log.Printf("[DNSSyncWorker] Successfully synced record ID=%d, provider_record_id=%s\n",
@@ -169,24 +324,182 @@ func (w *DNSSyncWorker) syncSingleRecord(record models.DomainDNSRecord) {
 	}
 }
 
+// providerClient returns the API client of a zone's provider together with
+// the API key ID its calls are accounted against
+func (w *DNSSyncWorker) providerClient(provider models.DomainDNSProvider) (dnsprovider.Provider, int, error) {
+	var apiKey models.APIKey
+	if err := w.db.First(&apiKey, provider.APIKeyID).Error; err != nil {
+		return nil, 0, fmt.Errorf("API key not found")
+	}
+
+	// Check API key status
+	if apiKey.Status != "active" {
+		return nil, 0, fmt.Errorf("API key is inactive")
+	}
+
+	if provider.Provider == dnsprovider.Cloudflare {
+		return dnsprovider.NewCloudflare(w.cloudflareClient.WithToken(string(apiKey.APIToken))), apiKey.ID, nil
+	}
+
+	creds := dnsprovider.Credentials{Secret: string(apiKey.APIToken)}
+	if apiKey.Account != nil {
+		creds.Account = *apiKey.Account
+	}
+	client, err := dnsprovider.New(provider.Provider, creds)
+	if err != nil {
+		return nil, 0, err
+	}
+	return client, apiKey.ID, nil
+}
+
+// buildProviderRecord maps a desired-state record to the provider record.
+// Providers managing record sets also get all live records sharing the
+// record's name, type and line (without the record itself if deleting).
+func (w *DNSSyncWorker) buildProviderRecord(record models.DomainDNSRecord, domain models.Domain, provider models.DomainDNSProvider) (dnsprovider.Record, error) {
+	providerRecord := toProviderRecord(record, domain.Domain)
+
+	if dnsprovider.UsesRecordSets(provider.Provider) {
+		var siblings []models.DomainDNSRecord
+		if err := w.db.Where("domain_id = ? AND type = ? AND name = ? AND line = ? AND status <> ?",
+			record.DomainID, record.Type, record.Name, record.Line, "deleting").
+			Find(&siblings).Error; err != nil {
+			return providerRecord, fmt.Errorf("failed to load record set: %w", err)
+		}
+		for _, sibling := range siblings {
+			providerRecord.Set = append(providerRecord.Set, toProviderRecord(sibling, domain.Domain))
+		}
+	}
+
+	return providerRecord, nil
+}
+
+// toProviderRecord converts a desired-state record for the provider API
+func toProviderRecord(record models.DomainDNSRecord, zone string) dnsprovider.Record {
+	fullName := zone
+	if record.Name != "@" {
+		fullName = record.Name + "." + zone
+	}
+
+	return dnsprovider.Record{
+		Type:     record.Type,
+		Name:     fullName,
+		Zone:     zone,
+		Content:  record.Value,
+		TTL:      record.TTL,
+		Proxied:  record.Proxied,
+		Priority: record.Priority,
+		Weight:   record.Weight,
+		Port:     record.Port,
+		CAAFlags: record.CAAFlags,
+		CAATag:   record.CAATag,
+		View:     record.Line,
+	}
+}
+
+// deleteSingleRecord removes a record in status=deleting from the provider and,
+// once the provider confirms, from the database
+func (w *DNSSyncWorker) deleteSingleRecord(record models.DomainDNSRecord) {
+	log.Printf("[DNSSyncWorker] Deleting record ID=%d, domain_id=%d, type=%s, name=%s\n",
+		record.ID, record.DomainID, record.Type, record.Name)
+
+	// A create still running has not stored the provider ID the delete
+	// needs; the record is deleted once it has
+	if (record.ProviderRecordID == nil || *record.ProviderRecordID == "") && w.isInFlight(record.ID) {
+		log.Printf("[DNSSyncWorker] Record ID=%d is being created, delete postponed\n", record.ID)
+		w.postponeRecord(record.ID, retryBaseDelay)
+		return
+	}
+
+	if err := w.DeleteDNSRecordFromProvider(record); err != nil {
+		var rateLimitErr *cloudflare.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			log.Printf("[DNSSyncWorker] Rate limited deleting record ID=%d, retry after %s\n", record.ID, rateLimitErr.RetryAfter)
+			w.deferRecord(record.ID, rateLimitErr)
+			return
+		}
+		log.Printf("[DNSSyncWorker] Error deleting record ID=%d: %v\n", record.ID, err)
+		w.markError(record.ID, err.Error())
+		return
+	}
+
+	// Only remove the row if it is still queued for deletion
+	if err := w.db.Where("id = ? AND status = ?", record.ID, "deleting").
+		Delete(&models.DomainDNSRecord{}).Error; err != nil {
+		log.Printf("[DNSSyncWorker] Error removing record %d: %v\n", record.ID, err)
+		return
+	}
+
+	if w.isBuiltinZone(record.DomainID) {
+		w.builtinChanged.Store(true)
+	}
+
+	log.Printf("[DNSSyncWorker] Successfully deleted record ID=%d\n", record.ID)
+}
+
+// isBuiltinZone reports whether a domain is served by dns-serve
+func (w *DNSSyncWorker) isBuiltinZone(domainID int) bool {
+	var count int64
+	w.db.Model(&models.DomainDNSProvider{}).
+		Where("domain_id = ? AND provider = ?", domainID, service.BuiltinDNSProvider).
+		Count(&count)
+	return count > 0
+}
+
 // markSuccess marks a record as successfully synced (A7 assertion)
+// If the record was queued for deletion while the provider call was in
+// flight, only provider_record_id is stored so the delete can reach it.
 func (w *DNSSyncWorker) markSuccess(recordID int, providerRecordID string) {
+	now := time.Now()
 	updates := map[string]interface{}{
 		"status":             "active",
 		"provider_record_id": providerRecordID,
 		"last_error":         nil,
 		"retry_count":        0,
 		"next_retry_at":      nil,
-		"updated_at":         time.Now(),
+		"synced_at":          now,
+		"verified_at":        nil,
+		"create_timed_out":   false,
+		"updated_at":         now,
 	}
 
-	if err := w.db.Model(&models.DomainDNSRecord{}).Where("id = ?", recordID).Updates(updates).Error; err != nil {
-		log.Printf("[DNSSyncWorker] Error marking record %d as success: %v\n", recordID, err)
+	result := w.db.Model(&models.DomainDNSRecord{}).
+		Where("id = ? AND status <> ?", recordID, "deleting").
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[DNSSyncWorker] Error marking record %d as success: %v\n", recordID, result.Error)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		if err := w.db.Model(&models.DomainDNSRecord{}).Where("id = ?", recordID).
+			Updates(map[string]interface{}{
+				"provider_record_id": providerRecordID,
+				"create_timed_out":   false,
+			}).Error; err != nil {
+			log.Printf("[DNSSyncWorker] Error storing provider_record_id for record %d: %v\n", recordID, err)
+		}
 	}
 }
 
+// markCreateTimedOut records that a create was sent but timed out, so the
+// provider may hold the record without its ID being stored
+func (w *DNSSyncWorker) markCreateTimedOut(recordID int) {
+	if err := w.db.Model(&models.DomainDNSRecord{}).Where("id = ?", recordID).
+		Update("create_timed_out", true).Error; err != nil {
+		log.Printf("[DNSSyncWorker] Error marking record %d create as timed out: %v\n", recordID, err)
+	}
+}
+
+// isTimeout reports whether a provider call failed by timing out, leaving
+// open whether the provider applied it
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
 // markError marks a record as failed with retry backoff (A7 assertion)
-// Backoff strategy: 60s * retry_count (60s, 120s, 180s, ...)
+// Records in status=deleting keep their status so the delete is retried.
+// Backoff strategy: exponential with jitter (~30s, 60s, 120s, ... up to 1h)
 func (w *DNSSyncWorker) markError(recordID int, errorMsg string) {
 	var record models.DomainDNSRecord
 	if err := w.db.First(&record, recordID).Error; err != nil {
@@ -195,16 +508,20 @@ func (w *DNSSyncWorker) markError(recordID int, errorMsg string) {
 	}
 
 	retryCount := record.RetryCount + 1
-	backoffSeconds := 60 * retryCount // 60s, 120s, 180s...
-	nextRetryAt := time.Now().Add(time.Duration(backoffSeconds) * time.Second)
+	nextRetryAt := time.Now().Add(retryBackoff(retryCount))
 
 	// Truncate error message if too long
 	if len(errorMsg) > 255 {
 		errorMsg = errorMsg[:252] + "..."
 	}
 
+	status := "error"
+	if record.Status == "deleting" {
+		status = "deleting"
+	}
+
 	updates := map[string]interface{}{
-		"status":        "error",
+		"status":        status,
 		"last_error":    errorMsg,
 		"retry_count":   retryCount,
 		"next_retry_at": nextRetryAt,
@@ -219,12 +536,175 @@ func (w *DNSSyncWorker) markError(recordID int, errorMsg string) {
 		recordID, retryCount, nextRetryAt.Format(time.RFC3339))
 }
 
-// DeleteDNSRecordFromProvider deletes a DNS record from Cloudflare
-// This is used when deleting a record from the database
+// verifySyncedRecords runs the verification phase: records in status=active
+// were accepted by the provider API and are checked against every
+// authoritative nameserver of their zone before being marked verified.
+// Records of other resolver views than the default stay active, since the
+// answer depends on the view of the querying resolver, and so do weighted
+// records, since each answer holds one of them.
+func (w *DNSSyncWorker) verifySyncedRecords() {
+	var records []models.DomainDNSRecord
+
+	err := w.db.Where("status = ?", "active").
+		Where("line IN ?", []string{"", dnsprovider.ViewDefault}).
+		Where("weight IS NULL OR type = ?", "SRV").
+		Where("next_retry_at IS NULL OR next_retry_at <= ?", time.Now()).
+		Order("synced_at ASC").
+		Limit(w.batchSize).
+		Find(&records).Error
+	if err != nil {
+		log.Printf("[DNSSyncWorker] Error fetching records to verify: %v\n", err)
+		return
+	}
+
+	if len(records) == 0 {
+		return
+	}
+
+	w.runPerZone(records, w.verifySingleRecord)
+}
+
+// verifySingleRecord queries the authoritative nameservers for one record
+func (w *DNSSyncWorker) verifySingleRecord(record models.DomainDNSRecord) {
+	var domain models.Domain
+	if err := w.db.First(&domain, record.DomainID).Error; err != nil {
+		w.markUnverified(record, "domain not found")
+		return
+	}
+
+	expected, err := service.RecordToRR(record, domain.Domain)
+	if err != nil {
+		w.markUnverified(record, err.Error())
+		return
+	}
+
+	// Proxied records are answered with the provider's edge addresses
+	result, err := w.verifier.Verify(domain.Domain, expected, record.Proxied)
+	if err != nil {
+		w.markUnverified(record, err.Error())
+		return
+	}
+
+	if !result.Verified {
+		w.markUnverified(record, "not visible on all nameservers: "+result.Mismatches())
+		return
+	}
+
+	w.markVerified(record, result)
+}
+
+// markVerified marks a record as served by all authoritative nameservers and
+// records when that happened. The update is skipped if the record changed
+// (e.g. back to pending or deleting) while it was being verified.
+func (w *DNSSyncWorker) markVerified(record models.DomainDNSRecord, result *dnsverify.Result) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":        "verified",
+		"verified_at":   now,
+		"last_error":    nil,
+		"retry_count":   0,
+		"next_retry_at": nil,
+		"updated_at":    now,
+	}
+
+	if err := w.db.Model(&models.DomainDNSRecord{}).
+		Where("id = ? AND status = ?", record.ID, "active").
+		Updates(updates).Error; err != nil {
+		log.Printf("[DNSSyncWorker] Error marking record %d as verified: %v\n", record.ID, err)
+		return
+	}
+
+	propagation := time.Duration(0)
+	if record.SyncedAt != nil {
+		propagation = now.Sub(*record.SyncedAt)
+	}
+	log.Printf("[DNSSyncWorker] Record %d verified on %d nameservers (propagation=%s, attempts=%d, query=%s)\n",
+		record.ID, len(result.Nameservers), propagation.Round(time.Millisecond), record.RetryCount+1,
+		result.Duration.Round(time.Millisecond))
+}
+
+// markUnverified schedules another verification attempt. The record stays
+// active: the provider accepted it, it just is not visible everywhere yet.
+func (w *DNSSyncWorker) markUnverified(record models.DomainDNSRecord, errorMsg string) {
+	retryCount := record.RetryCount + 1
+	nextRetryAt := time.Now().Add(verifyBackoff(retryCount))
+
+	if len(errorMsg) > 255 {
+		errorMsg = errorMsg[:252] + "..."
+	}
+
+	updates := map[string]interface{}{
+		"last_error":    errorMsg,
+		"retry_count":   retryCount,
+		"next_retry_at": nextRetryAt,
+	}
+
+	if err := w.db.Model(&models.DomainDNSRecord{}).
+		Where("id = ? AND status = ?", record.ID, "active").
+		Updates(updates).Error; err != nil {
+		log.Printf("[DNSSyncWorker] Error rescheduling verification of record %d: %v\n", record.ID, err)
+	}
+}
+
+// postponeRecord retries a record after delay without counting a failure
+func (w *DNSSyncWorker) postponeRecord(recordID int, delay time.Duration) {
+	if err := w.db.Model(&models.DomainDNSRecord{}).Where("id = ?", recordID).
+		Update("next_retry_at", time.Now().Add(delay)).Error; err != nil {
+		log.Printf("[DNSSyncWorker] Error postponing record %d: %v\n", recordID, err)
+	}
+}
+
+// deferRecord reschedules a rate-limited record after the provider's
+// Retry-After. Rate limiting is not a failure of the record itself, so the
+// status and retry_count are left unchanged.
+func (w *DNSSyncWorker) deferRecord(recordID int, rateLimitErr *cloudflare.RateLimitError) {
+	updates := map[string]interface{}{
+		"last_error":    rateLimitErr.Error(),
+		"next_retry_at": time.Now().Add(rateLimitErr.RetryAfter),
+		"updated_at":    time.Now(),
+	}
+
+	if err := w.db.Model(&models.DomainDNSRecord{}).Where("id = ?", recordID).Updates(updates).Error; err != nil {
+		log.Printf("[DNSSyncWorker] Error deferring record %d: %v\n", recordID, err)
+	}
+}
+
+// retryBackoff returns the delay before the given sync retry
+func retryBackoff(retryCount int) time.Duration {
+	return jitteredBackoff(retryBaseDelay, retryMaxDelay, retryCount)
+}
+
+// verifyBackoff returns the delay before the given verification attempt
+func verifyBackoff(attempt int) time.Duration {
+	return jitteredBackoff(verifyBaseDelay, verifyMaxDelay, attempt)
+}
+
+// jitteredBackoff is exponential in the attempt count (base * 2^(attempt-1)),
+// capped at max, with "equal jitter" (half fixed, half random) so records
+// that failed together do not retry in lockstep
+func jitteredBackoff(base, max time.Duration, attempt int) time.Duration {
+	delay := max
+	if attempt < 1 {
+		attempt = 1
+	}
+	if shift := attempt - 1; shift < 20 {
+		if d := base << shift; d < max {
+			delay = d
+		}
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// DeleteDNSRecordFromProvider deletes a DNS record at the zone's provider
+// This is used when deleting a record from the database. A record without a
+// provider_record_id whose create timed out is looked up at providers that
+// support it, since the create may have reached the provider.
 func (w *DNSSyncWorker) DeleteDNSRecordFromProvider(record models.DomainDNSRecord) error {
-	// If no provider_record_id, nothing to delete
-	if record.ProviderRecordID == nil || *record.ProviderRecordID == "" {
-		return nil
+	recordID := ""
+	if record.ProviderRecordID != nil {
+		recordID = *record.ProviderRecordID
 	}
 
 	// Get DNS provider
@@ -232,25 +712,60 @@ func (w *DNSSyncWorker) DeleteDNSRecordFromProvider(record models.DomainDNSRecor
 	if err := w.db.Where("domain_id = ?", record.DomainID).First(&provider).Error; err != nil {
 		return fmt.Errorf("DNS provider not found: %w", err)
 	}
+	if provider.Provider == service.BuiltinDNSProvider {
+		return nil
+	}
 
-	// Get API key
-	var apiKey models.APIKey
-	if err := w.db.First(&apiKey, provider.APIKeyID).Error; err != nil {
-		return fmt.Errorf("API key not found: %w", err)
+	var domain models.Domain
+	if err := w.db.First(&domain, record.DomainID).Error; err != nil {
+		return fmt.Errorf("domain not found: %w", err)
 	}
 
-	// Check API key status
-	if apiKey.Status != "active" {
-		return fmt.Errorf("API key is inactive")
+	client, apiKeyID, err := w.providerClient(provider)
+	if err != nil {
+		return err
 	}
 
-	// Initialize Cloudflare client
-	client := w.cloudflareClient.WithToken(apiKey.APIToken)
+	providerRecord, err := w.buildProviderRecord(record, domain, provider)
+	if err != nil {
+		return err
+	}
+
+	release := w.acquireAPIKey(apiKeyID)
+	defer release()
 
-	// Delete record from Cloudflare
-	if err := client.DeleteDNSRecord(provider.ProviderZoneID, *record.ProviderRecordID); err != nil {
-		return fmt.Errorf("failed to delete from Cloudflare: %w", err)
+	// Record set providers rewrite the whole set and need no ID
+	if recordID == "" && !dnsprovider.UsesRecordSets(provider.Provider) {
+		finder, ok := client.(dnsprovider.RecordFinder)
+		if !ok || !record.CreateTimedOut {
+			return nil
+		}
+		// A live row with the same content owns whatever the lookup finds
+		if shared, err := w.hasLiveDuplicate(record); err != nil || shared {
+			return err
+		}
+		if recordID, err = finder.FindRecord(provider.ProviderZoneID, providerRecord); err != nil {
+			return err
+		}
+		if recordID == "" {
+			return nil
+		}
+		log.Printf("[DNSSyncWorker] Found record ID=%d at the provider without provider_record_id: %s\n", record.ID, recordID)
 	}
 
-	return nil
+	// Delete record at the provider
+	return client.DeleteRecord(provider.ProviderZoneID, recordID, providerRecord)
+}
+
+// hasLiveDuplicate reports whether another row not being deleted has the
+// record's type, name and value in its zone
+func (w *DNSSyncWorker) hasLiveDuplicate(record models.DomainDNSRecord) (bool, error) {
+	var count int64
+	if err := w.db.Model(&models.DomainDNSRecord{}).
+		Where("domain_id = ? AND type = ? AND name = ? AND value = ? AND line = ? AND id <> ? AND status <> ?",
+			record.DomainID, record.Type, record.Name, record.Value, record.Line, record.ID, "deleting").
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check for duplicate records: %w", err)
+	}
+	return count > 0, nil
 }
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/service"
+)
+
+// DNSSECWorker runs the scheduled DNSSEC steps: provider status refreshes,
+// DS checks at the parent zone, key rollovers and re-signing of builtin zones
+type DNSSECWorker struct {
+	dnssecService *service.DNSSECService
+	interval      time.Duration
+}
+
+// NewDNSSECWorker creates a new DNSSEC worker
+func NewDNSSECWorker(dnssecService *service.DNSSECService, interval time.Duration) *DNSSECWorker {
+	return &DNSSECWorker{
+		dnssecService: dnssecService,
+		interval:      interval,
+	}
+}
+
+// Start starts the DNSSEC worker
+func (w *DNSSECWorker) Start(ctx context.Context) {
+	log.Println("[DNSSECWorker] Starting DNSSEC worker...")
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	// Run immediately on start
+	w.run()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[DNSSECWorker] Stopping DNSSEC worker...")
+			return
+		case <-ticker.C:
+			w.run()
+		}
+	}
+}
+
+func (w *DNSSECWorker) run() {
+	if err := w.dnssecService.RunScheduled(); err != nil {
+		log.Printf("[DNSSECWorker] %v\n", err)
+	}
+}
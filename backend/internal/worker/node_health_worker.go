@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/models"
+	"github.com/cdn-control-panel/backend/internal/service"
+)
+
+const (
+	// probeTimeout bounds a single TCP connect or HTTP request
+	probeTimeout = 5 * time.Second
+	// probeConcurrency bounds concurrent probes across all node groups
+	probeConcurrency = 32
+)
+
+// NodeHealthWorker probes the sub IPs of node groups with health checks
+// enabled and hands the results to NodeHealthService, which withdraws and
+// restores their A/AAAA records. Line groups then fail over between their
+// member node groups by the resulting health.
+type NodeHealthWorker struct {
+	healthService    *service.NodeHealthService
+	lineGroupService *service.LineGroupService
+	interval         time.Duration
+	httpClient       *http.Client
+}
+
+// NewNodeHealthWorker creates a new node health worker
+func NewNodeHealthWorker(healthService *service.NodeHealthService, lineGroupService *service.LineGroupService, interval time.Duration) *NodeHealthWorker {
+	return &NodeHealthWorker{
+		healthService:    healthService,
+		lineGroupService: lineGroupService,
+		interval:         interval,
+		httpClient: &http.Client{
+			Timeout: probeTimeout,
+			// Probes go to bare IPs, certificates cannot match
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Start starts the node health worker
+func (w *NodeHealthWorker) Start(ctx context.Context) {
+	log.Println("[NodeHealthWorker] Starting node health worker...")
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[NodeHealthWorker] Stopping node health worker...")
+			return
+		case <-ticker.C:
+			w.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll probes every health-checked node group once, then reevaluates
+// line group failover
+func (w *NodeHealthWorker) checkAll(ctx context.Context) {
+	groups, err := w.healthService.ListCheckedGroups()
+	if err != nil {
+		log.Printf("[NodeHealthWorker] Failed to list node groups: %v\n", err)
+		return
+	}
+
+	slots := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i := range groups {
+		wg.Add(1)
+		go func(group *models.NodeGroup) {
+			defer wg.Done()
+			w.checkGroup(ctx, group, slots)
+		}(&groups[i])
+	}
+	wg.Wait()
+
+	if err := w.lineGroupService.EvaluateFailovers(); err != nil {
+		log.Printf("[NodeHealthWorker] Line group failover: %v\n", err)
+	}
+}
+
+// checkGroup probes all members of a group and applies the results
+func (w *NodeHealthWorker) checkGroup(ctx context.Context, group *models.NodeGroup, slots chan struct{}) {
+	members, err := w.healthService.ListMembers(group.ID)
+	if err != nil {
+		log.Printf("[NodeHealthWorker] Node group %d: %v\n", group.ID, err)
+		return
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []service.ProbeResult
+	)
+	for _, m := range members {
+		// Disabled sub IPs have no records to withdraw or restore
+		if m.SubIP == nil || !m.SubIP.Enabled {
+			continue
+		}
+
+		wg.Add(1)
+		go func(subIP *models.NodeSubIP) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			result := service.ProbeResult{SubIPID: subIP.ID, Healthy: true}
+			if err := w.probe(ctx, group, subIP); err != nil {
+				result.Healthy = false
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(m.SubIP)
+	}
+	wg.Wait()
+
+	if len(results) == 0 {
+		return
+	}
+
+	if err := w.healthService.ApplyProbeResults(group.ID, results); err != nil {
+		log.Printf("[NodeHealthWorker] Node group %d: failed to apply results: %v\n", group.ID, err)
+	}
+}
+
+// probe checks one sub IP. TCP checks only connect; HTTP(S) checks need a
+// response below 500, since edges may answer bare-IP requests with 4xx.
+func (w *NodeHealthWorker) probe(ctx context.Context, group *models.NodeGroup, subIP *models.NodeSubIP) error {
+	addr := net.JoinHostPort(subIP.IP, strconv.Itoa(probePort(group, subIP)))
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	switch group.HealthCheckType {
+	case service.HealthCheckTCP:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case service.HealthCheckHTTP, service.HealthCheckHTTPS:
+		url := fmt.Sprintf("%s://%s%s", group.HealthCheckType, addr, group.HealthCheckPath)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := w.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported health check type %q", group.HealthCheckType)
+}
+
+// probePort returns the configured port, defaulting to the node agent port
+// (443 for https)
+func probePort(group *models.NodeGroup, subIP *models.NodeSubIP) int {
+	if group.HealthCheckPort > 0 {
+		return group.HealthCheckPort
+	}
+	if group.HealthCheckType == service.HealthCheckHTTPS {
+		return 443
+	}
+	if subIP.Node != nil && subIP.Node.AgentPort > 0 {
+		return subIP.Node.AgentPort
+	}
+	return 8080
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cdn-control-panel/backend/internal/service"
+)
+
+// OCSPWorker keeps the OCSP responses of certificates in use current,
+// refreshing them ahead of their next update
+type OCSPWorker struct {
+	ocspService *service.OCSPService
+	interval    time.Duration
+}
+
+// NewOCSPWorker creates a new OCSP worker
+func NewOCSPWorker(ocspService *service.OCSPService, interval time.Duration) *OCSPWorker {
+	return &OCSPWorker{
+		ocspService: ocspService,
+		interval:    interval,
+	}
+}
+
+// Start starts the OCSP worker
+func (w *OCSPWorker) Start(ctx context.Context) {
+	log.Println("[OCSPWorker] Starting OCSP worker...")
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	// Run immediately on start
+	w.run(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[OCSPWorker] Stopping OCSP worker...")
+			return
+		case <-ticker.C:
+			w.run(ctx)
+		}
+	}
+}
+
+func (w *OCSPWorker) run(ctx context.Context) {
+	if err := w.ocspService.RefreshDue(ctx); err != nil {
+		log.Printf("[OCSPWorker] %v\n", err)
+	}
+}
@@ -0,0 +1,71 @@
+package certchain
+
+import (
+	"crypto/x509"
+	_ "embed"
+	"sync"
+)
+
+// intermediates.pem is generated by scripts/update_intermediates.sh, make build
+// and the Docker build run it when the committed placeholder is empty
+//
+//go:embed intermediates.pem
+var bundlePEM string
+
+// maxCompletion bounds how many intermediates are appended to one chain
+const maxCompletion = 4
+
+var (
+	bundleOnce    sync.Once
+	bundleSubject map[string][]*x509.Certificate
+)
+
+// bundle indexes the embedded intermediates by raw subject
+func bundle() map[string][]*x509.Certificate {
+	bundleOnce.Do(func() {
+		bundleSubject = make(map[string][]*x509.Certificate)
+		certs, err := ParseCertificates(bundlePEM)
+		if err != nil {
+			return
+		}
+		for _, cert := range certs {
+			key := string(cert.RawSubject)
+			bundleSubject[key] = append(bundleSubject[key], cert)
+		}
+	})
+	return bundleSubject
+}
+
+// BundleSize returns the number of intermediates in the embedded bundle
+func BundleSize() int {
+	n := 0
+	for _, certs := range bundle() {
+		n += len(certs)
+	}
+	return n
+}
+
+// completeFromBundle returns the issuers of last found in the bundle, in
+// issuing order, stopping at a certificate the bundle has no issuer for
+func completeFromBundle(last *x509.Certificate) []*x509.Certificate {
+	var added []*x509.Certificate
+	current := last
+	for len(added) < maxCompletion && !isSelfSigned(current) {
+		var issuer *x509.Certificate
+		for _, cand := range bundle()[string(current.RawIssuer)] {
+			if isSelfSigned(cand) {
+				continue
+			}
+			if issuedBy(current, cand) {
+				issuer = cand
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		added = append(added, issuer)
+		current = issuer
+	}
+	return added
+}
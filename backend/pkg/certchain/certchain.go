@@ -0,0 +1,274 @@
+// Package certchain validates uploaded certificate chains: the private key
+// must match the leaf, the chain is put in issuing order and intermediates
+// the server would fail to send can be completed from an embedded bundle
+package certchain
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoCertificate        = errors.New("no certificate found in PEM")
+	ErrInvalidCertificate   = errors.New("invalid certificate PEM format")
+	ErrInvalidPrivateKey    = errors.New("invalid private key PEM format")
+	ErrKeyMismatch          = errors.New("private key does not match any certificate in the chain")
+	ErrExpired              = errors.New("certificate has expired")
+	ErrNotYetValid          = errors.New("certificate is not yet valid")
+	ErrUnrelatedCertificate = errors.New("chain contains a certificate that is not an issuer of the leaf")
+)
+
+// Options controls Validate
+type Options struct {
+	// CompleteChain appends missing intermediates found in the embedded bundle
+	CompleteChain bool
+	// Roots used to decide whether the chain is complete, nil for the system pool
+	Roots *x509.CertPool
+	// Now overrides the current time (zero for time.Now)
+	Now time.Time
+}
+
+// Result is a validated chain
+type Result struct {
+	Leaf *x509.Certificate
+	// Chain holds the leaf followed by its intermediates in issuing order,
+	// roots are never included
+	Chain []*x509.Certificate
+	// ChainPEM is Chain encoded as PEM, ready to be served
+	ChainPEM string
+	// Reordered is set when the uploaded chain was not in issuing order
+	Reordered bool
+	// Completed counts the intermediates added from the bundle
+	Completed int
+	// Trusted is set when the chain verifies to a root in Options.Roots
+	Trusted  bool
+	Warnings []string
+}
+
+// Validate parses certPEM (leaf and intermediates in any order) and keyPEM,
+// checks that the key belongs to the leaf and that the leaf is currently
+// valid, and returns the chain in issuing order. A chain that does not reach
+// a trusted root is not an error (private CAs are allowed), it is reported in
+// Result.Warnings
+func Validate(certPEM, keyPEM string, opts Options) (*Result, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	certs, err := ParseCertificates(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// The leaf is the certificate the key belongs to, wherever it was placed
+	leafIndex := -1
+	for i, cert := range certs {
+		if publicKeyEqual(cert.PublicKey, key.Public()) {
+			leafIndex = i
+			break
+		}
+	}
+	if leafIndex < 0 {
+		return nil, ErrKeyMismatch
+	}
+	leaf := certs[leafIndex]
+
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("%w (not after %s)", ErrExpired, leaf.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("%w (not before %s)", ErrNotYetValid, leaf.NotBefore.Format(time.RFC3339))
+	}
+
+	result := &Result{Leaf: leaf, Chain: []*x509.Certificate{leaf}, Warnings: []string{}}
+
+	rest := make([]*x509.Certificate, 0, len(certs)-1)
+	rest = append(rest, certs[:leafIndex]...)
+	rest = append(rest, certs[leafIndex+1:]...)
+
+	// Follow the issuers from the leaf upwards
+	current := leaf
+	for len(rest) > 0 && !isSelfSigned(current) {
+		next := -1
+		for i, cand := range rest {
+			if issuedBy(current, cand) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		current = rest[next]
+		rest = append(rest[:next], rest[next+1:]...)
+		if isSelfSigned(current) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("root certificate %q removed from the chain", current.Subject.CommonName))
+			continue
+		}
+		result.Chain = append(result.Chain, current)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnrelatedCertificate, rest[0].Subject.CommonName)
+	}
+
+	for i, cert := range result.Chain {
+		if cert != certs[i] {
+			result.Reordered = true
+			break
+		}
+	}
+	if result.Reordered {
+		result.Warnings = append(result.Warnings, "certificate chain was reordered (leaf first, then issuers)")
+	}
+
+	for _, cert := range result.Chain[1:] {
+		if now.After(cert.NotAfter) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("intermediate %q expired at %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339)))
+		}
+	}
+
+	result.Trusted = verify(result.Chain, opts.Roots, now)
+	if !result.Trusted && opts.CompleteChain {
+		if BundleSize() == 0 {
+			result.Warnings = append(result.Warnings, "complete_chain has no effect: the intermediate bundle is empty (regenerate it with scripts/update_intermediates.sh)")
+		}
+		for _, cert := range completeFromBundle(result.Chain[len(result.Chain)-1]) {
+			result.Chain = append(result.Chain, cert)
+			result.Completed++
+		}
+		if result.Completed > 0 {
+			result.Trusted = verify(result.Chain, opts.Roots, now)
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%d intermediate certificate(s) added from the bundle", result.Completed))
+		}
+	}
+	if !result.Trusted {
+		last := result.Chain[len(result.Chain)-1]
+		msg := fmt.Sprintf("chain does not verify to a trusted root, possibly missing the intermediate %q", last.Issuer.CommonName)
+		if !opts.CompleteChain {
+			msg += " (set complete_chain to fill it from the intermediate bundle)"
+		}
+		result.Warnings = append(result.Warnings, msg)
+	}
+
+	result.ChainPEM = EncodeCertificates(result.Chain)
+
+	return result, nil
+}
+
+// ParseCertificates decodes every CERTIFICATE block in data, in order
+func ParseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		if strings.TrimSpace(data) == "" {
+			return nil, ErrNoCertificate
+		}
+		return nil, ErrInvalidCertificate
+	}
+	return certs, nil
+}
+
+// ParsePrivateKey decodes an unencrypted PKCS#1, SEC 1 or PKCS#8 private key
+func ParsePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+	case "EC PRIVATE KEY":
+		if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+	case "PRIVATE KEY":
+		if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			if signer, ok := key.(crypto.Signer); ok {
+				return signer, nil
+			}
+		}
+	}
+	return nil, ErrInvalidPrivateKey
+}
+
+// EncodeCertificates encodes certs as concatenated PEM blocks
+func EncodeCertificates(certs []*x509.Certificate) string {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.String()
+}
+
+// publicKeyEqual reports whether two public keys are the same key
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	switch k := a.(type) {
+	case *rsa.PublicKey:
+		return k.Equal(b)
+	case *ecdsa.PublicKey:
+		return k.Equal(b)
+	case ed25519.PublicKey:
+		return k.Equal(b)
+	}
+	return false
+}
+
+// issuedBy reports whether cert was signed by issuer
+func issuedBy(cert, issuer *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	return cert.CheckSignatureFrom(issuer) == nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// verify reports whether chain (leaf first) verifies to one of roots
+func verify(chain []*x509.Certificate, roots *x509.CertPool, now time.Time) bool {
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err == nil
+}
@@ -0,0 +1,278 @@
+package certchain
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// issue creates a certificate for cn signed by parent, or self-signed when
+// parent is nil. CAs get the validity of notBefore..notAfter as well.
+func issue(t *testing.T, cn string, ca bool, parent *testCert, notBefore, notAfter time.Time) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+	if ca {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{cn}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	signer, issuerCert := crypto.Signer(key), template
+	if parent != nil {
+		signer, issuerCert = parent.key, parent.cert
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuerCert, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// hierarchy is a root, an intermediate and a leaf valid at testNow
+func hierarchy(t *testing.T) (root, intermediate, leaf *testCert) {
+	t.Helper()
+
+	start, end := testNow.AddDate(-1, 0, 0), testNow.AddDate(1, 0, 0)
+	root = issue(t, "Test Root", true, nil, start, end.AddDate(5, 0, 0))
+	intermediate = issue(t, "Test Intermediate", true, root, start, end.AddDate(1, 0, 0))
+	leaf = issue(t, "www.example.com", false, intermediate, start, end)
+	return root, intermediate, leaf
+}
+
+func keyPEM(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func chainPEM(certs ...*testCert) string {
+	list := make([]*x509.Certificate, len(certs))
+	for i, c := range certs {
+		list[i] = c.cert
+	}
+	return EncodeCertificates(list)
+}
+
+func rootPool(root *testCert) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(root.cert)
+	return pool
+}
+
+// setBundle replaces the embedded intermediates for one test
+func setBundle(t *testing.T, certs ...*testCert) {
+	saved := bundlePEM
+	bundlePEM = chainPEM(certs...)
+	bundleOnce = sync.Once{}
+	t.Cleanup(func() {
+		bundlePEM = saved
+		bundleOnce = sync.Once{}
+	})
+}
+
+func hasWarning(result *Result, substr string) bool {
+	for _, w := range result.Warnings {
+		if strings.Contains(w, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateInOrder(t *testing.T) {
+	root, intermediate, leaf := hierarchy(t)
+
+	result, err := Validate(chainPEM(leaf, intermediate), keyPEM(t, leaf.key), Options{Roots: rootPool(root), Now: testNow})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !result.Trusted || result.Reordered || result.Completed != 0 {
+		t.Errorf("trusted=%v reordered=%v completed=%d", result.Trusted, result.Reordered, result.Completed)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("unexpected warnings %q", result.Warnings)
+	}
+	if result.ChainPEM != chainPEM(leaf, intermediate) {
+		t.Error("chain PEM differs from the uploaded chain")
+	}
+}
+
+func TestValidateKeyMismatch(t *testing.T) {
+	_, intermediate, leaf := hierarchy(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Validate(chainPEM(leaf, intermediate), keyPEM(t, other), Options{Now: testNow})
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected ErrKeyMismatch, got %v", err)
+	}
+
+	// The key of an intermediate makes it the leaf, which leaves the real
+	// leaf unrelated to the chain
+	_, err = Validate(chainPEM(leaf, intermediate), keyPEM(t, intermediate.key), Options{Now: testNow})
+	if !errors.Is(err, ErrUnrelatedCertificate) {
+		t.Fatalf("expected ErrUnrelatedCertificate, got %v", err)
+	}
+}
+
+func TestValidateReorders(t *testing.T) {
+	root, intermediate, leaf := hierarchy(t)
+
+	result, err := Validate(chainPEM(root, intermediate, leaf), keyPEM(t, leaf.key), Options{Roots: rootPool(root), Now: testNow})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !result.Reordered || !hasWarning(result, "reordered") {
+		t.Errorf("expected the chain to be reported reordered, warnings %q", result.Warnings)
+	}
+	if !hasWarning(result, `root certificate "Test Root" removed`) {
+		t.Errorf("expected the root to be removed, warnings %q", result.Warnings)
+	}
+	if !result.Leaf.Equal(leaf.cert) || len(result.Chain) != 2 || !result.Chain[1].Equal(intermediate.cert) {
+		t.Fatalf("unexpected chain of %d certificates", len(result.Chain))
+	}
+	if result.ChainPEM != chainPEM(leaf, intermediate) {
+		t.Error("chain PEM is not leaf then intermediate")
+	}
+	if !result.Trusted {
+		t.Error("expected the reordered chain to verify")
+	}
+}
+
+func TestValidateUnrelatedCertificate(t *testing.T) {
+	_, intermediate, leaf := hierarchy(t)
+	_, otherIntermediate, _ := hierarchy(t)
+
+	_, err := Validate(chainPEM(leaf, intermediate, otherIntermediate), keyPEM(t, leaf.key), Options{Now: testNow})
+	if !errors.Is(err, ErrUnrelatedCertificate) {
+		t.Fatalf("expected ErrUnrelatedCertificate, got %v", err)
+	}
+}
+
+func TestValidateExpiry(t *testing.T) {
+	root, intermediate, leaf := hierarchy(t)
+	key := keyPEM(t, leaf.key)
+
+	_, err := Validate(chainPEM(leaf, intermediate), key, Options{Now: leaf.cert.NotAfter.Add(time.Second)})
+	if !errors.Is(err, ErrExpired) {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+	_, err = Validate(chainPEM(leaf, intermediate), key, Options{Now: leaf.cert.NotBefore.Add(-time.Second)})
+	if !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("expected ErrNotYetValid, got %v", err)
+	}
+
+	// An expired intermediate is only a warning, the leaf is still valid
+	expired := issue(t, "Expired Intermediate", true, root, testNow.AddDate(-2, 0, 0), testNow.AddDate(0, 0, -1))
+	expiredLeaf := issue(t, "old.example.com", false, expired, testNow.AddDate(-1, 0, 0), testNow.AddDate(1, 0, 0))
+	result, err := Validate(chainPEM(expiredLeaf, expired), keyPEM(t, expiredLeaf.key), Options{Roots: rootPool(root), Now: testNow})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !hasWarning(result, `intermediate "Expired Intermediate" expired`) {
+		t.Errorf("expected an expired intermediate warning, got %q", result.Warnings)
+	}
+	if result.Trusted {
+		t.Error("a chain through an expired intermediate must not verify")
+	}
+}
+
+func TestValidateCompletesFromBundle(t *testing.T) {
+	root, intermediate, leaf := hierarchy(t)
+	_, unrelated, _ := hierarchy(t)
+	setBundle(t, unrelated, root, intermediate)
+	if got := BundleSize(); got != 3 {
+		t.Fatalf("BundleSize() = %d, want 3", got)
+	}
+
+	key := keyPEM(t, leaf.key)
+	opts := Options{Roots: rootPool(root), Now: testNow}
+
+	result, err := Validate(chainPEM(leaf), key, opts)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if result.Trusted || result.Completed != 0 {
+		t.Errorf("completed without complete_chain: trusted=%v completed=%d", result.Trusted, result.Completed)
+	}
+	if !hasWarning(result, `missing the intermediate "Test Intermediate" (set complete_chain`) {
+		t.Errorf("expected a missing intermediate warning, got %q", result.Warnings)
+	}
+
+	opts.CompleteChain = true
+	result, err = Validate(chainPEM(leaf), key, opts)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if result.Completed != 1 || !result.Trusted {
+		t.Fatalf("trusted=%v completed=%d, warnings %q", result.Trusted, result.Completed, result.Warnings)
+	}
+	if result.ChainPEM != chainPEM(leaf, intermediate) {
+		t.Error("the bundle root was added or the intermediate is missing")
+	}
+	if !hasWarning(result, "1 intermediate certificate(s) added") {
+		t.Errorf("expected a completion warning, got %q", result.Warnings)
+	}
+}
+
+func TestValidateEmptyBundle(t *testing.T) {
+	root, _, leaf := hierarchy(t)
+	setBundle(t)
+
+	result, err := Validate(chainPEM(leaf), keyPEM(t, leaf.key), Options{CompleteChain: true, Roots: rootPool(root), Now: testNow})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if result.Completed != 0 || result.Trusted {
+		t.Errorf("trusted=%v completed=%d", result.Trusted, result.Completed)
+	}
+	if !hasWarning(result, "intermediate bundle is empty") {
+		t.Errorf("expected the empty bundle to be reported, got %q", result.Warnings)
+	}
+}
@@ -6,11 +6,16 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
 const (
 	BaseURL = "https://api.cloudflare.com/client/v4"
+
+	// listPageSize is the page size of list requests
+	listPageSize = 100
 )
 
 // Client represents a Cloudflare API client
@@ -18,24 +23,40 @@ type Client struct {
 	baseURL    string
 	token      string
 	httpClient *http.Client
+	limiter    *rateLimiter
 }
 
 // CloudflareResponse represents the standard Cloudflare API response
 type CloudflareResponse struct {
-	Success  bool                     `json:"success"`
-	Errors   []map[string]interface{} `json:"errors"`
-	Messages []string                 `json:"messages"`
-	Result   interface{}              `json:"result"`
+	Success    bool                     `json:"success"`
+	Errors     []map[string]interface{} `json:"errors"`
+	Messages   []string                 `json:"messages"`
+	Result     interface{}              `json:"result"`
+	ResultInfo *ResultInfo              `json:"result_info,omitempty"`
+	StatusCode int                      `json:"-"`
+}
+
+// ResultInfo is the pagination of list responses
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
 }
 
 // DNSRecord represents a Cloudflare DNS record
+// Priority is used by MX; Data carries the structured fields of SRV
+// (priority, weight, port, target) and CAA (flags, tag, value) records.
 type DNSRecord struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
-	TTL     int    `json:"ttl"`
-	Proxied bool   `json:"proxied"`
+	ID       string                 `json:"id,omitempty"`
+	Type     string                 `json:"type"`
+	Name     string                 `json:"name"`
+	Content  string                 `json:"content,omitempty"`
+	TTL      int                    `json:"ttl"`
+	Proxied  bool                   `json:"proxied"`
+	Priority *int                   `json:"priority,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
 }
 
 // NewClient creates a new Cloudflare API client
@@ -45,6 +66,7 @@ func NewClient() *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		limiter: newRateLimiter(),
 	}
 }
 
@@ -54,22 +76,16 @@ func (c *Client) WithToken(token string) *Client {
 		baseURL:    c.baseURL,
 		token:      token,
 		httpClient: c.httpClient,
+		limiter:    c.limiter,
 	}
 }
 
 // CreateDNSRecord creates a new DNS record in Cloudflare
-func (c *Client) CreateDNSRecord(zoneID, recordType, name, content string, ttl int, proxied bool) (string, error) {
+func (c *Client) CreateDNSRecord(zoneID string, record DNSRecord) (string, error) {
 	url := fmt.Sprintf("%s/zones/%s/dns_records", c.baseURL, zoneID)
 
-	payload := map[string]interface{}{
-		"type":    recordType,
-		"name":    name,
-		"content": content,
-		"ttl":     ttl,
-		"proxied": proxied,
-	}
-
-	resp, err := c.post(url, payload)
+	record.ID = ""
+	resp, err := c.post(url, record)
 	if err != nil {
 		return "", err
 	}
@@ -93,18 +109,11 @@ func (c *Client) CreateDNSRecord(zoneID, recordType, name, content string, ttl i
 }
 
 // UpdateDNSRecord updates an existing DNS record in Cloudflare
-func (c *Client) UpdateDNSRecord(zoneID, recordID, recordType, name, content string, ttl int, proxied bool) (string, error) {
+func (c *Client) UpdateDNSRecord(zoneID, recordID string, record DNSRecord) (string, error) {
 	url := fmt.Sprintf("%s/zones/%s/dns_records/%s", c.baseURL, zoneID, recordID)
 
-	payload := map[string]interface{}{
-		"type":    recordType,
-		"name":    name,
-		"content": content,
-		"ttl":     ttl,
-		"proxied": proxied,
-	}
-
-	resp, err := c.put(url, payload)
+	record.ID = ""
+	resp, err := c.put(url, record)
 	if err != nil {
 		return "", err
 	}
@@ -125,6 +134,11 @@ func (c *Client) DeleteDNSRecord(zoneID, recordID string) error {
 		return err
 	}
 
+	// Record already gone at Cloudflare: treat as deleted
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
 	if !resp.Success {
 		return fmt.Errorf("cloudflare API error: %v", resp.Errors)
 	}
@@ -161,29 +175,104 @@ func (c *Client) GetDNSRecord(zoneID, recordID string) (*DNSRecord, error) {
 
 // ListDNSRecords lists all DNS records for a zone
 func (c *Client) ListDNSRecords(zoneID string) ([]DNSRecord, error) {
-	url := fmt.Sprintf("%s/zones/%s/dns_records", c.baseURL, zoneID)
+	return c.listDNSRecords(zoneID, url.Values{})
+}
+
+// FindDNSRecords lists the records of a zone with the given type and name,
+// filtered by Cloudflare
+func (c *Client) FindDNSRecords(zoneID, recordType, name string) ([]DNSRecord, error) {
+	return c.listDNSRecords(zoneID, url.Values{"type": {recordType}, "name": {name}})
+}
+
+// listDNSRecords reads all pages of the zone's records matching filter
+func (c *Client) listDNSRecords(zoneID string, filter url.Values) ([]DNSRecord, error) {
+	filter.Set("per_page", strconv.Itoa(listPageSize))
+
+	var records []DNSRecord
+	for page := 1; ; page++ {
+		filter.Set("page", strconv.Itoa(page))
+		endpoint := fmt.Sprintf("%s/zones/%s/dns_records?%s", c.baseURL, zoneID, filter.Encode())
+
+		resp, err := c.get(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		if !resp.Success {
+			return nil, fmt.Errorf("cloudflare API error: %v", resp.Errors)
+		}
+
+		// Parse result
+		resultBytes, err := json.Marshal(resp.Result)
+		if err != nil {
+			return nil, err
+		}
+
+		var pageRecords []DNSRecord
+		if err := json.Unmarshal(resultBytes, &pageRecords); err != nil {
+			return nil, err
+		}
+		records = append(records, pageRecords...)
+
+		if resp.ResultInfo == nil || page >= resp.ResultInfo.TotalPages || len(pageRecords) == 0 {
+			return records, nil
+		}
+	}
+}
+
+// DNSSEC represents the DNSSEC settings of a Cloudflare zone. Status is one
+// of active, pending, disabled, pending-disabled or error; DS is the DS
+// record to add at the registrar.
+type DNSSEC struct {
+	Status     string `json:"status"`
+	DS         string `json:"ds"`
+	KeyTag     int    `json:"key_tag"`
+	Algorithm  string `json:"algorithm"`
+	Digest     string `json:"digest"`
+	DigestType string `json:"digest_type"`
+	PublicKey  string `json:"public_key"`
+}
+
+// GetDNSSEC retrieves the DNSSEC settings of a zone
+func (c *Client) GetDNSSEC(zoneID string) (*DNSSEC, error) {
+	url := fmt.Sprintf("%s/zones/%s/dnssec", c.baseURL, zoneID)
 
 	resp, err := c.get(url)
 	if err != nil {
 		return nil, err
 	}
 
+	return parseDNSSEC(resp)
+}
+
+// UpdateDNSSEC sets the DNSSEC status of a zone ("active" or "disabled")
+func (c *Client) UpdateDNSSEC(zoneID, status string) (*DNSSEC, error) {
+	url := fmt.Sprintf("%s/zones/%s/dnssec", c.baseURL, zoneID)
+
+	resp, err := c.patch(url, map[string]string{"status": status})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDNSSEC(resp)
+}
+
+func parseDNSSEC(resp *CloudflareResponse) (*DNSSEC, error) {
 	if !resp.Success {
 		return nil, fmt.Errorf("cloudflare API error: %v", resp.Errors)
 	}
 
-	// Parse result
 	resultBytes, err := json.Marshal(resp.Result)
 	if err != nil {
 		return nil, err
 	}
 
-	var records []DNSRecord
-	if err := json.Unmarshal(resultBytes, &records); err != nil {
+	var dnssec DNSSEC
+	if err := json.Unmarshal(resultBytes, &dnssec); err != nil {
 		return nil, err
 	}
 
-	return records, nil
+	return &dnssec, nil
 }
 
 // HTTP helper methods
@@ -227,6 +316,21 @@ func (c *Client) put(url string, payload interface{}) (*CloudflareResponse, erro
 	return c.doRequest(req)
 }
 
+func (c *Client) patch(url string, payload interface{}) (*CloudflareResponse, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return c.doRequest(req)
+}
+
 func (c *Client) delete(url string) (*CloudflareResponse, error) {
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
@@ -240,24 +344,49 @@ func (c *Client) doRequest(req *http.Request) (*CloudflareResponse, error) {
 	// Add authorization header
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
 
-	// Execute request
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+	for attempt := 0; ; attempt++ {
+		// Hold back while the token is rate limited
+		if err := c.limiter.wait(c.token); err != nil {
+			return nil, err
+		}
+
+		// Rewind the body when retrying
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		// Execute request
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		// Read response body
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		// Honour Retry-After / Ratelimit headers (429 Too Many Requests)
+		if retryAfter := c.limiter.observe(c.token, resp); retryAfter > 0 {
+			if attempt < maxRateLimitRetries && retryAfter <= MaxRateLimitWait {
+				continue
+			}
+			return nil, &RateLimitError{RetryAfter: retryAfter}
+		}
+
+		// Parse response
+		var cfResp CloudflareResponse
+		if err := json.Unmarshal(body, &cfResp); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w, body: %s", err, string(body))
+		}
+		cfResp.StatusCode = resp.StatusCode
+
+		return &cfResp, nil
 	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse response
-	var cfResp CloudflareResponse
-	if err := json.Unmarshal(body, &cfResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w, body: %s", err, string(body))
-	}
-
-	return &cfResp, nil
 }
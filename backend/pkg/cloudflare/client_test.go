@@ -0,0 +1,77 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newTestClient returns a client of a server answering record lists of
+// pages pages of one record each, and the queries it received
+func newTestClient(t *testing.T, pages int) (*Client, *[]map[string]string) {
+	t.Helper()
+
+	var queries []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones/zone-1/dns_records" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		query := make(map[string]string)
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+		queries = append(queries, query)
+
+		page, _ := strconv.Atoi(query["page"])
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result": []DNSRecord{{
+				ID:      "record-" + query["page"],
+				Type:    "A",
+				Name:    "www.example.com",
+				Content: "192.0.2." + query["page"],
+			}},
+			"result_info": ResultInfo{Page: page, PerPage: 1, Count: 1, TotalCount: pages, TotalPages: pages},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient().WithToken("token")
+	client.baseURL = server.URL
+	return client, &queries
+}
+
+func TestListDNSRecordsPaginates(t *testing.T) {
+	client, queries := newTestClient(t, 3)
+
+	records, err := client.ListDNSRecords("zone-1")
+	if err != nil {
+		t.Fatalf("ListDNSRecords: %v", err)
+	}
+	if len(records) != 3 || records[0].ID != "record-1" || records[2].ID != "record-3" {
+		t.Fatalf("got %+v, want the records of all 3 pages", records)
+	}
+	for i, query := range *queries {
+		if query["page"] != strconv.Itoa(i+1) || query["per_page"] != strconv.Itoa(listPageSize) {
+			t.Errorf("request %d: query %v", i, query)
+		}
+	}
+}
+
+func TestFindDNSRecordsFilters(t *testing.T) {
+	client, queries := newTestClient(t, 1)
+
+	records, err := client.FindDNSRecords("zone-1", "A", "www.example.com")
+	if err != nil {
+		t.Fatalf("FindDNSRecords: %v", err)
+	}
+	if len(records) != 1 || len(*queries) != 1 {
+		t.Fatalf("got %d records in %d requests, want 1 in 1", len(records), len(*queries))
+	}
+	if query := (*queries)[0]; query["type"] != "A" || query["name"] != "www.example.com" {
+		t.Errorf("query %v, want the type and name filters", query)
+	}
+}
@@ -0,0 +1,147 @@
+package cloudflare
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxRateLimitWait is the longest doRequest blocks waiting for a rate
+	// limit window to reset. Longer waits fail fast with a RateLimitError so
+	// the caller can reschedule the work instead of holding a worker.
+	MaxRateLimitWait = 30 * time.Second
+
+	// maxRateLimitRetries is how many times a 429 is retried inline
+	maxRateLimitRetries = 2
+
+	// defaultRetryAfter is used when a 429 carries no usable header
+	defaultRetryAfter = 60 * time.Second
+)
+
+// RateLimitError is returned when Cloudflare rejects a request with HTTP 429,
+// or when the token is known to be rate limited for longer than MaxRateLimitWait
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("cloudflare rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// rateLimiter tracks, per API token, until when requests must be held back.
+// It is shared between all clients derived from the same NewClient via WithToken.
+type rateLimiter struct {
+	mu           sync.Mutex
+	limitedUntil map[string]time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limitedUntil: make(map[string]time.Time),
+	}
+}
+
+// wait blocks until the token may send requests again. It returns a
+// RateLimitError without waiting if the remaining time exceeds MaxRateLimitWait.
+func (l *rateLimiter) wait(token string) error {
+	l.mu.Lock()
+	until := l.limitedUntil[token]
+	l.mu.Unlock()
+
+	delay := time.Until(until)
+	if delay <= 0 {
+		return nil
+	}
+	if delay > MaxRateLimitWait {
+		return &RateLimitError{RetryAfter: delay}
+	}
+
+	time.Sleep(delay)
+	return nil
+}
+
+// block holds back requests for the token for the given duration
+func (l *rateLimiter) block(token string, d time.Duration) {
+	until := time.Now().Add(d)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.limitedUntil[token]) {
+		l.limitedUntil[token] = until
+	}
+}
+
+// observe updates the limiter from the rate-limit headers of a response and
+// returns how long to wait before retrying (0 if the response was not a 429)
+func (l *rateLimiter) observe(token string, resp *http.Response) time.Duration {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := parseRetryAfter(resp.Header)
+		if retryAfter <= 0 {
+			retryAfter = defaultRetryAfter
+		}
+		l.block(token, retryAfter)
+		return retryAfter
+	}
+
+	// Quota exhausted but request still served: hold back until the window resets
+	if remaining, reset, ok := parseRateLimit(resp.Header.Get("Ratelimit")); ok && remaining == 0 {
+		l.block(token, reset)
+	}
+
+	return 0
+}
+
+// parseRetryAfter parses the Retry-After header (delay-seconds or HTTP-date),
+// falling back to the reset time of the Ratelimit header
+func parseRetryAfter(h http.Header) time.Duration {
+	if v := strings.TrimSpace(h.Get("Retry-After")); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return time.Until(t)
+		}
+	}
+
+	if _, reset, ok := parseRateLimit(h.Get("Ratelimit")); ok {
+		return reset
+	}
+
+	return 0
+}
+
+// parseRateLimit parses the structured Ratelimit header sent by the
+// Cloudflare API, e.g. `"default";r=50;t=30` (r = remaining, t = seconds to reset)
+func parseRateLimit(v string) (remaining int, reset time.Duration, ok bool) {
+	if v == "" {
+		return 0, 0, false
+	}
+
+	remaining = -1
+	for _, param := range strings.Split(v, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "r":
+			remaining = n
+		case "t":
+			reset = time.Duration(n) * time.Second
+		}
+	}
+
+	if remaining < 0 {
+		return 0, 0, false
+	}
+	return remaining, reset, true
+}
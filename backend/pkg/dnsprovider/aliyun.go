@@ -0,0 +1,205 @@
+package dnsprovider
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	aliyunEndpoint = "https://alidns.aliyuncs.com/"
+	aliyunVersion  = "2015-01-09"
+)
+
+// AliyunClient talks to Alibaba Cloud DNS (RPC API, signature version 1.0).
+// The zone ID is the domain name. Weighted records switch on the load
+// balancing (SLB) of their subdomain and set the record weight.
+type AliyunClient struct {
+	endpoint string
+	creds    Credentials
+}
+
+// NewAliyun creates an Aliyun DNS client
+func NewAliyun(creds Credentials) *AliyunClient {
+	return &AliyunClient{endpoint: aliyunEndpoint, creds: creds}
+}
+
+type aliyunResponse struct {
+	RecordId  string `json:"RecordId"`
+	RequestId string `json:"RequestId"`
+	Code      string `json:"Code"`
+	Message   string `json:"Message"`
+}
+
+func (c *AliyunClient) CreateRecord(zoneID string, record Record) (string, error) {
+	params, err := c.recordParams(record)
+	if err != nil {
+		return "", err
+	}
+	params["DomainName"] = zoneID
+
+	resp, err := c.call("AddDomainRecord", params)
+	if err != nil {
+		return "", err
+	}
+	if err := c.setWeight(zoneID, resp.RecordId, record); err != nil {
+		return resp.RecordId, err
+	}
+	return resp.RecordId, nil
+}
+
+func (c *AliyunClient) UpdateRecord(zoneID, recordID string, record Record) (string, error) {
+	params, err := c.recordParams(record)
+	if err != nil {
+		return "", err
+	}
+	params["RecordId"] = recordID
+
+	_, err = c.call("UpdateDomainRecord", params)
+	// Aliyun rejects updates that change nothing
+	if err != nil && !strings.Contains(err.Error(), "DomainRecordDuplicate") {
+		return "", err
+	}
+	if err := c.setWeight(zoneID, recordID, record); err != nil {
+		return "", err
+	}
+	return recordID, nil
+}
+
+func (c *AliyunClient) DeleteRecord(zoneID, recordID string, record Record) error {
+	_, err := c.call("DeleteDomainRecord", map[string]string{"RecordId": recordID})
+	// Record already gone at Aliyun: treat as deleted
+	if err != nil && (strings.Contains(err.Error(), "DomainRecordNotBelongToUser") || strings.Contains(err.Error(), "NotExist")) {
+		return nil
+	}
+	return err
+}
+
+// setWeight enables load balancing on the subdomain of a weighted record
+// and applies its weight
+func (c *AliyunClient) setWeight(zoneID, recordID string, record Record) error {
+	if !record.Weighted() {
+		return nil
+	}
+	if _, err := c.call("SetDNSSLBStatus", map[string]string{
+		"DomainName": zoneID,
+		"SubDomain":  strings.TrimSuffix(strings.ToLower(record.Name), "."),
+		"Type":       record.Type,
+		"Open":       "true",
+	}); err != nil {
+		return err
+	}
+	_, err := c.call("UpdateDNSSLBWeight", map[string]string{
+		"RecordId": recordID,
+		"Weight":   strconv.Itoa(*record.Weight),
+	})
+	return err
+}
+
+// recordParams builds the parameters shared by AddDomainRecord and UpdateDomainRecord
+func (c *AliyunClient) recordParams(record Record) (map[string]string, error) {
+	if record.Proxied {
+		return nil, ErrProxyNotSupported
+	}
+	line, err := providerLine(aliyunLines, Aliyun, record.View)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{
+		"RR":    relativeName(record),
+		"Type":  record.Type,
+		"Value": rdata(record),
+		"TTL":   strconv.Itoa(record.TTL),
+		"Line":  line,
+	}
+	if record.Type == "MX" {
+		params["Priority"] = strconv.Itoa(intValue(record.Priority))
+	}
+	return params, nil
+}
+
+// call performs a signed RPC request
+func (c *AliyunClient) call(action string, params map[string]string) (*aliyunResponse, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	query.Set("Action", action)
+	query.Set("Format", "JSON")
+	query.Set("Version", aliyunVersion)
+	query.Set("AccessKeyId", c.creds.Account)
+	query.Set("SignatureMethod", "HMAC-SHA1")
+	query.Set("SignatureVersion", "1.0")
+	query.Set("SignatureNonce", hex.EncodeToString(nonce))
+	query.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+
+	canonical := aliyunCanonicalQuery(query)
+	reqURL := c.endpoint + "?" + canonical + "&Signature=" + aliyunEscape(aliyunSignature(c.creds.Secret, canonical))
+	httpResp, err := httpClient.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp aliyunResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("Aliyun DNS API: invalid response (HTTP %d)", httpResp.StatusCode)
+	}
+	if httpResp.StatusCode != http.StatusOK || resp.Code != "" {
+		return nil, fmt.Errorf("Aliyun DNS API error: %s: %s", resp.Code, resp.Message)
+	}
+	return &resp, nil
+}
+
+// aliyunSignature computes the HMAC-SHA1 signature of a GET request with the
+// canonical query
+func aliyunSignature(secret, canonicalQuery string) string {
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte("GET&%2F&" + aliyunEscape(canonicalQuery)))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// aliyunCanonicalQuery sorts and percent-encodes the query parameters
+func aliyunCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, aliyunEscape(k)+"="+aliyunEscape(query.Get(k)))
+	}
+	return strings.Join(parts, "&")
+}
+
+// aliyunEscape percent-encodes per RFC 3986 as the signature requires
+func aliyunEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
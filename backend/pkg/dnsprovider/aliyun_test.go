@@ -0,0 +1,182 @@
+package dnsprovider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestAliyunSignature checks the signer against the example of the Alibaba
+// Cloud RPC signature documentation (DescribeRegions, secret "testsecret")
+func TestAliyunSignature(t *testing.T) {
+	query := url.Values{
+		"Timestamp":        {"2016-02-23T12:46:24Z"},
+		"Format":           {"XML"},
+		"AccessKeyId":      {"testid"},
+		"Action":           {"DescribeRegions"},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureNonce":   {"3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf"},
+		"Version":          {"2014-05-26"},
+		"SignatureVersion": {"1.0"},
+	}
+
+	canonical := aliyunCanonicalQuery(query)
+	wantCanonical := "AccessKeyId=testid&Action=DescribeRegions&Format=XML&SignatureMethod=HMAC-SHA1" +
+		"&SignatureNonce=3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf&SignatureVersion=1.0" +
+		"&Timestamp=2016-02-23T12%3A46%3A24Z&Version=2014-05-26"
+	if canonical != wantCanonical {
+		t.Errorf("canonical query\n got %s\nwant %s", canonical, wantCanonical)
+	}
+	if got, want := aliyunSignature("testsecret", canonical), "OLeaidS1JvxuMvnyHOwuJ+uX5qY="; got != want {
+		t.Errorf("signature %s, want %s", got, want)
+	}
+}
+
+func TestAliyunEscape(t *testing.T) {
+	tests := map[string]string{
+		"a b":      "a%20b",
+		"a*b":      "a%2Ab",
+		"a~b":      "a~b",
+		"a+b":      "a%2Bb",
+		"电信":       "%E7%94%B5%E4%BF%A1",
+		"1 issue;": "1%20issue%3B",
+	}
+	for in, want := range tests {
+		if got := aliyunEscape(in); got != want {
+			t.Errorf("aliyunEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// newAliyunServer returns a client of a server answering every call with
+// body, and the queries it received with valid signatures
+func newAliyunServer(t *testing.T, body string) (*AliyunClient, func() []url.Values) {
+	t.Helper()
+
+	creds := Credentials{Account: "testid", Secret: "testsecret"}
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		signature := query.Get("Signature")
+		query.Del("Signature")
+		if want := aliyunSignature(creds.Secret, aliyunCanonicalQuery(query)); signature != want {
+			t.Errorf("%s: signature %q, want %q", query.Get("Action"), signature, want)
+		}
+		if query.Get("AccessKeyId") != creds.Account || query.Get("SignatureNonce") == "" || query.Get("Timestamp") == "" {
+			t.Errorf("%s: common parameters missing from %v", query.Get("Action"), query)
+		}
+
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewAliyun(creds)
+	client.endpoint = server.URL + "/"
+	return client, func() []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+// actionParams returns the parameters of a call without the common ones
+func actionParams(query url.Values) map[string]string {
+	params := make(map[string]string)
+	for key := range query {
+		switch key {
+		case "Format", "Version", "AccessKeyId", "SignatureMethod", "SignatureVersion", "SignatureNonce", "Timestamp":
+		default:
+			params[key] = query.Get(key)
+		}
+	}
+	return params
+}
+
+func TestAliyunRecordParams(t *testing.T) {
+	priority := 10
+	weight := 5
+	flags := 0
+	tag := "issue"
+
+	tests := []struct {
+		name   string
+		record Record
+		want   []map[string]string
+	}{
+		{
+			name:   "a record on a line",
+			record: Record{Type: "A", Name: "www.example.com", Zone: "example.com", Content: "192.0.2.1", TTL: 600, View: ViewTelecom},
+			want: []map[string]string{
+				{"Action": "AddDomainRecord", "DomainName": "example.com", "RR": "www", "Type": "A", "Value": "192.0.2.1", "TTL": "600", "Line": "telecom"},
+			},
+		},
+		{
+			name:   "mx at the apex",
+			record: Record{Type: "MX", Name: "example.com", Zone: "example.com", Content: "mail.example.com", TTL: 600, Priority: &priority},
+			want: []map[string]string{
+				{"Action": "AddDomainRecord", "DomainName": "example.com", "RR": "@", "Type": "MX", "Value": "mail.example.com", "TTL": "600", "Line": "default", "Priority": "10"},
+			},
+		},
+		{
+			name:   "caa",
+			record: Record{Type: "CAA", Name: "example.com", Zone: "example.com", Content: "letsencrypt.org", TTL: 600, CAAFlags: &flags, CAATag: &tag},
+			want: []map[string]string{
+				{"Action": "AddDomainRecord", "DomainName": "example.com", "RR": "@", "Type": "CAA", "Value": `0 issue "letsencrypt.org"`, "TTL": "600", "Line": "default"},
+			},
+		},
+		{
+			name:   "weighted",
+			record: Record{Type: "A", Name: "lb.example.com", Zone: "example.com", Content: "192.0.2.2", TTL: 600, Weight: &weight},
+			want: []map[string]string{
+				{"Action": "AddDomainRecord", "DomainName": "example.com", "RR": "lb", "Type": "A", "Value": "192.0.2.2", "TTL": "600", "Line": "default"},
+				{"Action": "SetDNSSLBStatus", "DomainName": "example.com", "SubDomain": "lb.example.com", "Type": "A", "Open": "true"},
+				{"Action": "UpdateDNSSLBWeight", "RecordId": "9001", "Weight": "5"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, queries := newAliyunServer(t, `{"RecordId":"9001","RequestId":"req-1"}`)
+
+			id, err := client.CreateRecord("example.com", tt.record)
+			if err != nil {
+				t.Fatalf("CreateRecord: %v", err)
+			}
+			if id != "9001" {
+				t.Errorf("record ID %q, want 9001", id)
+			}
+
+			var got []map[string]string
+			for _, query := range queries() {
+				got = append(got, actionParams(query))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calls\n got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAliyunDeleteMissingRecord(t *testing.T) {
+	client, queries := newAliyunServer(t, `{"Code":"DomainRecordNotBelongToUser","Message":"The record does not exist."}`)
+
+	if err := client.DeleteRecord("example.com", "9001", Record{}); err != nil {
+		t.Errorf("DeleteRecord of a missing record: %v", err)
+	}
+	if got := queries(); len(got) != 1 || got[0].Get("Action") != "DeleteDomainRecord" || got[0].Get("RecordId") != "9001" {
+		t.Errorf("calls %v", got)
+	}
+
+	client, _ = newAliyunServer(t, `{"Code":"Forbidden.RAM","Message":"denied"}`)
+	if err := client.DeleteRecord("example.com", "9001", Record{}); err == nil {
+		t.Error("DeleteRecord ignored an API error")
+	}
+}
@@ -0,0 +1,112 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cdn-control-panel/backend/pkg/cloudflare"
+)
+
+// cloudflareProvider adapts the Cloudflare client. Rate limit errors are
+// returned as *cloudflare.RateLimitError so callers can defer the record.
+type cloudflareProvider struct {
+	client *cloudflare.Client
+}
+
+// NewCloudflare wraps a Cloudflare client that already carries its API token
+func NewCloudflare(client *cloudflare.Client) Provider {
+	return &cloudflareProvider{client: client}
+}
+
+func (p *cloudflareProvider) CreateRecord(zoneID string, record Record) (string, error) {
+	if err := checkNoView(Cloudflare, record); err != nil {
+		return "", err
+	}
+	return p.client.CreateDNSRecord(zoneID, buildCloudflareRecord(record))
+}
+
+func (p *cloudflareProvider) UpdateRecord(zoneID, recordID string, record Record) (string, error) {
+	if err := checkNoView(Cloudflare, record); err != nil {
+		return "", err
+	}
+	return p.client.UpdateDNSRecord(zoneID, recordID, buildCloudflareRecord(record))
+}
+
+func (p *cloudflareProvider) DeleteRecord(zoneID, recordID string, record Record) error {
+	if err := p.client.DeleteDNSRecord(zoneID, recordID); err != nil {
+		return fmt.Errorf("failed to delete from Cloudflare: %w", err)
+	}
+	return nil
+}
+
+// FindRecord looks the record up among the zone's records of its name and
+// type by value (the target of SRV and the value of CAA records)
+func (p *cloudflareProvider) FindRecord(zoneID string, record Record) (string, error) {
+	records, err := p.client.FindDNSRecords(zoneID, record.Type, record.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to list Cloudflare records: %w", err)
+	}
+
+	for _, candidate := range records {
+		if candidate.Type != record.Type || !strings.EqualFold(candidate.Name, record.Name) {
+			continue
+		}
+		content := candidate.Content
+		switch record.Type {
+		case "SRV":
+			content, _ = candidate.Data["target"].(string)
+		case "CAA":
+			content, _ = candidate.Data["value"].(string)
+		}
+		if strings.EqualFold(strings.TrimSuffix(content, "."), strings.TrimSuffix(record.Content, ".")) {
+			return candidate.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// checkNoView rejects view-specific records on providers without views
+func checkNoView(provider string, record Record) error {
+	if record.View != "" && record.View != ViewDefault {
+		return fmt.Errorf("%w: %s on %s", ErrViewNotSupported, record.View, provider)
+	}
+	return nil
+}
+
+// buildCloudflareRecord maps a record to the Cloudflare API payload, filling
+// the type-specific fields for MX, SRV and CAA records
+func buildCloudflareRecord(record Record) cloudflare.DNSRecord {
+	cfRecord := cloudflare.DNSRecord{
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Content,
+		TTL:     record.TTL,
+		Proxied: record.Proxied,
+	}
+
+	switch record.Type {
+	case "MX":
+		cfRecord.Priority = record.Priority
+	case "SRV":
+		cfRecord.Content = ""
+		cfRecord.Data = map[string]interface{}{
+			"priority": intValue(record.Priority),
+			"weight":   intValue(record.Weight),
+			"port":     intValue(record.Port),
+			"target":   record.Content,
+		}
+	case "CAA":
+		tag := ""
+		if record.CAATag != nil {
+			tag = *record.CAATag
+		}
+		cfRecord.Content = ""
+		cfRecord.Data = map[string]interface{}{
+			"flags": intValue(record.CAAFlags),
+			"tag":   tag,
+			"value": record.Content,
+		}
+	}
+
+	return cfRecord
+}
@@ -0,0 +1,217 @@
+package dnsprovider
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dnspodHost    = "dnspod.tencentcloudapi.com"
+	dnspodService = "dnspod"
+	dnspodVersion = "2021-03-23"
+)
+
+// DNSPodClient talks to the DNSPod API of Tencent Cloud (API 3.0, signed
+// with TC3-HMAC-SHA256). The zone ID is the domain name.
+type DNSPodClient struct {
+	endpoint string
+	creds    Credentials
+}
+
+// NewDNSPod creates a DNSPod client
+func NewDNSPod(creds Credentials) *DNSPodClient {
+	return &DNSPodClient{endpoint: "https://" + dnspodHost, creds: creds}
+}
+
+type dnspodResponse struct {
+	Response struct {
+		RecordId  uint64 `json:"RecordId"`
+		RequestId string `json:"RequestId"`
+		Error     *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	} `json:"Response"`
+}
+
+func (c *DNSPodClient) CreateRecord(zoneID string, record Record) (string, error) {
+	params, err := c.recordParams(zoneID, record)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.call("CreateRecord", params)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(resp.Response.RecordId, 10), nil
+}
+
+func (c *DNSPodClient) UpdateRecord(zoneID, recordID string, record Record) (string, error) {
+	params, err := c.recordParams(zoneID, record)
+	if err != nil {
+		return "", err
+	}
+	id, err := strconv.ParseUint(recordID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNSPod record ID %q", recordID)
+	}
+	params["RecordId"] = id
+
+	if _, err := c.call("ModifyRecord", params); err != nil {
+		return "", err
+	}
+	return recordID, nil
+}
+
+func (c *DNSPodClient) DeleteRecord(zoneID, recordID string, record Record) error {
+	id, err := strconv.ParseUint(recordID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid DNSPod record ID %q", recordID)
+	}
+
+	_, err = c.call("DeleteRecord", map[string]interface{}{
+		"Domain":   zoneID,
+		"RecordId": id,
+	})
+	// Record already gone at DNSPod: treat as deleted
+	if err != nil && strings.Contains(err.Error(), "ResourceNotFound") {
+		return nil
+	}
+	return err
+}
+
+// recordParams builds the parameters shared by CreateRecord and ModifyRecord
+func (c *DNSPodClient) recordParams(zoneID string, record Record) (map[string]interface{}, error) {
+	if record.Proxied {
+		return nil, ErrProxyNotSupported
+	}
+	line, err := providerLine(dnspodLines, Tencent, record.View)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{
+		"Domain":     zoneID,
+		"SubDomain":  relativeName(record),
+		"RecordType": record.Type,
+		"RecordLine": line,
+		"Value":      rdata(record),
+		"TTL":        record.TTL,
+	}
+	if record.Type == "MX" {
+		params["MX"] = intValue(record.Priority)
+	}
+	if record.Weighted() {
+		params["Weight"] = *record.Weight
+	}
+	return params, nil
+}
+
+// call performs a signed API request
+func (c *DNSPodClient) call(action string, params map[string]interface{}) (*dnspodResponse, error) {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Host", dnspodHost)
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-TC-Version", dnspodVersion)
+	req.Header.Set("Authorization", tc3Authorization(c.creds, dnspodService, map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         dnspodHost,
+		"x-tc-action":  strings.ToLower(action),
+	}, payload, now))
+
+	httpResp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp dnspodResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("DNSPod API: invalid response (HTTP %d)", httpResp.StatusCode)
+	}
+	if resp.Response.Error != nil {
+		return nil, fmt.Errorf("DNSPod API error: %s: %s", resp.Response.Error.Code, resp.Response.Error.Message)
+	}
+	return &resp, nil
+}
+
+// tc3Authorization computes the TC3-HMAC-SHA256 Authorization header of a
+// POST to / signing headers, whose names must be lowercase
+func tc3Authorization(creds Credentials, service string, headers map[string]string, payload []byte, now time.Time) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	date := now.Format("2006-01-02")
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+
+	scope := date + "/" + service + "/tc3_request"
+	stringToSign := strings.Join([]string{
+		"TC3-HMAC-SHA256",
+		strconv.FormatInt(now.Unix(), 10),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("TC3"+creds.Secret), date)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.Account, scope, signedHeaders, signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
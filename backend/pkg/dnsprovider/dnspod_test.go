@@ -0,0 +1,176 @@
+package dnsprovider
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTC3Authorization checks the signer against the example of the Tencent
+// Cloud API 3.0 signature documentation (CVM DescribeInstances)
+func TestTC3Authorization(t *testing.T) {
+	creds := Credentials{Account: "AKIDz8krbsJ5yKBZQpn74WFkmLPx3*******", Secret: "Gu5t9xGARNpq86cd98joQYCN3*******"}
+	payload := []byte(`{"Limit": 1, "Filters": [{"Values": ["\u672a\u547d\u540d"], "Name": "instance-name"}]}`)
+	headers := map[string]string{
+		"content-type": "application/json; charset=utf-8",
+		"host":         "cvm.tencentcloudapi.com",
+	}
+
+	got := tc3Authorization(creds, "cvm", headers, payload, time.Unix(1551113065, 0).UTC())
+	want := "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3*******/2019-02-25/cvm/tc3_request, " +
+		"SignedHeaders=content-type;host, Signature=2230eefd229f582d8b1b891af7107b91597240707d778ab3738f756258d7652c"
+	if got != want {
+		t.Errorf("\n got %s\nwant %s", got, want)
+	}
+}
+
+// dnspodCall is a call received by the test server
+type dnspodCall struct {
+	action string
+	params map[string]interface{}
+}
+
+// newDNSPodServer returns a client of a server answering every call with
+// body, and the calls it received with valid signatures
+func newDNSPodServer(t *testing.T, body string) (*DNSPodClient, func() []dnspodCall) {
+	t.Helper()
+
+	creds := Credentials{Account: "AKIDEXAMPLE", Secret: "secret"}
+	var mu sync.Mutex
+	var calls []dnspodCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		action := r.Header.Get("X-TC-Action")
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-TC-Timestamp"), 10, 64)
+		if err != nil || r.Method != http.MethodPost || r.Header.Get("X-TC-Version") != dnspodVersion {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		want := tc3Authorization(creds, dnspodService, map[string]string{
+			"content-type": r.Header.Get("Content-Type"),
+			"host":         dnspodHost,
+			"x-tc-action":  strings.ToLower(action),
+		}, payload, time.Unix(timestamp, 0).UTC())
+		if r.Header.Get("Authorization") != want {
+			t.Errorf("%s: Authorization %q, want %q", action, r.Header.Get("Authorization"), want)
+		}
+
+		var params map[string]interface{}
+		if err := json.Unmarshal(payload, &params); err != nil {
+			t.Errorf("%s: invalid payload %s", action, payload)
+		}
+		mu.Lock()
+		calls = append(calls, dnspodCall{action, params})
+		mu.Unlock()
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewDNSPod(creds)
+	client.endpoint = server.URL
+	return client, func() []dnspodCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func TestDNSPodRecordParams(t *testing.T) {
+	priority := 10
+	weight := 5
+	port := 5060
+	srvWeight := 1
+
+	tests := []struct {
+		name   string
+		record Record
+		want   map[string]interface{}
+	}{
+		{
+			name:   "a record on a line",
+			record: Record{Type: "A", Name: "www.example.com", Zone: "example.com", Content: "192.0.2.1", TTL: 600, View: ViewUnicom},
+			want: map[string]interface{}{
+				"Domain": "example.com", "SubDomain": "www", "RecordType": "A", "RecordLine": "联通", "Value": "192.0.2.1", "TTL": 600.0,
+			},
+		},
+		{
+			name:   "mx at the apex",
+			record: Record{Type: "MX", Name: "example.com", Zone: "example.com", Content: "mail.example.com", TTL: 600, Priority: &priority},
+			want: map[string]interface{}{
+				"Domain": "example.com", "SubDomain": "@", "RecordType": "MX", "RecordLine": "默认", "Value": "mail.example.com", "TTL": 600.0, "MX": 10.0,
+			},
+		},
+		{
+			name:   "srv",
+			record: Record{Type: "SRV", Name: "_sip._tcp.example.com", Zone: "example.com", Content: "sip.example.com", TTL: 600, Priority: &priority, Weight: &srvWeight, Port: &port},
+			want: map[string]interface{}{
+				"Domain": "example.com", "SubDomain": "_sip._tcp", "RecordType": "SRV", "RecordLine": "默认", "Value": "10 1 5060 sip.example.com", "TTL": 600.0,
+			},
+		},
+		{
+			name:   "weighted",
+			record: Record{Type: "A", Name: "lb.example.com", Zone: "example.com", Content: "192.0.2.2", TTL: 600, Weight: &weight},
+			want: map[string]interface{}{
+				"Domain": "example.com", "SubDomain": "lb", "RecordType": "A", "RecordLine": "默认", "Value": "192.0.2.2", "TTL": 600.0, "Weight": 5.0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, calls := newDNSPodServer(t, `{"Response":{"RecordId":9001,"RequestId":"req-1"}}`)
+
+			id, err := client.CreateRecord("example.com", tt.record)
+			if err != nil {
+				t.Fatalf("CreateRecord: %v", err)
+			}
+			if id != "9001" {
+				t.Errorf("record ID %q, want 9001", id)
+			}
+
+			got := calls()
+			if len(got) != 1 || got[0].action != "CreateRecord" {
+				t.Fatalf("calls %+v, want one CreateRecord", got)
+			}
+			if !reflect.DeepEqual(got[0].params, tt.want) {
+				t.Errorf("params\n got %v\nwant %v", got[0].params, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSPodModifyAndDelete(t *testing.T) {
+	client, calls := newDNSPodServer(t, `{"Response":{"RequestId":"req-1"}}`)
+	record := Record{Type: "A", Name: "www.example.com", Zone: "example.com", Content: "192.0.2.1", TTL: 600}
+
+	if _, err := client.UpdateRecord("example.com", "9001", record); err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+	if err := client.DeleteRecord("example.com", "9001", record); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	if _, err := client.UpdateRecord("example.com", "not-a-number", record); err == nil {
+		t.Error("UpdateRecord accepted a non-numeric record ID")
+	}
+
+	got := calls()
+	if len(got) != 2 || got[0].action != "ModifyRecord" || got[1].action != "DeleteRecord" {
+		t.Fatalf("calls %+v", got)
+	}
+	// Record IDs are sent as numbers
+	if got[0].params["RecordId"] != 9001.0 || got[1].params["RecordId"] != 9001.0 || got[1].params["Domain"] != "example.com" {
+		t.Errorf("params %v, %v", got[0].params, got[1].params)
+	}
+
+	client, _ = newDNSPodServer(t, `{"Response":{"Error":{"Code":"ResourceNotFound.NoDataOfRecord","Message":"no record"},"RequestId":"req-2"}}`)
+	if err := client.DeleteRecord("example.com", "9001", record); err != nil {
+		t.Errorf("DeleteRecord of a missing record: %v", err)
+	}
+}
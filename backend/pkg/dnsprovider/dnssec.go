@@ -0,0 +1,68 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cdn-control-panel/backend/pkg/cloudflare"
+)
+
+// DNSSEC states as stored in domain_dnssec.status
+const (
+	DNSSECDisabled  = "disabled"
+	DNSSECPending   = "pending" // Signing is being set up, or waits for the DS at the registrar
+	DNSSECActive    = "active"
+	DNSSECDisabling = "disabling"
+	DNSSECError     = "error"
+)
+
+// DNSSECStatus is the DNSSEC state of a zone at its provider
+type DNSSECStatus struct {
+	Status string
+	DS     []string // DS records in presentation format
+}
+
+// DNSSECProvider is implemented by providers that sign zones themselves.
+// Providers without it do not support DNSSEC management.
+type DNSSECProvider interface {
+	EnableDNSSEC(zoneID string) (*DNSSECStatus, error)
+	DisableDNSSEC(zoneID string) (*DNSSECStatus, error)
+	GetDNSSEC(zoneID string) (*DNSSECStatus, error)
+}
+
+func (p *cloudflareProvider) EnableDNSSEC(zoneID string) (*DNSSECStatus, error) {
+	return cloudflareDNSSEC(p.client.UpdateDNSSEC(zoneID, "active"))
+}
+
+func (p *cloudflareProvider) DisableDNSSEC(zoneID string) (*DNSSECStatus, error) {
+	return cloudflareDNSSEC(p.client.UpdateDNSSEC(zoneID, "disabled"))
+}
+
+func (p *cloudflareProvider) GetDNSSEC(zoneID string) (*DNSSECStatus, error) {
+	return cloudflareDNSSEC(p.client.GetDNSSEC(zoneID))
+}
+
+// cloudflareDNSSEC maps Cloudflare's DNSSEC settings
+func cloudflareDNSSEC(settings *cloudflare.DNSSEC, err error) (*DNSSECStatus, error) {
+	if err != nil {
+		return nil, fmt.Errorf("Cloudflare DNSSEC: %w", err)
+	}
+
+	status := &DNSSECStatus{}
+	switch settings.Status {
+	case "active":
+		status.Status = DNSSECActive
+	case "pending":
+		status.Status = DNSSECPending
+	case "pending-disabled":
+		status.Status = DNSSECDisabling
+	case "error":
+		status.Status = DNSSECError
+	default:
+		status.Status = DNSSECDisabled
+	}
+	if ds := strings.TrimSpace(settings.DS); ds != "" && status.Status != DNSSECDisabled {
+		status.DS = []string{ds}
+	}
+	return status, nil
+}
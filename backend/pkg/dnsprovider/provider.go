@@ -0,0 +1,140 @@
+// Package dnsprovider pushes desired-state DNS records to the supported DNS
+// provider APIs behind one interface
+package dnsprovider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider names as stored in domain_dns_providers.provider
+const (
+	Cloudflare = "cloudflare"
+	Aliyun     = "aliyun"
+	Tencent    = "tencent" // DNSPod
+	Route53    = "route53"
+)
+
+var (
+	ErrUnsupportedProvider = errors.New("unsupported DNS provider")
+	ErrViewNotSupported    = errors.New("resolver view not supported by DNS provider")
+	ErrProxyNotSupported   = errors.New("proxied records are only supported by Cloudflare")
+)
+
+// Record is a single desired record as pushed to a provider
+type Record struct {
+	Type     string
+	Name     string // FQDN without trailing dot
+	Zone     string // Zone apex, for providers addressing records by subdomain
+	Content  string
+	TTL      int
+	Proxied  bool
+	Priority *int // MX, SRV
+	Weight   *int // SRV; on other types a weighted record (see Weighted)
+	Port     *int // SRV
+	CAAFlags *int
+	CAATag   *string
+	View     string // Resolver view (see views.go), "" = not view-specific
+
+	// Set holds all records sharing name, type and view that should exist
+	// after the call, this one included (or excluded on delete). Only
+	// providers managing whole record sets (UsesRecordSets) need it.
+	Set []Record
+}
+
+// Provider creates, updates and deletes single records. Record IDs are
+// whatever the provider returns and are stored as provider_record_id.
+type Provider interface {
+	CreateRecord(zoneID string, record Record) (string, error)
+	UpdateRecord(zoneID, recordID string, record Record) (string, error)
+	DeleteRecord(zoneID, recordID string, record Record) error
+}
+
+// RecordFinder is implemented by providers that can look a record up by
+// name, type and value, for records whose provider ID was never stored
+// (e.g. a create that timed out but reached the provider)
+type RecordFinder interface {
+	// FindRecord returns the provider ID of the record, "" if it does not exist
+	FindRecord(zoneID string, record Record) (string, error)
+}
+
+// Credentials of a provider account. Account holds the access key ID
+// (SecretId on Tencent Cloud) and Secret the matching secret key; Cloudflare
+// only uses Secret as API token.
+type Credentials struct {
+	Account string
+	Secret  string
+}
+
+// httpClient is shared by the provider clients in this package
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// New returns the client of a non-Cloudflare provider. Cloudflare clients
+// are built with NewCloudflare so they share one rate limiter.
+func New(provider string, creds Credentials) (Provider, error) {
+	switch provider {
+	case Tencent:
+		return NewDNSPod(creds), nil
+	case Aliyun:
+		return NewAliyun(creds), nil
+	case Route53:
+		return NewRoute53(creds), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, provider)
+}
+
+// UsesRecordSets reports whether the provider needs Record.Set filled
+func UsesRecordSets(provider string) bool {
+	return provider == Route53
+}
+
+// SupportsWeight reports whether the provider serves weighted records, i.e.
+// several values of a name answered in proportion to their weights
+func SupportsWeight(provider string) bool {
+	switch provider {
+	case Tencent, Aliyun, Route53:
+		return true
+	}
+	return false
+}
+
+// Weighted reports whether a record is one of several weighted values
+func (r Record) Weighted() bool {
+	return r.Type != "SRV" && r.Weight != nil
+}
+
+// relativeName returns the record name relative to its zone ("@" for the apex)
+func relativeName(record Record) string {
+	name := strings.TrimSuffix(strings.ToLower(record.Name), ".")
+	zone := strings.TrimSuffix(strings.ToLower(record.Zone), ".")
+	if name == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
+
+// rdata returns the record value in the presentation format used by
+// providers taking a single value string (SRV and CAA fields are joined)
+func rdata(record Record) string {
+	switch record.Type {
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", intValue(record.Priority), intValue(record.Weight), intValue(record.Port), record.Content)
+	case "CAA":
+		tag := ""
+		if record.CAATag != nil {
+			tag = *record.CAATag
+		}
+		return fmt.Sprintf("%d %s %q", intValue(record.CAAFlags), tag, record.Content)
+	}
+	return record.Content
+}
+
+func intValue(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,317 @@
+package dnsprovider
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	route53Host    = "route53.amazonaws.com"
+	route53Region  = "us-east-1"
+	route53Service = "route53"
+	route53Version = "2013-04-01"
+	route53Xmlns   = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+	// route53SimpleID is the provider record ID of records outside any view
+	route53SimpleID = "simple"
+)
+
+// route53Locks serializes changes to the same record set, since every
+// record of a set is pushed as an UPSERT of the whole set
+var route53Locks sync.Map
+
+// Route53Client talks to Amazon Route 53 (REST/XML, Signature Version 4).
+// Route 53 manages all values of a name/type as one record set, so records
+// are pushed as the complete Record.Set. The zone ID is the hosted zone ID.
+// View-specific records become geolocation record sets with the view as
+// set identifier; the default view is the "*" location. Weighted records
+// are record sets of their own, identified by a hash of the value.
+type Route53Client struct {
+	endpoint string
+	creds    Credentials
+}
+
+// NewRoute53 creates a Route 53 client
+func NewRoute53(creds Credentials) *Route53Client {
+	return &Route53Client{endpoint: "https://" + route53Host, creds: creds}
+}
+
+type r53GeoLocation struct {
+	ContinentCode string `xml:"ContinentCode,omitempty"`
+	CountryCode   string `xml:"CountryCode,omitempty"`
+}
+
+// r53RecordSet follows the element order of the Route 53 schema
+type r53RecordSet struct {
+	Name          string          `xml:"Name"`
+	Type          string          `xml:"Type"`
+	SetIdentifier string          `xml:"SetIdentifier,omitempty"`
+	Weight        *int            `xml:"Weight,omitempty"`
+	GeoLocation   *r53GeoLocation `xml:"GeoLocation,omitempty"`
+	TTL           int             `xml:"TTL,omitempty"`
+	Values        []string        `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+type r53Change struct {
+	Action    string       `xml:"Action"`
+	RecordSet r53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type r53ChangeRequest struct {
+	XMLName xml.Name    `xml:"ChangeResourceRecordSetsRequest"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Changes []r53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type r53ListResponse struct {
+	RecordSets []r53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+}
+
+type r53ErrorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+func (c *Route53Client) CreateRecord(zoneID string, record Record) (string, error) {
+	return c.pushSet(zoneID, record, false)
+}
+
+// UpdateRecord pushes the set; a weighted record whose value changed moves
+// to a new set identifier, so the set under the old one is removed
+func (c *Route53Client) UpdateRecord(zoneID, recordID string, record Record) (string, error) {
+	newID, err := c.pushSet(zoneID, record, false)
+	if err != nil || !record.Weighted() || recordID == newID || recordID == route53SimpleID {
+		return newID, err
+	}
+
+	old, err := route53RecordSet(record, true)
+	if err != nil {
+		return "", err
+	}
+	old.SetIdentifier = recordID
+	current, err := c.findSet(strings.TrimPrefix(zoneID, "/hostedzone/"), old)
+	if err != nil || current == nil {
+		return newID, err
+	}
+	return newID, c.change(strings.TrimPrefix(zoneID, "/hostedzone/"), r53Change{Action: "DELETE", RecordSet: *current})
+}
+
+// DeleteRecord pushes the remaining set, or deletes the set once empty
+func (c *Route53Client) DeleteRecord(zoneID, recordID string, record Record) error {
+	_, err := c.pushSet(zoneID, record, true)
+	return err
+}
+
+// pushSet makes the record set of record match record.Set (weighted
+// records: the record itself, or nothing when deleting)
+func (c *Route53Client) pushSet(zoneID string, record Record, deleting bool) (string, error) {
+	if record.Proxied {
+		return "", ErrProxyNotSupported
+	}
+
+	desired, err := route53RecordSet(record, deleting)
+	if err != nil {
+		return "", err
+	}
+
+	zoneID = strings.TrimPrefix(zoneID, "/hostedzone/")
+	lockKey := zoneID + "|" + desired.Name + "|" + desired.Type + "|" + desired.SetIdentifier
+	lock, _ := route53Locks.LoadOrStore(lockKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	recordID := route53SimpleID
+	if desired.SetIdentifier != "" {
+		recordID = desired.SetIdentifier
+	}
+
+	if len(desired.Values) > 0 {
+		return recordID, c.change(zoneID, r53Change{Action: "UPSERT", RecordSet: desired})
+	}
+
+	// DELETE must match the current set exactly
+	current, err := c.findSet(zoneID, desired)
+	if err != nil {
+		return "", err
+	}
+	if current == nil {
+		return recordID, nil
+	}
+	return recordID, c.change(zoneID, r53Change{Action: "DELETE", RecordSet: *current})
+}
+
+// route53RecordSet builds the desired record set from record.Set
+func route53RecordSet(record Record, deleting bool) (r53RecordSet, error) {
+	set := r53RecordSet{
+		Name: strings.TrimSuffix(strings.ToLower(record.Name), ".") + ".",
+		Type: record.Type,
+		TTL:  record.TTL,
+	}
+
+	if record.Weighted() {
+		set.SetIdentifier = "w-" + sha256Hex([]byte(strings.ToLower(record.Content)))[:16]
+		set.Weight = record.Weight
+		if !deleting {
+			set.Values = []string{rdata(record)}
+		}
+		return set, nil
+	}
+
+	if record.View != "" {
+		geo, err := route53GeoLocation(record.View)
+		if err != nil {
+			return set, err
+		}
+		set.SetIdentifier = record.View
+		set.GeoLocation = geo
+	}
+
+	var txt []string
+	for _, r := range record.Set {
+		switch r.Type {
+		case "TXT":
+			txt = append(txt, route53TXT(r.Content))
+		case "MX":
+			set.Values = append(set.Values, fmt.Sprintf("%d %s", intValue(r.Priority), r.Content))
+		default:
+			set.Values = append(set.Values, rdata(r))
+		}
+	}
+	set.Values = append(set.Values, txt...)
+
+	return set, nil
+}
+
+// route53TXT quotes a TXT value, splitting it into 255-byte strings
+func route53TXT(value string) string {
+	var parts []string
+	for len(value) > 255 {
+		parts = append(parts, fmt.Sprintf("%q", value[:255]))
+		value = value[255:]
+	}
+	parts = append(parts, fmt.Sprintf("%q", value))
+	return strings.Join(parts, " ")
+}
+
+// findSet looks up the current record set matching name, type and set identifier
+func (c *Route53Client) findSet(zoneID string, want r53RecordSet) (*r53RecordSet, error) {
+	query := url.Values{}
+	query.Set("name", want.Name)
+	query.Set("type", want.Type)
+	if want.SetIdentifier != "" {
+		query.Set("identifier", want.SetIdentifier)
+	}
+	query.Set("maxitems", "10")
+
+	body, err := c.do(http.MethodGet, "/"+route53Version+"/hostedzone/"+zoneID+"/rrset", query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list r53ListResponse
+	if err := xml.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("Route 53 API: invalid response: %w", err)
+	}
+	for _, set := range list.RecordSets {
+		name := strings.ReplaceAll(strings.ToLower(set.Name), `\052`, "*")
+		if name == want.Name && set.Type == want.Type && set.SetIdentifier == want.SetIdentifier {
+			return &set, nil
+		}
+	}
+	return nil, nil
+}
+
+// change submits a change batch with one change
+func (c *Route53Client) change(zoneID string, change r53Change) error {
+	payload, err := xml.Marshal(r53ChangeRequest{Xmlns: route53Xmlns, Changes: []r53Change{change}})
+	if err != nil {
+		return err
+	}
+	payload = append([]byte(xml.Header), payload...)
+
+	_, err = c.do(http.MethodPost, "/"+route53Version+"/hostedzone/"+zoneID+"/rrset/", nil, payload)
+	return err
+}
+
+// do performs a signed request and returns the response body
+func (c *Route53Client) do(method, path string, query url.Values, payload []byte) ([]byte, error) {
+	reqURL := c.endpoint + path
+	canonicalQuery := ""
+	if len(query) > 0 {
+		// url.Values.Encode sorts by key; spaces must be %20 for SigV4
+		canonicalQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+		reqURL += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if payload != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	req.Header.Set("Authorization", sigV4(c.creds, route53Region, route53Service, method, route53Host, path, canonicalQuery, payload, now))
+
+	httpResp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpResp.StatusCode >= 300 {
+		var apiErr r53ErrorResponse
+		if xml.Unmarshal(body, &apiErr) == nil && apiErr.Code != "" {
+			return nil, fmt.Errorf("Route 53 API error: %s: %s", apiErr.Code, apiErr.Message)
+		}
+		return nil, fmt.Errorf("Route 53 API error: HTTP %d", httpResp.StatusCode)
+	}
+	return body, nil
+}
+
+// sigV4 computes the AWS Signature Version 4 Authorization header of a
+// request signing the host and x-amz-date headers
+func sigV4(creds Credentials, region, service, method, host, path, canonicalQuery string, payload []byte, now time.Time) string {
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	signedHeaders := "host;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery,
+		"host:" + host + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.Secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		creds.Account, scope, signedHeaders, hmacSHA256(key, stringToSign))
+}
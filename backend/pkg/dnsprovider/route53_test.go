@@ -0,0 +1,208 @@
+package dnsprovider
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSigV4 checks the signer against the AWS Signature Version 4 test
+// suite (get-vanilla, get-vanilla-query-order-key-case, post-vanilla)
+func TestSigV4(t *testing.T) {
+	creds := Credentials{Account: "AKIDEXAMPLE", Secret: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		method    string
+		query     url.Values
+		signature string
+	}{
+		{"get-vanilla", http.MethodGet, nil, "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", http.MethodGet, url.Values{"Param2": {"value2"}, "Param1": {"value1"}}, "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-vanilla", http.MethodPost, nil, "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+	}
+	for _, tt := range tests {
+		got := sigV4(creds, "us-east-1", "service", tt.method, "example.amazonaws.com", "/", tt.query.Encode(), nil, now)
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + tt.signature
+		if got != want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, want)
+		}
+	}
+}
+
+// route53Request is a request received by the test server
+type route53Request struct {
+	method, path, query string
+	body                []byte
+}
+
+// newRoute53Server returns a client of a server answering record set lists
+// with listBody, and the requests it received with valid signatures
+func newRoute53Server(t *testing.T, listBody string) (*Route53Client, func() []route53Request) {
+	t.Helper()
+
+	creds := Credentials{Account: "AKIDEXAMPLE", Secret: "secret"}
+	var mu sync.Mutex
+	var requests []route53Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		now, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			http.Error(w, "missing X-Amz-Date", http.StatusBadRequest)
+			return
+		}
+		if want := sigV4(creds, route53Region, route53Service, r.Method, route53Host, r.URL.Path, r.URL.RawQuery, body, now); r.Header.Get("Authorization") != want {
+			t.Errorf("%s %s: Authorization %q, want %q", r.Method, r.URL, r.Header.Get("Authorization"), want)
+		}
+
+		mu.Lock()
+		requests = append(requests, route53Request{r.Method, r.URL.Path, r.URL.RawQuery, body})
+		mu.Unlock()
+
+		if r.Method == http.MethodGet {
+			io.WriteString(w, listBody)
+			return
+		}
+		io.WriteString(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewRoute53(creds)
+	client.endpoint = server.URL
+	return client, func() []route53Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+// decodeChange parses a change batch with a single change
+func decodeChange(t *testing.T, body []byte) r53Change {
+	t.Helper()
+
+	if !strings.HasPrefix(string(body), xml.Header) {
+		t.Errorf("change batch without XML declaration: %s", body)
+	}
+	var batch r53ChangeRequest
+	if err := xml.Unmarshal(body, &batch); err != nil {
+		t.Fatalf("invalid change batch: %v", err)
+	}
+	if batch.Xmlns != route53Xmlns || len(batch.Changes) != 1 {
+		t.Fatalf("change batch %s", body)
+	}
+	return batch.Changes[0]
+}
+
+func TestRoute53ChangeBatch(t *testing.T) {
+	weight := 20
+	priority := 10
+	longTXT := strings.Repeat("a", 300)
+
+	tests := []struct {
+		name   string
+		record Record
+		wantID string
+		want   r53RecordSet
+	}{
+		{
+			name: "record set",
+			record: Record{Type: "A", Name: "www.example.com", Zone: "example.com", TTL: 300, Set: []Record{
+				{Type: "A", Content: "192.0.2.1"},
+				{Type: "A", Content: "192.0.2.2"},
+			}},
+			wantID: route53SimpleID,
+			want:   r53RecordSet{Name: "www.example.com.", Type: "A", TTL: 300, Values: []string{"192.0.2.1", "192.0.2.2"}},
+		},
+		{
+			name: "mx",
+			record: Record{Type: "MX", Name: "Example.com", Zone: "example.com", TTL: 600, Set: []Record{
+				{Type: "MX", Content: "mail.example.com", Priority: &priority},
+			}},
+			wantID: route53SimpleID,
+			want:   r53RecordSet{Name: "example.com.", Type: "MX", TTL: 600, Values: []string{"10 mail.example.com"}},
+		},
+		{
+			name: "split txt",
+			record: Record{Type: "TXT", Name: "txt.example.com", Zone: "example.com", TTL: 60, Set: []Record{
+				{Type: "TXT", Content: longTXT},
+			}},
+			wantID: route53SimpleID,
+			want:   r53RecordSet{Name: "txt.example.com.", Type: "TXT", TTL: 60, Values: []string{`"` + longTXT[:255] + `" "` + longTXT[255:] + `"`}},
+		},
+		{
+			name: "geolocation view",
+			record: Record{Type: "A", Name: "geo.example.com", Zone: "example.com", TTL: 300, View: "continent:EU", Set: []Record{
+				{Type: "A", Content: "192.0.2.3"},
+			}},
+			wantID: "continent:EU",
+			want: r53RecordSet{Name: "geo.example.com.", Type: "A", SetIdentifier: "continent:EU", TTL: 300,
+				GeoLocation: &r53GeoLocation{ContinentCode: "EU"}, Values: []string{"192.0.2.3"}},
+		},
+		{
+			name:   "weighted",
+			record: Record{Type: "A", Name: "lb.example.com", Zone: "example.com", TTL: 300, Content: "192.0.2.4", Weight: &weight},
+			wantID: "w-" + sha256Hex([]byte("192.0.2.4"))[:16],
+			want: r53RecordSet{Name: "lb.example.com.", Type: "A", SetIdentifier: "w-" + sha256Hex([]byte("192.0.2.4"))[:16],
+				Weight: &weight, TTL: 300, Values: []string{"192.0.2.4"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, requests := newRoute53Server(t, "")
+
+			id, err := client.CreateRecord("/hostedzone/Z1EXAMPLE", tt.record)
+			if err != nil {
+				t.Fatalf("CreateRecord: %v", err)
+			}
+			if id != tt.wantID {
+				t.Errorf("record ID %q, want %q", id, tt.wantID)
+			}
+
+			got := requests()
+			if len(got) != 1 || got[0].method != http.MethodPost || got[0].path != "/2013-04-01/hostedzone/Z1EXAMPLE/rrset/" {
+				t.Fatalf("requests %+v, want one POST of the change batch", got)
+			}
+			change := decodeChange(t, got[0].body)
+			if change.Action != "UPSERT" || !reflect.DeepEqual(change.RecordSet, tt.want) {
+				t.Errorf("change %s %+v, want UPSERT %+v", change.Action, change.RecordSet, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoute53DeleteLastRecord(t *testing.T) {
+	current := `<ListResourceRecordSetsResponse><ResourceRecordSets>
+<ResourceRecordSet><Name>www.example.com.</Name><Type>A</Type><TTL>120</TTL>
+<ResourceRecords><ResourceRecord><Value>192.0.2.1</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+</ResourceRecordSets></ListResourceRecordSetsResponse>`
+	client, requests := newRoute53Server(t, current)
+
+	// The last record of the set leaves Set empty
+	record := Record{Type: "A", Name: "www.example.com", Zone: "example.com", TTL: 300, Content: "192.0.2.1"}
+	if err := client.DeleteRecord("Z1EXAMPLE", route53SimpleID, record); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+
+	got := requests()
+	if len(got) != 2 || got[0].method != http.MethodGet || got[1].method != http.MethodPost {
+		t.Fatalf("requests %+v, want the set looked up, then deleted", got)
+	}
+	if got[0].path != "/2013-04-01/hostedzone/Z1EXAMPLE/rrset" || got[0].query != "maxitems=10&name=www.example.com.&type=A" {
+		t.Errorf("lookup %s?%s", got[0].path, got[0].query)
+	}
+	// DELETE must repeat the current set, TTL included
+	change := decodeChange(t, got[1].body)
+	want := r53RecordSet{Name: "www.example.com.", Type: "A", TTL: 120, Values: []string{"192.0.2.1"}}
+	if change.Action != "DELETE" || !reflect.DeepEqual(change.RecordSet, want) {
+		t.Errorf("change %s %+v, want DELETE %+v", change.Action, change.RecordSet, want)
+	}
+}
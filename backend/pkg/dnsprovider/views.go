@@ -0,0 +1,125 @@
+package dnsprovider
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resolver views a line group can route. ISP views select resolvers of a
+// Chinese carrier; region views are "continent:<code>" (AF, AN, AS, EU, NA,
+// OC, SA) or "country:<ISO 3166-1 alpha-2>".
+const (
+	ViewDefault  = "default"
+	ViewTelecom  = "telecom"
+	ViewUnicom   = "unicom"
+	ViewMobile   = "mobile"
+	ViewEdu      = "edu"
+	ViewOverseas = "overseas"
+
+	continentPrefix = "continent:"
+	countryPrefix   = "country:"
+)
+
+var continents = map[string]bool{
+	"AF": true, "AN": true, "AS": true, "EU": true, "NA": true, "OC": true, "SA": true,
+}
+
+// dnspodLines maps views to DNSPod record lines
+var dnspodLines = map[string]string{
+	ViewDefault:  "默认",
+	ViewTelecom:  "电信",
+	ViewUnicom:   "联通",
+	ViewMobile:   "移动",
+	ViewEdu:      "教育网",
+	ViewOverseas: "境外",
+}
+
+// aliyunLines maps views to Aliyun DNS resolution lines
+var aliyunLines = map[string]string{
+	ViewDefault:            "default",
+	ViewTelecom:            "telecom",
+	ViewUnicom:             "unicom",
+	ViewMobile:             "mobile",
+	ViewEdu:                "edu",
+	ViewOverseas:           "oversea",
+	continentPrefix + "AS": "os_asia",
+	continentPrefix + "EU": "os_euro",
+	continentPrefix + "NA": "os_namerica",
+	continentPrefix + "SA": "os_samerica",
+	continentPrefix + "AF": "os_africa",
+	continentPrefix + "OC": "os_oceanica",
+}
+
+// NormalizeView lowercases a view and uppercases region codes
+func NormalizeView(view string) string {
+	view = strings.TrimSpace(view)
+	lower := strings.ToLower(view)
+	for _, prefix := range []string{continentPrefix, countryPrefix} {
+		if strings.HasPrefix(lower, prefix) {
+			return prefix + strings.ToUpper(lower[len(prefix):])
+		}
+	}
+	return lower
+}
+
+// ValidView reports whether a (normalized) view is known
+func ValidView(view string) bool {
+	switch view {
+	case ViewDefault, ViewTelecom, ViewUnicom, ViewMobile, ViewEdu, ViewOverseas:
+		return true
+	}
+	if code, ok := strings.CutPrefix(view, continentPrefix); ok {
+		return continents[code]
+	}
+	if code, ok := strings.CutPrefix(view, countryPrefix); ok {
+		return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+	}
+	return false
+}
+
+// SupportsView reports whether a provider can serve records for a view.
+// Providers without views (Cloudflare, builtin) only serve the default.
+func SupportsView(provider, view string) bool {
+	if view == "" || view == ViewDefault {
+		return true
+	}
+	switch provider {
+	case Tencent:
+		_, ok := dnspodLines[view]
+		return ok
+	case Aliyun:
+		_, ok := aliyunLines[view]
+		return ok
+	case Route53:
+		_, err := route53GeoLocation(view)
+		return err == nil
+	}
+	return false
+}
+
+// providerLine returns the provider line name of a view
+func providerLine(lines map[string]string, provider, view string) (string, error) {
+	if view == "" {
+		view = ViewDefault
+	}
+	line, ok := lines[view]
+	if !ok {
+		return "", fmt.Errorf("%w: %s on %s", ErrViewNotSupported, view, provider)
+	}
+	return line, nil
+}
+
+// route53GeoLocation maps a view to a Route 53 geolocation; the default view
+// is the "*" country that catches all other locations
+func route53GeoLocation(view string) (*r53GeoLocation, error) {
+	if view == ViewDefault {
+		return &r53GeoLocation{CountryCode: "*"}, nil
+	}
+	if code, ok := strings.CutPrefix(view, continentPrefix); ok && continents[code] {
+		return &r53GeoLocation{ContinentCode: code}, nil
+	}
+	if code, ok := strings.CutPrefix(view, countryPrefix); ok && ValidView(view) {
+		return &r53GeoLocation{CountryCode: code}, nil
+	}
+	return nil, fmt.Errorf("%w: %s on %s", ErrViewNotSupported, view, Route53)
+}
@@ -0,0 +1,208 @@
+package dnsverify
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultTimeout is the per-query timeout against a single nameserver
+	DefaultTimeout = 5 * time.Second
+
+	// nameserverCacheTTL is how long discovered nameservers of a zone are reused
+	nameserverCacheTTL = 10 * time.Minute
+)
+
+// Verifier checks that a record is served by every authoritative nameserver
+// of its zone. Queries are sent directly to the nameservers with recursion
+// disabled, so caches of public resolvers do not affect the result.
+type Verifier struct {
+	// Nameservers, if set, replaces nameserver discovery with a fixed list of
+	// host:port addresses, e.g. an in-process DNS server standing in for the
+	// provider in tests
+	Nameservers []string
+	Timeout     time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedNameservers
+}
+
+type cachedNameservers struct {
+	addrs     []string
+	expiresAt time.Time
+}
+
+// NameserverResult is the outcome of the query against one nameserver
+type NameserverResult struct {
+	Server  string        `json:"server"`
+	Matched bool          `json:"matched"`
+	Answers []string      `json:"answers"`
+	RTT     time.Duration `json:"rtt"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Result is the outcome of a verification
+type Result struct {
+	Verified    bool               `json:"verified"`
+	Nameservers []NameserverResult `json:"nameservers"`
+	Duration    time.Duration      `json:"duration"`
+}
+
+// Mismatches summarises the nameservers that did not serve the expected record
+func (r *Result) Mismatches() string {
+	var parts []string
+	for _, ns := range r.Nameservers {
+		if ns.Matched {
+			continue
+		}
+		if ns.Error != "" {
+			parts = append(parts, fmt.Sprintf("%s: %s", ns.Server, ns.Error))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s: got [%s]", ns.Server, strings.Join(ns.Answers, ", ")))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// NewVerifier creates a verifier that discovers nameservers through the
+// system resolver
+func NewVerifier() *Verifier {
+	return &Verifier{
+		Timeout: DefaultTimeout,
+		cache:   make(map[string]cachedNameservers),
+	}
+}
+
+// Verify queries all authoritative nameservers of zone for the owner name and
+// type of expected. The record is verified only when every nameserver answers
+// with matching RDATA (TTL is ignored). With anyValue set, any answer of the
+// expected type counts as a match, which is what proxied records need since
+// the provider answers with its own edge addresses.
+func (v *Verifier) Verify(zone string, expected dns.RR, anyValue bool) (*Result, error) {
+	start := time.Now()
+
+	servers, err := v.AuthoritativeServers(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Verified: true}
+	for _, server := range servers {
+		ns := v.query(server, expected, anyValue)
+		if !ns.Matched {
+			result.Verified = false
+		}
+		result.Nameservers = append(result.Nameservers, ns)
+	}
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
+
+// AuthoritativeServers returns host:port addresses of all nameservers of a zone
+func (v *Verifier) AuthoritativeServers(zone string) ([]string, error) {
+	if len(v.Nameservers) > 0 {
+		return v.Nameservers, nil
+	}
+
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+
+	v.mu.Lock()
+	cached, ok := v.cache[zone]
+	v.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.addrs, nil
+	}
+
+	nsRecords, err := net.LookupNS(zone)
+	if err != nil {
+		return nil, fmt.Errorf("lookup NS for %s: %w", zone, err)
+	}
+
+	var addrs []string
+	for _, ns := range nsRecords {
+		ips, err := net.LookupHost(strings.TrimSuffix(ns.Host, "."))
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, "53"))
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no reachable nameservers found for %s", zone)
+	}
+
+	v.mu.Lock()
+	if v.cache == nil {
+		v.cache = make(map[string]cachedNameservers)
+	}
+	v.cache[zone] = cachedNameservers{addrs: addrs, expiresAt: time.Now().Add(nameserverCacheTTL)}
+	v.mu.Unlock()
+
+	return addrs, nil
+}
+
+// query asks a single nameserver, retrying over TCP if the answer was truncated
+func (v *Verifier) query(server string, expected dns.RR, anyValue bool) NameserverResult {
+	hdr := expected.Header()
+	result := NameserverResult{Server: server, Answers: []string{}}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(hdr.Name), hdr.Rrtype)
+	msg.RecursionDesired = false
+
+	timeout := v.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+	resp, rtt, err := client.Exchange(msg, server)
+	if err == nil && resp.Truncated {
+		client.Net = "tcp"
+		resp, rtt, err = client.Exchange(msg, server)
+	}
+	result.RTT = rtt
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		result.Error = dns.RcodeToString[resp.Rcode]
+		return result
+	}
+
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype != hdr.Rrtype || !strings.EqualFold(rr.Header().Name, dns.Fqdn(hdr.Name)) {
+			continue
+		}
+		result.Answers = append(result.Answers, rdata(rr))
+		if anyValue || matches(rr, expected) {
+			result.Matched = true
+		}
+	}
+
+	return result
+}
+
+// matches compares RDATA ignoring TTL. TXT values are compared after joining
+// their character-strings, since providers may split long values differently.
+func matches(rr, expected dns.RR) bool {
+	if txt, ok := rr.(*dns.TXT); ok {
+		if want, ok := expected.(*dns.TXT); ok {
+			return strings.Join(txt.Txt, "") == strings.Join(want.Txt, "")
+		}
+	}
+	return dns.IsDuplicate(rr, expected)
+}
+
+// rdata returns the presentation form of a record without its header
+func rdata(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
@@ -0,0 +1,219 @@
+package dnsverify
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startServer runs an in-process authoritative server on 127.0.0.1 answering
+// every query with records (those matching the question), after delay
+func startServer(t *testing.T, delay time.Duration, records ...string) string {
+	t.Helper()
+
+	var answers []dns.RR
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatalf("invalid test record %q: %v", record, err)
+		}
+		answers = append(answers, rr)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		time.Sleep(delay)
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Authoritative = true
+		q := req.Question[0]
+		for _, rr := range answers {
+			if rr.Header().Rrtype == q.Qtype && strings.EqualFold(rr.Header().Name, q.Name) {
+				resp.Answer = append(resp.Answer, rr)
+			}
+		}
+		w.WriteMsg(resp)
+	})
+
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+// startSilentServer returns an address that accepts queries but never answers
+func startSilentServer(t *testing.T) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	return pc.LocalAddr().String()
+}
+
+func mustRR(t *testing.T, record string) dns.RR {
+	t.Helper()
+
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		t.Fatalf("invalid test record %q: %v", record, err)
+	}
+	return rr
+}
+
+func TestVerifyAllNameserversMatch(t *testing.T) {
+	delay := 20 * time.Millisecond
+	v := NewVerifier()
+	v.Nameservers = []string{
+		startServer(t, delay, "www.example.com. 300 IN A 192.0.2.1", "www.example.com. 300 IN A 192.0.2.2"),
+		startServer(t, delay, "www.example.com. 60 IN A 192.0.2.1"),
+	}
+
+	start := time.Now()
+	result, err := v.Verify("example.com", mustRR(t, "www.example.com. 600 IN A 192.0.2.1"), false)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if !result.Verified {
+		t.Fatalf("expected verified, got mismatches %q", result.Mismatches())
+	}
+	if len(result.Nameservers) != 2 {
+		t.Fatalf("expected 2 nameserver results, got %d", len(result.Nameservers))
+	}
+	for _, ns := range result.Nameservers {
+		if !ns.Matched || ns.Error != "" {
+			t.Errorf("%s: matched=%v error=%q", ns.Server, ns.Matched, ns.Error)
+		}
+		if ns.RTT < delay {
+			t.Errorf("%s: RTT %s shorter than the server delay %s", ns.Server, ns.RTT, delay)
+		}
+	}
+	if result.Duration < 2*delay || result.Duration > elapsed {
+		t.Errorf("duration %s not between the summed delays %s and the elapsed time %s", result.Duration, 2*delay, elapsed)
+	}
+}
+
+func TestVerifyMismatchOnOneNameserver(t *testing.T) {
+	v := NewVerifier()
+	good := startServer(t, 0, "_acme-challenge.example.com. 60 IN TXT \"token-value\"")
+	stale := startServer(t, 0, "_acme-challenge.example.com. 60 IN TXT \"old-value\"")
+	v.Nameservers = []string{good, stale}
+
+	result, err := v.Verify("example.com", mustRR(t, "_acme-challenge.example.com. 60 IN TXT \"token-value\""), false)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if result.Verified {
+		t.Fatal("expected unverified while one nameserver serves a stale value")
+	}
+	if !result.Nameservers[0].Matched {
+		t.Errorf("%s: expected match", good)
+	}
+	if result.Nameservers[1].Matched {
+		t.Errorf("%s: expected mismatch", stale)
+	}
+	if got := result.Mismatches(); !strings.Contains(got, stale) || !strings.Contains(got, "old-value") || strings.Contains(got, good) {
+		t.Errorf("unexpected mismatch summary %q", got)
+	}
+}
+
+func TestVerifySplitTXT(t *testing.T) {
+	v := NewVerifier()
+	v.Nameservers = []string{startServer(t, 0, "txt.example.com. 60 IN TXT \"abc\" \"def\"")}
+
+	result, err := v.Verify("example.com", mustRR(t, "txt.example.com. 60 IN TXT \"abcdef\""), false)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !result.Verified {
+		t.Fatalf("expected TXT split into character-strings to match, got %q", result.Mismatches())
+	}
+}
+
+func TestVerifyProxied(t *testing.T) {
+	v := NewVerifier()
+	v.Nameservers = []string{startServer(t, 0, "cdn.example.com. 300 IN A 104.16.0.1")}
+	expected := mustRR(t, "cdn.example.com. 300 IN A 192.0.2.10")
+
+	result, err := v.Verify("example.com", expected, false)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if result.Verified {
+		t.Fatal("expected the provider's edge address not to match the origin")
+	}
+
+	result, err = v.Verify("example.com", expected, true)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !result.Verified {
+		t.Fatalf("expected any A answer to verify a proxied record, got %q", result.Mismatches())
+	}
+	if got := result.Nameservers[0].Answers; len(got) != 1 || strings.TrimSpace(got[0]) != "104.16.0.1" {
+		t.Errorf("unexpected answers %q", got)
+	}
+}
+
+func TestVerifyMissingRecord(t *testing.T) {
+	v := NewVerifier()
+	v.Nameservers = []string{startServer(t, 0)}
+
+	result, err := v.Verify("example.com", mustRR(t, "new.example.com. 300 IN CNAME ng-1.cdn.example.net."), false)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if result.Verified || result.Nameservers[0].Matched {
+		t.Fatal("expected a nameserver without the record not to match")
+	}
+	if len(result.Nameservers[0].Answers) != 0 {
+		t.Errorf("expected no answers, got %q", result.Nameservers[0].Answers)
+	}
+}
+
+func TestVerifyTimeout(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	v := NewVerifier()
+	v.Timeout = timeout
+	good := startServer(t, 0, "www.example.com. 300 IN A 192.0.2.1")
+	silent := startSilentServer(t)
+	v.Nameservers = []string{good, silent}
+
+	result, err := v.Verify("example.com", mustRR(t, "www.example.com. 300 IN A 192.0.2.1"), false)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if result.Verified {
+		t.Fatal("expected unverified when a nameserver does not answer")
+	}
+	ns := result.Nameservers[1]
+	if ns.Matched || ns.Error == "" {
+		t.Fatalf("%s: expected a timeout error, got matched=%v error=%q", silent, ns.Matched, ns.Error)
+	}
+	if !strings.Contains(result.Mismatches(), silent) {
+		t.Errorf("mismatch summary %q does not name %s", result.Mismatches(), silent)
+	}
+	if result.Duration < timeout {
+		t.Errorf("duration %s shorter than the query timeout %s", result.Duration, timeout)
+	}
+	if result.Duration > 5*timeout {
+		t.Errorf("duration %s: the timeout %s was not applied", result.Duration, timeout)
+	}
+}
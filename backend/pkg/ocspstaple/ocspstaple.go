@@ -0,0 +1,153 @@
+// Package ocspstaple fetches OCSP responses for certificates so they can be
+// stapled by the edges, and decides when a cached response must be refreshed
+package ocspstaple
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	ErrNoResponder   = errors.New("certificate has no OCSP responder")
+	ErrNoIssuer      = errors.New("issuer certificate is missing from the chain")
+	ErrStaleResponse = errors.New("OCSP response is not current")
+)
+
+// maxResponseSize bounds responder bodies, real responses are a few KB
+const maxResponseSize = 1 << 20
+
+// Response statuses
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+	StatusUnknown = "unknown"
+)
+
+// Response is a verified OCSP response for one certificate
+type Response struct {
+	// Raw is the DER response as sent by the responder, stapled as is
+	Raw          []byte
+	ResponderURL string
+	Status       string
+	ProducedAt   time.Time
+	ThisUpdate   time.Time
+	// NextUpdate is zero when the responder always has newer information
+	NextUpdate time.Time
+	RevokedAt  time.Time
+}
+
+// Fetch asks the first OCSP responder of leaf for its status, signed by
+// issuer or a responder delegated by it. A response that is not valid at now
+// is rejected so it is never stapled
+func Fetch(ctx context.Context, client *http.Client, leaf, issuer *x509.Certificate, now time.Time) (*Response, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return nil, ErrNoResponder
+	}
+	if issuer == nil {
+		return nil, ErrNoIssuer
+	}
+	url := leaf.OCSPServer[0]
+
+	// SHA-1 CertIDs are what every responder supports (RFC 5019)
+	request, err := ocsp.CreateRequest(leaf, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP responder %q: %w", url, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpReq.Header.Set("Accept", "application/ocsp-response")
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("OCSP responder %q: %w", url, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder %q returned HTTP %d", url, httpResp.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("OCSP responder %q: %w", url, err)
+	}
+	if len(raw) > maxResponseSize {
+		return nil, fmt.Errorf("OCSP responder %q returned more than %d bytes", url, maxResponseSize)
+	}
+
+	parsed, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP response from %q: %w", url, err)
+	}
+
+	resp := &Response{
+		Raw:          raw,
+		ResponderURL: url,
+		ProducedAt:   parsed.ProducedAt,
+		ThisUpdate:   parsed.ThisUpdate,
+		NextUpdate:   parsed.NextUpdate,
+	}
+	switch parsed.Status {
+	case ocsp.Good:
+		resp.Status = StatusGood
+	case ocsp.Revoked:
+		resp.Status = StatusRevoked
+		resp.RevokedAt = parsed.RevokedAt
+	default:
+		resp.Status = StatusUnknown
+	}
+
+	if !resp.ValidAt(now) {
+		return nil, fmt.Errorf("%w (this update %s, next update %s)", ErrStaleResponse,
+			resp.ThisUpdate.Format(time.RFC3339), resp.NextUpdate.Format(time.RFC3339))
+	}
+
+	return resp, nil
+}
+
+// ValidAt reports whether the response may be stapled at t
+func (r *Response) ValidAt(t time.Time) bool {
+	return ValidAt(r.ThisUpdate, r.NextUpdate, t)
+}
+
+// RefreshAt returns when the response should be replaced
+func (r *Response) RefreshAt(now time.Time) time.Time {
+	return RefreshAt(r.ThisUpdate, r.NextUpdate, now)
+}
+
+// ValidAt reports whether a response with the given validity interval may
+// be stapled at t; a few minutes of clock skew are tolerated on thisUpdate
+func ValidAt(thisUpdate, nextUpdate, t time.Time) bool {
+	if thisUpdate.After(t.Add(5 * time.Minute)) {
+		return false
+	}
+	return nextUpdate.IsZero() || t.Before(nextUpdate)
+}
+
+// RefreshAt returns when a response should be replaced: halfway through its
+// validity interval (responders publish new responses well before the old
+// ones expire), so several retries fit before nextUpdate. Responses without
+// nextUpdate are refreshed hourly
+func RefreshAt(thisUpdate, nextUpdate, now time.Time) time.Time {
+	if nextUpdate.IsZero() {
+		return now.Add(time.Hour)
+	}
+	refresh := thisUpdate.Add(nextUpdate.Sub(thisUpdate) / 2)
+	// Short-lived responses are still not fetched in a loop
+	if earliest := now.Add(5 * time.Minute); refresh.Before(earliest) {
+		refresh = earliest
+	}
+	return refresh
+}
@@ -0,0 +1,291 @@
+package ocspstaple
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testCA is an issuer with a leaf whose OCSP responder is an httptest
+// server answering with respond
+type testCA struct {
+	issuer    *x509.Certificate
+	issuerKey crypto.Signer
+	leaf      *x509.Certificate
+	server    *httptest.Server
+	respond   func(w http.ResponseWriter, req *ocsp.Request)
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	ca := &testCA{}
+	ca.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/ocsp-request" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ca.respond(w, req)
+	}))
+	t.Cleanup(ca.server.Close)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.issuerKey = key
+	ca.issuer = createCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OCSP Test CA"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, key)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.leaf = createCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		OCSPServer:   []string{ca.server.URL},
+	}, ca, leafKey)
+
+	return ca
+}
+
+// createCertificate signs template with the CA, or self-signs it when ca is nil
+func createCertificate(t *testing.T, template *x509.Certificate, ca *testCA, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.issuer, ca.issuerKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// answer makes the responder sign template for the requested serial with key
+func (ca *testCA) answer(t *testing.T, template ocsp.Response, key crypto.Signer) {
+	ca.respond = func(w http.ResponseWriter, req *ocsp.Request) {
+		template.SerialNumber = req.SerialNumber
+		raw, err := ocsp.CreateResponse(ca.issuer, ca.issuer, template, key)
+		if err != nil {
+			t.Errorf("CreateResponse: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(raw)
+	}
+}
+
+func (ca *testCA) fetch(now time.Time) (*Response, error) {
+	return Fetch(context.Background(), ca.server.Client(), ca.leaf, ca.issuer, now)
+}
+
+func TestFetchGood(t *testing.T) {
+	ca := newTestCA(t)
+	now := time.Now().Truncate(time.Second)
+	ca.answer(t, ocsp.Response{
+		Status:     ocsp.Good,
+		ThisUpdate: now.Add(-time.Hour),
+		NextUpdate: now.Add(3 * 24 * time.Hour),
+	}, ca.issuerKey)
+
+	resp, err := ca.fetch(now)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if resp.Status != StatusGood || resp.ResponderURL != ca.server.URL {
+		t.Errorf("status %q from %q", resp.Status, resp.ResponderURL)
+	}
+	if !resp.ThisUpdate.Equal(now.Add(-time.Hour)) || !resp.NextUpdate.Equal(now.Add(3*24*time.Hour)) {
+		t.Errorf("validity %s - %s", resp.ThisUpdate, resp.NextUpdate)
+	}
+	parsed, err := ocsp.ParseResponseForCert(resp.Raw, ca.leaf, ca.issuer)
+	if err != nil || parsed.SerialNumber.Cmp(ca.leaf.SerialNumber) != 0 {
+		t.Errorf("Raw is not the response for the leaf: %v", err)
+	}
+}
+
+func TestFetchRevoked(t *testing.T) {
+	ca := newTestCA(t)
+	now := time.Now().Truncate(time.Second)
+	revokedAt := now.Add(-2 * time.Hour)
+	ca.answer(t, ocsp.Response{
+		Status:           ocsp.Revoked,
+		RevokedAt:        revokedAt,
+		RevocationReason: ocsp.KeyCompromise,
+		ThisUpdate:       now.Add(-time.Hour),
+		NextUpdate:       now.Add(24 * time.Hour),
+	}, ca.issuerKey)
+
+	resp, err := ca.fetch(now)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if resp.Status != StatusRevoked || !resp.RevokedAt.Equal(revokedAt) {
+		t.Errorf("status %q revoked at %s, want revoked at %s", resp.Status, resp.RevokedAt, revokedAt)
+	}
+}
+
+func TestFetchStale(t *testing.T) {
+	ca := newTestCA(t)
+	now := time.Now().Truncate(time.Second)
+
+	ca.answer(t, ocsp.Response{
+		Status:     ocsp.Good,
+		ThisUpdate: now.Add(-48 * time.Hour),
+		NextUpdate: now.Add(-time.Minute),
+	}, ca.issuerKey)
+	if _, err := ca.fetch(now); !errors.Is(err, ErrStaleResponse) {
+		t.Errorf("nextUpdate in the past: got %v, want ErrStaleResponse", err)
+	}
+
+	ca.answer(t, ocsp.Response{
+		Status:     ocsp.Good,
+		ThisUpdate: now.Add(time.Hour),
+		NextUpdate: now.Add(48 * time.Hour),
+	}, ca.issuerKey)
+	if _, err := ca.fetch(now); !errors.Is(err, ErrStaleResponse) {
+		t.Errorf("thisUpdate in the future: got %v, want ErrStaleResponse", err)
+	}
+}
+
+func TestFetchWrongSigner(t *testing.T) {
+	ca := newTestCA(t)
+	now := time.Now()
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.answer(t, ocsp.Response{
+		Status:     ocsp.Good,
+		ThisUpdate: now.Add(-time.Hour),
+		NextUpdate: now.Add(24 * time.Hour),
+	}, other)
+
+	_, err = ca.fetch(now)
+	if err == nil || !strings.Contains(err.Error(), "invalid OCSP response") {
+		t.Errorf("got %v, want an invalid response error", err)
+	}
+}
+
+func TestFetchOversizedBody(t *testing.T) {
+	ca := newTestCA(t)
+	ca.respond = func(w http.ResponseWriter, req *ocsp.Request) {
+		w.Write(bytes.Repeat([]byte{0x30}, maxResponseSize+1))
+	}
+
+	_, err := ca.fetch(time.Now())
+	if err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Errorf("got %v, want a size limit error", err)
+	}
+}
+
+func TestFetchHTTPError(t *testing.T) {
+	ca := newTestCA(t)
+	ca.respond = func(w http.ResponseWriter, req *ocsp.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}
+
+	_, err := ca.fetch(time.Now())
+	if err == nil || !strings.Contains(err.Error(), "HTTP 503") {
+		t.Errorf("got %v, want an HTTP error", err)
+	}
+}
+
+func TestFetchPreconditions(t *testing.T) {
+	ca := newTestCA(t)
+
+	noResponder := *ca.leaf
+	noResponder.OCSPServer = nil
+	if _, err := Fetch(context.Background(), http.DefaultClient, &noResponder, ca.issuer, time.Now()); !errors.Is(err, ErrNoResponder) {
+		t.Errorf("got %v, want ErrNoResponder", err)
+	}
+	if _, err := Fetch(context.Background(), http.DefaultClient, ca.leaf, nil, time.Now()); !errors.Is(err, ErrNoIssuer) {
+		t.Errorf("got %v, want ErrNoIssuer", err)
+	}
+}
+
+func TestValidAt(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                   string
+		thisUpdate, nextUpdate time.Time
+		want                   bool
+	}{
+		{"current", now.Add(-time.Hour), now.Add(time.Hour), true},
+		{"expired", now.Add(-2 * time.Hour), now.Add(-time.Second), false},
+		{"next update now", now.Add(-time.Hour), now, false},
+		{"within clock skew", now.Add(4 * time.Minute), now.Add(time.Hour), true},
+		{"beyond clock skew", now.Add(6 * time.Minute), now.Add(time.Hour), false},
+		{"no next update", now.Add(-time.Hour), time.Time{}, true},
+	}
+	for _, tt := range tests {
+		if got := ValidAt(tt.thisUpdate, tt.nextUpdate, now); got != tt.want {
+			t.Errorf("%s: ValidAt() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshAt(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                   string
+		thisUpdate, nextUpdate time.Time
+		want                   time.Time
+	}{
+		{"halfway", now, now.Add(4 * 24 * time.Hour), now.Add(2 * 24 * time.Hour)},
+		{"halfway of an older response", now.Add(-24 * time.Hour), now.Add(3 * 24 * time.Hour), now.Add(24 * time.Hour)},
+		{"past halfway", now.Add(-3 * time.Hour), now.Add(time.Hour), now.Add(5 * time.Minute)},
+		{"short lived", now, now.Add(4 * time.Minute), now.Add(5 * time.Minute)},
+		{"no next update", now.Add(-time.Hour), time.Time{}, now.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		if got := RefreshAt(tt.thisUpdate, tt.nextUpdate, now); !got.Equal(tt.want) {
+			t.Errorf("%s: RefreshAt() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	resp := &Response{ThisUpdate: now, NextUpdate: now.Add(2 * time.Hour)}
+	if got := resp.RefreshAt(now); !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("Response.RefreshAt() = %s, want %s", got, now.Add(time.Hour))
+	}
+}
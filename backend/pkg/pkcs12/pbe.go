@@ -0,0 +1,231 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	oidPBES2                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidPBEWithSHAAnd3KeyTDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidHMACWithSHA1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256        = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384        = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512        = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC             = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC             = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC             = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC            = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	errUnsupportedEncryption = fmt.Errorf("%w: unsupported encryption algorithm", ErrInvalidData)
+	errUnsupportedDigest     = fmt.Errorf("%w: unsupported digest algorithm", ErrInvalidData)
+)
+
+// pbeParams are the parameters of the PKCS#12 password based encryption
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// pbes2Params are the parameters of PBES2 (RFC 8018)
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// prfByOID returns the hash of a PBKDF2 pseudorandom function
+func prfByOID(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case oid.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case oid.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	}
+	return nil, errUnsupportedDigest
+}
+
+// bmpPassword encodes a password as a NUL terminated BMPString, the form
+// used by the PKCS#12 key derivation
+func bmpPassword(password string) []byte {
+	units := utf16.Encode([]rune(password))
+	out := make([]byte, 0, 2*len(units)+2)
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return append(out, 0, 0)
+}
+
+// kdf is the PKCS#12 key derivation function (RFC 7292 appendix B.2), id is
+// 1 for keys, 2 for IVs and 3 for MAC keys
+func kdf(h func() hash.Hash, v int, salt, password []byte, iterations int, id byte, size int) []byte {
+	fill := func(in []byte) []byte {
+		if len(in) == 0 {
+			return nil
+		}
+		n := v * ((len(in) + v - 1) / v)
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = in[i%len(in)]
+		}
+		return out
+	}
+
+	d := bytes.Repeat([]byte{id}, v)
+	i := append(fill(salt), fill(password)...)
+
+	one := big.NewInt(1)
+	var out []byte
+	for len(out) < size {
+		digest := h()
+		digest.Write(d)
+		digest.Write(i)
+		a := digest.Sum(nil)
+		for r := 1; r < iterations; r++ {
+			digest = h()
+			digest.Write(a)
+			a = digest.Sum(nil)
+		}
+		out = append(out, a...)
+
+		// I_j = (I_j + B + 1) mod 2^(v*8) for every v byte block of I
+		b := new(big.Int).SetBytes(fill(a)[:v])
+		b.Add(b, one)
+		for j := 0; j < len(i); j += v {
+			ij := new(big.Int).SetBytes(i[j : j+v])
+			ij.Add(ij, b)
+			buf := ij.Bytes()
+			if len(buf) > v {
+				buf = buf[len(buf)-v:]
+			}
+			block := i[j : j+v]
+			for k := range block {
+				block[k] = 0
+			}
+			copy(block[v-len(buf):], buf)
+		}
+	}
+	return out[:size]
+}
+
+// decrypt decrypts data encrypted with one of the password based schemes
+// of PKCS#8
+func decrypt(alg pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+
+	switch {
+	case alg.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if err := unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+		}
+		var err error
+		if block, iv, err = pbes2Cipher(params, []byte(password)); err != nil {
+			return nil, err
+		}
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3KeyTDES):
+		var params pbeParams
+		if err := unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+		}
+		pw := bmpPassword(password)
+		key := kdf(sha1.New, 64, params.Salt, pw, params.Iterations, 1, 24)
+		iv = kdf(sha1.New, 64, params.Salt, pw, params.Iterations, 2, des.BlockSize)
+		var err error
+		if block, err = des.NewTripleDESCipher(key); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errUnsupportedEncryption
+	}
+
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, ErrIncorrectPassword
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// A wrong password almost always shows up as broken padding
+	n := int(out[len(out)-1])
+	if n == 0 || n > block.BlockSize() || n > len(out) {
+		return nil, ErrIncorrectPassword
+	}
+	for _, c := range out[len(out)-n:] {
+		if int(c) != n {
+			return nil, ErrIncorrectPassword
+		}
+	}
+	return out[:len(out)-n], nil
+}
+
+// pbes2Cipher derives the block cipher and IV of a PBES2 scheme
+func pbes2Cipher(params pbes2Params, password []byte) (cipher.Block, []byte, error) {
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, errUnsupportedEncryption
+	}
+	var kdfParams pbkdf2Params
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	prf := sha1.New
+	if len(kdfParams.PRF.Algorithm) > 0 {
+		var err error
+		if prf, err = prfByOID(kdfParams.PRF.Algorithm); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case params.EncryptionScheme.Algorithm.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, nil, errUnsupportedEncryption
+	}
+
+	key := pbkdf2.Key(password, kdfParams.Salt, kdfParams.Iterations, keyLen, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, nil, fmt.Errorf("%w: invalid IV length", ErrInvalidData)
+	}
+	return block, iv, nil
+}
@@ -0,0 +1,114 @@
+// Package pkcs12 reads and writes PKCS#12 (.pfx/.p12) bundles and reads
+// password protected PKCS#8 keys. Bundles are handled by go-pkcs12: decoding
+// accepts the modern PBES2/AES format as well as the legacy 3DES and RC2
+// ones, encoding writes PBES2 with AES-256 or, for old clients, 3DES
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	ErrIncorrectPassword = errors.New("pkcs12: decryption password incorrect")
+	ErrInvalidData       = errors.New("pkcs12: invalid PKCS#12 data")
+	ErrNoPrivateKey      = errors.New("pkcs12: no private key in the bundle")
+	ErrNoCertificate     = errors.New("pkcs12: no certificate in the bundle")
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// Decode returns the private key and the certificates of a PKCS#12 bundle,
+// certificates in the order they are stored
+func Decode(data []byte, password string) (crypto.Signer, []*x509.Certificate, error) {
+	privateKey, leaf, chain, err := gopkcs12.DecodeChain(data, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, gopkcs12.ErrIncorrectPassword), errors.Is(err, gopkcs12.ErrDecryption):
+			return nil, nil, ErrIncorrectPassword
+		// go-pkcs12 has no error values for incomplete bundles
+		case err.Error() == "pkcs12: private key missing":
+			return nil, nil, ErrNoPrivateKey
+		case err.Error() == "pkcs12: certificate missing":
+			return nil, nil, ErrNoCertificate
+		}
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+
+	key, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unsupported private key type", ErrInvalidData)
+	}
+	return key, append([]*x509.Certificate{leaf}, chain...), nil
+}
+
+// EncodeOptions controls Encode
+type EncodeOptions struct {
+	// Legacy writes 3DES and a SHA-1 MAC for clients that do not support
+	// PBES2 (Windows Server 2016 and older, Java before 8u301)
+	Legacy bool
+}
+
+// Encode writes key, the leaf certificate and its chain as a PKCS#12 bundle
+// protected by password
+func Encode(key crypto.Signer, leaf *x509.Certificate, chain []*x509.Certificate, password string, opts EncodeOptions) ([]byte, error) {
+	encoder := gopkcs12.Modern2023
+	if opts.Legacy {
+		encoder = gopkcs12.LegacyDES
+	}
+	return encoder.Encode(key, leaf, chain, password)
+}
+
+// DecryptPKCS8PEM decrypts an "ENCRYPTED PRIVATE KEY" PEM block
+func DecryptPKCS8PEM(data []byte, password string) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		return nil, fmt.Errorf("%w: not an encrypted PKCS#8 key", ErrInvalidData)
+	}
+	der, err := decryptPKCS8(block.Bytes, password)
+	if err != nil {
+		return nil, err
+	}
+	return parsePKCS8(der)
+}
+
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if err := unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	return decrypt(info.Algorithm, info.EncryptedData, password)
+}
+
+func parsePKCS8(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported private key type", ErrInvalidData)
+	}
+	return signer, nil
+}
+
+func unmarshal(in []byte, out interface{}) error {
+	rest, err := asn1.Unmarshal(in, out)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data")
+	}
+	return nil
+}
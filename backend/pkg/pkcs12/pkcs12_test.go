@@ -0,0 +1,284 @@
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// The fixtures in testdata were written by OpenSSL 3.0 with the password
+// below, for a leaf "<type>.example.com" issued by "PKCS12 Test CA":
+//
+//	openssl pkcs12 -export -inkey <type>.key -in <type>.pem -certfile ca.pem -out openssl3-<type>.p12
+//	openssl pkcs12 -export -legacy -inkey <type>.key -in <type>.pem -certfile ca.pem -out legacy-<type>.p12
+//	openssl pkcs8 -topk8 -in ec.key -out ec-pbes2.key
+//	openssl pkcs8 -topk8 -v1 PBE-SHA1-3DES -in rsa.key -out rsa-3des.key
+const fixturePassword = "test-password"
+
+type publicKeyer interface {
+	Equal(crypto.PublicKey) bool
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newChain creates a key of keyType and a leaf for it issued by a CA
+func newChain(t *testing.T, keyType string) (crypto.Signer, *x509.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key crypto.Signer
+	switch keyType {
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ec":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Round Trip CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: keyType + ".example.com"},
+		DNSNames:     []string{keyType + ".example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, leaf, ca
+}
+
+// checkDecoded checks that key belongs to the first certificate, named cn,
+// followed by the CA named caCN
+func checkDecoded(t *testing.T, key crypto.Signer, certs []*x509.Certificate, cn, caCN string) {
+	t.Helper()
+
+	if len(certs) != 2 {
+		t.Fatalf("decoded %d certificates, want 2", len(certs))
+	}
+	if certs[0].Subject.CommonName != cn || certs[1].Subject.CommonName != caCN {
+		t.Errorf("certificates %q, %q, want %q, %q", certs[0].Subject.CommonName, certs[1].Subject.CommonName, cn, caCN)
+	}
+	if !key.Public().(publicKeyer).Equal(certs[0].PublicKey) {
+		t.Error("private key does not match the leaf certificate")
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ec", "ed25519"} {
+		for _, legacy := range []bool{false, true} {
+			name := keyType
+			if legacy {
+				name += "/legacy"
+			}
+			t.Run(name, func(t *testing.T) {
+				key, leaf, ca := newChain(t, keyType)
+
+				data, err := Encode(key, leaf, []*x509.Certificate{ca}, "secret", EncodeOptions{Legacy: legacy})
+				if err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+
+				decodedKey, certs, err := Decode(data, "secret")
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				checkDecoded(t, decodedKey, certs, leaf.Subject.CommonName, ca.Subject.CommonName)
+				if !certs[0].Equal(leaf) || !certs[1].Equal(ca) {
+					t.Error("decoded certificates differ from the encoded ones")
+				}
+				if !decodedKey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key) {
+					t.Error("decoded private key differs from the encoded one")
+				}
+
+				if _, _, err := Decode(data, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+					t.Errorf("wrong password: got %v, want ErrIncorrectPassword", err)
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeEmptyPassword(t *testing.T) {
+	key, leaf, ca := newChain(t, "ec")
+
+	data, err := Encode(key, leaf, []*x509.Certificate{ca}, "", EncodeOptions{})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decodedKey, certs, err := Decode(data, "")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	checkDecoded(t, decodedKey, certs, leaf.Subject.CommonName, ca.Subject.CommonName)
+}
+
+func TestDecodeOpenSSLFixtures(t *testing.T) {
+	for _, format := range []string{"openssl3", "legacy"} {
+		for _, keyType := range []string{"rsa", "ec", "ed25519"} {
+			name := format + "-" + keyType + ".p12"
+			t.Run(name, func(t *testing.T) {
+				data := readFixture(t, name)
+
+				key, certs, err := Decode(data, fixturePassword)
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				checkDecoded(t, key, certs, keyType+".example.com", "PKCS12 Test CA")
+
+				if _, _, err := Decode(data, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+					t.Errorf("wrong password: got %v, want ErrIncorrectPassword", err)
+				}
+			})
+		}
+	}
+}
+
+// testPFX is the outer structure of a PKCS#12 bundle, enough to change its MAC
+type testPFX struct {
+	Version  int
+	AuthSafe asn1.RawValue
+	MacData  struct {
+		Mac struct {
+			Algorithm pkix.AlgorithmIdentifier
+			Digest    []byte
+		}
+		MacSalt    []byte
+		Iterations int `asn1:"optional,default:1"`
+	}
+}
+
+func TestDecodeTamperedMAC(t *testing.T) {
+	key, leaf, ca := newChain(t, "rsa")
+	encoded, err := Encode(key, leaf, []*x509.Certificate{ca}, "secret", EncodeOptions{})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	for _, name := range []string{"encoded", "openssl3-rsa.p12", "legacy-rsa.p12"} {
+		t.Run(name, func(t *testing.T) {
+			data, password := encoded, "secret"
+			if name != "encoded" {
+				data, password = readFixture(t, name), fixturePassword
+			}
+
+			var pfx testPFX
+			if _, err := asn1.Unmarshal(data, &pfx); err != nil {
+				t.Fatal(err)
+			}
+			pfx.MacData.Mac.Digest[0] ^= 0xff
+			tampered, err := asn1.Marshal(pfx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := Decode(tampered, password); !errors.Is(err, ErrIncorrectPassword) {
+				t.Errorf("tampered MAC: got %v, want ErrIncorrectPassword", err)
+			}
+
+			// A changed byte in the protected content fails the MAC as well
+			contentTampered := append([]byte(nil), data...)
+			contentTampered[len(contentTampered)/2] ^= 0xff
+			if _, _, err := Decode(contentTampered, password); err == nil {
+				t.Error("tampered content decoded without error")
+			}
+		})
+	}
+}
+
+func TestDecodeInvalidData(t *testing.T) {
+	if _, _, err := Decode([]byte("not a pfx"), "secret"); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("got %v, want ErrInvalidData", err)
+	}
+}
+
+func TestDecodeWithoutKey(t *testing.T) {
+	_, _, ca := newChain(t, "ec")
+	data, err := gopkcs12.Modern2023.EncodeTrustStore([]*x509.Certificate{ca}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Decode(data, "secret"); !errors.Is(err, ErrNoPrivateKey) {
+		t.Errorf("got %v, want ErrNoPrivateKey", err)
+	}
+}
+
+func TestEncryptedPKCS8(t *testing.T) {
+	fixtures := map[string]string{
+		"ec-pbes2.key": "openssl3-ec.p12",
+		"rsa-3des.key": "openssl3-rsa.p12",
+	}
+	for keyFile, p12File := range fixtures {
+		t.Run(keyFile, func(t *testing.T) {
+			_, certs, err := Decode(readFixture(t, p12File), fixturePassword)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			key, err := DecryptPKCS8PEM(readFixture(t, keyFile), fixturePassword)
+			if err != nil {
+				t.Fatalf("DecryptPKCS8PEM: %v", err)
+			}
+			if !key.Public().(publicKeyer).Equal(certs[0].PublicKey) {
+				t.Error("decrypted key does not match the certificate")
+			}
+
+			if _, err := DecryptPKCS8PEM(readFixture(t, keyFile), "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+				t.Errorf("wrong password: got %v, want ErrIncorrectPassword", err)
+			}
+		})
+	}
+}
@@ -29,6 +29,13 @@ const (
 	CodeValidationMissing    = 2002
 	CodeValidationInvalid    = 2003
 	CodeValidationFQDNNotInZone = 2004
+	CodeCertificateInvalidPEM  = 2005
+	CodePrivateKeyInvalid      = 2006
+	CodeCertificateKeyMismatch = 2007
+	CodeCertificateExpired     = 2008
+	CodeCertificateChainInvalid = 2009
+	CodePKCS12Invalid          = 2010
+	CodePasswordIncorrect      = 2011
 
 	// Business/Resource errors (3000-3999)
 	CodeResourceNotFound     = 3001
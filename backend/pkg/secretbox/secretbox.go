@@ -0,0 +1,229 @@
+// Package secretbox encrypts secrets stored in the database with envelope
+// encryption: every value is sealed (AES-256-GCM) under its own data key,
+// which is sealed under the master key. Rotating the master key only
+// re-seals the data keys.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of a master key in bytes
+const KeySize = 32
+
+// Sealed formats:
+//
+//	v1:<base64(nonce || ciphertext)>                    sealed directly under the master key
+//	v2:<key id>:<base64(wrapped data key)>:<base64(nonce || ciphertext)>
+//
+// where the wrapped data key is base64(nonce || ciphertext) of the data key
+// under the master key identified by key id
+const (
+	prefixV1 = "v1:"
+	prefixV2 = "v2:"
+)
+
+var (
+	ErrNoKey      = errors.New("no master key configured (MASTER_KEY or MASTER_KEY_FILE)")
+	ErrInvalidKey = errors.New("master key must be 32 bytes, base64 or hex encoded")
+	ErrDecrypt    = errors.New("failed to decrypt secret")
+)
+
+// Box seals secrets with its master key and opens secrets sealed with it or
+// with one of its previous keys
+type Box struct {
+	aead     cipher.AEAD
+	keyID    string
+	previous []*Box
+}
+
+// New creates a box from a raw 32-byte key
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &Box{aead: aead, keyID: hex.EncodeToString(sum[:4])}, nil
+}
+
+// KeyID identifies the master key (first 4 bytes of its SHA-256, hex)
+func (b *Box) KeyID() string {
+	return b.keyID
+}
+
+// WithPrevious returns a box that seals with b and also opens values sealed
+// with the previous boxes, for use while a rotation is rolled out
+func (b *Box) WithPrevious(previous ...*Box) *Box {
+	return &Box{aead: b.aead, keyID: b.keyID, previous: append(append([]*Box{}, b.previous...), previous...)}
+}
+
+// IsSealed reports whether value looks like a sealed secret
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefixV1) || strings.HasPrefix(value, prefixV2)
+}
+
+// NewFromString creates a box from a base64 or hex encoded key. An empty
+// key returns ErrNoKey.
+func NewFromString(encoded string) (*Box, error) {
+	key, err := ParseKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return New(key)
+}
+
+// ParseKey decodes a base64 or hex encoded 32-byte key
+func ParseKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, ErrNoKey
+	}
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// Seal encrypts plaintext under a new data key
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := New(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(b.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(data.aead, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return prefixV2 + b.keyID + ":" + wrapped + ":" + ciphertext, nil
+}
+
+// Open decrypts a value produced by Seal
+func (b *Box) Open(sealed string) ([]byte, error) {
+	if encoded, ok := strings.CutPrefix(sealed, prefixV1); ok {
+		// v1 values carry no key id, try every key
+		for _, box := range b.keys() {
+			if plaintext, err := open(box.aead, encoded); err == nil {
+				return plaintext, nil
+			}
+		}
+		return nil, ErrDecrypt
+	}
+
+	keyID, wrapped, ciphertext, err := parseV2(sealed)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := b.openDataKey(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	data, err := New(dataKey)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return open(data.aead, ciphertext)
+}
+
+// Rewrap re-seals a value under the current master key. For envelope values
+// only the data key is re-sealed, older formats are decrypted and sealed
+// again.
+func (b *Box) Rewrap(sealed string) (string, error) {
+	if strings.HasPrefix(sealed, prefixV1) {
+		plaintext, err := b.Open(sealed)
+		if err != nil {
+			return "", err
+		}
+		return b.Seal(plaintext)
+	}
+
+	keyID, wrapped, ciphertext, err := parseV2(sealed)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := b.openDataKey(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	rewrapped, err := seal(b.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return prefixV2 + b.keyID + ":" + rewrapped + ":" + ciphertext, nil
+}
+
+// keys returns the current key followed by the previous ones
+func (b *Box) keys() []*Box {
+	return append([]*Box{b}, b.previous...)
+}
+
+// openDataKey opens a data key wrapped under the master key keyID
+func (b *Box) openDataKey(keyID, wrapped string) ([]byte, error) {
+	for _, box := range b.keys() {
+		if box.keyID == keyID {
+			return open(box.aead, wrapped)
+		}
+	}
+	return nil, fmt.Errorf("%w: sealed with unknown master key %s", ErrDecrypt, keyID)
+}
+
+func parseV2(sealed string) (keyID, wrapped, ciphertext string, err error) {
+	encoded, ok := strings.CutPrefix(sealed, prefixV2)
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: unknown format", ErrDecrypt)
+	}
+	parts := strings.Split(encoded, ":")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("%w: malformed value", ErrDecrypt)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// seal encrypts plaintext as base64(nonce || ciphertext)
+func seal(aead cipher.AEAD, plaintext []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func open(aead cipher.AEAD, encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: malformed value", ErrDecrypt)
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,49 @@
+#!/bin/bash
+
+# 更新证书链补全使用的中间证书包 (pkg/certchain/intermediates.pem)
+# 数据来源: CCADB 公开的未吊销中间证书报告 (含 PEM)
+# 用法: ./update_intermediates.sh [report_url]
+
+set -e
+
+REPORT_URL="${1:-https://ccadb.my.salesforce-sites.com/mozilla/PublicAllIntermediateCertsWithPEMCSV}"
+
+cd "$(dirname "$0")/.." || exit 1
+OUTPUT="pkg/certchain/intermediates.pem"
+TMP="$(mktemp)"
+trap 'rm -f "$TMP" "$TMP.pem"' EXIT
+
+echo "Downloading intermediate report..."
+curl -fsSL "$REPORT_URL" -o "$TMP"
+
+{
+    echo "# Public intermediate certificates used to complete uploaded chains."
+    echo "# Generated by scripts/update_intermediates.sh on $(date -u +%Y-%m-%d), do not edit."
+    echo "# Source: $REPORT_URL"
+    echo
+    # PEM 列为带引号的多行字段，只保留 BEGIN/END 之间的内容
+    awk '
+        /-----BEGIN CERTIFICATE-----/ { sub(/^.*-----BEGIN/, "-----BEGIN"); inpem = 1 }
+        inpem {
+            line = $0
+            if (line ~ /-----END CERTIFICATE-----/) {
+                sub(/-----END CERTIFICATE-----.*$/, "-----END CERTIFICATE-----", line)
+                print line
+                inpem = 0
+                next
+            }
+            gsub(/[" \r]/, "", line)
+            if (line ~ /^-----BEGIN/) line = "-----BEGIN CERTIFICATE-----"
+            print line
+        }
+    ' "$TMP"
+} > "$TMP.pem"
+
+COUNT=$(grep -c "BEGIN CERTIFICATE" "$TMP.pem" || true)
+if [ "$COUNT" -eq 0 ]; then
+    rm -f "$TMP.pem"
+    echo "✗ No certificates found in the report, $OUTPUT left unchanged" >&2
+    exit 1
+fi
+mv "$TMP.pem" "$OUTPUT"
+echo "✓ $COUNT intermediate certificates written to $OUTPUT"